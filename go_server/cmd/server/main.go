@@ -0,0 +1,479 @@
+package main
+
+import (
+	_ "app-distribution-server-go/docs" // Import the generated docs
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/infrastructure"
+	"app-distribution-server-go/internal/interfaces"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	httpSwagger "github.com/swaggo/http-swagger"
+)
+
+// loggingMiddleware logs the incoming requests.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsMiddleware adds CORS headers to the response.
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("CORS middleware: Origin=%s", r.Header.Get("Origin"))
+		// Allow requests from any origin. For production, you might want to restrict this.
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Auth-Token, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
+		w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires")
+
+		// If it's a preflight request, respond with 200 OK. Other OPTIONS requests,
+		// such as tus discovery, are passed on to the handlers.
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			log.Printf("CORS preflight request: Method=%s, Headers=%s", r.Header.Get("Access-Control-Request-Method"), r.Header.Get("Access-Control-Request-Headers"))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// defaultMaxUploadSize is the maximum app file size when MAX_UPLOAD_SIZE is not set.
+const defaultMaxUploadSize = 2 << 30 // 2 GB
+
+// resumableUploadTTL is how long a resumable upload is kept without receiving data.
+const resumableUploadTTL = 24 * time.Hour
+
+// defaultDeleteGracePeriod is how long deleted builds can be restored when
+// BUILD_DELETE_GRACE_PERIOD is not set.
+const defaultDeleteGracePeriod = 7 * 24 * time.Hour
+
+// deleteGracePeriod returns how long deleted builds are kept before they are purged,
+// read from BUILD_DELETE_GRACE_PERIOD as a duration such as 72h.
+func deleteGracePeriod() time.Duration {
+	value := os.Getenv("BUILD_DELETE_GRACE_PERIOD")
+	if value == "" {
+		return defaultDeleteGracePeriod
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil || period < 0 {
+		log.Fatalf("Invalid BUILD_DELETE_GRACE_PERIOD %q: must be a duration such as 72h", value)
+	}
+	return period
+}
+
+// sessionTTL is how long users stay logged in.
+const sessionTTL = 24 * time.Hour
+
+// signedURLTTL is how long signed links to builds can be opened without logging in.
+const signedURLTTL = time.Hour
+
+// newAuthService returns the service that logs users in at the OpenID Connect provider
+// set by OIDC_ISSUER_URL, or nil if it isn't set and login is disabled.
+func newAuthService(repo application.UserRepository) *application.AuthService {
+	issuerURL := os.Getenv("OIDC_ISSUER_URL")
+	if issuerURL == "" {
+		return nil
+	}
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if clientID == "" {
+		log.Fatalf("OIDC_CLIENT_ID must be set along with OIDC_ISSUER_URL")
+	}
+	scopes := []string{"openid", "email", "profile"}
+	if value := os.Getenv("OIDC_SCOPES"); value != "" {
+		scopes = strings.Fields(value)
+	}
+
+	provider, err := infrastructure.NewOIDCProvider(context.Background(), issuerURL, clientID, os.Getenv("OIDC_CLIENT_SECRET"), scopes, assumeEmailVerified())
+	if err != nil {
+		log.Fatalf("Failed to initialize OpenID Connect: %v", err)
+	}
+	return application.NewAuthService(repo, provider, allowedDomains(), sessionTTL)
+}
+
+// assumeEmailVerified reports whether OIDC_ASSUME_EMAIL_VERIFIED is set, which lets users
+// log in with ID tokens that have no email_verified claim. Only set it for providers that
+// never issue unverified addresses.
+func assumeEmailVerified() bool {
+	value := os.Getenv("OIDC_ASSUME_EMAIL_VERIFIED")
+	if value == "" {
+		return false
+	}
+	assume, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid OIDC_ASSUME_EMAIL_VERIFIED %q: must be true or false", value)
+	}
+	if assume {
+		log.Println("ID tokens without an email_verified claim are treated as verified")
+	}
+	return assume
+}
+
+// allowedDomains returns the email domains that can log in, read from the comma
+// separated OIDC_ALLOWED_DOMAINS. It is empty if every domain can.
+func allowedDomains() []string {
+	var domains []string
+	for _, domain := range strings.Split(os.Getenv("OIDC_ALLOWED_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// urlSigningKey returns the key that signs links to builds, read from URL_SIGNING_KEY.
+// Without it a random key is used, so signed links stop working when the server restarts.
+func urlSigningKey() []byte {
+	if key := os.Getenv("URL_SIGNING_KEY"); key != "" {
+		return []byte(key)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("Failed to generate URL signing key: %v", err)
+	}
+	return key
+}
+
+// deviceCAs returns the Apple CAs that device attributes posted during enrollment must
+// chain to, read from the certificate file set by DEVICE_CA_FILE. It is nil if the
+// variable isn't set, which disables device enrollment.
+func deviceCAs() *x509.CertPool {
+	path := os.Getenv("DEVICE_CA_FILE")
+	if path == "" {
+		log.Println("DEVICE_CA_FILE is not set, so devices can't be enrolled")
+		return nil
+	}
+	pool, err := infrastructure.LoadCertPool(path)
+	if err != nil {
+		log.Fatalf("Failed to load DEVICE_CA_FILE: %v", err)
+	}
+	return pool
+}
+
+// maxUploadSize returns the maximum app file size in bytes, read from MAX_UPLOAD_SIZE.
+func maxUploadSize() int64 {
+	value := os.Getenv("MAX_UPLOAD_SIZE")
+	if value == "" {
+		return defaultMaxUploadSize
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		log.Fatalf("Invalid MAX_UPLOAD_SIZE %q: must be a positive number of bytes", value)
+	}
+	return size
+}
+
+// storageBackend returns the repository backend selected by STORAGE_BACKEND, either
+// "postgres", "sqlite" or "file". It defaults to sqlite for a sqlite:// DATABASE_URL,
+// to postgres for any other DATABASE_URL and to file otherwise.
+func storageBackend() string {
+	if backend := os.Getenv("STORAGE_BACKEND"); backend != "" {
+		return backend
+	}
+	databaseURL := os.Getenv("DATABASE_URL")
+	if infrastructure.IsSQLiteURL(databaseURL) {
+		return "sqlite"
+	}
+	if databaseURL != "" {
+		return "postgres"
+	}
+	return "file"
+}
+
+// @title App Distribution API
+// @version 1.0
+// @description This is a sample server for distributing mobile applications.
+// @termsOfService http://swagger.io/terms/
+
+// @contact.name API Support
+// @contact.url http://www.swagger.io/support
+// @contact.email support@swagger.io
+
+// @license.name Apache 2.0
+// @license.url http://www.apache.org/licenses/LICENSE-2.0.html
+
+// @host localhost:8080
+// @BasePath /api
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	backend := storageBackend()
+	storageDir := infrastructure.UploadsDir
+	if backend == "file" {
+		storageDir = infrastructure.StorageDir
+	}
+
+	blobs, err := infrastructure.NewBlobStore(storageDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize blob store: %v", err)
+	}
+
+	var repo application.AppRepository
+	var deviceRepo application.DeviceRepository
+	var tokenRepo application.TokenRepository
+	var userRepo application.UserRepository
+	var memberRepo application.MemberRepository
+	switch backend {
+	case "postgres":
+		db, err := infrastructure.NewDBConnection()
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer db.Close()
+
+		if err := infrastructure.MigrateDB(db); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+
+		if repo, err = infrastructure.NewPostgresAppRepository(db, blobs); err != nil {
+			log.Fatalf("Failed to initialize repository: %v", err)
+		}
+		if deviceRepo, err = infrastructure.NewPostgresDeviceRepository(db); err != nil {
+			log.Fatalf("Failed to initialize device repository: %v", err)
+		}
+		if tokenRepo, err = infrastructure.NewPostgresTokenRepository(db); err != nil {
+			log.Fatalf("Failed to initialize token repository: %v", err)
+		}
+		if userRepo, err = infrastructure.NewPostgresUserRepository(db); err != nil {
+			log.Fatalf("Failed to initialize user repository: %v", err)
+		}
+		if memberRepo, err = infrastructure.NewPostgresMemberRepository(db); err != nil {
+			log.Fatalf("Failed to initialize member repository: %v", err)
+		}
+	case "sqlite":
+		db, err := infrastructure.NewSQLiteConnection()
+		if err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		if err := infrastructure.MigrateSQLiteDB(db); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+
+		if repo, err = infrastructure.NewSQLiteAppRepository(db, blobs); err != nil {
+			log.Fatalf("Failed to initialize repository: %v", err)
+		}
+		if deviceRepo, err = infrastructure.NewSQLiteDeviceRepository(db); err != nil {
+			log.Fatalf("Failed to initialize device repository: %v", err)
+		}
+		if tokenRepo, err = infrastructure.NewSQLiteTokenRepository(db); err != nil {
+			log.Fatalf("Failed to initialize token repository: %v", err)
+		}
+		if userRepo, err = infrastructure.NewSQLiteUserRepository(db); err != nil {
+			log.Fatalf("Failed to initialize user repository: %v", err)
+		}
+		if memberRepo, err = infrastructure.NewSQLiteMemberRepository(db); err != nil {
+			log.Fatalf("Failed to initialize member repository: %v", err)
+		}
+	case "file":
+		if repo, err = infrastructure.NewFileAppRepository(blobs); err != nil {
+			log.Fatalf("Failed to initialize repository: %v", err)
+		}
+		if deviceRepo, err = infrastructure.NewFileDeviceRepository(); err != nil {
+			log.Fatalf("Failed to initialize device repository: %v", err)
+		}
+		if tokenRepo, err = infrastructure.NewFileTokenRepository(); err != nil {
+			log.Fatalf("Failed to initialize token repository: %v", err)
+		}
+		if userRepo, err = infrastructure.NewFileUserRepository(); err != nil {
+			log.Fatalf("Failed to initialize user repository: %v", err)
+		}
+		if memberRepo, err = infrastructure.NewFileMemberRepository(); err != nil {
+			log.Fatalf("Failed to initialize member repository: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q: must be postgres, sqlite or file", backend)
+	}
+	log.Printf("Using %s storage backend", backend)
+
+	// Tokens are managed with ADMIN_TOKEN, so without it nothing can be uploaded
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		log.Println("ADMIN_TOKEN is not set, so no API tokens can be created")
+	}
+	tokenService := application.NewTokenService(tokenRepo, adminToken)
+
+	service := application.NewAppService(repo, deleteGracePeriod())
+	accessService := application.NewAccessService(service, memberRepo)
+	handlers := interfaces.NewAppHandlers(service, accessService, tokenService, maxUploadSize())
+
+	// Partial uploads are kept with the app files, so any replica can resume them
+	uploadRepo := infrastructure.NewBlobResumableUploadRepository(blobs)
+	uploadService := application.NewUploadService(uploadRepo, resumableUploadTTL)
+	tusHandlers := interfaces.NewTusHandlers(handlers, uploadService)
+
+	// Remove resumable uploads that clients have abandoned
+	go func() {
+		for range time.Tick(time.Hour) {
+			if deleted, err := uploadService.DeleteExpiredUploads(); err != nil {
+				log.Printf("Error deleting expired uploads: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Deleted %d expired uploads", deleted)
+			}
+		}
+	}()
+
+	// Purge deleted builds and their files once their grace period has passed
+	go func() {
+		for range time.Tick(time.Hour) {
+			purged, err := service.PurgeDeletedBuilds()
+			if err != nil {
+				log.Printf("Error purging deleted builds: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("Purged %d deleted builds", purged)
+			}
+		}
+	}()
+
+	deviceHandlers := interfaces.NewDeviceHandlers(application.NewDeviceService(deviceRepo), accessService, tokenService, deviceCAs())
+	tokenHandlers := interfaces.NewTokenHandlers(tokenService)
+
+	mux := http.NewServeMux()
+
+	// Without an OpenID Connect provider builds can be listed and downloaded by anyone,
+	// and only API tokens can change them
+	protect := func(next http.HandlerFunc) http.HandlerFunc { return next }
+	identify := protect
+	if authService := newAuthService(userRepo); authService != nil {
+		authHandlers := interfaces.NewAuthHandlers(authService, tokenService, interfaces.NewURLSigner(urlSigningKey(), signedURLTTL), os.Getenv("OIDC_REDIRECT_URL"))
+		protect = authHandlers.RequireUser
+		identify = authHandlers.Identify
+		mux.HandleFunc("/api/auth/login", authHandlers.LoginHandler)
+		mux.HandleFunc("/api/auth/callback", authHandlers.CallbackHandler)
+		mux.HandleFunc("/api/auth/logout", authHandlers.LogoutHandler)
+		mux.HandleFunc("/api/auth/me", protect(authHandlers.MeHandler))
+
+		// End the sessions of users who haven't logged out
+		go func() {
+			for range time.Tick(time.Hour) {
+				if deleted, err := authService.DeleteExpiredSessions(); err != nil {
+					log.Printf("Error deleting expired sessions: %v", err)
+				} else if deleted > 0 {
+					log.Printf("Deleted %d expired sessions", deleted)
+				}
+			}
+		}()
+		log.Println("Login through OpenID Connect is enabled")
+	}
+
+	mux.HandleFunc("/api/apps", protect(handlers.AppsHandler))
+	mux.HandleFunc("/api/apps/upload", identify(handlers.UploadHandler))
+	mux.HandleFunc("/api/apps/uploads", tusHandlers.UploadsHandler)
+	mux.HandleFunc("/api/apps/uploads/", tusHandlers.UploadHandler)
+	mux.HandleFunc("/api/apps/", func(w http.ResponseWriter, r *http.Request) {
+		downloadRegex := regexp.MustCompile(`^/api/apps/([^/]+)/([^/]+)/([^/]+)/download$`)
+		manifestRegex := regexp.MustCompile(`^/api/apps/([^/]+)/([^/]+)/([^/]+)/manifest\.plist$`)
+		iconRegex := regexp.MustCompile(`^/api/apps/([^/]+)/([^/]+)/([^/]+)/icon$`)
+		versionsRegex := regexp.MustCompile(`^/api/apps/([^/]+)/versions$`)
+		channelsRegex := regexp.MustCompile(`^/api/apps/([^/]+)/channels$`)
+		promoteRegex := regexp.MustCompile(`^/api/apps/([^/]+)/channels/([^/]+)/promote$`)
+		promotionsRegex := regexp.MustCompile(`^/api/apps/([^/]+)/promotions$`)
+		changelogRegex := regexp.MustCompile(`^/api/apps/([^/]+)/changelog$`)
+		membersRegex := regexp.MustCompile(`^/api/apps/([^/]+)/members$`)
+		restoreBuildRegex := regexp.MustCompile(`^/api/apps/([^/]+)/([^/]+)/([^/]+)/restore$`)
+		feedbackRegex := regexp.MustCompile(`^/api/apps/([^/]+)/([^/]+)/([^/]+)/feedback$`)
+		buildRegex := regexp.MustCompile(`^/api/apps/([^/]+)/([^/]+)/([^/]+)$`)
+		latestRegex := regexp.MustCompile(`^/api/apps/([^/]+)$`)
+
+		if channelsRegex.MatchString(r.URL.Path) {
+			protect(handlers.ChannelsHandler)(w, r)
+		} else if promoteRegex.MatchString(r.URL.Path) {
+			identify(handlers.PromoteHandler)(w, r)
+		} else if promotionsRegex.MatchString(r.URL.Path) {
+			protect(handlers.PromotionsHandler)(w, r)
+		} else if changelogRegex.MatchString(r.URL.Path) {
+			protect(handlers.ChangelogHandler)(w, r)
+		} else if membersRegex.MatchString(r.URL.Path) {
+			identify(handlers.MembersHandler)(w, r)
+		} else if downloadRegex.MatchString(r.URL.Path) {
+			protect(handlers.DownloadHandler)(w, r)
+		} else if manifestRegex.MatchString(r.URL.Path) {
+			protect(handlers.ManifestHandler)(w, r)
+		} else if iconRegex.MatchString(r.URL.Path) {
+			protect(handlers.IconHandler)(w, r)
+		} else if versionsRegex.MatchString(r.URL.Path) {
+			protect(handlers.GetAllAppVersionsHandler)(w, r)
+		} else if restoreBuildRegex.MatchString(r.URL.Path) {
+			identify(handlers.RestoreBuildHandler)(w, r)
+		} else if feedbackRegex.MatchString(r.URL.Path) {
+			if r.Method == http.MethodPost {
+				identify(handlers.AddFeedbackHandler)(w, r)
+			} else {
+				protect(handlers.FeedbackHandler)(w, r)
+			}
+		} else if buildRegex.MatchString(r.URL.Path) {
+			switch r.Method {
+			case http.MethodPatch:
+				identify(handlers.UpdateBuildHandler)(w, r)
+			case http.MethodDelete:
+				identify(handlers.DeleteBuildHandler)(w, r)
+			default:
+				protect(handlers.GetBuildHandler)(w, r)
+			}
+		} else if latestRegex.MatchString(r.URL.Path) {
+			switch r.Method {
+			case http.MethodPatch:
+				identify(handlers.UpdateAppHandler)(w, r)
+			case http.MethodDelete:
+				identify(handlers.DeleteAppHandler)(w, r)
+			default:
+				protect(handlers.GetLatestAppVersionHandler)(w, r)
+			}
+		} else {
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/api/products", protect(handlers.ProductsHandler))
+	mux.HandleFunc("/api/products/", func(w http.ResponseWriter, r *http.Request) {
+		productLatestRegex := regexp.MustCompile(`^/api/products/([^/]+)/latest$`)
+		productInstallRegex := regexp.MustCompile(`^/api/products/([^/]+)/install$`)
+
+		if productLatestRegex.MatchString(r.URL.Path) {
+			protect(handlers.ProductLatestHandler)(w, r)
+		} else if productInstallRegex.MatchString(r.URL.Path) {
+			protect(handlers.ProductInstallHandler)(w, r)
+		} else {
+			switch r.Method {
+			case http.MethodPut:
+				identify(handlers.UpdateProductHandler)(w, r)
+			case http.MethodDelete:
+				identify(handlers.DeleteProductHandler)(w, r)
+			default:
+				identify(handlers.GetProductHandler)(w, r)
+			}
+		}
+	})
+	mux.HandleFunc("/api/builds", protect(handlers.BuildsHandler))
+	mux.HandleFunc("/api/devices", protect(deviceHandlers.DevicesHandler))
+	mux.HandleFunc("/api/devices/export", protect(deviceHandlers.ExportDevicesHandler))
+	mux.HandleFunc("/api/devices/enroll", deviceHandlers.EnrollHandler)
+	mux.HandleFunc("/api/devices/enroll/callback", deviceHandlers.EnrollCallbackHandler)
+	mux.HandleFunc("/api/devices/enroll/complete", deviceHandlers.EnrollCompleteHandler)
+	mux.HandleFunc("/api/tokens", tokenHandlers.TokensHandler)
+	mux.HandleFunc("/api/tokens/", tokenHandlers.RevokeTokenHandler)
+	mux.HandleFunc("/swagger/", httpSwagger.WrapHandler)
+
+	// Wrap the mux with the middlewares
+	handler := loggingMiddleware(corsMiddleware(mux))
+
+	log.Println("Starting server on :8080")
+	if err := http.ListenAndServe(":8080", handler); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
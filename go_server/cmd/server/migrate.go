@@ -0,0 +1,91 @@
+package main
+
+import (
+	"app-distribution-server-go/internal/infrastructure"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = `Usage: server migrate <command>
+
+Commands:
+  status      list the migrations and whether they have been applied
+  up          apply all pending migrations
+  down [n]    roll back the last n applied migrations (default 1)
+
+The database is selected by DATABASE_URL and STORAGE_BACKEND, like for the server.`
+
+// runMigrate implements the migrate subcommand, which manages the database schema
+// without starting the server.
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	var db *sql.DB
+	var dialect infrastructure.Dialect
+	var err error
+	switch backend := storageBackend(); backend {
+	case "postgres":
+		db, err = infrastructure.NewDBConnection()
+		dialect = infrastructure.DialectPostgres
+	case "sqlite":
+		db, err = infrastructure.NewSQLiteConnection()
+		dialect = infrastructure.DialectSQLite
+	default:
+		log.Fatalf("The %s storage backend has no database to migrate", backend)
+	}
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := infrastructure.NewMigrator(db, dialect)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		tw.Flush()
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+		fmt.Printf("Applied %d migrations\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("Invalid number of migrations %q: must be a positive number", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(steps)
+		if err != nil {
+			log.Fatalf("Failed to roll back migrations: %v", err)
+		}
+		fmt.Printf("Rolled back %d migrations\n", rolledBack)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
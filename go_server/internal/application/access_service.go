@@ -0,0 +1,274 @@
+package application
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotAuthenticated is returned when an action needs a logged in user or an API
+	// token and the caller has neither.
+	ErrNotAuthenticated = errors.New("login or API token required")
+	// ErrMemberNotFound is returned when an app has no member with the requested email or group.
+	ErrMemberNotFound = errors.New("member not found")
+)
+
+// ForbiddenError is returned when the role or API token of a caller doesn't allow an
+// action on an app. It is written to the caller as JSON.
+type ForbiddenError struct {
+	// BundleID is empty for actions whose app isn't known yet, such as uploads.
+	BundleID   string            `json:"bundle_id,omitempty"`
+	Permission domain.Permission `json:"permission"`
+	// Role is the role of a logged in user on the app, empty if the user isn't a member.
+	Role   domain.Role `json:"role,omitempty"`
+	Reason string      `json:"reason"`
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Reason
+}
+
+type MemberRepository interface {
+	// SaveMember creates the member, or changes the role of the member with the same
+	// bundle ID, email and group, and sets the CreatedAt of member to the stored one.
+	SaveMember(member *domain.Member) error
+	GetMembers(bundleID string) ([]*domain.Member, error)
+	// GetUserMembers returns the members of every app that are the user with email or
+	// one of groups.
+	GetUserMembers(email string, groups []string) ([]*domain.Member, error)
+	// DeleteMember returns ErrMemberNotFound if the app has no such member.
+	DeleteMember(bundleID, email, group string) error
+}
+
+// Caller is who makes a request: a logged in user, an API token or a guest. The zero
+// Caller can't do anything.
+type Caller struct {
+	User  *domain.User
+	Token *domain.APIToken
+	// Guest is set for requests that may view builds without a user or token: every
+	// request while logins are disabled, and requests with a signed link.
+	Guest bool
+}
+
+// Name returns who the caller is in the history of an app, such as its promotions.
+func (c Caller) Name() string {
+	switch {
+	case c.User != nil:
+		return c.User.Email
+	case c.Token != nil:
+		return c.Token.Name
+	}
+	return ""
+}
+
+// AccessService decides what callers can do with apps, from the roles users have as
+// members of the apps and the permissions of API tokens. The admin token can do
+// everything. Handlers check with it before they use AppService.
+type AccessService struct {
+	apps *AppService
+	repo MemberRepository
+}
+
+func NewAccessService(apps *AppService, repo MemberRepository) *AccessService {
+	return &AccessService{apps: apps, repo: repo}
+}
+
+// Authorize returns nil if caller has permission on the app with bundleID. Otherwise it
+// returns ErrNotAuthenticated for callers that have to log in or use an API token, and
+// a *ForbiddenError for the rest.
+func (s *AccessService) Authorize(caller Caller, bundleID string, permission domain.Permission) error {
+	switch {
+	case caller.Token != nil:
+		if caller.Token.ID == AdminTokenID || caller.Token.Allows(bundleID, permission) {
+			return nil
+		}
+		reason := fmt.Sprintf("Token %s does not have the %s permission for %s", caller.Token.Name, permission, bundleID)
+		if permission == domain.PermissionView {
+			reason = fmt.Sprintf("Token %s can't be used for %s", caller.Token.Name, bundleID)
+		}
+		return &ForbiddenError{BundleID: bundleID, Permission: permission, Reason: reason}
+	case caller.User != nil:
+		roles, err := s.roles(caller.User)
+		if err != nil {
+			return err
+		}
+		role := roles[bundleID]
+		if role.Allows(permission) {
+			return nil
+		}
+		reason := fmt.Sprintf("You are not a member of %s", bundleID)
+		if role != "" {
+			reason = fmt.Sprintf("Your %s role on %s does not allow %s", role, bundleID, permission)
+		}
+		return &ForbiddenError{BundleID: bundleID, Permission: permission, Role: role, Reason: reason}
+	case caller.Guest && permission == domain.PermissionView:
+		return nil
+	}
+	return ErrNotAuthenticated
+}
+
+// AuthorizeAny is Authorize for actions whose app is only known later, such as
+// uploads. It checks that caller has permission on at least one app.
+func (s *AccessService) AuthorizeAny(caller Caller, permission domain.Permission) error {
+	switch {
+	case caller.Token != nil:
+		if caller.Token.ID == AdminTokenID || caller.Token.HasPermission(permission) {
+			return nil
+		}
+		return &ForbiddenError{
+			Permission: permission,
+			Reason:     fmt.Sprintf("Token %s does not have the %s permission", caller.Token.Name, permission),
+		}
+	case caller.User != nil:
+		roles, err := s.roles(caller.User)
+		if err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if role.Allows(permission) {
+				return nil
+			}
+		}
+		return &ForbiddenError{
+			Permission: permission,
+			Reason:     fmt.Sprintf("None of your roles allows %s", permission),
+		}
+	case caller.Guest && permission == domain.PermissionView:
+		return nil
+	}
+	return ErrNotAuthenticated
+}
+
+// GetAllApps returns the apps that caller can view, with their newest build.
+func (s *AccessService) GetAllApps(caller Caller) ([]*domain.AppSummary, error) {
+	canView, err := s.viewer(caller)
+	if err != nil {
+		return nil, err
+	}
+	apps, err := s.apps.GetAllApps()
+	if err != nil {
+		return nil, err
+	}
+	visible := []*domain.AppSummary{}
+	for _, app := range apps {
+		if canView(app.BundleID) {
+			visible = append(visible, app)
+		}
+	}
+	return visible, nil
+}
+
+// GetBuildsByCommit returns the builds made from commit of the apps that caller can view.
+func (s *AccessService) GetBuildsByCommit(caller Caller, commit string) ([]*domain.BuildInfo, error) {
+	canView, err := s.viewer(caller)
+	if err != nil {
+		return nil, err
+	}
+	builds, err := s.apps.GetBuildsByCommit(commit)
+	if err != nil {
+		return nil, err
+	}
+	visible := []*domain.BuildInfo{}
+	for _, build := range builds {
+		if canView(build.BundleID) {
+			visible = append(visible, build)
+		}
+	}
+	return visible, nil
+}
+
+// GetProducts returns the products with an app that caller can view. The apps caller
+// can't view are left out of them.
+func (s *AccessService) GetProducts(caller Caller) ([]*domain.Product, error) {
+	canView, err := s.viewer(caller)
+	if err != nil {
+		return nil, err
+	}
+	products, err := s.apps.GetProducts()
+	if err != nil {
+		return nil, err
+	}
+	visible := []*domain.Product{}
+	for _, product := range products {
+		apps := make(map[domain.Platform]string)
+		for platform, bundleID := range product.Apps {
+			if canView(bundleID) {
+				apps[platform] = bundleID
+			}
+		}
+		if len(apps) == 0 {
+			continue
+		}
+		product.Apps = apps
+		visible = append(visible, product)
+	}
+	return visible, nil
+}
+
+// viewer returns a function that reports whether caller can view the app with a bundle
+// ID, so listings only look up the roles of a user once.
+func (s *AccessService) viewer(caller Caller) (func(bundleID string) bool, error) {
+	switch {
+	case caller.Token != nil:
+		return func(bundleID string) bool {
+			return caller.Token.ID == AdminTokenID || caller.Token.Allows(bundleID, domain.PermissionView)
+		}, nil
+	case caller.User != nil:
+		roles, err := s.roles(caller.User)
+		if err != nil {
+			return nil, err
+		}
+		return func(bundleID string) bool {
+			return roles[bundleID].Allows(domain.PermissionView)
+		}, nil
+	case caller.Guest:
+		return func(string) bool { return true }, nil
+	}
+	return nil, ErrNotAuthenticated
+}
+
+// roles returns the role of user on each app the user is a member of. Users who are
+// members both directly and through groups get the role with the most permissions.
+func (s *AccessService) roles(user *domain.User) (map[string]domain.Role, error) {
+	members, err := s.repo.GetUserMembers(user.Email, user.Groups)
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]domain.Role)
+	for _, member := range members {
+		if !roles[member.BundleID].Includes(member.Role) {
+			roles[member.BundleID] = member.Role
+		}
+	}
+	return roles, nil
+}
+
+// GetMembers returns the users and groups that have a role on the app with bundleID.
+func (s *AccessService) GetMembers(bundleID string) ([]*domain.Member, error) {
+	return s.repo.GetMembers(bundleID)
+}
+
+// SetMember gives the user with email, or the group, role on the app with bundleID.
+// Exactly one of email and group must be set.
+func (s *AccessService) SetMember(bundleID, email, group string, role domain.Role) (*domain.Member, error) {
+	member := &domain.Member{
+		BundleID:  bundleID,
+		Email:     strings.ToLower(email),
+		Group:     group,
+		Role:      role,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.SaveMember(member); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember takes the role on the app with bundleID away from the user with email,
+// or from the group.
+func (s *AccessService) RemoveMember(bundleID, email, group string) error {
+	return s.repo.DeleteMember(bundleID, strings.ToLower(email), group)
+}
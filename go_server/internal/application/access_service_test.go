@@ -0,0 +1,161 @@
+package application
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// memberRepository keeps members in memory.
+type memberRepository struct {
+	members []*domain.Member
+}
+
+func (r *memberRepository) SaveMember(member *domain.Member) error {
+	r.members = append(r.members, member)
+	return nil
+}
+
+func (r *memberRepository) GetMembers(bundleID string) ([]*domain.Member, error) {
+	var members []*domain.Member
+	for _, member := range r.members {
+		if member.BundleID == bundleID {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+func (r *memberRepository) GetUserMembers(email string, groups []string) ([]*domain.Member, error) {
+	var members []*domain.Member
+	for _, member := range r.members {
+		if (member.Email != "" && member.Email == email) || (member.Group != "" && slices.Contains(groups, member.Group)) {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+func (r *memberRepository) DeleteMember(bundleID, email, group string) error {
+	return ErrMemberNotFound
+}
+
+func TestAccessServiceAuthorize(t *testing.T) {
+	repo := &memberRepository{members: []*domain.Member{
+		{BundleID: "com.example.app", Email: "dev@example.com", Role: domain.RoleDeveloper},
+		{BundleID: "com.example.app", Group: "qa", Role: domain.RoleTester},
+		// Membership through a group with a higher role wins over the direct one
+		{BundleID: "com.example.other", Email: "dev@example.com", Role: domain.RoleViewer},
+		{BundleID: "com.example.other", Group: "leads", Role: domain.RoleManager},
+	}}
+	access := NewAccessService(nil, repo)
+
+	developer := Caller{User: &domain.User{Email: "dev@example.com", Groups: []string{"leads"}}}
+	tester := Caller{User: &domain.User{Email: "qa@example.com", Groups: []string{"qa"}}}
+	stranger := Caller{User: &domain.User{Email: "someone@example.com"}}
+	uploader := Caller{Token: &domain.APIToken{ID: "ci", Name: "ci", BundleIDs: []string{"com.example.app"}, Permissions: []domain.Permission{domain.PermissionUpload}}}
+	allApps := Caller{Token: &domain.APIToken{ID: "all", Name: "all", BundleIDs: []string{domain.AllBundleIDs}, Permissions: []domain.Permission{domain.PermissionPromote}}}
+	admin := Caller{Token: &domain.APIToken{ID: AdminTokenID, Name: AdminTokenID}}
+	guest := Caller{Guest: true}
+
+	tests := []struct {
+		name       string
+		caller     Caller
+		bundleID   string
+		permission domain.Permission
+		// role is the role a *ForbiddenError reports, or "allowed" if access is granted
+		want domain.Role
+	}{
+		{"developer can upload", developer, "com.example.app", domain.PermissionUpload, "allowed"},
+		{"developer can view", developer, "com.example.app", domain.PermissionView, "allowed"},
+		{"developer can't promote", developer, "com.example.app", domain.PermissionPromote, domain.RoleDeveloper},
+		{"group role wins over a lower direct role", developer, "com.example.other", domain.PermissionDelete, "allowed"},
+		{"tester through group can give feedback", tester, "com.example.app", domain.PermissionFeedback, "allowed"},
+		{"tester through group can't upload", tester, "com.example.app", domain.PermissionUpload, domain.RoleTester},
+		{"tester has no role on other apps", tester, "com.example.other", domain.PermissionView, ""},
+		{"non-member can't view", stranger, "com.example.app", domain.PermissionView, ""},
+		{"token can use its permission", uploader, "com.example.app", domain.PermissionUpload, "allowed"},
+		{"token can view its apps", uploader, "com.example.app", domain.PermissionView, "allowed"},
+		{"token can't use other permissions", uploader, "com.example.app", domain.PermissionDelete, ""},
+		{"token can't be used for other apps", uploader, "com.example.other", domain.PermissionView, ""},
+		{"token for all apps", allApps, "com.example.new", domain.PermissionPromote, "allowed"},
+		{"admin token can do everything", admin, "com.example.app", domain.PermissionManageMembers, "allowed"},
+		{"guest can view", guest, "com.example.app", domain.PermissionView, "allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := access.Authorize(tt.caller, tt.bundleID, tt.permission)
+			if tt.want == "allowed" {
+				if err != nil {
+					t.Errorf("Authorize() error = %v, want nil", err)
+				}
+				return
+			}
+			var forbidden *ForbiddenError
+			if !errors.As(err, &forbidden) {
+				t.Fatalf("Authorize() error = %v, want a *ForbiddenError", err)
+			}
+			if forbidden.Role != tt.want || forbidden.BundleID != tt.bundleID || forbidden.Permission != tt.permission {
+				t.Errorf("Authorize() error = %+v, want role %q on %s for %s", forbidden, tt.want, tt.bundleID, tt.permission)
+			}
+		})
+	}
+}
+
+func TestAccessServiceAuthorizeUnauthenticated(t *testing.T) {
+	access := NewAccessService(nil, &memberRepository{})
+	tests := []struct {
+		name       string
+		caller     Caller
+		permission domain.Permission
+	}{
+		{"nobody can view", Caller{}, domain.PermissionView},
+		{"nobody can upload", Caller{}, domain.PermissionUpload},
+		{"guest can't upload", Caller{Guest: true}, domain.PermissionUpload},
+		{"guest can't delete", Caller{Guest: true}, domain.PermissionDelete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := access.Authorize(tt.caller, "com.example.app", tt.permission); !errors.Is(err, ErrNotAuthenticated) {
+				t.Errorf("Authorize() error = %v, want %v", err, ErrNotAuthenticated)
+			}
+			if err := access.AuthorizeAny(tt.caller, tt.permission); !errors.Is(err, ErrNotAuthenticated) {
+				t.Errorf("AuthorizeAny() error = %v, want %v", err, ErrNotAuthenticated)
+			}
+		})
+	}
+}
+
+func TestAccessServiceAuthorizeAny(t *testing.T) {
+	repo := &memberRepository{members: []*domain.Member{
+		{BundleID: "com.example.app", Email: "viewer@example.com", Role: domain.RoleViewer},
+		{BundleID: "com.example.other", Group: "mobile", Role: domain.RoleDeveloper},
+	}}
+	access := NewAccessService(nil, repo)
+
+	tests := []struct {
+		name       string
+		caller     Caller
+		permission domain.Permission
+		allowed    bool
+	}{
+		{"developer role on any app allows uploads", Caller{User: &domain.User{Email: "viewer@example.com", Groups: []string{"mobile"}}}, domain.PermissionUpload, true},
+		{"viewer role doesn't allow uploads", Caller{User: &domain.User{Email: "viewer@example.com"}}, domain.PermissionUpload, false},
+		{"token with the permission", Caller{Token: &domain.APIToken{ID: "ci", Permissions: []domain.Permission{domain.PermissionUpload}}}, domain.PermissionUpload, true},
+		{"token without the permission", Caller{Token: &domain.APIToken{ID: "ci", Permissions: []domain.Permission{domain.PermissionPromote}}}, domain.PermissionUpload, false},
+		{"admin token", Caller{Token: &domain.APIToken{ID: AdminTokenID}}, domain.PermissionDelete, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := access.AuthorizeAny(tt.caller, tt.permission)
+			if tt.allowed && err != nil {
+				t.Errorf("AuthorizeAny() error = %v, want nil", err)
+			}
+			var forbidden *ForbiddenError
+			if !tt.allowed && !errors.As(err, &forbidden) {
+				t.Errorf("AuthorizeAny() error = %v, want a *ForbiddenError", err)
+			}
+		})
+	}
+}
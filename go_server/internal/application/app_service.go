@@ -2,41 +2,720 @@ package application
 
 import (
 	"app-distribution-server-go/internal/domain"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
+// ErrSignerChanged is returned when an Android build is signed with a different
+// certificate than earlier builds of the same app.
+var ErrSignerChanged = errors.New("signing certificate differs from earlier builds")
+
+// ErrBuildExists is returned when a build with the same bundle ID, version, build
+// number and platform has already been uploaded.
+var ErrBuildExists = errors.New("build has already been uploaded")
+
+// ErrAppNotFound is returned when no app with the requested bundle ID exists.
+var ErrAppNotFound = errors.New("app not found")
+
+// ErrAppExists is returned when creating an app whose bundle ID is already taken.
+var ErrAppExists = errors.New("app already exists")
+
+// ErrAppHasBuilds is returned when deleting an app that still has builds.
+var ErrAppHasBuilds = errors.New("app still has builds")
+
+// ErrChannelNotFound is returned when an app has no channel with the requested name.
+var ErrChannelNotFound = errors.New("channel not found")
+
+// ErrBuildNotFound is returned when a requested build doesn't exist.
+var ErrBuildNotFound = errors.New("build not found")
+
+// ErrBuildOnChannel is returned when deleting a build that a channel points to.
+var ErrBuildOnChannel = errors.New("build is on a channel")
+
+// ErrProductNotFound is returned when no product with the requested ID exists.
+var ErrProductNotFound = errors.New("product not found")
+
+// ErrProductExists is returned when creating a product whose ID is already taken.
+var ErrProductExists = errors.New("product already exists")
+
+// ErrAppInProduct is returned when a product is given an app that belongs to another
+// product. The app has to be removed from that product first.
+var ErrAppInProduct = errors.New("app belongs to another product")
+
+// ErrPlatformTaken is returned when a product is given more than one app for the same platform.
+var ErrPlatformTaken = errors.New("product has more than one app for a platform")
+
+// ErrUploadTooLarge is returned when an application file exceeds the maximum upload size.
+var ErrUploadTooLarge = errors.New("upload exceeds the maximum size")
+
+// StagedUpload is an application file that has been streamed into storage before its
+// metadata is known. SaveUpload moves it into place without copying it again.
+type StagedUpload struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
+// Remove deletes the staged file. It is a no-op once the upload has been saved.
+func (u *StagedUpload) Remove() error {
+	if err := os.Remove(u.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 type AppRepository interface {
-	GetAllApps() ([]*domain.BuildInfo, error)
+	GetApps() ([]*domain.App, error)
+	// GetApp returns the app with bundleID, or ErrAppNotFound.
+	GetApp(bundleID string) (*domain.App, error)
+	// CreateApp stores a new app, or returns ErrAppExists.
+	CreateApp(app *domain.App) error
+	// UpdateApp replaces the metadata of an app, or returns ErrAppNotFound.
+	UpdateApp(app *domain.App) error
+	// DeleteApp deletes an app, or returns ErrAppNotFound.
+	DeleteApp(bundleID string) error
+
+	// GetLatestBuilds returns the newest listed build of every app.
+	GetLatestBuilds() ([]*domain.BuildInfo, error)
+	// GetAllVersions returns every build of an app, newest first, including archived
+	// and deleted ones.
 	GetAllVersions(bundleID string) ([]*domain.BuildInfo, error)
+	// GetLatestVersion returns the newest listed build of an app, or ErrBuildNotFound
+	// if it has none.
 	GetLatestVersion(bundleID string) (*domain.BuildInfo, error)
-	GetBuild(bundleID, version, buildNumber string) (*domain.BuildInfo, error)
-	SaveUpload(info *domain.BuildInfo, appFile io.Reader) error
+	// GetBuild returns the build of an app for platform, deleted or not, or ErrBuildNotFound.
+	GetBuild(bundleID string, platform domain.Platform, version, buildNumber string) (*domain.BuildInfo, error)
+	// GetBuildByUploadID returns the build with uploadID, deleted or not, or ErrBuildNotFound.
+	GetBuildByUploadID(uploadID string) (*domain.BuildInfo, error)
+	// GetBuildsByCommit returns the builds of every app whose commit starts with commit,
+	// newest first, including archived and deleted ones.
+	GetBuildsByCommit(commit string) ([]*domain.BuildInfo, error)
+	// UpdateBuild saves the title, description, release notes and archived and deleted
+	// state of a build, or returns ErrBuildNotFound.
+	UpdateBuild(build *domain.BuildInfo) error
+	// GetDeletedBuilds returns the builds that were deleted before the given time.
+	GetDeletedBuilds(before time.Time) ([]*domain.BuildInfo, error)
+	// PurgeBuild removes a build, its promotions and feedback and its files. App files shared with
+	// other builds through content addressing are kept until no build uses them.
+	PurgeBuild(build *domain.BuildInfo) error
+	// StageUpload streams appFile into storage, failing with ErrUploadTooLarge once
+	// more than maxSize bytes have been read.
+	StageUpload(appFile io.Reader, maxSize int64) (*StagedUpload, error)
+	SaveUpload(info *domain.BuildInfo, upload *StagedUpload) error
+	SaveIcon(info *domain.BuildInfo, icon []byte) error
+	OpenAppFile(info *domain.BuildInfo) (io.ReadSeekCloser, *BlobInfo, error)
+	OpenIcon(info *domain.BuildInfo) (io.ReadSeekCloser, *BlobInfo, error)
+
+	GetChannels(bundleID string) ([]*domain.Channel, error)
+	// GetChannel returns the channel of an app, or ErrChannelNotFound.
+	GetChannel(bundleID, name string) (*domain.Channel, error)
+	// SavePromotion points the promotion's channel to its build, creating the channel
+	// if needed, and records the promotion.
+	SavePromotion(promotion *domain.Promotion) error
+	// GetPromotions returns the promotions of an app, newest first, optionally only
+	// those of one channel.
+	GetPromotions(bundleID, channel string) ([]*domain.Promotion, error)
+
+	SaveFeedback(feedback *domain.Feedback) error
+	// GetFeedback returns the feedback on the build with uploadID, newest first.
+	GetFeedback(uploadID string) ([]*domain.Feedback, error)
+
+	GetProducts() ([]*domain.Product, error)
+	// GetProduct returns a product, or ErrProductNotFound.
+	GetProduct(id string) (*domain.Product, error)
+	// CreateProduct stores a new product and links its apps to it, or returns ErrProductExists,
+	// or ErrAppInProduct if one of the apps belongs to another product.
+	CreateProduct(product *domain.Product) error
+	// UpdateProduct replaces the name and apps of a product, or returns ErrProductNotFound,
+	// or ErrAppInProduct if one of the apps belongs to another product.
+	UpdateProduct(product *domain.Product) error
+	// DeleteProduct unlinks the apps of a product and deletes it, or returns ErrProductNotFound.
+	DeleteProduct(id string) error
 }
 
 type AppService struct {
-	repo AppRepository
+	repo              AppRepository
+	deleteGracePeriod time.Duration
+}
+
+// NewAppService returns an AppService that purges deleted builds once they have
+// been deleted for deleteGracePeriod.
+func NewAppService(repo AppRepository, deleteGracePeriod time.Duration) *AppService {
+	return &AppService{repo: repo, deleteGracePeriod: deleteGracePeriod}
+}
+
+// BuildQuery selects and orders the builds of an app.
+type BuildQuery struct {
+	// Order is the order of the builds. Empty means the one set by the app's LatestBy.
+	Order domain.VersionOrder
+	// Versions is the range the version of the builds is in.
+	Versions domain.VersionRange
+	// Archived selects the archived builds instead of the listed ones.
+	Archived bool
+	// Branch, if set, selects the builds made from this branch.
+	Branch string
+	// Commit, if set, selects the builds whose commit starts with it.
+	Commit string
+	// Installable selects only the builds devices can install, leaving out .aab bundles.
+	Installable bool
 }
 
-func NewAppService(repo AppRepository) *AppService {
-	return &AppService{repo: repo}
+// matches reports whether a build that isn't deleted is selected by the query.
+func (q BuildQuery) matches(build *domain.BuildInfo) bool {
+	if (build.ArchivedAt != nil) != q.Archived || !q.Versions.Contains(build.Version) {
+		return false
+	}
+	if q.Installable && !build.Artifact().Installable() {
+		return false
+	}
+	if q.Branch == "" && q.Commit == "" {
+		return true
+	}
+	provenance := build.Provenance
+	if provenance == nil {
+		return false
+	}
+	return (q.Branch == "" || provenance.Branch == q.Branch) &&
+		(q.Commit == "" || strings.HasPrefix(provenance.Commit, q.Commit))
 }
 
-func (s *AppService) GetAllApps() ([]*domain.BuildInfo, error) {
-	return s.repo.GetAllApps()
+// GetAllApps returns every app with its newest build. Apps whose builds were uploaded
+// before apps were stored are derived from their newest build.
+func (s *AppService) GetAllApps() ([]*domain.AppSummary, error) {
+	apps, err := s.repo.GetApps()
+	if err != nil {
+		return nil, err
+	}
+	builds, err := s.repo.GetLatestBuilds()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*domain.AppSummary, 0, len(apps))
+	byBundleID := make(map[string]*domain.AppSummary, len(apps))
+	for _, app := range apps {
+		summary := &domain.AppSummary{App: *app}
+		summaries = append(summaries, summary)
+		byBundleID[app.BundleID] = summary
+	}
+	for _, build := range builds {
+		if summary, ok := byBundleID[build.BundleID]; ok {
+			summary.LatestBuild = build
+			continue
+		}
+		summaries = append(summaries, &domain.AppSummary{App: *domain.NewAppFromBuild(build), LatestBuild: build})
+	}
+
+	// The newest upload isn't the latest build of apps ordered by version
+	for _, summary := range summaries {
+		if summary.LatestBy == domain.OrderByVersion && summary.LatestBuild != nil {
+			if summary.LatestBuild, err = s.latestBuild(summary.BundleID, BuildQuery{Order: summary.LatestBy}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].BundleID < summaries[j].BundleID
+	})
+	return summaries, nil
 }
 
+// GetApp returns the app with bundleID, or ErrAppNotFound. Apps whose builds were
+// uploaded before apps were stored are derived from their newest build.
+func (s *AppService) GetApp(bundleID string) (*domain.App, error) {
+	app, err := s.repo.GetApp(bundleID)
+	if !errors.Is(err, ErrAppNotFound) {
+		return app, err
+	}
+
+	builds, err := s.repo.GetAllVersions(bundleID)
+	if err != nil {
+		return nil, err
+	}
+	if len(builds) == 0 {
+		return nil, ErrAppNotFound
+	}
+	return domain.NewAppFromBuild(builds[0]), nil
+}
+
+// CreateApp creates an app ahead of its first upload, or returns ErrAppExists.
+func (s *AppService) CreateApp(app *domain.App) error {
+	if app.CreatedAt.IsZero() {
+		app.CreatedAt = time.Now()
+	}
+	return s.repo.CreateApp(app)
+}
+
+// UpdateApp replaces the metadata of an app, storing apps that GetApp derived from
+// their builds.
+func (s *AppService) UpdateApp(app *domain.App) error {
+	err := s.repo.UpdateApp(app)
+	if errors.Is(err, ErrAppNotFound) {
+		if _, err := s.GetApp(app.BundleID); err != nil {
+			return err
+		}
+		return s.repo.CreateApp(app)
+	}
+	return err
+}
+
+// DeleteApp deletes an app, or returns ErrAppHasBuilds while it still has builds.
+// Builds that were deleted but not purged yet are purged with the app.
+func (s *AppService) DeleteApp(bundleID string) error {
+	builds, err := s.repo.GetAllVersions(bundleID)
+	if err != nil {
+		return err
+	}
+	for _, build := range builds {
+		if build.DeletedAt == nil {
+			return ErrAppHasBuilds
+		}
+	}
+	for _, build := range builds {
+		if err := s.repo.PurgeBuild(build); err != nil {
+			return err
+		}
+	}
+	return s.repo.DeleteApp(bundleID)
+}
+
+// GetLatestVersion returns the latest build of an app in the order set by its LatestBy,
+// or ErrBuildNotFound if it has no listed builds.
 func (s *AppService) GetLatestVersion(bundleID string) (*domain.BuildInfo, error) {
-	return s.repo.GetLatestVersion(bundleID)
+	return s.GetLatestVersionInRange(bundleID, nil, false)
+}
+
+// GetLatestVersionInRange returns the latest build of an app whose version is in
+// versions, in the order set by the app's LatestBy, or ErrBuildNotFound. With
+// installable, the latest build devices can install is returned.
+func (s *AppService) GetLatestVersionInRange(bundleID string, versions domain.VersionRange, installable bool) (*domain.BuildInfo, error) {
+	order, err := s.latestBy(bundleID)
+	if err != nil {
+		return nil, err
+	}
+	return s.latestBuild(bundleID, BuildQuery{Order: order, Versions: versions, Installable: installable})
+}
+
+// GetAllVersions returns the builds of an app selected by query, newest first in
+// its order. With the default order the first build is the latest one.
+func (s *AppService) GetAllVersions(bundleID string, query BuildQuery) ([]*domain.BuildInfo, error) {
+	if query.Order == "" {
+		var err error
+		if query.Order, err = s.latestBy(bundleID); err != nil {
+			return nil, err
+		}
+	}
+
+	builds, err := s.repo.GetAllVersions(bundleID)
+	if err != nil {
+		return nil, err
+	}
+	matching := builds[:0]
+	for _, build := range builds {
+		if build.DeletedAt == nil && query.matches(build) {
+			matching = append(matching, build)
+		}
+	}
+	domain.SortBuilds(matching, query.Order)
+	return matching, nil
 }
 
-func (s *AppService) GetAllVersions(bundleID string) ([]*domain.BuildInfo, error) {
-	return s.repo.GetAllVersions(bundleID)
+// latestBy returns the order that decides the latest build of an app. Apps derived
+// from their builds use the default order.
+func (s *AppService) latestBy(bundleID string) (domain.VersionOrder, error) {
+	app, err := s.repo.GetApp(bundleID)
+	if errors.Is(err, ErrAppNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return app.LatestBy, nil
+}
+
+// latestBuild returns the first listed build of an app selected by query.
+func (s *AppService) latestBuild(bundleID string, query BuildQuery) (*domain.BuildInfo, error) {
+	if query.Order != domain.OrderByVersion && len(query.Versions) == 0 && query.Branch == "" && query.Commit == "" && !query.Installable {
+		return s.repo.GetLatestVersion(bundleID)
+	}
+
+	builds, err := s.GetAllVersions(bundleID, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(builds) == 0 {
+		return nil, fmt.Errorf("%w: no build of %s matches the query", ErrBuildNotFound, bundleID)
+	}
+	return builds[0], nil
 }
 
+// GetBuild returns a build of an app for the app's platform, or ErrBuildNotFound if
+// it doesn't exist or has been deleted. Archived builds are returned.
 func (s *AppService) GetBuild(bundleID, version, buildNumber string) (*domain.BuildInfo, error) {
-	return s.repo.GetBuild(bundleID, version, buildNumber)
+	build, err := s.getBuild(bundleID, version, buildNumber)
+	if err != nil {
+		return nil, err
+	}
+	if build.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: build %s of %s was deleted", ErrBuildNotFound, build.UploadID, bundleID)
+	}
+	return build, nil
+}
+
+// GetBuildsByCommit returns the builds of every app made from a commit, newest
+// first. Abbreviated commits match every commit they are a prefix of. Deleted builds
+// are left out, while archived builds are included since they can still be downloaded.
+func (s *AppService) GetBuildsByCommit(commit string) ([]*domain.BuildInfo, error) {
+	builds, err := s.repo.GetBuildsByCommit(strings.ToLower(commit))
+	if err != nil {
+		return nil, err
+	}
+	matching := builds[:0]
+	for _, build := range builds {
+		if build.DeletedAt == nil {
+			matching = append(matching, build)
+		}
+	}
+	return matching, nil
+}
+
+// GetChangelog returns the builds of an app that are newer than from, up to and
+// including to, newest first in version order. Archived builds are included, since
+// they were released, while deleted builds are left out.
+func (s *AppService) GetChangelog(from, to *domain.BuildInfo) ([]*domain.BuildInfo, error) {
+	builds, err := s.repo.GetAllVersions(to.BundleID)
+	if err != nil {
+		return nil, err
+	}
+	var changes []*domain.BuildInfo
+	for _, build := range builds {
+		if build.DeletedAt == nil && domain.CompareBuilds(build, from) > 0 && domain.CompareBuilds(build, to) <= 0 {
+			changes = append(changes, build)
+		}
+	}
+	domain.SortBuilds(changes, domain.OrderByVersion)
+	return changes, nil
+}
+
+// UpdateBuild saves the title, description, release notes and archived state of a build.
+func (s *AppService) UpdateBuild(build *domain.BuildInfo) error {
+	return s.repo.UpdateBuild(build)
 }
 
-func (s *AppService) SaveUpload(info *domain.BuildInfo, appFile io.Reader) error {
-	return s.repo.SaveUpload(info, appFile)
+// DeleteBuild deletes a build, which is purged with its files once the grace period
+// has passed. It returns ErrBuildOnChannel while a channel points to the build.
+func (s *AppService) DeleteBuild(build *domain.BuildInfo) error {
+	channels, err := s.repo.GetChannels(build.BundleID)
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		if channel.UploadID == build.UploadID {
+			return fmt.Errorf("%w: %s", ErrBuildOnChannel, channel.Name)
+		}
+	}
+
+	now := time.Now()
+	build.DeletedAt = &now
+	return s.repo.UpdateBuild(build)
+}
+
+// getBuild returns a build of an app, deleted or not. Version and build number are
+// only unique per platform, so the build for the app's platform is returned.
+func (s *AppService) getBuild(bundleID, version, buildNumber string) (*domain.BuildInfo, error) {
+	app, err := s.GetApp(bundleID)
+	if errors.Is(err, ErrAppNotFound) {
+		return nil, fmt.Errorf("%w: no app with bundle ID %s", ErrBuildNotFound, bundleID)
+	} else if err != nil {
+		return nil, err
+	}
+	return s.repo.GetBuild(bundleID, app.Platform, version, buildNumber)
+}
+
+// RestoreBuild undoes the deletion of a build that hasn't been purged yet, or
+// returns ErrBuildNotFound.
+func (s *AppService) RestoreBuild(bundleID, version, buildNumber string) (*domain.BuildInfo, error) {
+	build, err := s.getBuild(bundleID, version, buildNumber)
+	if err != nil {
+		return nil, err
+	}
+	if build.DeletedAt == nil {
+		return build, nil
+	}
+	build.DeletedAt = nil
+	if err := s.repo.UpdateBuild(build); err != nil {
+		return nil, err
+	}
+	return build, nil
+}
+
+// PurgeDeletedBuilds removes the builds whose grace period has passed, with their
+// files, and returns how many were purged. Builds that fail to purge are skipped and
+// their errors returned together.
+func (s *AppService) PurgeDeletedBuilds() (int, error) {
+	builds, err := s.repo.GetDeletedBuilds(time.Now().Add(-s.deleteGracePeriod))
+	if err != nil {
+		return 0, err
+	}
+	// A build that can't be purged is retried next time, and doesn't hold up the rest
+	purged := 0
+	var errs []error
+	for _, build := range builds {
+		if err := s.repo.PurgeBuild(build); err != nil {
+			errs = append(errs, fmt.Errorf("failed to purge build %s of %s: %w", build.UploadID, build.BundleID, err))
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+func (s *AppService) StageUpload(appFile io.Reader, maxSize int64) (*StagedUpload, error) {
+	return s.repo.StageUpload(appFile, maxSize)
+}
+
+// SaveUpload saves a build, creating its app from it if this is the app's first build.
+// A deleted build with the same version and build number is purged first, so uploading
+// it again replaces it instead of failing with ErrBuildExists.
+func (s *AppService) SaveUpload(info *domain.BuildInfo, upload *StagedUpload) error {
+	if _, err := s.repo.GetApp(info.BundleID); err != nil {
+		if !errors.Is(err, ErrAppNotFound) {
+			return err
+		}
+		// Another upload may have created the app in the meantime
+		if err := s.repo.CreateApp(domain.NewAppFromBuild(info)); err != nil && !errors.Is(err, ErrAppExists) {
+			return err
+		}
+	}
+
+	existing, err := s.repo.GetBuild(info.BundleID, info.Platform, info.Version, info.BuildNumber)
+	switch {
+	case err == nil && existing.DeletedAt != nil:
+		// Another upload may have purged it in the meantime
+		if err := s.repo.PurgeBuild(existing); err != nil && !errors.Is(err, ErrBuildNotFound) {
+			return err
+		}
+	case err != nil && !errors.Is(err, ErrBuildNotFound):
+		return err
+	}
+	return s.repo.SaveUpload(info, upload)
+}
+
+func (s *AppService) SaveIcon(info *domain.BuildInfo, icon []byte) error {
+	return s.repo.SaveIcon(info, icon)
+}
+
+// OpenAppFile opens the application file of a build, or returns ErrBlobNotFound.
+func (s *AppService) OpenAppFile(info *domain.BuildInfo) (io.ReadSeekCloser, *BlobInfo, error) {
+	return s.repo.OpenAppFile(info)
+}
+
+// OpenIcon opens the app icon of a build, or returns ErrBlobNotFound.
+func (s *AppService) OpenIcon(info *domain.BuildInfo) (io.ReadSeekCloser, *BlobInfo, error) {
+	return s.repo.OpenIcon(info)
+}
+
+// GetChannels returns the channels of an app with the builds they point to.
+func (s *AppService) GetChannels(bundleID string) ([]*domain.Channel, error) {
+	channels, err := s.repo.GetChannels(bundleID)
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if channel.Build, err = s.repo.GetBuildByUploadID(channel.UploadID); err != nil {
+			return nil, err
+		}
+	}
+	return channels, nil
+}
+
+// GetChannelBuild returns the build a channel of an app points to, or ErrChannelNotFound.
+func (s *AppService) GetChannelBuild(bundleID, channel string) (*domain.BuildInfo, error) {
+	c, err := s.repo.GetChannel(bundleID, channel)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetBuildByUploadID(c.UploadID)
+}
+
+// PromoteBuild puts a build on a channel of its app.
+func (s *AppService) PromoteBuild(build *domain.BuildInfo, channel, promotedBy string) (*domain.Channel, error) {
+	return s.promote(build, channel, "", promotedBy)
+}
+
+// PromoteChannel puts the build of one channel of an app on another, or returns
+// ErrChannelNotFound if the source channel doesn't exist.
+func (s *AppService) PromoteChannel(bundleID, fromChannel, channel, promotedBy string) (*domain.Channel, error) {
+	build, err := s.GetChannelBuild(bundleID, fromChannel)
+	if err != nil {
+		return nil, err
+	}
+	return s.promote(build, channel, fromChannel, promotedBy)
+}
+
+func (s *AppService) promote(build *domain.BuildInfo, channel, fromChannel, promotedBy string) (*domain.Channel, error) {
+	promotion := &domain.Promotion{
+		ID:          uuid.New().String(),
+		BundleID:    build.BundleID,
+		Channel:     channel,
+		UploadID:    build.UploadID,
+		FromChannel: fromChannel,
+		PromotedBy:  promotedBy,
+		PromotedAt:  time.Now(),
+	}
+	if err := s.repo.SavePromotion(promotion); err != nil {
+		return nil, err
+	}
+	return &domain.Channel{
+		BundleID:  build.BundleID,
+		Name:      channel,
+		UploadID:  build.UploadID,
+		UpdatedAt: promotion.PromotedAt,
+		UpdatedBy: promotedBy,
+		Build:     build,
+	}, nil
+}
+
+// GetPromotions returns the promotions of an app, newest first. If channel is not
+// empty only the promotions to that channel are returned.
+func (s *AppService) GetPromotions(bundleID, channel string) ([]*domain.Promotion, error) {
+	return s.repo.GetPromotions(bundleID, channel)
+}
+
+// AddFeedback records feedback from author on a build.
+func (s *AppService) AddFeedback(build *domain.BuildInfo, author, message string) (*domain.Feedback, error) {
+	feedback := &domain.Feedback{
+		ID:        uuid.New().String(),
+		BundleID:  build.BundleID,
+		UploadID:  build.UploadID,
+		Author:    author,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.SaveFeedback(feedback); err != nil {
+		return nil, err
+	}
+	return feedback, nil
+}
+
+// GetFeedback returns the feedback on a build, newest first.
+func (s *AppService) GetFeedback(build *domain.BuildInfo) ([]*domain.Feedback, error) {
+	return s.repo.GetFeedback(build.UploadID)
+}
+
+func (s *AppService) GetProducts() ([]*domain.Product, error) {
+	return s.repo.GetProducts()
+}
+
+// GetProduct returns a product, or ErrProductNotFound.
+func (s *AppService) GetProduct(id string) (*domain.Product, error) {
+	return s.repo.GetProduct(id)
+}
+
+// CreateProduct creates a product grouping the apps with bundleIDs, which must have
+// different platforms.
+func (s *AppService) CreateProduct(id, name string, bundleIDs []string) (*domain.Product, error) {
+	apps, err := s.productApps(bundleIDs)
+	if err != nil {
+		return nil, err
+	}
+	product := &domain.Product{ID: id, Name: name, Apps: apps, CreatedAt: time.Now()}
+	if err := s.repo.CreateProduct(product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// UpdateProduct replaces the name and apps of a product.
+func (s *AppService) UpdateProduct(id, name string, bundleIDs []string) (*domain.Product, error) {
+	product, err := s.repo.GetProduct(id)
+	if err != nil {
+		return nil, err
+	}
+	if product.Apps, err = s.productApps(bundleIDs); err != nil {
+		return nil, err
+	}
+	product.Name = name
+	if err := s.repo.UpdateProduct(product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+func (s *AppService) DeleteProduct(id string) error {
+	return s.repo.DeleteProduct(id)
+}
+
+// GetProductBuild returns the latest build of a product's app for platform that
+// devices can install, or the build its channel points to if channel is set. It
+// returns ErrAppNotFound if the product has no app for platform.
+func (s *AppService) GetProductBuild(product *domain.Product, platform domain.Platform, channel string) (*domain.BuildInfo, error) {
+	bundleID, ok := product.Apps[platform]
+	if !ok {
+		return nil, ErrAppNotFound
+	}
+	if channel != "" {
+		return s.GetChannelBuild(bundleID, channel)
+	}
+	// Products are installed on devices, so a newer .aab doesn't hide the latest .apk
+	return s.GetLatestVersionInRange(bundleID, nil, true)
+}
+
+// productApps maps the apps with bundleIDs by platform. Apps derived from their
+// builds are stored, so that they can be linked to the product.
+func (s *AppService) productApps(bundleIDs []string) (map[domain.Platform]string, error) {
+	apps := make(map[domain.Platform]string, len(bundleIDs))
+	for _, bundleID := range bundleIDs {
+		app, err := s.repo.GetApp(bundleID)
+		if errors.Is(err, ErrAppNotFound) {
+			if app, err = s.GetApp(bundleID); err == nil {
+				err = s.repo.CreateApp(app)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := apps[app.Platform]; ok && existing != bundleID {
+			return nil, fmt.Errorf("%w: %s and %s are both %s apps", ErrPlatformTaken, existing, bundleID, app.Platform)
+		}
+		apps[app.Platform] = bundleID
+	}
+	return apps, nil
+}
+
+// CheckSigner compares the signer of an Android build with the most recent signed
+// build of the same app. If they differ the build is flagged as SignerChanged, and
+// ErrSignerChanged is returned unless allowChange is set.
+func (s *AppService) CheckSigner(info *domain.BuildInfo, allowChange bool) error {
+	if info.Signature == nil {
+		return nil
+	}
+
+	builds, err := s.repo.GetAllVersions(info.BundleID)
+	if err != nil {
+		return err
+	}
+	for _, build := range builds {
+		if build.Signature == nil {
+			continue
+		}
+		if info.Signature.SharesSigner(build.Signature) {
+			return nil
+		}
+		info.Signature.SignerChanged = true
+		if !allowChange {
+			return ErrSignerChanged
+		}
+		return nil
+	}
+
+	return nil
 }
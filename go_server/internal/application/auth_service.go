@@ -0,0 +1,145 @@
+package application
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSessionNotFound is returned for sessions that don't exist, expired or were logged out.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrUserNotFound is returned when no user with the requested ID exists.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrEmailNotAllowed is returned when a user logs in without a verified email
+	// address in one of the allowed domains.
+	ErrEmailNotAllowed = errors.New("email address is not allowed to log in")
+)
+
+// sessionPrefix starts every session cookie.
+const sessionPrefix = "ads_session_"
+
+// IdentityProvider logs users in through the OpenID Connect authorization code flow with PKCE.
+type IdentityProvider interface {
+	// AuthCodeURL returns the URL of the provider's login page. The provider redirects
+	// back to redirectURL with state and an authorization code. nonce is embedded in the
+	// ID token, and verifier is the PKCE code verifier whose challenge is sent.
+	AuthCodeURL(redirectURL, state, nonce, verifier string) string
+	// Exchange redeems an authorization code and returns the identity in its verified ID token.
+	Exchange(ctx context.Context, redirectURL, code, verifier, nonce string) (*domain.Identity, error)
+}
+
+type UserRepository interface {
+	// SaveUser creates the user with the user's issuer and subject, or updates it,
+	// and sets the ID and CreatedAt of user to the stored ones.
+	SaveUser(user *domain.User) error
+	GetUser(id string) (*domain.User, error)
+	CreateSession(session *domain.Session) error
+	// GetSessionByHash returns ErrSessionNotFound if no session has the hash.
+	GetSessionByHash(hash string) (*domain.Session, error)
+	DeleteSession(hash string) error
+	DeleteExpiredSessions(now time.Time) (int, error)
+}
+
+type AuthService struct {
+	repo           UserRepository
+	provider       IdentityProvider
+	allowedDomains []string
+	sessionTTL     time.Duration
+}
+
+// NewAuthService returns an AuthService whose sessions last sessionTTL. If
+// allowedDomains is not empty, only users with an email address in one of them can log in.
+func NewAuthService(repo UserRepository, provider IdentityProvider, allowedDomains []string, sessionTTL time.Duration) *AuthService {
+	return &AuthService{repo: repo, provider: provider, allowedDomains: allowedDomains, sessionTTL: sessionTTL}
+}
+
+// LoginURL returns the URL of the identity provider's login page.
+func (s *AuthService) LoginURL(redirectURL, state, nonce, verifier string) string {
+	return s.provider.AuthCodeURL(redirectURL, state, nonce, verifier)
+}
+
+// Login completes a login with the authorization code the identity provider redirected
+// back with. It creates or updates the user from the ID token and returns the user with
+// the secret of a new session.
+func (s *AuthService) Login(ctx context.Context, redirectURL, code, verifier, nonce string) (*domain.User, string, error) {
+	identity, err := s.provider.Exchange(ctx, redirectURL, code, verifier, nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	if !s.emailAllowed(identity) {
+		return nil, "", ErrEmailNotAllowed
+	}
+
+	now := time.Now()
+	user := &domain.User{
+		Issuer:      identity.Issuer,
+		Subject:     identity.Subject,
+		Email:       strings.ToLower(identity.Email),
+		Name:        identity.Name,
+		Groups:      identity.Groups,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	}
+	if err := s.repo.SaveUser(user); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := randomSecret(sessionPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+	session := &domain.Session{
+		Hash:      hashToken(secret),
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.sessionTTL),
+	}
+	if err := s.repo.CreateSession(session); err != nil {
+		return nil, "", err
+	}
+	return user, secret, nil
+}
+
+// emailAllowed reports whether the identity has a verified email address in one of
+// the allowed domains.
+func (s *AuthService) emailAllowed(identity *domain.Identity) bool {
+	if identity.Email == "" || !identity.EmailVerified {
+		return false
+	}
+	if len(s.allowedDomains) == 0 {
+		return true
+	}
+	_, emailDomain, _ := strings.Cut(strings.ToLower(identity.Email), "@")
+	return slices.Contains(s.allowedDomains, emailDomain)
+}
+
+// Authenticate returns the user logged in with the session secret. It returns
+// ErrSessionNotFound for unknown and expired sessions.
+func (s *AuthService) Authenticate(secret string) (*domain.User, error) {
+	session, err := s.repo.GetSessionByHash(hashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+	if session.Expired(time.Now()) {
+		return nil, ErrSessionNotFound
+	}
+	user, err := s.repo.GetUser(session.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	return user, err
+}
+
+// Logout ends the session with the given secret.
+func (s *AuthService) Logout(secret string) error {
+	return s.repo.DeleteSession(hashToken(secret))
+}
+
+// DeleteExpiredSessions removes the sessions that have expired and returns how many there were.
+func (s *AuthService) DeleteExpiredSessions() (int, error) {
+	return s.repo.DeleteExpiredSessions(time.Now())
+}
@@ -0,0 +1,99 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	// ErrBlobNotFound is returned when a blob doesn't exist.
+	ErrBlobNotFound = errors.New("blob not found")
+	// ErrBlobExists is returned by BlobStore.Create when a blob with the key exists.
+	ErrBlobExists = errors.New("blob already exists")
+)
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// BlobStore stores the binary content of builds, such as app files and icons, by key.
+// Keys are slash separated paths.
+type BlobStore interface {
+	// Put stores the contents of r under key, replacing any existing blob.
+	// size is the number of bytes r will return, or -1 if it is unknown.
+	Put(key string, r io.Reader, size int64) error
+	// Create is Put for keys that don't exist yet. If a blob with key exists it is kept
+	// and ErrBlobExists is returned, even when another replica creates it at the same
+	// time, so replicas sharing the store can use blobs as locks.
+	Create(key string, r io.Reader, size int64) error
+	// Get returns length bytes of the blob starting at offset. A negative length
+	// reads to the end of the blob.
+	Get(key string, offset, length int64) (io.ReadCloser, error)
+	Stat(key string) (*BlobInfo, error)
+	// Delete removes the blob. Deleting a blob that doesn't exist is not an error.
+	Delete(key string) error
+	// List returns the blobs whose keys start with prefix.
+	List(prefix string) ([]*BlobInfo, error)
+}
+
+// NewBlobReader returns a reader over the blob described by info that can seek,
+// so blobs can be served with http.ServeContent. Reading after a seek fetches the
+// rest of the blob from the new offset with a ranged Get.
+func NewBlobReader(store BlobStore, info *BlobInfo) io.ReadSeekCloser {
+	return &blobReader{store: store, key: info.Key, size: info.Size}
+}
+
+type blobReader struct {
+	store  BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (b *blobReader) Read(p []byte) (int, error) {
+	if b.offset >= b.size {
+		return 0, io.EOF
+	}
+	if b.body == nil {
+		body, err := b.store.Get(b.key, b.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		b.body = body
+	}
+	n, err := b.body.Read(p)
+	b.offset += int64(n)
+	return n, err
+}
+
+func (b *blobReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		offset += b.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid seek to negative offset %d", offset)
+	}
+	if offset != b.offset {
+		b.Close()
+		b.offset = offset
+	}
+	return offset, nil
+}
+
+func (b *blobReader) Close() error {
+	if b.body == nil {
+		return nil
+	}
+	err := b.body.Close()
+	b.body = nil
+	return err
+}
@@ -0,0 +1,27 @@
+package application
+
+import (
+	"app-distribution-server-go/internal/domain"
+)
+
+type DeviceRepository interface {
+	GetDevices(tester string) ([]*domain.Device, error)
+	SaveDevice(device *domain.Device) error
+}
+
+type DeviceService struct {
+	repo DeviceRepository
+}
+
+func NewDeviceService(repo DeviceRepository) *DeviceService {
+	return &DeviceService{repo: repo}
+}
+
+// GetDevices returns the devices registered by tester, or all devices if tester is empty.
+func (s *DeviceService) GetDevices(tester string) ([]*domain.Device, error) {
+	return s.repo.GetDevices(tester)
+}
+
+func (s *DeviceService) SaveDevice(device *domain.Device) error {
+	return s.repo.SaveDevice(device)
+}
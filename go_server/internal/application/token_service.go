@@ -0,0 +1,133 @@
+package application
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrTokenNotFound is returned for API tokens that don't exist or were revoked.
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrTokenExpired is returned when authenticating with an API token past its expiry.
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// tokenPrefix starts every API token secret, so leaked tokens are easy to scan for.
+const tokenPrefix = "ads_"
+
+// AdminTokenID is the ID of the token configured with ADMIN_TOKEN, which can manage
+// the other tokens and has every permission on every app.
+const AdminTokenID = "admin"
+
+type TokenRepository interface {
+	CreateToken(token *domain.APIToken) error
+	GetTokens() ([]*domain.APIToken, error)
+	// GetTokenByHash returns ErrTokenNotFound if no token has the hash.
+	GetTokenByHash(hash string) (*domain.APIToken, error)
+	// UpdateLastUsed sets when the token was last used.
+	UpdateLastUsed(id string, usedAt time.Time) error
+	// DeleteToken returns ErrTokenNotFound if the token doesn't exist.
+	DeleteToken(id string) error
+}
+
+type TokenService struct {
+	repo       TokenRepository
+	adminToken string
+}
+
+// NewTokenService returns a TokenService. Requests authenticated with adminToken
+// can manage tokens; if it is empty, no request can.
+func NewTokenService(repo TokenRepository, adminToken string) *TokenService {
+	return &TokenService{repo: repo, adminToken: adminToken}
+}
+
+// CreateToken creates a token and returns it with its secret, which is not stored
+// and cannot be retrieved again.
+func (s *TokenService) CreateToken(name string, bundleIDs []string, permissions []domain.Permission, expiresAt *time.Time) (*domain.APIToken, string, error) {
+	secret, err := randomSecret(tokenPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := &domain.APIToken{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Prefix:      secret[:len(tokenPrefix)+6],
+		Hash:        hashToken(secret),
+		BundleIDs:   bundleIDs,
+		Permissions: permissions,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   expiresAt,
+	}
+	if err := s.repo.CreateToken(token); err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+// GetTokens returns every token, oldest first.
+func (s *TokenService) GetTokens() ([]*domain.APIToken, error) {
+	return s.repo.GetTokens()
+}
+
+// RevokeToken deletes a token, so it can no longer be used.
+func (s *TokenService) RevokeToken(id string) error {
+	return s.repo.DeleteToken(id)
+}
+
+// Authenticate returns the token with the given secret and records that it was used.
+// It returns ErrTokenNotFound for unknown secrets and ErrTokenExpired for expired tokens.
+func (s *TokenService) Authenticate(secret string) (*domain.APIToken, error) {
+	if s.adminToken != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(s.adminToken)) == 1 {
+		return &domain.APIToken{
+			ID:          AdminTokenID,
+			Name:        AdminTokenID,
+			BundleIDs:   []string{domain.AllBundleIDs},
+			Permissions: domain.Permissions,
+		}, nil
+	}
+
+	// Looking the token up by its hash keeps the comparison from leaking the secret
+	token, err := s.repo.GetTokenByHash(hashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if token.Expired(now) {
+		return nil, ErrTokenExpired
+	}
+	if err := s.repo.UpdateLastUsed(token.ID, now); err != nil {
+		return nil, err
+	}
+	token.LastUsedAt = &now
+	return token, nil
+}
+
+// IsAdmin reports whether token is the ADMIN_TOKEN.
+func (s *TokenService) IsAdmin(token *domain.APIToken) bool {
+	return token.ID == AdminTokenID
+}
+
+// randomSecret returns prefix followed by 256 random bits.
+func randomSecret(prefix string) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// hashToken returns the hex encoded SHA-256 digest of a secret. Secrets are random,
+// so they don't need a slow password hash.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,117 @@
+package application
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrUploadNotFound is returned for resumable uploads that don't exist or were terminated.
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadExpired is returned for resumable uploads that have not been resumed in time.
+	ErrUploadExpired = errors.New("upload expired")
+	// ErrUploadOffsetMismatch is returned when a chunk doesn't start at the upload's current offset.
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+	// ErrUploadLocked is returned while another request, possibly on another replica,
+	// is writing to or saving the same upload.
+	ErrUploadLocked = errors.New("upload is locked by another request")
+)
+
+type ResumableUploadRepository interface {
+	CreateUpload(upload *domain.ResumableUpload) error
+	GetUpload(id string) (*domain.ResumableUpload, error)
+	// WriteChunk appends chunk to the upload at offset and moves its expiration to
+	// expiresAt. The upload is returned with the bytes that were written even if
+	// reading the chunk fails partway through.
+	WriteChunk(id string, offset int64, chunk io.Reader, expiresAt time.Time) (*domain.ResumableUpload, error)
+	// StageUpload returns the data of a finished upload as a staged app file.
+	StageUpload(id string) (*StagedUpload, error)
+	UpdateUpload(upload *domain.ResumableUpload) error
+	// LockUpload keeps other requests on every replica from writing to or deleting the
+	// upload until UnlockUpload, or returns ErrUploadLocked if another request holds it.
+	LockUpload(id string) error
+	UnlockUpload(id string) error
+	DeleteUpload(id string) error
+	DeleteExpiredUploads(now time.Time) (int, error)
+}
+
+type UploadService struct {
+	repo ResumableUploadRepository
+	ttl  time.Duration
+}
+
+// NewUploadService returns an UploadService whose uploads expire when they
+// haven't received data for ttl.
+func NewUploadService(repo ResumableUploadRepository, ttl time.Duration) *UploadService {
+	return &UploadService{repo: repo, ttl: ttl}
+}
+
+// CreateUpload starts a resumable upload of length bytes for the API token with tokenID.
+func (s *UploadService) CreateUpload(length int64, metadata map[string]string, tokenID string) (*domain.ResumableUpload, error) {
+	now := time.Now()
+	upload := &domain.ResumableUpload{
+		ID:        uuid.New().String(),
+		Length:    length,
+		Metadata:  metadata,
+		TokenID:   tokenID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+	if err := s.repo.CreateUpload(upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetUpload returns the upload with the given ID, or ErrUploadExpired if it has expired.
+func (s *UploadService) GetUpload(id string) (*domain.ResumableUpload, error) {
+	upload, err := s.repo.GetUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	return upload, nil
+}
+
+// WriteChunk appends chunk to the upload at offset, which must be its current offset.
+func (s *UploadService) WriteChunk(id string, offset int64, chunk io.Reader) (*domain.ResumableUpload, error) {
+	if _, err := s.GetUpload(id); err != nil {
+		return nil, err
+	}
+	return s.repo.WriteChunk(id, offset, chunk, time.Now().Add(s.ttl))
+}
+
+func (s *UploadService) StageUpload(id string) (*StagedUpload, error) {
+	return s.repo.StageUpload(id)
+}
+
+// CompleteUpload records the build a finished upload was saved as.
+func (s *UploadService) CompleteUpload(upload *domain.ResumableUpload, build *domain.BuildInfo) error {
+	upload.Build = build
+	return s.repo.UpdateUpload(upload)
+}
+
+// LockUpload keeps other requests from writing to, saving or deleting the upload until
+// UnlockUpload is called.
+func (s *UploadService) LockUpload(id string) error {
+	return s.repo.LockUpload(id)
+}
+
+func (s *UploadService) UnlockUpload(id string) error {
+	return s.repo.UnlockUpload(id)
+}
+
+func (s *UploadService) DeleteUpload(id string) error {
+	return s.repo.DeleteUpload(id)
+}
+
+// DeleteExpiredUploads removes the uploads that have expired and returns how many there were.
+func (s *UploadService) DeleteExpiredUploads() (int, error) {
+	return s.repo.DeleteExpiredUploads(time.Now())
+}
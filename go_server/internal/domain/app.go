@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"regexp"
+	"time"
+)
+
+// bundleIDRegex matches reverse-DNS identifiers such as com.example.app, which is
+// the form of iOS bundle IDs and Android package names.
+var bundleIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)+$`)
+
+// ValidBundleID reports whether id is a reverse-DNS bundle ID. Bundle IDs become
+// part of storage paths, so anything else is rejected.
+func ValidBundleID(id string) bool {
+	return bundleIDRegex.MatchString(id)
+}
+
+// App represents an application whose builds are distributed. Its metadata is
+// edited independently of the builds, which only provide the defaults when the
+// first build of an app is uploaded.
+type App struct {
+	BundleID    string   `json:"bundle_id"`
+	Platform    Platform `json:"platform"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Icon        string   `json:"icon,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	// ProductID is the product the app belongs to, if any. It is changed through the product.
+	ProductID string `json:"product_id,omitempty"`
+	// LatestBy is the order that decides which build is the latest. Empty means by upload time.
+	LatestBy  VersionOrder `json:"latest_by,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// NewAppFromBuild returns the app a build belongs to, for builds of apps that
+// haven't been created yet.
+func NewAppFromBuild(build *BuildInfo) *App {
+	return &App{
+		BundleID:    build.BundleID,
+		Platform:    build.Platform,
+		Name:        build.Title,
+		Description: build.Description,
+		Icon:        build.Icon,
+		CreatedAt:   build.CreatedAt,
+	}
+}
+
+// AppSummary is an app together with its newest build, as listed in the catalog.
+type AppSummary struct {
+	App
+	LatestBuild *BuildInfo `json:"latest_build,omitempty"`
+}
@@ -12,6 +12,23 @@ const (
 	Android Platform = "android"
 )
 
+// ArtifactType represents the kind of file a build was uploaded as.
+type ArtifactType string
+
+const (
+	// IPA is an iOS application archive.
+	IPA ArtifactType = "ipa"
+	// APK is an Android application package.
+	APK ArtifactType = "apk"
+	// AAB is an Android App Bundle, which Google Play turns into APKs. It cannot be installed directly.
+	AAB ArtifactType = "aab"
+)
+
+// Installable reports whether a device can install the artifact directly.
+func (t ArtifactType) Installable() bool {
+	return t != AAB
+}
+
 // BuildInfo represents the metadata for a single build of an application.
 type BuildInfo struct {
 	UploadID    string    `json:"upload_id"`
@@ -22,6 +39,132 @@ type BuildInfo struct {
 	Icon        string    `json:"icon,omitempty"`
 	Description string    `json:"description,omitempty"`
 	FileSize    int64     `json:"file_size"`
+	SHA256      string    `json:"sha256,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	Platform    Platform  `json:"platform"`
+	// ArtifactType is empty for builds stored before artifact types were recorded; use Artifact().
+	ArtifactType ArtifactType `json:"artifact_type"`
+	// ReleaseNotes describe what changed in the build, as Markdown.
+	ReleaseNotes string `json:"release_notes,omitempty"`
+	// ArchivedAt is set for archived builds, which are left out of listings but can
+	// still be downloaded by direct link.
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	// DeletedAt is set for deleted builds, which are purged with their files once the
+	// grace period has passed. Until then they can be restored.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Provenance is where the build came from. It is nil for builds uploaded without it.
+	Provenance *Provenance `json:"provenance,omitempty"`
+
+	Provisioning *ProvisioningProfile `json:"provisioning,omitempty"`
+	Android      *AndroidMetadata     `json:"android,omitempty"`
+	Signature    *APKSignature        `json:"signature,omitempty"`
+}
+
+// Provenance records the source and CI pipeline a build was made from, so bug
+// reports on a build can be traced back to a commit.
+type Provenance struct {
+	// Commit is the full or abbreviated git commit SHA, in lowercase.
+	Commit        string `json:"commit,omitempty"`
+	Branch        string `json:"branch,omitempty"`
+	Tag           string `json:"tag,omitempty"`
+	RepositoryURL string `json:"repository_url,omitempty"`
+	// CIProvider is the CI service that made the build, e.g. github-actions or bitrise.
+	CIProvider  string `json:"ci_provider,omitempty"`
+	PipelineURL string `json:"pipeline_url,omitempty"`
+	// Variant is the build variant or flavor, e.g. stagingDebug.
+	Variant string `json:"variant,omitempty"`
+}
+
+// IsZero reports whether no provenance field is set.
+func (p Provenance) IsZero() bool {
+	return p == Provenance{}
+}
+
+// AndroidMetadata represents the manifest details of an Android build.
+type AndroidMetadata struct {
+	VersionCode      int32    `json:"version_code"`
+	MinSDKVersion    int32    `json:"min_sdk_version,omitempty"`
+	TargetSDKVersion int32    `json:"target_sdk_version,omitempty"`
+	Permissions      []string `json:"permissions,omitempty"`
+	ABIs             []string `json:"abis,omitempty"`
+	ScreenDensities  []string `json:"screen_densities,omitempty"`
+	Debuggable       bool     `json:"debuggable"`
+}
+
+// Artifact returns the artifact type of the build, deriving it from the platform
+// for builds stored before artifact types were recorded.
+func (b *BuildInfo) Artifact() ArtifactType {
+	if b.ArtifactType != "" {
+		return b.ArtifactType
+	}
+	if b.Platform == Android {
+		return APK
+	}
+	return IPA
+}
+
+// Listed reports whether the build is shown in listings, which leave out archived and deleted builds.
+func (b *BuildInfo) Listed() bool {
+	return b.ArchivedAt == nil && b.DeletedAt == nil
+}
+
+// FileName returns the name the build's binary is stored and downloaded as.
+func (b *BuildInfo) FileName() string {
+	return "app." + string(b.Artifact())
+}
+
+// DistributionType is the kind of distribution an iOS provisioning profile allows.
+type DistributionType string
+
+const (
+	// AdHoc profiles can only be installed on the provisioned devices.
+	AdHoc DistributionType = "ad-hoc"
+	// Enterprise profiles can be installed on any device.
+	Enterprise DistributionType = "enterprise"
+	// Development profiles can be installed on the provisioned devices and debugged.
+	Development DistributionType = "development"
+	// AppStore profiles can only be distributed through the App Store or TestFlight.
+	AppStore DistributionType = "app-store"
+)
+
+// ProvisioningProfile represents the embedded.mobileprovision of an iOS build.
+type ProvisioningProfile struct {
+	Name               string           `json:"name"`
+	TeamID             string           `json:"team_id"`
+	ProvisionedDevices []string         `json:"provisioned_devices,omitempty"`
+	ExpirationDate     time.Time        `json:"expiration_date"`
+	DistributionType   DistributionType `json:"distribution_type"`
+}
+
+// APKSignature represents the verified signing state of an Android build.
+type APKSignature struct {
+	// Schemes lists the signature schemes that verified, e.g. "v1", "v2", "v3".
+	Schemes      []string            `json:"schemes"`
+	Certificates []SignerCertificate `json:"certificates"`
+	// DebugSigned is set when the build is signed with an Android SDK debug key.
+	DebugSigned bool `json:"debug_signed"`
+	// SignerChanged is set when the signer differs from earlier builds of the app,
+	// so the build cannot be installed as an update.
+	SignerChanged bool `json:"signer_changed"`
+}
+
+// SignerCertificate represents a certificate an APK is signed with.
+type SignerCertificate struct {
+	SHA256    string    `json:"sha256"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// SharesSigner reports whether both signatures have a certificate in common.
+func (s *APKSignature) SharesSigner(other *APKSignature) bool {
+	for _, a := range s.Certificates {
+		for _, b := range other.Certificates {
+			if a.SHA256 == b.SHA256 {
+				return true
+			}
+		}
+	}
+	return false
 }
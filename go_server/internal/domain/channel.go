@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+// Channel is a named distribution track of an app, such as beta or production,
+// that points to the build testers on that track should install.
+type Channel struct {
+	BundleID  string    `json:"bundle_id"`
+	Name      string    `json:"name"`
+	UploadID  string    `json:"upload_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+
+	Build *BuildInfo `json:"build,omitempty"`
+}
+
+// Promotion records a build being put on a channel, either directly or by
+// promoting it from another channel.
+type Promotion struct {
+	ID          string    `json:"id"`
+	BundleID    string    `json:"bundle_id"`
+	Channel     string    `json:"channel"`
+	UploadID    string    `json:"upload_id"`
+	FromChannel string    `json:"from_channel,omitempty"`
+	PromotedBy  string    `json:"promoted_by,omitempty"`
+	PromotedAt  time.Time `json:"promoted_at"`
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// Device represents an iOS device registered by a tester through profile enrollment.
+type Device struct {
+	UDID      string    `json:"udid"`
+	Tester    string    `json:"tester"`
+	Product   string    `json:"product"`
+	Version   string    `json:"version"`
+	Serial    string    `json:"serial,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// Feedback is a comment a tester left on a build, such as a bug report.
+type Feedback struct {
+	ID       string `json:"id"`
+	BundleID string `json:"bundle_id"`
+	UploadID string `json:"upload_id"`
+	// Author is the email of the user or the name of the API token that left it.
+	Author    string    `json:"author,omitempty"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
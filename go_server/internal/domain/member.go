@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// Role is what a member can do with an app. Every role has the permissions of the
+// roles before it in Roles.
+type Role string
+
+const (
+	// RoleViewer can list and download builds.
+	RoleViewer Role = "viewer"
+	// RoleTester can also give feedback on builds.
+	RoleTester Role = "tester"
+	// RoleDeveloper can also upload and edit builds.
+	RoleDeveloper Role = "developer"
+	// RoleManager can also delete and promote builds and change the members of the app.
+	RoleManager Role = "manager"
+)
+
+// Roles lists the roles from the fewest to the most permissions.
+var Roles = []Role{RoleViewer, RoleTester, RoleDeveloper, RoleManager}
+
+// rolePermissions are the permissions each role adds to the roles before it.
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:    {PermissionView},
+	RoleTester:    {PermissionFeedback},
+	RoleDeveloper: {PermissionUpload},
+	RoleManager:   {PermissionDelete, PermissionPromote, PermissionManageMembers},
+}
+
+// Valid reports whether the role is known.
+func (r Role) Valid() bool {
+	return slices.Contains(Roles, r)
+}
+
+// Allows reports whether the role grants permission. The empty role grants nothing.
+func (r Role) Allows(permission Permission) bool {
+	for _, role := range Roles[:r.rank()+1] {
+		if slices.Contains(rolePermissions[role], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Includes reports whether the role has every permission of other.
+func (r Role) Includes(other Role) bool {
+	return r.rank() >= other.rank()
+}
+
+// rank returns the position of the role in Roles, or -1 for unknown roles.
+func (r Role) rank() int {
+	return slices.Index(Roles, r)
+}
+
+// Member gives a user, or every user in a group, a role on an app. Members are kept
+// by bundle ID, so they can be added before the first build of an app is uploaded.
+type Member struct {
+	BundleID string `json:"bundle_id"`
+	// Exactly one of Email and Group is set. Email is in lowercase, and groups are
+	// matched against the groups claim of the users' ID tokens.
+	Email     string    `json:"email,omitempty"`
+	Group     string    `json:"group,omitempty"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// Product groups the apps that ship the same product on different platforms,
+// such as com.acme.app on Android and com.acme.ios on iOS.
+type Product struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Apps maps each platform to the bundle ID of the product's app on it.
+	Apps      map[Platform]string `json:"apps"`
+	CreatedAt time.Time           `json:"created_at"`
+}
@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// Permission is an action that a role or an API token can allow on an app.
+type Permission string
+
+const (
+	// PermissionView allows listing and downloading builds.
+	PermissionView Permission = "view"
+	// PermissionFeedback allows giving feedback on builds.
+	PermissionFeedback Permission = "feedback"
+	// PermissionUpload allows uploading builds.
+	PermissionUpload Permission = "upload"
+	// PermissionDelete allows deleting and restoring builds, and deleting apps.
+	PermissionDelete Permission = "delete"
+	// PermissionPromote allows promoting builds to release channels.
+	PermissionPromote Permission = "promote"
+	// PermissionManageMembers allows changing who has a role on an app.
+	PermissionManageMembers Permission = "manage_members"
+)
+
+// Permissions lists every permission a token can be given.
+var Permissions = []Permission{PermissionFeedback, PermissionUpload, PermissionDelete, PermissionPromote}
+
+// Valid reports whether a token can be given the permission.
+func (p Permission) Valid() bool {
+	return slices.Contains(Permissions, p)
+}
+
+// AllBundleIDs scopes a token to every app, including ones created later.
+const AllBundleIDs = "*"
+
+// APIToken is a credential that CI pipelines and scripts use to change the builds of
+// some apps. Only a hash of the secret is stored, so it is shown once on creation.
+type APIToken struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Prefix is the start of the secret, so a token can be recognized in listings.
+	Prefix string `json:"prefix"`
+	// Hash is the hex encoded SHA-256 digest of the secret.
+	Hash string `json:"-"`
+	// BundleIDs are the apps the token can be used for, or AllBundleIDs.
+	BundleIDs   []string     `json:"bundle_ids"`
+	Permissions []Permission `json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+	// ExpiresAt is nil for tokens that don't expire.
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Expired reports whether the token has expired at now.
+func (t *APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// HasPermission reports whether the token grants permission on any app.
+func (t *APIToken) HasPermission(permission Permission) bool {
+	return slices.Contains(t.Permissions, permission)
+}
+
+// Allows reports whether the token grants permission on the app with bundleID. Every
+// token can view the apps it can be used for.
+func (t *APIToken) Allows(bundleID string, permission Permission) bool {
+	if permission != PermissionView && !t.HasPermission(permission) {
+		return false
+	}
+	return slices.Contains(t.BundleIDs, AllBundleIDs) || slices.Contains(t.BundleIDs, bundleID)
+}
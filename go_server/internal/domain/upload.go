@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// ResumableUpload represents an app file that is uploaded in chunks through the tus protocol.
+type ResumableUpload struct {
+	ID     string `json:"id"`
+	Length int64  `json:"length"`
+	Offset int64  `json:"offset"`
+	// Metadata holds the Upload-Metadata sent on creation, such as the file name.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// TokenID is the API token that created the upload. Only it can resume the upload.
+	TokenID   string    `json:"token_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Build is set once the upload has finished and been saved as a build.
+	Build *BuildInfo `json:"build,omitempty"`
+}
+
+// Finished reports whether all bytes of the upload have been received.
+func (u *ResumableUpload) Finished() bool {
+	return u.Offset == u.Length
+}
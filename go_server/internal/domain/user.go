@@ -0,0 +1,42 @@
+package domain
+
+import "time"
+
+// User is a person who logged in through the OpenID Connect provider. Users are
+// created on their first login and updated from the ID token on every login.
+type User struct {
+	ID string `json:"id"`
+	// Issuer and Subject identify the user at the OpenID Connect provider.
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+	// Email is in lowercase.
+	Email       string    `json:"email"`
+	Name        string    `json:"name,omitempty"`
+	Groups      []string  `json:"groups,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// Identity is what the OpenID Connect provider asserts about a user who logged in.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+// Session keeps a user logged in. Only a hash of the session cookie is stored.
+type Session struct {
+	// Hash is the hex encoded SHA-256 digest of the session cookie.
+	Hash      string    `json:"hash"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the session has expired at now.
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
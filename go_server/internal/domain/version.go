@@ -0,0 +1,286 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VersionOrder is how the builds of an app are ordered, and so which build is its latest.
+type VersionOrder string
+
+const (
+	// OrderByUploadTime puts the most recently uploaded build first. It is the default.
+	OrderByUploadTime VersionOrder = "upload_time"
+	// OrderByVersion puts the build with the highest version and build number first,
+	// so that a hotfix uploaded for an older version doesn't become the latest build.
+	OrderByVersion VersionOrder = "version"
+)
+
+// Valid reports whether the order is known. The empty order is valid and means the default.
+func (o VersionOrder) Valid() bool {
+	return o == "" || o == OrderByUploadTime || o == OrderByVersion
+}
+
+// CompareVersions compares two version strings and returns -1, 0 or 1. It understands
+// semantic versions (1.2.3-beta.1+build.5), dotted versions of any length such as iOS
+// CFBundleVersion (1.2.3.4) and plain integers such as Android versionCode. Missing
+// components count as 0, so 2.3 equals 2.3.0, and a pre-release sorts before its release.
+// Build metadata after a '+' is ignored.
+func CompareVersions(a, b string) int {
+	aRelease, aPre := splitVersion(a)
+	bRelease, bPre := splitVersion(b)
+
+	aParts := strings.Split(aRelease, ".")
+	bParts := strings.Split(bRelease, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aPart, bPart := "0", "0"
+		if i < len(aParts) && aParts[i] != "" {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) && bParts[i] != "" {
+			bPart = bParts[i]
+		}
+		if c := compareIdentifiers(aPart, bPart); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	aIDs := strings.Split(aPre, ".")
+	bIDs := strings.Split(bPre, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		if c := compareIdentifiers(aIDs[i], bIDs[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(aIDs), len(bIDs))
+}
+
+// splitVersion returns the release and pre-release parts of a version, dropping
+// a leading 'v' and any build metadata.
+func splitVersion(version string) (release, preRelease string) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexByte(version, '+'); i >= 0 {
+		version = version[:i]
+	}
+	if i := strings.IndexByte(version, '-'); i >= 0 {
+		return version[:i], version[i+1:]
+	}
+	return version, ""
+}
+
+// compareIdentifiers compares numeric identifiers numerically and others lexically.
+// As in semver, numeric identifiers sort before alphanumeric ones.
+func compareIdentifiers(a, b string) int {
+	aNum, aErr := strconv.ParseUint(a, 10, 64)
+	bNum, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		if aNum < bNum {
+			return -1
+		}
+		if aNum > bNum {
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// CompareBuilds compares two builds of an app by version, then by build number
+// (the versionCode on Android, CFBundleVersion on iOS), then by upload time.
+func CompareBuilds(a, b *BuildInfo) int {
+	if c := CompareVersions(a.Version, b.Version); c != 0 {
+		return c
+	}
+	if c := CompareVersions(a.BuildNumber, b.BuildNumber); c != 0 {
+		return c
+	}
+	return a.CreatedAt.Compare(b.CreatedAt)
+}
+
+// SortBuilds sorts builds newest first in the given order.
+func SortBuilds(builds []*BuildInfo, order VersionOrder) {
+	sort.SliceStable(builds, func(i, j int) bool {
+		if order == OrderByVersion {
+			return CompareBuilds(builds[i], builds[j]) > 0
+		}
+		return builds[i].CreatedAt.After(builds[j].CreatedAt)
+	})
+}
+
+// VersionRange is a set of constraints that versions are matched against, such as
+// ">=2.3 <3". The zero VersionRange matches every version.
+type VersionRange []versionConstraint
+
+type versionConstraint struct {
+	op      string
+	version string
+}
+
+// versionOperators are the supported comparison operators, longest first so
+// that ">=" isn't read as ">".
+var versionOperators = []string{">=", "<=", "!=", "==", ">", "<", "=", "^", "~"}
+
+// rangeVersionRegex matches the versions a range can compare against: a number,
+// optionally followed by more dot separated components, a pre-release and build metadata.
+var rangeVersionRegex = regexp.MustCompile(`^v?[0-9]+(\.[0-9A-Za-z]+)*(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// ParseVersionRange parses space separated constraints that must all hold, each an
+// operator (=, !=, >, >=, < or <=) followed by a version. A version without an
+// operator must match exactly. As in npm, ^1.2.3 allows changes that keep the first
+// non-zero component, ~1.2.3 allows patch changes, and x or * in a version such as
+// 1.2.x matches any value of that component.
+func ParseVersionRange(s string) (VersionRange, error) {
+	var versionRange VersionRange
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		op, version := "=", fields[i]
+		for _, candidate := range versionOperators {
+			if strings.HasPrefix(fields[i], candidate) {
+				op = candidate
+				version = strings.TrimPrefix(fields[i], candidate)
+				break
+			}
+		}
+		// Allow a space between the operator and the version, as in ">= 2.3"
+		if version == "" && i+1 < len(fields) {
+			i++
+			version = fields[i]
+		}
+		if version == "" {
+			return nil, fmt.Errorf("missing version after %q", op)
+		}
+		if op == "==" {
+			op = "="
+		}
+		constraints, err := parseConstraint(op, version)
+		if err != nil {
+			return nil, err
+		}
+		versionRange = append(versionRange, constraints...)
+	}
+	return versionRange, nil
+}
+
+// parseConstraint returns the constraints an operator and version stand for. Caret,
+// tilde and wildcard versions become a lower and an upper bound.
+func parseConstraint(op, version string) ([]versionConstraint, error) {
+	release, preRelease := splitVersion(version)
+	parts := strings.Split(release, ".")
+	wildcard := len(parts)
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			wildcard = i
+			break
+		}
+	}
+
+	if wildcard == len(parts) && op != "^" && op != "~" {
+		if !rangeVersionRegex.MatchString(version) {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		return []versionConstraint{{op: op, version: version}}, nil
+	}
+	if op != "=" && op != "^" && op != "~" {
+		return nil, fmt.Errorf("wildcard version %q can only follow =, ^ or ~", version)
+	}
+
+	numbers := make([]uint64, wildcard)
+	for i, part := range parts[:wildcard] {
+		number, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		numbers[i] = number
+	}
+	if len(numbers) == 0 {
+		// x and ^* match every version
+		return nil, nil
+	}
+
+	// Versions may change below the component at index fixed
+	fixed := len(numbers) - 1
+	switch op {
+	case "^":
+		for i, number := range numbers {
+			if number != 0 {
+				fixed = i
+				break
+			}
+		}
+	case "~":
+		fixed = min(1, fixed)
+	}
+
+	lower := joinNumbers(numbers)
+	if wildcard == len(parts) && preRelease != "" {
+		lower += "-" + preRelease
+	}
+	upper := append([]uint64(nil), numbers[:fixed+1]...)
+	upper[fixed]++
+	// The -0 pre-release sorts before any other, so pre-releases of the upper bound
+	// are out of the range too
+	return []versionConstraint{
+		{op: ">=", version: lower},
+		{op: "<", version: joinNumbers(upper) + "-0"},
+	}, nil
+}
+
+func joinNumbers(numbers []uint64) string {
+	parts := make([]string, len(numbers))
+	for i, number := range numbers {
+		parts[i] = strconv.FormatUint(number, 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Contains reports whether version satisfies every constraint of the range.
+func (r VersionRange) Contains(version string) bool {
+	for _, constraint := range r {
+		c := CompareVersions(version, constraint.version)
+		var ok bool
+		switch constraint.op {
+		case "=":
+			ok = c == 0
+		case "!=":
+			ok = c != 0
+		case ">":
+			ok = c > 0
+		case ">=":
+			ok = c >= 0
+		case "<":
+			ok = c < 0
+		case "<=":
+			ok = c <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
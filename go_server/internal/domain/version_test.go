@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.1", "1.0.0", 1},
+		{"1.2.10", "1.2.9", 1},
+		{"2.3", "2.3.0", 0},
+		{"2.3.0.1", "2.3", 1},
+		{"v1.2.3", "1.2.3", 0},
+		{"10", "9", 1},
+		{"321", "1000", -1},
+		// Pre-releases sort before their release, and numeric identifiers before alphanumeric ones
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-rc.1", "1.0.0-beta.11", 1},
+		{"1.0.0-0", "1.0.0-alpha", -1},
+		// Build metadata is ignored
+		{"1.0.0+build.5", "1.0.0+build.7", 0},
+		{"1.0.0-beta+exp.sha.5114f85", "1.0.0-beta", 0},
+		// Components that aren't numbers compare lexically, after numbers
+		{"1.a", "1.b", -1},
+		{"1.a", "1.5", 1},
+		{"", "0", 0},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestVersionRange(t *testing.T) {
+	tests := []struct {
+		versionRange string
+		in           []string
+		out          []string
+	}{
+		{"", []string{"0", "1.0.0", "2.0.0-beta"}, nil},
+		{"1.2.3", []string{"1.2.3", "v1.2.3", "1.2.3.0", "1.2.3+build.5"}, []string{"1.2.4", "1.2.3-beta"}},
+		{"== 1.2", []string{"1.2.0"}, []string{"1.2.1"}},
+		{"!=1.2", []string{"1.3"}, []string{"1.2.0"}},
+		{">=2.3 <3", []string{"2.3", "2.9.9", "3.0.0-beta"}, []string{"2.2.9", "3", "3.0.1"}},
+		{">= 2.3 < 3", []string{"2.3.1"}, []string{"3.1"}},
+		{">1.0.0-beta", []string{"1.0.0-rc.1", "1.0.0"}, []string{"1.0.0-alpha", "1.0.0-beta"}},
+		{"<=42", []string{"42", "7"}, []string{"43"}},
+		// Caret ranges keep the first non-zero component
+		{"^1.2.3", []string{"1.2.3", "1.9.0", "1.99.99"}, []string{"1.2.2", "2.0.0", "2.0.0-beta", "1.2.3-beta"}},
+		{"^1.2.3-beta.2", []string{"1.2.3-beta.2", "1.2.3-rc.1", "1.2.3", "1.5.0"}, []string{"1.2.3-beta.1", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2", "1.0.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4", "0.1.0"}},
+		{"^0.x", []string{"0.0.1", "0.9.9"}, []string{"1.0.0", "1.0.0-beta"}},
+		{"^0.0.x", []string{"0.0.0", "0.0.9"}, []string{"0.1.0"}},
+		{"^0", []string{"0.5.0"}, []string{"1.0.0"}},
+		{"^1.2", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0"}},
+		{"^ 2", []string{"2.0.0", "2.5"}, []string{"3.0.0"}},
+		// Tilde ranges allow patch changes
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0", "1.2.2"}},
+		{"~1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+		{"~1", []string{"1.0.0", "1.9.9"}, []string{"2.0.0"}},
+		{"~0.2.x", []string{"0.2.0", "0.2.9"}, []string{"0.3.0"}},
+		// Wildcards match any value of their component
+		{"1.2.x", []string{"1.2.0", "1.2.99"}, []string{"1.3.0", "1.1.9"}},
+		{"1.X", []string{"1.0", "1.9.9"}, []string{"2.0", "0.9"}},
+		{"1.*", []string{"1.2.3.4"}, []string{"2.0.0"}},
+		{"*", []string{"0", "99.0.0", "1.0.0-beta"}, nil},
+		{"x <2", []string{"1.5"}, []string{"2.0"}},
+	}
+	for _, tt := range tests {
+		versionRange, err := ParseVersionRange(tt.versionRange)
+		if err != nil {
+			t.Errorf("ParseVersionRange(%q) error = %v", tt.versionRange, err)
+			continue
+		}
+		for _, version := range tt.in {
+			if !versionRange.Contains(version) {
+				t.Errorf("ParseVersionRange(%q).Contains(%q) = false, want true", tt.versionRange, version)
+			}
+		}
+		for _, version := range tt.out {
+			if versionRange.Contains(version) {
+				t.Errorf("ParseVersionRange(%q).Contains(%q) = true, want false", tt.versionRange, version)
+			}
+		}
+	}
+}
+
+func TestParseVersionRangeInvalid(t *testing.T) {
+	for _, versionRange := range []string{
+		">=",
+		"<3 >=",
+		"^",
+		"~",
+		">=abc",
+		"latest",
+		"1..2",
+		"^abc",
+		"^1.a",
+		"~v",
+		">=1.x",
+		"!=*",
+		"<1.2.*",
+		"1.2.3-",
+		"1.2.3+",
+	} {
+		if _, err := ParseVersionRange(versionRange); err == nil {
+			t.Errorf("ParseVersionRange(%q) error = nil, want an error", versionRange)
+		}
+	}
+}
+
+func TestSortBuilds(t *testing.T) {
+	now := time.Now()
+	builds := []*BuildInfo{
+		{UploadID: "hotfix", Version: "1.9.1", BuildNumber: "30", CreatedAt: now},
+		{UploadID: "release", Version: "2.0.0", BuildNumber: "20", CreatedAt: now.Add(-time.Hour)},
+		{UploadID: "beta", Version: "2.0.0-beta.2", BuildNumber: "10", CreatedAt: now.Add(-2 * time.Hour)},
+		{UploadID: "rebuild", Version: "2.0.0", BuildNumber: "21", CreatedAt: now.Add(-3 * time.Hour)},
+	}
+	tests := []struct {
+		order VersionOrder
+		want  []string
+	}{
+		{OrderByUploadTime, []string{"hotfix", "release", "beta", "rebuild"}},
+		{"", []string{"hotfix", "release", "beta", "rebuild"}},
+		{OrderByVersion, []string{"rebuild", "release", "beta", "hotfix"}},
+	}
+	for _, tt := range tests {
+		sorted := append([]*BuildInfo(nil), builds...)
+		SortBuilds(sorted, tt.order)
+		for i, build := range sorted {
+			if build.UploadID != tt.want[i] {
+				t.Errorf("SortBuilds(%q) put %s at %d, want %s", tt.order, build.UploadID, i, tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"archive/zip"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const androidNamespace = "http://schemas.android.com/apk/res/android"
+
+// ParseAAB opens the Android App Bundle at filePath and reads the application metadata
+// from base/manifest/AndroidManifest.xml, which bundles store in aapt2's protobuf format.
+// Resource references such as the app label are resolved through base/resources.pb.
+func ParseAAB(filePath string) (*APKInfo, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open aab file: %w", err)
+	}
+	defer archive.Close()
+
+	manifestData, err := readZipFile(&archive.Reader, "base/manifest/AndroidManifest.xml")
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseXMLNode(manifestData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode AndroidManifest.xml: %w", err)
+	}
+	if root == nil || root.name != "manifest" {
+		return nil, fmt.Errorf("AndroidManifest.xml has no manifest element")
+	}
+
+	// The resource table is only needed for references, so a missing one isn't fatal
+	var resources *resourceTable
+	if data, err := readZipFile(&archive.Reader, "base/resources.pb"); err == nil {
+		if resources, err = parseResourceTable(data); err != nil {
+			fmt.Printf("Error parsing resources.pb: %v\n", err)
+		}
+	}
+
+	metadata := &domain.AndroidMetadata{}
+	metadata.VersionCode = root.attr(androidNamespace, "versionCode").int32()
+
+	var title string
+	for _, child := range root.children {
+		switch child.name {
+		case "uses-sdk":
+			metadata.MinSDKVersion = child.attr(androidNamespace, "minSdkVersion").int32()
+			metadata.TargetSDKVersion = child.attr(androidNamespace, "targetSdkVersion").int32()
+		case "uses-permission":
+			if name := child.attr(androidNamespace, "name").value; name != "" {
+				metadata.Permissions = append(metadata.Permissions, name)
+			}
+		case "application":
+			metadata.Debuggable = child.attr(androidNamespace, "debuggable").bool()
+			title = resources.resolveString(child.attr(androidNamespace, "label"))
+		}
+	}
+	if title == "" {
+		title = "(unknown)"
+	}
+
+	version := resources.resolveString(root.attr(androidNamespace, "versionName"))
+	if version == "" {
+		version = "(unknown)"
+	}
+
+	metadata.ABIs, metadata.ScreenDensities = scanAABLayout(&archive.Reader)
+
+	return &APKInfo{
+		BundleID:    root.attr("", "package").value,
+		Version:     version,
+		BuildNumber: strconv.Itoa(int(metadata.VersionCode)),
+		Title:       title,
+		Android:     metadata,
+	}, nil
+}
+
+// ExtractAABIcon returns the launcher icon of the Android App Bundle at filePath,
+// picking the largest bitmap the icon resource points to.
+func ExtractAABIcon(filePath string) ([]byte, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open aab file: %w", err)
+	}
+	defer archive.Close()
+
+	manifestData, err := readZipFile(&archive.Reader, "base/manifest/AndroidManifest.xml")
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseXMLNode(manifestData)
+	if err != nil || root == nil {
+		return nil, fmt.Errorf("failed to decode AndroidManifest.xml: %w", err)
+	}
+
+	var icon xmlAttribute
+	for _, child := range root.children {
+		if child.name == "application" {
+			icon = child.attr(androidNamespace, "icon")
+		}
+	}
+	if icon.resourceRef == 0 {
+		return nil, fmt.Errorf("application has no icon")
+	}
+
+	data, err := readZipFile(&archive.Reader, "base/resources.pb")
+	if err != nil {
+		return nil, err
+	}
+	resources, err := parseResourceTable(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *zip.File
+	for _, filePath := range resources.files[icon.resourceRef] {
+		if !isBitmap(filePath) {
+			continue
+		}
+		for _, f := range archive.File {
+			if f.Name == "base/"+filePath && (best == nil || f.UncompressedSize64 > best.UncompressedSize64) {
+				best = f
+			}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no bitmap icon found for resource %#x", icon.resourceRef)
+	}
+	return readZipFile(&archive.Reader, best.Name)
+}
+
+// scanAABLayout returns the native ABIs and screen densities of the base module.
+func scanAABLayout(archive *zip.Reader) (abis []string, densities []string) {
+	abiSet := make(map[string]bool)
+	densitySet := make(map[string]bool)
+
+	for _, f := range archive.File {
+		parts := strings.Split(f.Name, "/")
+		if len(parts) < 4 || parts[0] != "base" {
+			continue
+		}
+		switch parts[1] {
+		case "lib":
+			abiSet[parts[2]] = true
+		case "res":
+			for _, qualifier := range strings.Split(parts[2], "-")[1:] {
+				if strings.HasSuffix(qualifier, "dpi") {
+					densitySet[qualifier] = true
+				}
+			}
+		}
+	}
+
+	return sortedKeys(abiSet), sortedKeys(densitySet)
+}
+
+// xmlElement is a decoded aapt2 XmlElement.
+type xmlElement struct {
+	name       string
+	attributes []xmlAttribute
+	children   []*xmlElement
+}
+
+// xmlAttribute is a decoded aapt2 XmlAttribute.
+type xmlAttribute struct {
+	namespace   string
+	name        string
+	value       string
+	resourceRef uint32
+	intValue    *int64
+	boolValue   *bool
+}
+
+func (e *xmlElement) attr(namespace, name string) xmlAttribute {
+	for _, a := range e.attributes {
+		if a.namespace == namespace && a.name == name {
+			return a
+		}
+	}
+	return xmlAttribute{}
+}
+
+func (a xmlAttribute) int32() int32 {
+	if a.intValue != nil {
+		return int32(*a.intValue)
+	}
+	v, _ := strconv.ParseInt(a.value, 10, 32)
+	return int32(v)
+}
+
+func (a xmlAttribute) bool() bool {
+	if a.boolValue != nil {
+		return *a.boolValue
+	}
+	return a.value == "true"
+}
+
+// parseXMLNode decodes an aapt2 XmlNode and returns its element, or nil for text nodes.
+func parseXMLNode(data []byte) (*xmlElement, error) {
+	node, err := parseProto(data)
+	if err != nil {
+		return nil, err
+	}
+	elementData := node.bytes(1)
+	if elementData == nil {
+		return nil, nil
+	}
+
+	element, err := parseProto(elementData)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &xmlElement{name: element.string(3)}
+	for _, attributeData := range element.all(4) {
+		attribute, err := parseXMLAttribute(attributeData)
+		if err != nil {
+			return nil, err
+		}
+		result.attributes = append(result.attributes, attribute)
+	}
+	for _, childData := range element.all(5) {
+		child, err := parseXMLNode(childData)
+		if err != nil {
+			return nil, err
+		}
+		if child != nil {
+			result.children = append(result.children, child)
+		}
+	}
+	return result, nil
+}
+
+func parseXMLAttribute(data []byte) (xmlAttribute, error) {
+	attribute, err := parseProto(data)
+	if err != nil {
+		return xmlAttribute{}, err
+	}
+
+	result := xmlAttribute{
+		namespace: attribute.string(1),
+		name:      attribute.string(2),
+		value:     attribute.string(3),
+	}
+
+	if itemData := attribute.bytes(6); itemData != nil {
+		item, err := parseProto(itemData)
+		if err != nil {
+			return xmlAttribute{}, err
+		}
+		if refData := item.bytes(1); refData != nil {
+			ref, err := parseProto(refData)
+			if err != nil {
+				return xmlAttribute{}, err
+			}
+			result.resourceRef = uint32(ref.varint(2))
+		}
+		if primData := item.bytes(7); primData != nil {
+			prim, err := parseProto(primData)
+			if err != nil {
+				return xmlAttribute{}, err
+			}
+			// int_decimal_value = 6, int_hexadecimal_value = 7, boolean_value = 8
+			for _, field := range []protowire.Number{6, 7} {
+				if prim.has(field) {
+					v := int64(int32(prim.varint(field)))
+					result.intValue = &v
+				}
+			}
+			if prim.has(8) {
+				v := prim.varint(8) != 0
+				result.boolValue = &v
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// resourceTable holds the string values and file paths of an aapt2 ResourceTable by resource ID.
+type resourceTable struct {
+	strings map[uint32]string
+	files   map[uint32][]string
+}
+
+// resolveString returns the attribute's literal value, or the string it references.
+func (t *resourceTable) resolveString(a xmlAttribute) string {
+	if a.resourceRef == 0 {
+		return a.value
+	}
+	if t != nil {
+		if s, ok := t.strings[a.resourceRef]; ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// parseResourceTable decodes the string and file entries of an aapt2 ResourceTable.
+func parseResourceTable(data []byte) (*resourceTable, error) {
+	table, err := parseProto(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &resourceTable{strings: make(map[uint32]string), files: make(map[uint32][]string)}
+	for _, packageData := range table.all(2) {
+		pkg, err := parseProto(packageData)
+		if err != nil {
+			return nil, err
+		}
+		packageID := uint32(pkg.message(1).varint(1))
+
+		for _, typeData := range pkg.all(3) {
+			typ, err := parseProto(typeData)
+			if err != nil {
+				return nil, err
+			}
+			typeID := uint32(typ.message(1).varint(1))
+
+			for _, entryData := range typ.all(3) {
+				entry, err := parseProto(entryData)
+				if err != nil {
+					return nil, err
+				}
+				id := packageID<<24 | typeID<<16 | uint32(entry.message(1).varint(1))
+
+				// ConfigValue { config = 1; value = 2 }, Value { item = 4 }
+				for _, configValueData := range entry.all(6) {
+					configValue, err := parseProto(configValueData)
+					if err != nil {
+						return nil, err
+					}
+					item := configValue.message(2).message(4)
+					if str := item.message(2); str != nil {
+						if _, ok := result.strings[id]; !ok {
+							result.strings[id] = str.string(1)
+						}
+					}
+					if file := item.message(5); file != nil {
+						result.files[id] = append(result.files[id], file.string(1))
+					}
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// protoMessage holds the raw fields of a protobuf message by field number.
+type protoMessage map[protowire.Number][]protoField
+
+type protoField struct {
+	varint uint64
+	bytes  []byte
+}
+
+// parseProto decodes the top level fields of a protobuf message.
+func parseProto(data []byte) (protoMessage, error) {
+	message := make(protoMessage)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var field protoField
+		switch typ {
+		case protowire.VarintType:
+			field.varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			field.bytes, n = protowire.ConsumeBytes(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			field.varint = uint64(v)
+		case protowire.Fixed64Type:
+			field.varint, n = protowire.ConsumeFixed64(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		message[num] = append(message[num], field)
+	}
+	return message, nil
+}
+
+func (m protoMessage) has(num protowire.Number) bool {
+	return len(m[num]) > 0
+}
+
+func (m protoMessage) all(num protowire.Number) [][]byte {
+	var values [][]byte
+	for _, field := range m[num] {
+		values = append(values, field.bytes)
+	}
+	return values
+}
+
+func (m protoMessage) bytes(num protowire.Number) []byte {
+	if !m.has(num) {
+		return nil
+	}
+	return m[num][0].bytes
+}
+
+func (m protoMessage) string(num protowire.Number) string {
+	return string(m.bytes(num))
+}
+
+func (m protoMessage) varint(num protowire.Number) uint64 {
+	if !m.has(num) {
+		return 0
+	}
+	return m[num][0].varint
+}
+
+// message decodes a nested message field, returning nil if it is absent or invalid.
+func (m protoMessage) message(num protowire.Number) protoMessage {
+	data := m.bytes(num)
+	if data == nil {
+		return nil
+	}
+	nested, err := parseProto(data)
+	if err != nil {
+		return nil
+	}
+	return nested
+}
@@ -0,0 +1,166 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoBytes returns a length-delimited protobuf field with the concatenated values.
+func protoBytes(num protowire.Number, values ...[]byte) []byte {
+	b := protowire.AppendTag(nil, num, protowire.BytesType)
+	return protowire.AppendBytes(b, bytes.Join(values, nil))
+}
+
+func protoVarint(num protowire.Number, v uint64) []byte {
+	return protowire.AppendVarint(protowire.AppendTag(nil, num, protowire.VarintType), v)
+}
+
+// xmlAttr returns an aapt2 XmlAttribute with a raw value, or a compiled item if item is set.
+func xmlAttr(namespace, name, value string, item []byte) []byte {
+	fields := [][]byte{protoBytes(1, []byte(namespace)), protoBytes(2, []byte(name)), protoBytes(3, []byte(value))}
+	if item != nil {
+		fields = append(fields, protoBytes(6, item))
+	}
+	return protoBytes(4, fields...)
+}
+
+// xmlNode returns an aapt2 XmlNode of an element with its attributes and child nodes.
+func xmlNode(name string, attributes [][]byte, children ...[]byte) []byte {
+	element := append([][]byte{protoBytes(3, []byte(name))}, attributes...)
+	for _, child := range children {
+		element = append(element, protoBytes(5, child))
+	}
+	return protoBytes(1, element...)
+}
+
+// resourceEntry returns an aapt2 Entry with the ID whose values are the items.
+func resourceEntry(id uint64, items ...[]byte) []byte {
+	fields := [][]byte{protoBytes(1, protoVarint(1, id))}
+	for _, item := range items {
+		fields = append(fields, protoBytes(6, protoBytes(2, protoBytes(4, item))))
+	}
+	return protoBytes(3, fields...)
+}
+
+func resourceType(id uint64, entries ...[]byte) []byte {
+	return protoBytes(3, append([][]byte{protoBytes(1, protoVarint(1, id))}, entries...)...)
+}
+
+// writeAAB writes a bundle with a manifest and the resources of a label string
+// (0x7f010000) and a launcher icon (0x7f020000) to a temporary directory.
+func writeAAB(t *testing.T) string {
+	t.Helper()
+	manifest := xmlNode("manifest", [][]byte{
+		xmlAttr("", "package", "com.example.bundle", nil),
+		xmlAttr(androidNamespace, "versionCode", "", protoBytes(7, protoVarint(6, 1234))),
+		xmlAttr(androidNamespace, "versionName", "3.2.1", nil),
+	},
+		xmlNode("uses-sdk", [][]byte{
+			xmlAttr(androidNamespace, "minSdkVersion", "", protoBytes(7, protoVarint(6, 26))),
+			xmlAttr(androidNamespace, "targetSdkVersion", "", protoBytes(7, protoVarint(6, 34))),
+		}),
+		xmlNode("uses-permission", [][]byte{xmlAttr(androidNamespace, "name", "android.permission.INTERNET", nil)}),
+		xmlNode("application", [][]byte{
+			xmlAttr(androidNamespace, "label", "@string/app_name", protoBytes(1, protoVarint(2, 0x7f010000))),
+			xmlAttr(androidNamespace, "icon", "@mipmap/ic_launcher", protoBytes(1, protoVarint(2, 0x7f020000))),
+			xmlAttr(androidNamespace, "debuggable", "", protoBytes(7, protoVarint(8, 1))),
+		}),
+	)
+	resources := protoBytes(2,
+		protoBytes(1, protoVarint(1, 0x7f)),
+		resourceType(1, resourceEntry(0, protoBytes(2, protoBytes(1, []byte("Bundle Example"))))),
+		resourceType(2, resourceEntry(0,
+			protoBytes(5, protoBytes(1, []byte("res/mipmap-mdpi/ic_launcher.png"))),
+			protoBytes(5, protoBytes(1, []byte("res/mipmap-xxhdpi/ic_launcher.png"))),
+		)),
+	)
+
+	path := filepath.Join(t.TempDir(), "app.aab")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	for name, content := range map[string][]byte{
+		"base/manifest/AndroidManifest.xml":      manifest,
+		"base/resources.pb":                      resources,
+		"base/res/mipmap-mdpi/ic_launcher.png":   []byte("small"),
+		"base/res/mipmap-xxhdpi/ic_launcher.png": []byte("the large icon"),
+		"base/lib/armeabi-v7a/libexample.so":     []byte("elf"),
+		"feature/lib/x86/libfeature.so":          []byte("elf"),
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseAAB(t *testing.T) {
+	info, err := ParseAAB(writeAAB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.BundleID != "com.example.bundle" || info.Version != "3.2.1" || info.BuildNumber != "1234" {
+		t.Errorf("ParseAAB() = %+v", info)
+	}
+	// The label is a reference into the resource table
+	if info.Title != "Bundle Example" {
+		t.Errorf("Title = %q, want %q", info.Title, "Bundle Example")
+	}
+	want := &domain.AndroidMetadata{
+		VersionCode:      1234,
+		MinSDKVersion:    26,
+		TargetSDKVersion: 34,
+		Debuggable:       true,
+		Permissions:      []string{"android.permission.INTERNET"},
+		ABIs:             []string{"armeabi-v7a"},
+		ScreenDensities:  []string{"mdpi", "xxhdpi"},
+	}
+	if !reflect.DeepEqual(info.Android, want) {
+		t.Errorf("Android = %+v, want %+v", info.Android, want)
+	}
+}
+
+func TestExtractAABIcon(t *testing.T) {
+	icon, err := ExtractAABIcon(writeAAB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(icon) != "the large icon" {
+		t.Errorf("ExtractAABIcon() = %q, want the largest bitmap", icon)
+	}
+}
+
+func TestParseAABInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.aab")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	w, err := archive.Create("base/manifest/AndroidManifest.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("<manifest/>"))
+	archive.Close()
+	file.Close()
+
+	if _, err := ParseAAB(path); err == nil {
+		t.Error("ParseAAB() of a text manifest error = nil, want an error")
+	}
+}
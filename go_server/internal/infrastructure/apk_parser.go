@@ -0,0 +1,103 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"archive/zip"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shogo82148/androidbinary/apk"
+)
+
+// APKInfo holds the metadata read from the AndroidManifest.xml of an .apk file.
+type APKInfo struct {
+	BundleID    string
+	Version     string
+	BuildNumber string
+	Title       string
+	Android     *domain.AndroidMetadata
+}
+
+// ParseAPK opens the .apk file at filePath and reads the application metadata
+// from its binary manifest, resource table and native library layout.
+func ParseAPK(filePath string) (*APKInfo, error) {
+	pkg, err := apk.OpenFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open apk file: %w", err)
+	}
+	defer pkg.Close()
+
+	manifest := pkg.Manifest()
+
+	title, err := pkg.Label(nil)
+	if err != nil {
+		title = "(unknown)"
+	}
+	version, err := manifest.VersionName.String()
+	if err != nil {
+		version = "(unknown)"
+	}
+
+	metadata := &domain.AndroidMetadata{}
+	metadata.VersionCode, _ = manifest.VersionCode.Int32()
+	metadata.MinSDKVersion, _ = manifest.SDK.Min.Int32()
+	metadata.TargetSDKVersion, _ = manifest.SDK.Target.Int32()
+	metadata.Debuggable, _ = manifest.App.Debuggable.Bool()
+	for _, permission := range manifest.UsesPermissions {
+		if name, err := permission.Name.String(); err == nil {
+			metadata.Permissions = append(metadata.Permissions, name)
+		}
+	}
+
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open apk file: %w", err)
+	}
+	defer archive.Close()
+	metadata.ABIs, metadata.ScreenDensities = scanAPKLayout(&archive.Reader)
+
+	return &APKInfo{
+		BundleID:    pkg.PackageName(),
+		Version:     version,
+		BuildNumber: strconv.Itoa(int(metadata.VersionCode)),
+		Title:       title,
+		Android:     metadata,
+	}, nil
+}
+
+// scanAPKLayout returns the native ABIs (lib/<abi>/) and the screen densities
+// resources are provided for (res/<type>-<density>dpi/) in the archive.
+func scanAPKLayout(archive *zip.Reader) (abis []string, densities []string) {
+	abiSet := make(map[string]bool)
+	densitySet := make(map[string]bool)
+
+	for _, f := range archive.File {
+		parts := strings.Split(f.Name, "/")
+		if len(parts) < 3 {
+			continue
+		}
+		switch parts[0] {
+		case "lib":
+			abiSet[parts[1]] = true
+		case "res":
+			for _, qualifier := range strings.Split(parts[1], "-")[1:] {
+				if strings.HasSuffix(qualifier, "dpi") {
+					densitySet[qualifier] = true
+				}
+			}
+		}
+	}
+
+	return sortedKeys(abiSet), sortedKeys(densitySet)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
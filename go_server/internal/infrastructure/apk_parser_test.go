@@ -0,0 +1,78 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"app-distribution-server-go/internal/infrastructure/apktest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeAPK builds an unsigned .apk with manifest and files in a temporary directory
+// and returns its path.
+func writeAPK(t *testing.T, manifest apktest.Manifest, files map[string][]byte) string {
+	t.Helper()
+	data, err := apktest.Build(manifest, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "app.apk")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseAPK(t *testing.T) {
+	path := writeAPK(t, apktest.Manifest{
+		Package:     "com.example.android",
+		VersionName: "2.1.0",
+		VersionCode: 42,
+		Label:       "Example",
+		MinSDK:      24,
+		TargetSDK:   34,
+		Debuggable:  true,
+		Permissions: []string{"android.permission.INTERNET", "android.permission.CAMERA"},
+	}, map[string][]byte{
+		"lib/arm64-v8a/libexample.so":          []byte("elf"),
+		"lib/x86_64/libexample.so":             []byte("elf"),
+		"res/mipmap-xxhdpi-v4/ic_launcher.png": []byte("png"),
+		"res/drawable-mdpi/splash.png":         []byte("png"),
+		"res/layout/main.xml":                  []byte("xml"),
+	})
+
+	info, err := ParseAPK(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.BundleID != "com.example.android" || info.Version != "2.1.0" || info.Title != "Example" {
+		t.Errorf("ParseAPK() = %+v", info)
+	}
+	// The versionCode is the build number rather than a fixed "0"
+	if info.BuildNumber != "42" {
+		t.Errorf("BuildNumber = %q, want %q", info.BuildNumber, "42")
+	}
+	want := &domain.AndroidMetadata{
+		VersionCode:      42,
+		MinSDKVersion:    24,
+		TargetSDKVersion: 34,
+		Debuggable:       true,
+		Permissions:      []string{"android.permission.INTERNET", "android.permission.CAMERA"},
+		ABIs:             []string{"arm64-v8a", "x86_64"},
+		ScreenDensities:  []string{"mdpi", "xxhdpi"},
+	}
+	if !reflect.DeepEqual(info.Android, want) {
+		t.Errorf("Android = %+v, want %+v", info.Android, want)
+	}
+}
+
+func TestParseAPKInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.apk")
+	if err := os.WriteFile(path, []byte("not a zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseAPK(path); err == nil {
+		t.Error("ParseAPK() of a file that isn't a zip error = nil, want an error")
+	}
+}
@@ -0,0 +1,472 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// APK Signature Scheme block IDs, see https://source.android.com/docs/security/features/apksigning
+const (
+	apkSigV2BlockID = 0x7109871a
+	apkSigV3BlockID = 0xf05368c0
+
+	apkSigBlockMagic = "APK Sig Block 42"
+	eocdSignature    = 0x06054b50
+	apkDigestChunk   = 1 << 20
+)
+
+// apkSigAlgorithm describes a signature algorithm used in v2/v3 signing blocks.
+type apkSigAlgorithm struct {
+	hash   crypto.Hash
+	verify func(pub crypto.PublicKey, digest, signature []byte) error
+}
+
+var apkSigAlgorithms = map[uint32]apkSigAlgorithm{
+	0x0101: {crypto.SHA256, verifyRSAPSS(crypto.SHA256)},
+	0x0102: {crypto.SHA512, verifyRSAPSS(crypto.SHA512)},
+	0x0103: {crypto.SHA256, verifyRSAPKCS1(crypto.SHA256)},
+	0x0104: {crypto.SHA512, verifyRSAPKCS1(crypto.SHA512)},
+	0x0201: {crypto.SHA256, verifyECDSA},
+	0x0202: {crypto.SHA512, verifyECDSA},
+}
+
+// debugCertificateSubject is the subject of the keys generated by the Android SDK for debug builds.
+const debugCertificateSubject = "CN=Android Debug,O=Android,C=US"
+
+// VerifyAPKSignature verifies the v1 (JAR), v2 and v3 signatures of the .apk file at
+// filePath and returns the schemes that verified along with the signer certificates.
+// An error is returned if any present signature fails to verify or if the APK is unsigned.
+func VerifyAPKSignature(filePath string) (*domain.APKSignature, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open apk file: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat apk file: %w", err)
+	}
+
+	signature := &domain.APKSignature{}
+	var certificates []*x509.Certificate
+
+	layout, err := readAPKLayout(file, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	if layout.signingBlock != nil {
+		for _, scheme := range []struct {
+			name string
+			id   uint32
+		}{{"v2", apkSigV2BlockID}, {"v3", apkSigV3BlockID}} {
+			block, ok := layout.signingBlock[scheme.id]
+			if !ok {
+				continue
+			}
+			certs, err := verifyAPKSigningBlock(file, layout, block, scheme.id == apkSigV3BlockID)
+			if err != nil {
+				return nil, fmt.Errorf("%s signature verification failed: %w", scheme.name, err)
+			}
+			signature.Schemes = append(signature.Schemes, scheme.name)
+			certificates = append(certificates, certs...)
+		}
+	}
+
+	v1Certs, strippedSchemes, err := verifyJARSignature(filePath)
+	if err != nil && !errors.Is(err, errNotJARSigned) {
+		return nil, fmt.Errorf("v1 signature verification failed: %w", err)
+	}
+	if err == nil {
+		signature.Schemes = append([]string{"v1"}, signature.Schemes...)
+		certificates = append(certificates, v1Certs...)
+		// Signers declare newer schemes in the JAR signature so that stripping them is detected
+		for _, scheme := range strippedSchemes {
+			if !containsString(signature.Schemes, scheme) {
+				return nil, fmt.Errorf("%s signature was stripped from the apk", scheme)
+			}
+		}
+	}
+
+	if len(signature.Schemes) == 0 {
+		return nil, fmt.Errorf("apk is not signed")
+	}
+
+	seen := make(map[string]bool)
+	for _, cert := range certificates {
+		info := signerCertificate(cert)
+		if seen[info.SHA256] {
+			continue
+		}
+		seen[info.SHA256] = true
+		signature.Certificates = append(signature.Certificates, info)
+		if info.Subject == debugCertificateSubject {
+			signature.DebugSigned = true
+		}
+	}
+
+	return signature, nil
+}
+
+// signerCertificate summarizes a signing certificate.
+func signerCertificate(cert *x509.Certificate) domain.SignerCertificate {
+	fingerprint := sha256.Sum256(cert.Raw)
+	return domain.SignerCertificate{
+		SHA256:    hex.EncodeToString(fingerprint[:]),
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+}
+
+// apkLayout holds the offsets of the sections covered by v2/v3 content digests.
+type apkLayout struct {
+	signingBlockOffset int64
+	centralDirOffset   int64
+	eocdOffset         int64
+	eocd               []byte
+	signingBlock       map[uint32][]byte
+}
+
+// readAPKLayout locates the End of Central Directory record and the APK Signing Block.
+func readAPKLayout(r io.ReaderAt, size int64) (*apkLayout, error) {
+	// The EOCD is at least 22 bytes long and may be followed by a comment of up to 64 KiB
+	tailSize := int64(22 + 0xffff)
+	if tailSize > size {
+		tailSize = size
+	}
+	tail := make([]byte, tailSize)
+	if _, err := r.ReadAt(tail, size-tailSize); err != nil {
+		return nil, fmt.Errorf("failed to read end of central directory: %w", err)
+	}
+
+	eocdPos := -1
+	for i := len(tail) - 22; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) == eocdSignature {
+			eocdPos = i
+			break
+		}
+	}
+	if eocdPos < 0 {
+		return nil, fmt.Errorf("end of central directory not found")
+	}
+
+	layout := &apkLayout{
+		eocdOffset:       size - tailSize + int64(eocdPos),
+		eocd:             tail[eocdPos:],
+		centralDirOffset: int64(binary.LittleEndian.Uint32(tail[eocdPos+16:])),
+	}
+	layout.signingBlockOffset = layout.centralDirOffset
+
+	if layout.centralDirOffset < 32 {
+		return layout, nil
+	}
+	footer := make([]byte, 24)
+	if _, err := r.ReadAt(footer, layout.centralDirOffset-24); err != nil {
+		return nil, fmt.Errorf("failed to read signing block footer: %w", err)
+	}
+	if string(footer[8:]) != apkSigBlockMagic {
+		return layout, nil
+	}
+
+	blockSize := int64(binary.LittleEndian.Uint64(footer))
+	blockOffset := layout.centralDirOffset - blockSize - 8
+	if blockSize < 24 || blockOffset < 0 {
+		return nil, fmt.Errorf("invalid signing block size")
+	}
+	block := make([]byte, blockSize+8)
+	if _, err := r.ReadAt(block, blockOffset); err != nil {
+		return nil, fmt.Errorf("failed to read signing block: %w", err)
+	}
+	if int64(binary.LittleEndian.Uint64(block)) != blockSize {
+		return nil, fmt.Errorf("signing block header and footer sizes differ")
+	}
+
+	layout.signingBlockOffset = blockOffset
+	layout.signingBlock = make(map[uint32][]byte)
+	pairs := block[8 : len(block)-24]
+	for len(pairs) > 0 {
+		if len(pairs) < 12 {
+			return nil, fmt.Errorf("truncated signing block entry")
+		}
+		pairLen := binary.LittleEndian.Uint64(pairs)
+		if pairLen < 4 || pairLen > uint64(len(pairs)-8) {
+			return nil, fmt.Errorf("invalid signing block entry length")
+		}
+		id := binary.LittleEndian.Uint32(pairs[8:])
+		layout.signingBlock[id] = pairs[12 : 8+pairLen]
+		pairs = pairs[8+pairLen:]
+	}
+
+	return layout, nil
+}
+
+// verifyAPKSigningBlock verifies every signer of a v2 or v3 block and returns their certificates.
+func verifyAPKSigningBlock(r io.ReaderAt, layout *apkLayout, block []byte, v3 bool) ([]*x509.Certificate, error) {
+	signers, _, err := lengthPrefixed(block)
+	if err != nil {
+		return nil, err
+	}
+	signerList, err := lengthPrefixedSequence(signers)
+	if err != nil {
+		return nil, err
+	}
+	if len(signerList) == 0 {
+		return nil, fmt.Errorf("no signers")
+	}
+
+	var certificates []*x509.Certificate
+	for _, signer := range signerList {
+		cert, err := verifyAPKSigner(r, layout, signer, v3)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, cert)
+	}
+	return certificates, nil
+}
+
+// verifyAPKSigner verifies a single signer of a v2/v3 block.
+func verifyAPKSigner(r io.ReaderAt, layout *apkLayout, signer []byte, v3 bool) (*x509.Certificate, error) {
+	signedData, rest, err := lengthPrefixed(signer)
+	if err != nil {
+		return nil, err
+	}
+	if v3 {
+		// minSdkVersion and maxSdkVersion of the signer
+		if len(rest) < 8 {
+			return nil, fmt.Errorf("truncated v3 signer")
+		}
+		rest = rest[8:]
+	}
+	signaturesData, rest, err := lengthPrefixed(rest)
+	if err != nil {
+		return nil, err
+	}
+	publicKeyData, _, err := lengthPrefixed(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(publicKeyData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signer public key: %w", err)
+	}
+
+	signatures, err := lengthPrefixedSequence(signaturesData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the strongest supported signature over the signed data
+	var algorithmID uint32
+	var algorithm apkSigAlgorithm
+	var signatureBytes []byte
+	for _, sig := range signatures {
+		if len(sig) < 4 {
+			return nil, fmt.Errorf("truncated signature")
+		}
+		id := binary.LittleEndian.Uint32(sig)
+		alg, ok := apkSigAlgorithms[id]
+		if !ok || (signatureBytes != nil && alg.hash <= algorithm.hash) {
+			continue
+		}
+		value, _, err := lengthPrefixed(sig[4:])
+		if err != nil {
+			return nil, err
+		}
+		algorithmID, algorithm, signatureBytes = id, alg, value
+	}
+	if signatureBytes == nil {
+		return nil, fmt.Errorf("no supported signature algorithm")
+	}
+
+	h := algorithm.hash.New()
+	h.Write(signedData)
+	if err := algorithm.verify(publicKey, h.Sum(nil), signatureBytes); err != nil {
+		return nil, fmt.Errorf("signature over signed data is invalid: %w", err)
+	}
+
+	// Signed data: digests, certificates, [minSdk, maxSdk,] additional attributes
+	digestsData, rest, err := lengthPrefixed(signedData)
+	if err != nil {
+		return nil, err
+	}
+	certificatesData, _, err := lengthPrefixed(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	certificates, err := lengthPrefixedSequence(certificatesData)
+	if err != nil {
+		return nil, err
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificates")
+	}
+	cert, err := x509.ParseCertificate(certificates[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signer certificate: %w", err)
+	}
+	certKey, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil || !bytes.Equal(certKey, publicKeyData) {
+		return nil, fmt.Errorf("signer certificate does not match public key")
+	}
+
+	digests, err := lengthPrefixedSequence(digestsData)
+	if err != nil {
+		return nil, err
+	}
+	for _, digest := range digests {
+		if len(digest) < 4 || binary.LittleEndian.Uint32(digest) != algorithmID {
+			continue
+		}
+		expected, _, err := lengthPrefixed(digest[4:])
+		if err != nil {
+			return nil, err
+		}
+		actual, err := apkContentDigest(r, layout, algorithm.hash)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(expected, actual) {
+			return nil, fmt.Errorf("content digest mismatch")
+		}
+		return cert, nil
+	}
+
+	return nil, fmt.Errorf("no content digest for signature algorithm %#x", algorithmID)
+}
+
+// apkContentDigest computes the chunked digest of the zip entries, central directory
+// and EOCD, as defined by APK Signature Scheme v2.
+func apkContentDigest(r io.ReaderAt, layout *apkLayout, hashType crypto.Hash) ([]byte, error) {
+	// The EOCD is digested as if the central directory started where the signing block does
+	eocd := append([]byte(nil), layout.eocd...)
+	binary.LittleEndian.PutUint32(eocd[16:], uint32(layout.signingBlockOffset))
+
+	sections := []io.ReaderAt{
+		io.NewSectionReader(r, 0, layout.signingBlockOffset),
+		io.NewSectionReader(r, layout.centralDirOffset, layout.eocdOffset-layout.centralDirOffset),
+		bytes.NewReader(eocd),
+	}
+	sizes := []int64{layout.signingBlockOffset, layout.eocdOffset - layout.centralDirOffset, int64(len(eocd))}
+
+	var chunkDigests []byte
+	var chunkCount uint32
+	chunk := make([]byte, apkDigestChunk)
+	prefix := make([]byte, 5)
+	for i, section := range sections {
+		for offset := int64(0); offset < sizes[i]; offset += apkDigestChunk {
+			n := sizes[i] - offset
+			if n > apkDigestChunk {
+				n = apkDigestChunk
+			}
+			if _, err := section.ReadAt(chunk[:n], offset); err != nil && err != io.EOF {
+				return nil, fmt.Errorf("failed to read apk contents: %w", err)
+			}
+			prefix[0] = 0xa5
+			binary.LittleEndian.PutUint32(prefix[1:], uint32(n))
+			h := newHash(hashType)
+			h.Write(prefix)
+			h.Write(chunk[:n])
+			chunkDigests = h.Sum(chunkDigests)
+			chunkCount++
+		}
+	}
+
+	prefix[0] = 0x5a
+	binary.LittleEndian.PutUint32(prefix[1:], chunkCount)
+	h := newHash(hashType)
+	h.Write(prefix)
+	h.Write(chunkDigests)
+	return h.Sum(nil), nil
+}
+
+func newHash(hashType crypto.Hash) hash.Hash {
+	if hashType == crypto.SHA512 {
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+func verifyRSAPSS(hashType crypto.Hash) func(crypto.PublicKey, []byte, []byte) error {
+	return func(pub crypto.PublicKey, digest, signature []byte) error {
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("public key is not an RSA key")
+		}
+		return rsa.VerifyPSS(key, hashType, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	}
+}
+
+func verifyRSAPKCS1(hashType crypto.Hash) func(crypto.PublicKey, []byte, []byte) error {
+	return func(pub crypto.PublicKey, digest, signature []byte) error {
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("public key is not an RSA key")
+		}
+		return rsa.VerifyPKCS1v15(key, hashType, digest, signature)
+	}
+}
+
+func verifyECDSA(pub crypto.PublicKey, digest, signature []byte) error {
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("public key is not an ECDSA key")
+	}
+	if !ecdsa.VerifyASN1(key, digest, signature) {
+		return fmt.Errorf("invalid ECDSA signature")
+	}
+	return nil
+}
+
+// lengthPrefixed splits a uint32 little-endian length-prefixed value off data.
+func lengthPrefixed(data []byte) (value, rest []byte, err error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("truncated length-prefixed value")
+	}
+	n := binary.LittleEndian.Uint32(data)
+	if uint64(n) > uint64(len(data)-4) {
+		return nil, nil, fmt.Errorf("length-prefixed value out of bounds")
+	}
+	return data[4 : 4+n], data[4+n:], nil
+}
+
+// lengthPrefixedSequence splits data into consecutive length-prefixed values.
+func lengthPrefixedSequence(data []byte) ([][]byte, error) {
+	var values [][]byte
+	for len(data) > 0 {
+		value, rest, err := lengthPrefixed(data)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		data = rest
+	}
+	return values, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/infrastructure/apktest"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSignedAPK builds an .apk signed by signer with the schemes and returns its path.
+func writeSignedAPK(t *testing.T, signer *apktest.Signer, schemes ...uint32) string {
+	t.Helper()
+	data, err := apktest.Build(apktest.Manifest{Package: "com.example.android", VersionName: "1.0", VersionCode: 1, Label: "Example"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = signer.Sign(data, schemes...); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "app.apk")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyAPKSignature(t *testing.T) {
+	signer, err := apktest.NewSigner(pkix.Name{CommonName: "Example Release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := sha256.Sum256(signer.Certificate.Raw)
+
+	tests := []struct {
+		name    string
+		schemes []uint32
+		want    []string
+	}{
+		{"v2", []uint32{apktest.V2}, []string{"v2"}},
+		{"v3", []uint32{apktest.V3}, []string{"v3"}},
+		{"v2 and v3", []uint32{apktest.V2, apktest.V3}, []string{"v2", "v3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature, err := VerifyAPKSignature(writeSignedAPK(t, signer, tt.schemes...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(signature.Schemes, tt.want) {
+				t.Errorf("Schemes = %v, want %v", signature.Schemes, tt.want)
+			}
+			// Both schemes carry the same certificate, which is only recorded once
+			if len(signature.Certificates) != 1 {
+				t.Fatalf("Certificates = %+v, want one", signature.Certificates)
+			}
+			cert := signature.Certificates[0]
+			if cert.SHA256 != hex.EncodeToString(fingerprint[:]) || cert.Subject != "CN=Example Release" ||
+				!cert.NotAfter.Equal(signer.Certificate.NotAfter) {
+				t.Errorf("Certificates[0] = %+v", cert)
+			}
+			if signature.DebugSigned {
+				t.Error("DebugSigned = true for a release key")
+			}
+		})
+	}
+}
+
+func TestVerifyAPKSignatureDebugKey(t *testing.T) {
+	signer, err := apktest.NewSigner(pkix.Name{CommonName: "Android Debug", Organization: []string{"Android"}, Country: []string{"US"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := VerifyAPKSignature(writeSignedAPK(t, signer, apktest.V2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signature.DebugSigned {
+		t.Error("DebugSigned = false for the Android SDK debug key")
+	}
+}
+
+func TestVerifyAPKSignatureRejects(t *testing.T) {
+	signer, err := apktest.NewSigner(pkix.Name{CommonName: "Example Release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyAPKSignature(writeSignedAPK(t, signer)); err == nil {
+		t.Error("VerifyAPKSignature() of an unsigned apk error = nil, want an error")
+	}
+
+	// Changing a signed entry breaks the content digest
+	path := writeSignedAPK(t, signer, apktest.V2)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[40] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAPKSignature(path); err == nil {
+		t.Error("VerifyAPKSignature() of a modified apk error = nil, want an error")
+	}
+}
@@ -0,0 +1,212 @@
+// Package apktest builds minimal .apk files for tests: a binary AndroidManifest.xml,
+// an empty resource table and optional APK Signature Scheme v2 and v3 blocks.
+package apktest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"strconv"
+)
+
+const androidNS = "http://schemas.android.com/apk/res/android"
+
+// Manifest is the part of an AndroidManifest.xml that Build writes.
+type Manifest struct {
+	Package     string
+	VersionName string
+	VersionCode int
+	Label       string
+	// Icon is the path of the launcher icon in the archive.
+	Icon        string
+	MinSDK      int
+	TargetSDK   int
+	Debuggable  bool
+	Permissions []string
+}
+
+// Build returns an unsigned .apk with manifest and the other files, such as icons
+// and native libraries, keyed by their path in the archive.
+func Build(manifest Manifest, files map[string][]byte) ([]byte, error) {
+	var data bytes.Buffer
+	archive := zip.NewWriter(&data)
+	entries := map[string][]byte{
+		"AndroidManifest.xml": manifest.encode(),
+		"resources.arsc":      emptyResourceTable(),
+	}
+	for name, content := range files {
+		entries[name] = content
+	}
+	for name, content := range entries {
+		w, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// encode writes the manifest as binary XML, with every attribute as a raw string.
+func (m Manifest) encode() []byte {
+	root := element{name: "manifest", attrs: []attr{
+		{"", "package", m.Package},
+		{androidNS, "versionCode", strconv.Itoa(m.VersionCode)},
+		{androidNS, "versionName", m.VersionName},
+	}}
+	sdk := element{name: "uses-sdk"}
+	if m.MinSDK != 0 {
+		sdk.attrs = append(sdk.attrs, attr{androidNS, "minSdkVersion", strconv.Itoa(m.MinSDK)})
+	}
+	if m.TargetSDK != 0 {
+		sdk.attrs = append(sdk.attrs, attr{androidNS, "targetSdkVersion", strconv.Itoa(m.TargetSDK)})
+	}
+	root.children = append(root.children, sdk)
+	for _, permission := range m.Permissions {
+		root.children = append(root.children, element{name: "uses-permission", attrs: []attr{{androidNS, "name", permission}}})
+	}
+	app := element{name: "application", attrs: []attr{
+		{androidNS, "label", m.Label},
+		{androidNS, "debuggable", strconv.FormatBool(m.Debuggable)},
+	}}
+	if m.Icon != "" {
+		app.attrs = append(app.attrs, attr{androidNS, "icon", m.Icon})
+	}
+	root.children = append(root.children, app)
+	return encodeXML(root)
+}
+
+type attr struct {
+	ns, name, value string
+}
+
+type element struct {
+	name     string
+	attrs    []attr
+	children []element
+}
+
+// Chunk types of Android's binary XML, see ResourceTypes.h.
+const (
+	stringPoolType     = 0x0001
+	resourceTableType  = 0x0002
+	xmlType            = 0x0003
+	startNamespaceType = 0x0100
+	endNamespaceType   = 0x0101
+	startElementType   = 0x0102
+	endElementType     = 0x0103
+
+	utf8Flag       = 1 << 8
+	typeString     = 0x03
+	noStringRef    = 0xffffffff
+	nodeHeaderSize = 16
+)
+
+// encodeXML returns root as binary XML that declares the android namespace.
+func encodeXML(root element) []byte {
+	pool := &stringPool{index: make(map[string]uint32)}
+	prefix, uri := pool.ref("android"), pool.ref(androidNS)
+
+	var body bytes.Buffer
+	writeNode(&body, startNamespaceType, prefix, uri)
+	writeElement(&body, pool, root, uri)
+	writeNode(&body, endNamespaceType, prefix, uri)
+
+	strings := pool.encode()
+	var out bytes.Buffer
+	writeChunkHeader(&out, xmlType, 8, 8+len(strings)+body.Len())
+	out.Write(strings)
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+func writeElement(w *bytes.Buffer, pool *stringPool, e element, uri uint32) {
+	const attrSize = 20
+	var ext bytes.Buffer
+	le(&ext, uint32(noStringRef), pool.ref(e.name), uint16(20), uint16(attrSize), uint16(len(e.attrs)), uint16(0), uint16(0), uint16(0))
+	for _, a := range e.attrs {
+		ns := uint32(noStringRef)
+		if a.ns != "" {
+			ns = uri
+		}
+		value := pool.ref(a.value)
+		le(&ext, ns, pool.ref(a.name), value, uint16(8), uint8(0), uint8(typeString), value)
+	}
+	writeChunkHeader(w, startElementType, nodeHeaderSize, nodeHeaderSize+ext.Len())
+	le(w, uint32(1), uint32(noStringRef))
+	w.Write(ext.Bytes())
+
+	for _, child := range e.children {
+		writeElement(w, pool, child, uri)
+	}
+	writeNode(w, endElementType, noStringRef, pool.ref(e.name))
+}
+
+// writeNode writes a namespace or end element node, whose extensions are two string references.
+func writeNode(w *bytes.Buffer, typ uint16, first, second uint32) {
+	writeChunkHeader(w, typ, nodeHeaderSize, nodeHeaderSize+8)
+	le(w, uint32(1), uint32(noStringRef), first, second)
+}
+
+func writeChunkHeader(w *bytes.Buffer, typ uint16, headerSize, size int) {
+	le(w, typ, uint16(headerSize), uint32(size))
+}
+
+// stringPool collects the strings of a binary XML file.
+type stringPool struct {
+	strings []string
+	index   map[string]uint32
+}
+
+func (p *stringPool) ref(s string) uint32 {
+	if i, ok := p.index[s]; ok {
+		return i
+	}
+	p.index[s] = uint32(len(p.strings))
+	p.strings = append(p.strings, s)
+	return p.index[s]
+}
+
+// encode returns the UTF-8 string pool chunk. The strings must be shorter than 128 bytes.
+func (p *stringPool) encode() []byte {
+	const headerSize = 28
+	var offsets, data bytes.Buffer
+	for _, s := range p.strings {
+		le(&offsets, uint32(data.Len()))
+		data.WriteByte(byte(len(s)))
+		data.WriteByte(byte(len(s)))
+		data.WriteString(s)
+		data.WriteByte(0)
+	}
+	for data.Len()%4 != 0 {
+		data.WriteByte(0)
+	}
+
+	var out bytes.Buffer
+	stringsStart := headerSize + offsets.Len()
+	writeChunkHeader(&out, stringPoolType, headerSize, stringsStart+data.Len())
+	le(&out, uint32(len(p.strings)), uint32(0), uint32(utf8Flag), uint32(stringsStart), uint32(0))
+	out.Write(offsets.Bytes())
+	out.Write(data.Bytes())
+	return out.Bytes()
+}
+
+// emptyResourceTable returns a resources.arsc without packages, which is enough for
+// manifests whose attributes are all raw strings.
+func emptyResourceTable() []byte {
+	var out bytes.Buffer
+	writeChunkHeader(&out, resourceTableType, 12, 12)
+	le(&out, uint32(0))
+	return out.Bytes()
+}
+
+func le(w *bytes.Buffer, values ...any) {
+	for _, v := range values {
+		binary.Write(w, binary.LittleEndian, v)
+	}
+}
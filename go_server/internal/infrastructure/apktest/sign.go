@@ -0,0 +1,146 @@
+package apktest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Signer is a certificate and key that APKs are signed with.
+type Signer struct {
+	Certificate *x509.Certificate
+	Key         *ecdsa.PrivateKey
+}
+
+// NewSigner returns a self-signed P-256 signer with the subject.
+func NewSigner(subject pkix.Name) (*Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{Certificate: cert, Key: key}, nil
+}
+
+// Signing block IDs of APK Signature Scheme v2 and v3.
+const (
+	V2 = 0x7109871a
+	V3 = 0xf05368c0
+)
+
+// ecdsaSHA256 is the signature algorithm ID of ECDSA with SHA2-256.
+const ecdsaSHA256 = 0x0201
+
+// Sign inserts an APK Signing Block with a signature of each scheme (V2 or V3) in
+// front of the central directory of the unsigned apk.
+func (s *Signer) Sign(apk []byte, schemes ...uint32) ([]byte, error) {
+	if len(apk) < 22 || binary.LittleEndian.Uint32(apk[len(apk)-22:]) != 0x06054b50 {
+		return nil, fmt.Errorf("apk must end with an end of central directory record without comment")
+	}
+	eocd := apk[len(apk)-22:]
+	centralDir := int(binary.LittleEndian.Uint32(eocd[16:]))
+	digest := contentDigest(apk[:centralDir], apk[centralDir:len(apk)-22], eocd)
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&s.Key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var pairs bytes.Buffer
+	for _, scheme := range schemes {
+		v3 := scheme == V3
+		var signedData bytes.Buffer
+		signedData.Write(prefixed(prefixed(append(u32(ecdsaSHA256), prefixed(digest)...))))
+		signedData.Write(prefixed(prefixed(s.Certificate.Raw)))
+		if v3 {
+			signedData.Write(sdkRange())
+		}
+		signedData.Write(prefixed(nil))
+
+		hash := sha256.Sum256(signedData.Bytes())
+		signature, err := ecdsa.SignASN1(rand.Reader, s.Key, hash[:])
+		if err != nil {
+			return nil, err
+		}
+
+		var signer bytes.Buffer
+		signer.Write(prefixed(signedData.Bytes()))
+		if v3 {
+			signer.Write(sdkRange())
+		}
+		signer.Write(prefixed(prefixed(append(u32(ecdsaSHA256), prefixed(signature)...))))
+		signer.Write(prefixed(publicKey))
+
+		value := prefixed(prefixed(signer.Bytes()))
+		le(&pairs, uint64(4+len(value)), scheme)
+		pairs.Write(value)
+	}
+
+	var block bytes.Buffer
+	size := uint64(pairs.Len() + 8 + 16)
+	le(&block, size)
+	block.Write(pairs.Bytes())
+	le(&block, size)
+	block.WriteString("APK Sig Block 42")
+
+	var out bytes.Buffer
+	out.Write(apk[:centralDir])
+	out.Write(block.Bytes())
+	out.Write(apk[centralDir:])
+	binary.LittleEndian.PutUint32(out.Bytes()[out.Len()-22+16:], uint32(centralDir+block.Len()))
+	return out.Bytes(), nil
+}
+
+// contentDigest is the SHA-256 digest of the sections of an apk in 1 MiB chunks.
+func contentDigest(sections ...[]byte) []byte {
+	const chunkSize = 1 << 20
+	var digests []byte
+	var count uint32
+	for _, section := range sections {
+		for offset := 0; offset < len(section); offset += chunkSize {
+			chunk := section[offset:min(offset+chunkSize, len(section))]
+			h := sha256.New()
+			h.Write(append([]byte{0xa5}, u32(uint32(len(chunk)))...))
+			h.Write(chunk)
+			digests = h.Sum(digests)
+			count++
+		}
+	}
+	h := sha256.New()
+	h.Write(append([]byte{0x5a}, u32(count)...))
+	h.Write(digests)
+	return h.Sum(nil)
+}
+
+// sdkRange is the minimum and maximum SDK version of a v3 signer.
+func sdkRange() []byte {
+	return append(u32(24), u32(0x7fffffff)...)
+}
+
+func prefixed(value []byte) []byte {
+	return append(u32(uint32(len(value))), value...)
+}
+
+func u32(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
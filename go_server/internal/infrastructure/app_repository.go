@@ -1,21 +1,32 @@
 package infrastructure
 
 import (
+	"app-distribution-server-go/internal/application"
 	"app-distribution-server-go/internal/domain"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	StorageDir        = "storage"
-	indexesDir        = "_indexes"
-	byBundleIDDir     = "by_bundle_id"
-	buildInfoFileName = "build_info.json"
+	StorageDir         = "storage"
+	indexesDir         = "_indexes"
+	byBundleIDDir      = "by_bundle_id"
+	buildInfoFileName  = "build_info.json"
+	appsFileName       = "_apps.json"
+	channelsFileName   = "_channels.json"
+	promotionsFileName = "_promotions.json"
+	feedbackFileName   = "_feedback.json"
+	productsFileName   = "_products.json"
 )
 
 // IndexEntry represents an entry in the bundle ID index.
@@ -24,46 +35,115 @@ type IndexEntry struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-type FileAppRepository struct{}
+// FileAppRepository keeps build metadata and indexes as JSON files in StorageDir,
+// and app files and icons in a blob store.
+type FileAppRepository struct {
+	blobs application.BlobStore
+
+	// indexMu serializes index updates, which read, modify and rewrite the index file
+	indexMu sync.Mutex
+	// listsMu serializes changes to the apps, channels, promotions and products files in the same way
+	listsMu sync.Mutex
+	// contentLocks keeps a purge from deleting an app file that a concurrent upload shares
+	contentLocks contentLocks
+}
 
 // NewFileAppRepository initializes the storage and returns a new FileAppRepository.
-func NewFileAppRepository() (*FileAppRepository, error) {
+func NewFileAppRepository(blobs application.BlobStore) (*FileAppRepository, error) {
 	for _, dir := range []string{StorageDir, filepath.Join(StorageDir, indexesDir), filepath.Join(StorageDir, indexesDir, byBundleIDDir)} {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
 		}
 	}
-	return &FileAppRepository{}, nil
+	return &FileAppRepository{blobs: blobs}, nil
+}
+
+func (r *FileAppRepository) GetApps() ([]*domain.App, error) {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+	return loadJSONList[*domain.App](appsFileName)
+}
+
+func (r *FileAppRepository) GetApp(bundleID string) (*domain.App, error) {
+	apps, err := r.GetApps()
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range apps {
+		if app.BundleID == bundleID {
+			return app, nil
+		}
+	}
+	return nil, application.ErrAppNotFound
+}
+
+func (r *FileAppRepository) CreateApp(app *domain.App) error {
+	return r.updateApps(func(apps []*domain.App) ([]*domain.App, error) {
+		for _, existing := range apps {
+			if existing.BundleID == app.BundleID {
+				return nil, application.ErrAppExists
+			}
+		}
+		return append(apps, app), nil
+	})
+}
+
+func (r *FileAppRepository) UpdateApp(app *domain.App) error {
+	return r.updateApps(func(apps []*domain.App) ([]*domain.App, error) {
+		for i, existing := range apps {
+			if existing.BundleID == app.BundleID {
+				apps[i] = app
+				return apps, nil
+			}
+		}
+		return nil, application.ErrAppNotFound
+	})
+}
+
+func (r *FileAppRepository) DeleteApp(bundleID string) error {
+	return r.updateApps(func(apps []*domain.App) ([]*domain.App, error) {
+		for i, existing := range apps {
+			if existing.BundleID == bundleID {
+				return append(apps[:i], apps[i+1:]...), nil
+			}
+		}
+		return nil, application.ErrAppNotFound
+	})
 }
 
-func (r *FileAppRepository) GetAllApps() ([]*domain.BuildInfo, error) {
-	allApps := make([]*domain.BuildInfo, 0)
+func (r *FileAppRepository) GetLatestBuilds() ([]*domain.BuildInfo, error) {
+	builds := make([]*domain.BuildInfo, 0)
 	bundleIDFiles, err := os.ReadDir(filepath.Join(StorageDir, indexesDir, byBundleIDDir))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return allApps, nil // Return empty slice if directory doesn't exist
+			return builds, nil // Return empty slice if directory doesn't exist
 		}
 		return nil, fmt.Errorf("failed to read bundle ID index directory: %w", err)
 	}
 
 	for _, file := range bundleIDFiles {
-		if file.IsDir() {
+		// Skip directories and temporary files left behind by interrupted index updates
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || !strings.HasSuffix(file.Name(), ".json") {
 			continue
 		}
-		bundleID := file.Name()
-		bundleID = bundleID[:len(bundleID)-len(".json")]
+		bundleID := strings.TrimSuffix(file.Name(), ".json")
 		build, err := r.GetLatestVersion(bundleID)
 		if err != nil {
 			fmt.Printf("Error getting latest version for %s: %v\n", bundleID, err)
 			continue
 		}
-		allApps = append(allApps, build)
+		builds = append(builds, build)
 	}
 
-	return allApps, nil
+	return builds, nil
 }
 
 func (r *FileAppRepository) GetAllVersions(bundleID string) ([]*domain.BuildInfo, error) {
+	indexFilePath := filepath.Join(StorageDir, indexesDir, byBundleIDDir, fmt.Sprintf("%s.json", bundleID))
+	if _, err := os.Stat(indexFilePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
 	index, err := r.getIndexEntriesForBundleID(bundleID)
 	if err != nil {
 		return nil, err
@@ -84,33 +164,577 @@ func (r *FileAppRepository) GetAllVersions(bundleID string) ([]*domain.BuildInfo
 }
 
 func (r *FileAppRepository) GetLatestVersion(bundleID string) (*domain.BuildInfo, error) {
-	uploadID, err := r.getLatestUploadIDForBundleID(bundleID)
+	builds, err := r.GetAllVersions(bundleID)
+	if err != nil {
+		return nil, err
+	}
+	for _, build := range builds {
+		if build.Listed() {
+			return build, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no listed build for bundle ID %s", application.ErrBuildNotFound, bundleID)
+}
+
+func (r *FileAppRepository) GetBuild(bundleID string, platform domain.Platform, version, buildNumber string) (*domain.BuildInfo, error) {
+	builds, err := r.GetAllVersions(bundleID)
 	if err != nil {
 		return nil, err
 	}
+	for _, build := range builds {
+		if build.Platform == platform && build.Version == version && build.BuildNumber == buildNumber {
+			return build, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no %s build for bundle ID %s, version %s, build number %s", application.ErrBuildNotFound, platform, bundleID, version, buildNumber)
+}
+
+func (r *FileAppRepository) GetBuildByUploadID(uploadID string) (*domain.BuildInfo, error) {
+	// Upload IDs are used as directory names, so make sure they can't point elsewhere
+	if uploadID == "" || filepath.Base(uploadID) != uploadID || strings.HasPrefix(uploadID, ".") || strings.HasPrefix(uploadID, "_") {
+		return nil, application.ErrBuildNotFound
+	}
 	return r.getBuildInfo(uploadID)
 }
 
-func (r *FileAppRepository) SaveUpload(info *domain.BuildInfo, appFile io.Reader) error {
-	if err := r.saveBuildInfo(info); err != nil {
+func (r *FileAppRepository) GetBuildsByCommit(commit string) ([]*domain.BuildInfo, error) {
+	builds, err := r.allBuilds()
+	if err != nil {
+		return nil, err
+	}
+	var matching []*domain.BuildInfo
+	for _, build := range builds {
+		if build.Provenance != nil && build.Provenance.Commit != "" && strings.HasPrefix(build.Provenance.Commit, commit) {
+			matching = append(matching, build)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].CreatedAt.After(matching[j].CreatedAt)
+	})
+	return matching, nil
+}
+
+// UpdateBuild rewrites the build info of a build. It holds indexMu, so concurrent
+// updates can't undo each other and a build purged meanwhile isn't written back.
+func (r *FileAppRepository) UpdateBuild(build *domain.BuildInfo) error {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	existing, err := r.GetBuildByUploadID(build.UploadID)
+	if err != nil {
 		return err
 	}
-	if err := r.saveAppFile(info, appFile); err != nil {
+	if !r.indexed(existing) {
+		return fmt.Errorf("%w: build %s is not in the index of %s", application.ErrBuildNotFound, existing.UploadID, existing.BundleID)
+	}
+	existing.Title = build.Title
+	existing.Description = build.Description
+	existing.ReleaseNotes = build.ReleaseNotes
+	existing.ArchivedAt = build.ArchivedAt
+	existing.DeletedAt = build.DeletedAt
+	return r.saveBuildInfo(existing)
+}
+
+func (r *FileAppRepository) GetDeletedBuilds(before time.Time) ([]*domain.BuildInfo, error) {
+	builds, err := r.allBuilds()
+	if err != nil {
+		return nil, err
+	}
+	var deleted []*domain.BuildInfo
+	for _, build := range builds {
+		if build.DeletedAt != nil && build.DeletedAt.Before(before) {
+			deleted = append(deleted, build)
+		}
+	}
+	return deleted, nil
+}
+
+// PurgeBuild removes a build from its index with its promotions and feedback, then
+// deletes its files. The app file is kept while other builds share its content.
+func (r *FileAppRepository) PurgeBuild(build *domain.BuildInfo) error {
+	if build.SHA256 != "" {
+		defer r.contentLocks.lock(build.SHA256)()
+	}
+	if err := r.removeFromIndex(build); err != nil {
+		return err
+	}
+	if err := r.removePromotions(build.UploadID); err != nil {
+		return err
+	}
+	if err := r.removeFeedback(build.UploadID); err != nil {
 		return err
 	}
-	if err := r.updateIndex(info); err != nil {
+
+	builds, err := r.allBuilds()
+	if err != nil {
 		return err
 	}
+	shared := false
+	for _, other := range builds {
+		if build.SHA256 != "" && other.SHA256 == build.SHA256 {
+			shared = true
+			break
+		}
+	}
+
+	keys := []string{path.Join(build.UploadID, iconFileName)}
+	if !shared {
+		keys = append(keys, appFileKey(build, build.UploadID))
+	}
+	if err := deleteBlobs(r.blobs, keys); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(StorageDir, build.UploadID)); err != nil {
+		return fmt.Errorf("failed to delete build directory: %w", err)
+	}
 	return nil
 }
 
+// StageUpload streams the application file into the staging directory of the blob store.
+func (r *FileAppRepository) StageUpload(appFile io.Reader, maxSize int64) (*application.StagedUpload, error) {
+	return stageUpload(stagingDir(r.blobs), appFile, maxSize)
+}
+
+func (r *FileAppRepository) SaveUpload(info *domain.BuildInfo, upload *application.StagedUpload) error {
+	if !domain.ValidBundleID(info.BundleID) {
+		return fmt.Errorf("invalid bundle ID %q", info.BundleID)
+	}
+	defer r.contentLocks.lock(upload.SHA256)()
+
+	// The check and the index update happen under one lock, so two uploads of the
+	// same build can't both pass the check
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	if r.buildExists(info) {
+		return application.ErrBuildExists
+	}
+	if err := r.saveBuildInfo(info); err != nil {
+		return errors.Join(err, r.removeBuildDir(info))
+	}
+	if err := putContent(r.blobs, upload); err != nil {
+		return errors.Join(err, r.removeBuildDir(info))
+	}
+	if err := r.addToIndex(info); err != nil {
+		return errors.Join(err, r.removeBuildDir(info))
+	}
+	return nil
+}
+
+// removeBuildDir removes the directory of a build that could not be saved.
+func (r *FileAppRepository) removeBuildDir(info *domain.BuildInfo) error {
+	if err := os.RemoveAll(filepath.Join(StorageDir, info.UploadID)); err != nil {
+		return fmt.Errorf("failed to delete directory of unsaved build: %w", err)
+	}
+	return nil
+}
+
+// SaveIcon saves the app icon next to the application file.
+func (r *FileAppRepository) SaveIcon(info *domain.BuildInfo, icon []byte) error {
+	if err := r.blobs.Put(path.Join(info.UploadID, iconFileName), bytes.NewReader(icon), int64(len(icon))); err != nil {
+		return fmt.Errorf("failed to save icon: %w", err)
+	}
+	return nil
+}
+
+// OpenAppFile opens the application file of a build.
+func (r *FileAppRepository) OpenAppFile(info *domain.BuildInfo) (io.ReadSeekCloser, *application.BlobInfo, error) {
+	return openBlob(r.blobs, appFileKey(info, info.UploadID))
+}
+
+// OpenIcon opens the app icon of a build.
+func (r *FileAppRepository) OpenIcon(info *domain.BuildInfo) (io.ReadSeekCloser, *application.BlobInfo, error) {
+	return openBlob(r.blobs, path.Join(info.UploadID, iconFileName))
+}
+
+func (r *FileAppRepository) GetChannels(bundleID string) ([]*domain.Channel, error) {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+
+	all, err := loadJSONList[*domain.Channel](channelsFileName)
+	if err != nil {
+		return nil, err
+	}
+	var channels []*domain.Channel
+	for _, channel := range all {
+		if channel.BundleID == bundleID {
+			channels = append(channels, channel)
+		}
+	}
+	return channels, nil
+}
+
+func (r *FileAppRepository) GetChannel(bundleID, name string) (*domain.Channel, error) {
+	channels, err := r.GetChannels(bundleID)
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if channel.Name == name {
+			return channel, nil
+		}
+	}
+	return nil, application.ErrChannelNotFound
+}
+
+func (r *FileAppRepository) SavePromotion(promotion *domain.Promotion) error {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+
+	channels, err := loadJSONList[*domain.Channel](channelsFileName)
+	if err != nil {
+		return err
+	}
+	channel := &domain.Channel{
+		BundleID:  promotion.BundleID,
+		Name:      promotion.Channel,
+		UploadID:  promotion.UploadID,
+		UpdatedAt: promotion.PromotedAt,
+		UpdatedBy: promotion.PromotedBy,
+	}
+	saved := false
+	for i, existing := range channels {
+		if existing.BundleID == channel.BundleID && existing.Name == channel.Name {
+			channels[i] = channel
+			saved = true
+			break
+		}
+	}
+	if !saved {
+		channels = append(channels, channel)
+		sort.Slice(channels, func(i, j int) bool {
+			if channels[i].BundleID != channels[j].BundleID {
+				return channels[i].BundleID < channels[j].BundleID
+			}
+			return channels[i].Name < channels[j].Name
+		})
+	}
+
+	promotions, err := loadJSONList[*domain.Promotion](promotionsFileName)
+	if err != nil {
+		return err
+	}
+	// Record the promotion first, so a failure in between never leaves a channel
+	// change without a record of who made it
+	if err := saveJSONList(promotionsFileName, append(promotions, promotion)); err != nil {
+		return err
+	}
+	return saveJSONList(channelsFileName, channels)
+}
+
+func (r *FileAppRepository) GetPromotions(bundleID, channel string) ([]*domain.Promotion, error) {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+
+	all, err := loadJSONList[*domain.Promotion](promotionsFileName)
+	if err != nil {
+		return nil, err
+	}
+	var promotions []*domain.Promotion
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].BundleID == bundleID && (channel == "" || all[i].Channel == channel) {
+			promotions = append(promotions, all[i])
+		}
+	}
+	return promotions, nil
+}
+
+func (r *FileAppRepository) SaveFeedback(feedback *domain.Feedback) error {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+
+	all, err := loadJSONList[*domain.Feedback](feedbackFileName)
+	if err != nil {
+		return err
+	}
+	return saveJSONList(feedbackFileName, append(all, feedback))
+}
+
+func (r *FileAppRepository) GetFeedback(uploadID string) ([]*domain.Feedback, error) {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+
+	all, err := loadJSONList[*domain.Feedback](feedbackFileName)
+	if err != nil {
+		return nil, err
+	}
+	var feedback []*domain.Feedback
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].UploadID == uploadID {
+			feedback = append(feedback, all[i])
+		}
+	}
+	return feedback, nil
+}
+
+// GetProducts returns the products sorted by ID. The apps of a product are those
+// whose ProductID refers to it.
+func (r *FileAppRepository) GetProducts() ([]*domain.Product, error) {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+
+	products, err := loadJSONList[*domain.Product](productsFileName)
+	if err != nil {
+		return nil, err
+	}
+	apps, err := loadJSONList[*domain.App](appsFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, product := range products {
+		product.Apps = make(map[domain.Platform]string)
+		for _, app := range apps {
+			if app.ProductID == product.ID {
+				product.Apps[app.Platform] = app.BundleID
+			}
+		}
+	}
+	return products, nil
+}
+
+func (r *FileAppRepository) GetProduct(id string) (*domain.Product, error) {
+	products, err := r.GetProducts()
+	if err != nil {
+		return nil, err
+	}
+	for _, product := range products {
+		if product.ID == id {
+			return product, nil
+		}
+	}
+	return nil, application.ErrProductNotFound
+}
+
+func (r *FileAppRepository) CreateProduct(product *domain.Product) error {
+	return r.updateProducts(product.ID, product.Apps, func(products []*domain.Product) ([]*domain.Product, error) {
+		for _, existing := range products {
+			if existing.ID == product.ID {
+				return nil, application.ErrProductExists
+			}
+		}
+		products = append(products, &domain.Product{ID: product.ID, Name: product.Name, CreatedAt: product.CreatedAt})
+		sort.Slice(products, func(i, j int) bool {
+			return products[i].ID < products[j].ID
+		})
+		return products, nil
+	})
+}
+
+func (r *FileAppRepository) UpdateProduct(product *domain.Product) error {
+	return r.updateProducts(product.ID, product.Apps, func(products []*domain.Product) ([]*domain.Product, error) {
+		for _, existing := range products {
+			if existing.ID == product.ID {
+				existing.Name = product.Name
+				return products, nil
+			}
+		}
+		return nil, application.ErrProductNotFound
+	})
+}
+
+func (r *FileAppRepository) DeleteProduct(id string) error {
+	return r.updateProducts(id, nil, func(products []*domain.Product) ([]*domain.Product, error) {
+		for i, existing := range products {
+			if existing.ID == id {
+				return append(products[:i], products[i+1:]...), nil
+			}
+		}
+		return nil, application.ErrProductNotFound
+	})
+}
+
+// updateProducts applies update to the list of products and links exactly the apps
+// in apps to the product with id. Apps of other products are not moved.
+func (r *FileAppRepository) updateProducts(id string, apps map[domain.Platform]string, update func(products []*domain.Product) ([]*domain.Product, error)) error {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+
+	products, err := loadJSONList[*domain.Product](productsFileName)
+	if err != nil {
+		return err
+	}
+	if products, err = update(products); err != nil {
+		return err
+	}
+	for _, product := range products {
+		// The apps of a product are stored with the apps
+		product.Apps = nil
+	}
+
+	allApps, err := loadJSONList[*domain.App](appsFileName)
+	if err != nil {
+		return err
+	}
+	linked := make(map[string]bool, len(apps))
+	for _, bundleID := range apps {
+		linked[bundleID] = true
+	}
+	for _, app := range allApps {
+		if linked[app.BundleID] {
+			if app.ProductID != "" && app.ProductID != id {
+				return fmt.Errorf("%w: %s belongs to %s", application.ErrAppInProduct, app.BundleID, app.ProductID)
+			}
+			app.ProductID = id
+			delete(linked, app.BundleID)
+		} else if app.ProductID == id {
+			app.ProductID = ""
+		}
+	}
+	if len(linked) > 0 {
+		return application.ErrAppNotFound
+	}
+
+	if err := saveJSONList(appsFileName, allApps); err != nil {
+		return err
+	}
+	return saveJSONList(productsFileName, products)
+}
+
+// buildExists reports whether a build with the same version, build number and platform
+// as info has already been saved.
+func (r *FileAppRepository) buildExists(info *domain.BuildInfo) bool {
+	builds, err := r.GetAllVersions(info.BundleID)
+	if err != nil {
+		return false
+	}
+	for _, build := range builds {
+		if build.Version == info.Version && build.BuildNumber == info.BuildNumber && build.Platform == info.Platform {
+			return true
+		}
+	}
+	return false
+}
+
+// indexed reports whether a build is in the index of its bundle ID. The caller holds indexMu.
+func (r *FileAppRepository) indexed(info *domain.BuildInfo) bool {
+	index, err := r.getIndexEntriesForBundleID(info.BundleID)
+	if err != nil {
+		return false
+	}
+	for _, entry := range index {
+		if entry.UploadID == info.UploadID {
+			return true
+		}
+	}
+	return false
+}
+
+// allBuilds returns the builds of every app.
+func (r *FileAppRepository) allBuilds() ([]*domain.BuildInfo, error) {
+	bundleIDFiles, err := os.ReadDir(filepath.Join(StorageDir, indexesDir, byBundleIDDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle ID index directory: %w", err)
+	}
+
+	var builds []*domain.BuildInfo
+	for _, file := range bundleIDFiles {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		appBuilds, err := r.GetAllVersions(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, appBuilds...)
+	}
+	return builds, nil
+}
+
+// removePromotions removes the promotions of the build with uploadID.
+func (r *FileAppRepository) removePromotions(uploadID string) error {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+
+	promotions, err := loadJSONList[*domain.Promotion](promotionsFileName)
+	if err != nil {
+		return err
+	}
+	kept := promotions[:0]
+	for _, promotion := range promotions {
+		if promotion.UploadID != uploadID {
+			kept = append(kept, promotion)
+		}
+	}
+	if len(kept) == len(promotions) {
+		return nil
+	}
+	return saveJSONList(promotionsFileName, kept)
+}
+
+// removeFeedback removes the feedback on the build with uploadID.
+func (r *FileAppRepository) removeFeedback(uploadID string) error {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+
+	all, err := loadJSONList[*domain.Feedback](feedbackFileName)
+	if err != nil {
+		return err
+	}
+	kept := all[:0]
+	for _, feedback := range all {
+		if feedback.UploadID != uploadID {
+			kept = append(kept, feedback)
+		}
+	}
+	if len(kept) == len(all) {
+		return nil
+	}
+	return saveJSONList(feedbackFileName, kept)
+}
+
+// updateApps applies update to the list of apps and saves the result sorted by
+// bundle ID, unless update returns an error.
+func (r *FileAppRepository) updateApps(update func(apps []*domain.App) ([]*domain.App, error)) error {
+	r.listsMu.Lock()
+	defer r.listsMu.Unlock()
+
+	apps, err := loadJSONList[*domain.App](appsFileName)
+	if err != nil {
+		return err
+	}
+	if apps, err = update(apps); err != nil {
+		return err
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].BundleID < apps[j].BundleID
+	})
+	return saveJSONList(appsFileName, apps)
+}
+
+// loadJSONList reads a list kept as a JSON file in StorageDir.
+func loadJSONList[T any](fileName string) ([]T, error) {
+	data, err := os.ReadFile(filepath.Join(StorageDir, fileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", fileName, err)
+	}
+
+	var list []T
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", fileName, err)
+	}
+	return list, nil
+}
+
+// saveJSONList replaces a list kept as a JSON file in StorageDir.
+func saveJSONList[T any](fileName string, list []T) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", fileName, err)
+	}
+	return writeFileAtomic(filepath.Join(StorageDir, fileName), data)
+}
+
 // getBuildInfo loads the build metadata from a file.
 func (r *FileAppRepository) getBuildInfo(uploadID string) (*domain.BuildInfo, error) {
 	filePath := filepath.Join(StorageDir, uploadID, buildInfoFileName)
 	file, err := os.Open(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("build info not found for upload ID %s", uploadID)
+			return nil, fmt.Errorf("%w: no build info for upload ID %s", application.ErrBuildNotFound, uploadID)
 		}
 		return nil, fmt.Errorf("failed to open build info file: %w", err)
 	}
@@ -132,7 +756,7 @@ func (r *FileAppRepository) getIndexEntriesForBundleID(bundleID string) ([]Index
 	file, err := os.Open(indexFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("no versions found for bundle ID %s", bundleID)
+			return nil, fmt.Errorf("%w: no versions found for bundle ID %s", application.ErrBuildNotFound, bundleID)
 		}
 		return nil, fmt.Errorf("failed to open index file: %w", err)
 	}
@@ -147,18 +771,6 @@ func (r *FileAppRepository) getIndexEntriesForBundleID(bundleID string) ([]Index
 	return index, nil
 }
 
-// getLatestUploadIDForBundleID returns the upload ID of the latest version for a given bundle ID.
-func (r *FileAppRepository) getLatestUploadIDForBundleID(bundleID string) (string, error) {
-	index, err := r.getIndexEntriesForBundleID(bundleID)
-	if err != nil {
-		return "", err
-	}
-	if len(index) == 0 {
-		return "", fmt.Errorf("no versions found for bundle ID %s", bundleID)
-	}
-	return index[0].UploadID, nil
-}
-
 // saveBuildInfo saves the build metadata to a file.
 func (r *FileAppRepository) saveBuildInfo(info *domain.BuildInfo) error {
 	uploadDir := filepath.Join(StorageDir, info.UploadID)
@@ -166,59 +778,27 @@ func (r *FileAppRepository) saveBuildInfo(info *domain.BuildInfo) error {
 		return fmt.Errorf("failed to create upload directory: %w", err)
 	}
 
-	filePath := filepath.Join(uploadDir, buildInfoFileName)
-	file, err := os.Create(filePath)
+	data, err := json.MarshalIndent(info, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to create build info file: %w", err)
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(info); err != nil {
 		return fmt.Errorf("failed to encode build info: %w", err)
 	}
-
-	return nil
-}
-
-// saveAppFile saves the application file.
-func (r *FileAppRepository) saveAppFile(info *domain.BuildInfo, appFile io.Reader) error {
-	uploadDir := filepath.Join(StorageDir, info.UploadID)
-	fileName := "app.ipa"
-	if info.Platform == domain.Android {
-		fileName = "app.apk"
-	}
-	filePath := filepath.Join(uploadDir, fileName)
-
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create app file: %w", err)
-	}
-	defer file.Close()
-
-	_, err = io.Copy(file, appFile)
-	if err != nil {
-		return fmt.Errorf("failed to save app file: %w", err)
-	}
-
-	return nil
+	return writeFileAtomic(filepath.Join(uploadDir, buildInfoFileName), data)
 }
 
-// updateIndex adds a new entry to the bundle ID index.
-func (r *FileAppRepository) updateIndex(info *domain.BuildInfo) error {
+// addToIndex adds a new entry to the bundle ID index. The caller holds indexMu, and
+// the index is replaced atomically so a crash can't corrupt it.
+func (r *FileAppRepository) addToIndex(info *domain.BuildInfo) error {
 	indexFilePath := filepath.Join(StorageDir, indexesDir, byBundleIDDir, fmt.Sprintf("%s.json", info.BundleID))
 
 	var index []IndexEntry
-	file, err := os.Open(indexFilePath)
+	data, err := os.ReadFile(indexFilePath)
 	if err == nil {
 		// Index file exists, read it
-		decoder := json.NewDecoder(file)
-		if err := decoder.Decode(&index); err != nil && err != io.EOF {
-			file.Close()
-			return fmt.Errorf("failed to decode index file: %w", err)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &index); err != nil {
+				return fmt.Errorf("failed to decode index file: %w", err)
+			}
 		}
-		file.Close()
 	} else if !os.IsNotExist(err) {
 		return fmt.Errorf("failed to open index file: %w", err)
 	}
@@ -234,18 +814,44 @@ func (r *FileAppRepository) updateIndex(info *domain.BuildInfo) error {
 		return index[i].CreatedAt.After(index[j].CreatedAt)
 	})
 
-	// Write back to the index file
-	file, err = os.Create(indexFilePath)
+	data, err = json.MarshalIndent(index, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to create index file for writing: %w", err)
+		return fmt.Errorf("failed to encode index: %w", err)
 	}
-	defer file.Close()
+	return writeFileAtomic(indexFilePath, data)
+}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(index); err != nil {
-		return fmt.Errorf("failed to encode index: %w", err)
+// removeFromIndex removes a build from the bundle ID index, deleting the index once
+// it is empty.
+func (r *FileAppRepository) removeFromIndex(info *domain.BuildInfo) error {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	indexFilePath := filepath.Join(StorageDir, indexesDir, byBundleIDDir, fmt.Sprintf("%s.json", info.BundleID))
+	index, err := r.getIndexEntriesForBundleID(info.BundleID)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	kept := index[:0]
+	for _, entry := range index {
+		if entry.UploadID != info.UploadID {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == len(index) {
+		return fmt.Errorf("%w: build %s is not in the index of %s", application.ErrBuildNotFound, info.UploadID, info.BundleID)
+	}
+	if len(kept) == 0 {
+		if err := os.Remove(indexFilePath); err != nil {
+			return fmt.Errorf("failed to delete index file: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	return writeFileAtomic(indexFilePath, data)
 }
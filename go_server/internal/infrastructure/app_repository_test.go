@@ -0,0 +1,425 @@
+package infrastructure_test
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"app-distribution-server-go/internal/infrastructure"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The app repository tests run against every backend. The file and SQLite backends
+// always run; Postgres runs when TEST_DATABASE_URL points to a database the tests may
+// write to.
+
+func TestFileAppRepository(t *testing.T) {
+	// The file backend keeps its metadata in StorageDir below the working directory
+	t.Chdir(t.TempDir())
+
+	testAppRepository(t, func(blobs application.BlobStore) application.AppRepository {
+		repo, err := infrastructure.NewFileAppRepository(blobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+func TestSQLiteAppRepository(t *testing.T) {
+	t.Setenv("DATABASE_URL", "sqlite://"+filepath.Join(t.TempDir(), "test.db"))
+	db, err := infrastructure.NewSQLiteConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := infrastructure.MigrateSQLiteDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	testAppRepository(t, func(blobs application.BlobStore) application.AppRepository {
+		repo, err := infrastructure.NewSQLiteAppRepository(db, blobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+func TestPostgresAppRepository(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	t.Setenv("DATABASE_URL", databaseURL)
+	db, err := infrastructure.NewDBConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := infrastructure.MigrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	testAppRepository(t, func(blobs application.BlobStore) application.AppRepository {
+		repo, err := infrastructure.NewPostgresAppRepository(db, blobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+// testAppRepository runs the shared tests against the repositories newRepo returns.
+// Every test uses its own blob store and bundle ID, so they don't depend on what is
+// already in the database.
+func testAppRepository(t *testing.T, newRepo func(blobs application.BlobStore) application.AppRepository) {
+	setup := func(t *testing.T) (application.AppRepository, string) {
+		blobs, err := infrastructure.NewLocalBlobStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo := newRepo(blobs)
+		bundleID := "com.example.test" + uuid.NewString()[:8]
+		app := &domain.App{BundleID: bundleID, Platform: domain.Android, Name: "Test", CreatedAt: time.Now()}
+		if err := repo.CreateApp(app); err != nil {
+			t.Fatal(err)
+		}
+		return repo, bundleID
+	}
+
+	t.Run("SaveUpload", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		build := saveBuild(t, repo, bundleID, "1.0", "1", []byte("app"))
+
+		saved, err := repo.GetBuild(bundleID, domain.Android, "1.0", "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.UploadID != build.UploadID || saved.SHA256 != build.SHA256 {
+			t.Errorf("GetBuild() = %+v, want %+v", saved, build)
+		}
+		if got := readAppFile(t, repo, saved); got != "app" {
+			t.Errorf("app file = %q, want %q", got, "app")
+		}
+	})
+
+	t.Run("GetBuild of builds that only differ by platform", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		android := saveBuild(t, repo, bundleID, "1.0", "1", []byte("apk"))
+		ios := newBuild(bundleID, "1.0", "1")
+		ios.Platform, ios.ArtifactType = domain.IOS, domain.IPA
+		upload := stage(t, repo, []byte("ipa"))
+		ios.FileSize, ios.SHA256 = upload.Size, upload.SHA256
+		if err := repo.SaveUpload(ios, upload); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, want := range []*domain.BuildInfo{android, ios} {
+			got, err := repo.GetBuild(bundleID, want.Platform, "1.0", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.UploadID != want.UploadID {
+				t.Errorf("GetBuild(%s) = build %s, want %s", want.Platform, got.UploadID, want.UploadID)
+			}
+		}
+	})
+
+	t.Run("GetBuildsByCommit", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		// A commit of its own, since other tests may share the database
+		commit := strings.ReplaceAll(uuid.NewString(), "-", "")
+		var builds []*domain.BuildInfo
+		for i, provenance := range []*domain.Provenance{
+			{Commit: commit, Branch: "main", Tag: "v1.0", RepositoryURL: "https://example.com/app.git", CIProvider: "github-actions", PipelineURL: "https://example.com/runs/1", Variant: "release"},
+			{Commit: commit, Variant: "debug"},
+			{Commit: "0000000" + commit[7:]},
+			nil,
+		} {
+			build := newBuild(bundleID, "1.0", fmt.Sprint(i+1))
+			build.CreatedAt = time.Now().Add(time.Duration(i) * time.Minute)
+			build.Provenance = provenance
+			upload := stage(t, repo, []byte("app"))
+			build.FileSize, build.SHA256 = upload.Size, upload.SHA256
+			if err := repo.SaveUpload(build, upload); err != nil {
+				t.Fatal(err)
+			}
+			builds = append(builds, build)
+		}
+
+		// Abbreviated commits match too, and the builds are newest first
+		for _, query := range []string{commit, commit[:7]} {
+			got, err := repo.GetBuildsByCommit(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 || got[0].UploadID != builds[1].UploadID || got[1].UploadID != builds[0].UploadID {
+				t.Fatalf("GetBuildsByCommit(%s) = %d builds, want builds 2 and 1", query, len(got))
+			}
+			if *got[1].Provenance != *builds[0].Provenance {
+				t.Errorf("GetBuildsByCommit(%s) provenance = %+v, want %+v", query, got[1].Provenance, builds[0].Provenance)
+			}
+		}
+	})
+
+	t.Run("SaveUpload rejects duplicate builds", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		saveBuild(t, repo, bundleID, "1.0", "1", []byte("app"))
+
+		build := newBuild(bundleID, "1.0", "1")
+		upload := stage(t, repo, []byte(bundleID+" other"))
+		build.FileSize, build.SHA256 = upload.Size, upload.SHA256
+		err := repo.SaveUpload(build, upload)
+		if !errors.Is(err, application.ErrBuildExists) {
+			t.Errorf("SaveUpload() error = %v, want %v", err, application.ErrBuildExists)
+		}
+		// The app file of the rejected build is not left behind
+		if _, _, err := repo.OpenAppFile(build); !errors.Is(err, application.ErrBlobNotFound) {
+			t.Errorf("OpenAppFile() of rejected build error = %v, want %v", err, application.ErrBlobNotFound)
+		}
+	})
+
+	t.Run("UpdateBuild", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		build := saveBuild(t, repo, bundleID, "1.0", "1", []byte("app"))
+
+		archivedAt := time.Now().UTC().Truncate(time.Second)
+		update := *build
+		update.Title, update.ReleaseNotes, update.ArchivedAt = "Renamed", "Fixes", &archivedAt
+		// Only the editable fields are saved
+		update.Version = "2.0"
+		if err := repo.UpdateBuild(&update); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := repo.GetBuildByUploadID(build.UploadID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Title != "Renamed" || saved.ReleaseNotes != "Fixes" || saved.ArchivedAt == nil || !saved.ArchivedAt.Equal(archivedAt) || saved.Version != "1.0" {
+			t.Errorf("GetBuildByUploadID() after UpdateBuild() = %+v", saved)
+		}
+	})
+
+	t.Run("UpdateBuild during a purge", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		for i := range 20 {
+			build := saveBuild(t, repo, bundleID, "1.0", fmt.Sprint(i), []byte(fmt.Sprintf("%s %d", bundleID, i)))
+
+			var wg sync.WaitGroup
+			var purgeErr, updateErr error
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				purgeErr = repo.PurgeBuild(build)
+			}()
+			go func() {
+				defer wg.Done()
+				update := *build
+				update.Title = "Renamed"
+				updateErr = repo.UpdateBuild(&update)
+			}()
+			wg.Wait()
+			if purgeErr != nil || (updateErr != nil && !errors.Is(updateErr, application.ErrBuildNotFound)) {
+				t.Fatalf("PurgeBuild() error = %v, UpdateBuild() error = %v", purgeErr, updateErr)
+			}
+
+			// The update doesn't bring the purged build back
+			if _, err := repo.GetBuildByUploadID(build.UploadID); !errors.Is(err, application.ErrBuildNotFound) {
+				t.Fatalf("GetBuildByUploadID() of purged build error = %v, want %v", err, application.ErrBuildNotFound)
+			}
+		}
+	})
+
+	t.Run("Products don't take apps of other products", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		id := "product-" + uuid.NewString()[:8]
+		first := &domain.Product{ID: id + "-a", Name: "A", Apps: map[domain.Platform]string{domain.Android: bundleID}, CreatedAt: time.Now()}
+		if err := repo.CreateProduct(first); err != nil {
+			t.Fatal(err)
+		}
+		second := &domain.Product{ID: id + "-b", Name: "B", Apps: map[domain.Platform]string{domain.Android: bundleID}, CreatedAt: time.Now()}
+		if err := repo.CreateProduct(second); !errors.Is(err, application.ErrAppInProduct) {
+			t.Errorf("CreateProduct() with the app of another product error = %v, want %v", err, application.ErrAppInProduct)
+		}
+
+		second.Apps = nil
+		if err := repo.CreateProduct(second); err != nil {
+			t.Fatal(err)
+		}
+		second.Apps = map[domain.Platform]string{domain.Android: bundleID}
+		if err := repo.UpdateProduct(second); !errors.Is(err, application.ErrAppInProduct) {
+			t.Errorf("UpdateProduct() with the app of another product error = %v, want %v", err, application.ErrAppInProduct)
+		}
+		// Updating a product with its own apps is fine
+		if err := repo.UpdateProduct(first); err != nil {
+			t.Errorf("UpdateProduct() with its own apps error = %v", err)
+		}
+		app, err := repo.GetApp(bundleID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.ProductID != first.ID {
+			t.Errorf("ProductID = %q, want %q", app.ProductID, first.ID)
+		}
+	})
+
+	t.Run("PurgeBuild keeps shared app files", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		// The content is unique to the test, so no other build in the database shares it
+		content := []byte(bundleID)
+		first := saveBuild(t, repo, bundleID, "1.0", "1", content)
+		second := saveBuild(t, repo, bundleID, "1.0", "2", content)
+
+		if err := repo.PurgeBuild(first); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.GetBuild(bundleID, domain.Android, "1.0", "1"); !errors.Is(err, application.ErrBuildNotFound) {
+			t.Errorf("GetBuild() of purged build error = %v, want %v", err, application.ErrBuildNotFound)
+		}
+		if got := readAppFile(t, repo, second); got != bundleID {
+			t.Errorf("app file of remaining build = %q, want %q", got, bundleID)
+		}
+
+		if err := repo.PurgeBuild(second); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := repo.OpenAppFile(second); !errors.Is(err, application.ErrBlobNotFound) {
+			t.Errorf("OpenAppFile() of unused app file error = %v, want %v", err, application.ErrBlobNotFound)
+		}
+	})
+
+	t.Run("PurgeBuild removes feedback", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		first := saveBuild(t, repo, bundleID, "1.0", "1", []byte(bundleID+" 1"))
+		second := saveBuild(t, repo, bundleID, "1.0", "2", []byte(bundleID+" 2"))
+		now := time.Now().UTC().Truncate(time.Second)
+		for i, build := range []*domain.BuildInfo{first, first, second} {
+			feedback := &domain.Feedback{
+				ID:        uuid.NewString(),
+				BundleID:  bundleID,
+				UploadID:  build.UploadID,
+				Author:    "tester@example.com",
+				Message:   fmt.Sprint("feedback ", i),
+				CreatedAt: now.Add(time.Duration(i) * time.Minute),
+			}
+			if err := repo.SaveFeedback(feedback); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		feedback, err := repo.GetFeedback(first.UploadID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(feedback) != 2 || feedback[0].Message != "feedback 1" || feedback[1].Message != "feedback 0" || feedback[0].Author != "tester@example.com" {
+			t.Errorf("GetFeedback() = %+v, want feedback 1 and 0", feedback)
+		}
+
+		if err := repo.PurgeBuild(first); err != nil {
+			t.Fatal(err)
+		}
+		if feedback, err := repo.GetFeedback(first.UploadID); err != nil || len(feedback) != 0 {
+			t.Errorf("GetFeedback() of purged build = %+v, %v, want none", feedback, err)
+		}
+		if feedback, err := repo.GetFeedback(second.UploadID); err != nil || len(feedback) != 1 {
+			t.Errorf("GetFeedback() of remaining build = %+v, %v, want its feedback", feedback, err)
+		}
+	})
+
+	t.Run("PurgeBuild of a missing build", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		build := newBuild(bundleID, "1.0", "1")
+		build.SHA256 = "0000000000000000000000000000000000000000000000000000000000000000"
+		if err := repo.PurgeBuild(build); !errors.Is(err, application.ErrBuildNotFound) {
+			t.Errorf("PurgeBuild() error = %v, want %v", err, application.ErrBuildNotFound)
+		}
+	})
+
+	t.Run("PurgeBuild during an upload of the same content", func(t *testing.T) {
+		repo, bundleID := setup(t)
+		for i := range 20 {
+			content := []byte(fmt.Sprintf("%s %d", bundleID, i))
+			purged := saveBuild(t, repo, bundleID, "1.0", fmt.Sprintf("%d-a", i), content)
+			build := newBuild(bundleID, "1.0", fmt.Sprintf("%d-b", i))
+			upload := stage(t, repo, content)
+
+			var wg sync.WaitGroup
+			var purgeErr, saveErr error
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				purgeErr = repo.PurgeBuild(purged)
+			}()
+			go func() {
+				defer wg.Done()
+				build.FileSize, build.SHA256 = upload.Size, upload.SHA256
+				saveErr = repo.SaveUpload(build, upload)
+			}()
+			wg.Wait()
+			if purgeErr != nil || saveErr != nil {
+				t.Fatalf("PurgeBuild() error = %v, SaveUpload() error = %v", purgeErr, saveErr)
+			}
+
+			if got := readAppFile(t, repo, build); got != string(content) {
+				t.Fatalf("app file of build saved during purge = %q, want %q", got, content)
+			}
+		}
+	})
+}
+
+func newBuild(bundleID, version, buildNumber string) *domain.BuildInfo {
+	return &domain.BuildInfo{
+		UploadID:     uuid.NewString(),
+		BundleID:     bundleID,
+		Version:      version,
+		BuildNumber:  buildNumber,
+		Title:        "Test",
+		CreatedAt:    time.Now(),
+		Platform:     domain.Android,
+		ArtifactType: domain.APK,
+	}
+}
+
+func stage(t *testing.T, repo application.AppRepository, content []byte) *application.StagedUpload {
+	t.Helper()
+	upload, err := repo.StageUpload(bytes.NewReader(content), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return upload
+}
+
+func saveBuild(t *testing.T, repo application.AppRepository, bundleID, version, buildNumber string, content []byte) *domain.BuildInfo {
+	t.Helper()
+	build := newBuild(bundleID, version, buildNumber)
+	upload := stage(t, repo, content)
+	build.FileSize, build.SHA256 = upload.Size, upload.SHA256
+	if err := repo.SaveUpload(build, upload); err != nil {
+		t.Fatal(err)
+	}
+	return build
+}
+
+func readAppFile(t *testing.T, repo application.AppRepository, build *domain.BuildInfo) string {
+	t.Helper()
+	file, _, err := repo.OpenAppFile(build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,90 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"sync"
+)
+
+// NewBlobStore returns the blob store selected by the BLOB_STORE environment variable.
+// "local" (the default) stores blobs below root. "s3" stores them in the bucket
+// configured by S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY, S3_SECRET_KEY and
+// S3_USE_SSL, so several replicas can share them.
+func NewBlobStore(root string) (application.BlobStore, error) {
+	switch backend := os.Getenv("BLOB_STORE"); backend {
+	case "", "local":
+		return NewLocalBlobStore(root)
+	case "s3":
+		config := S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			UseSSL:    os.Getenv("S3_USE_SSL") != "false",
+		}
+		if config.Endpoint == "" || config.Bucket == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET environment variables are required for the s3 blob store")
+		}
+		return NewS3BlobStore(config)
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q", backend)
+	}
+}
+
+// appFileKey returns the blob key of a build's application file. App files are
+// stored by their SHA-256 digest, so identical uploads share a blob; builds stored
+// before that keep their file in buildDir.
+func appFileKey(info *domain.BuildInfo, buildDir string) string {
+	if info.SHA256 != "" {
+		return contentKey(info.SHA256)
+	}
+	return path.Join(buildDir, info.FileName())
+}
+
+// contentKey returns the blob key of content with the given SHA-256 digest.
+func contentKey(digest string) string {
+	return path.Join("sha256", digest[:2], digest)
+}
+
+// contentLocks serializes the saving and purging of builds whose app files have the
+// same digest, so a purge can't delete content that a concurrent upload relies on.
+// Digests are spread over a fixed set of mutexes; the zero value is ready to use.
+type contentLocks [64]sync.Mutex
+
+// lock locks the content with digest and returns the function that unlocks it.
+func (l *contentLocks) lock(digest string) func() {
+	hash := fnv.New32a()
+	hash.Write([]byte(digest))
+	mu := &l[hash.Sum32()%uint32(len(l))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// putContent stores a staged upload under its content key. If a blob with the same
+// digest is already stored, the staged upload is discarded instead.
+func putContent(store application.BlobStore, upload *application.StagedUpload) error {
+	key := contentKey(upload.SHA256)
+	if _, err := store.Stat(key); err == nil {
+		return upload.Remove()
+	} else if !errors.Is(err, application.ErrBlobNotFound) {
+		return err
+	}
+	return putStagedUpload(store, key, upload)
+}
+
+// deleteBlobs deletes the blobs with keys, trying all of them even if some fail.
+func deleteBlobs(store application.BlobStore, keys []string) error {
+	var errs []error
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete blob %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,176 @@
+package infrastructure
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// UncrushPNG converts a PNG optimized by Xcode ("CgBI" format) back into a standard PNG.
+// CgBI images store raw deflate data without a zlib header and premultiplied BGRA pixels,
+// which browsers cannot display. Standard PNGs are returned unchanged.
+func UncrushPNG(data []byte) ([]byte, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].typ != "CgBI" {
+		return data, nil
+	}
+
+	var width, height int
+	var compressed bytes.Buffer
+	for _, chunk := range chunks {
+		switch chunk.typ {
+		case "IHDR":
+			if len(chunk.data) < 13 {
+				return nil, fmt.Errorf("invalid IHDR chunk")
+			}
+			width = int(binary.BigEndian.Uint32(chunk.data[0:4]))
+			height = int(binary.BigEndian.Uint32(chunk.data[4:8]))
+			bitDepth, colorType, interlace := chunk.data[8], chunk.data[9], chunk.data[12]
+			// Xcode always writes 8-bit, non-interlaced RGBA
+			if bitDepth != 8 || colorType != 6 || interlace != 0 {
+				return nil, fmt.Errorf("unsupported CgBI image format")
+			}
+		case "IDAT":
+			compressed.Write(chunk.data)
+		}
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("missing IHDR chunk")
+	}
+
+	raw, err := io.ReadAll(flate.NewReader(&compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inflate CgBI image data: %w", err)
+	}
+
+	const bpp = 4
+	stride := width * bpp
+	if len(raw) < height*(stride+1) {
+		return nil, fmt.Errorf("truncated CgBI image data")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	prev := make([]byte, stride)
+	for y := 0; y < height; y++ {
+		row := raw[y*(stride+1) : (y+1)*(stride+1)]
+		line := row[1:]
+		if err := unfilterPNGRow(row[0], line, prev, bpp); err != nil {
+			return nil, err
+		}
+
+		out := img.Pix[y*img.Stride : y*img.Stride+stride]
+		for x := 0; x < stride; x += bpp {
+			b, g, r, a := line[x], line[x+1], line[x+2], line[x+3]
+			if a != 0 && a != 0xff {
+				r = unpremultiply(r, a)
+				g = unpremultiply(g, a)
+				b = unpremultiply(b, a)
+			}
+			out[x], out[x+1], out[x+2], out[x+3] = r, g, b, a
+		}
+		prev = line
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// readPNGChunks splits a PNG file into its chunks.
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("not a png file")
+	}
+
+	var chunks []pngChunk
+	for pos := len(pngSignature); pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		typ := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			return nil, fmt.Errorf("truncated %s chunk", typ)
+		}
+		chunks = append(chunks, pngChunk{typ: typ, data: data[pos+8 : pos+8+length]})
+		pos += 12 + length
+		if typ == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// unfilterPNGRow reverses the PNG filter applied to line in place.
+func unfilterPNGRow(filter byte, line, prev []byte, bpp int) error {
+	switch filter {
+	case 0: // None
+	case 1: // Sub
+		for i := bpp; i < len(line); i++ {
+			line[i] += line[i-bpp]
+		}
+	case 2: // Up
+		for i := range line {
+			line[i] += prev[i]
+		}
+	case 3: // Average
+		for i := range line {
+			var left int
+			if i >= bpp {
+				left = int(line[i-bpp])
+			}
+			line[i] += byte((left + int(prev[i])) / 2)
+		}
+	case 4: // Paeth
+		for i := range line {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = line[i-bpp], prev[i-bpp]
+			}
+			line[i] += paeth(left, prev[i], upLeft)
+		}
+	default:
+		return fmt.Errorf("invalid png filter type %d", filter)
+	}
+	return nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func unpremultiply(c, a byte) byte {
+	v := (int(c)*255 + int(a)/2) / int(a)
+	if v > 255 {
+		v = 255
+	}
+	return byte(v)
+}
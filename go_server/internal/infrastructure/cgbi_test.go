@@ -0,0 +1,119 @@
+package infrastructure
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// crushPNG returns a CgBI PNG of rows of premultiplied BGRA pixels the way Xcode writes
+// them, with each row filtered by filter.
+func crushPNG(t *testing.T, width int, rows [][]byte, filter byte) []byte {
+	t.Helper()
+	var raw bytes.Buffer
+	prev := make([]byte, width*4)
+	for _, row := range rows {
+		raw.WriteByte(filter)
+		for i := range row {
+			switch filter {
+			case 1:
+				if i >= 4 {
+					raw.WriteByte(row[i] - row[i-4])
+				} else {
+					raw.WriteByte(row[i])
+				}
+			case 2:
+				raw.WriteByte(row[i] - prev[i])
+			default:
+				raw.WriteByte(row[i])
+			}
+		}
+		prev = row
+	}
+	var compressed bytes.Buffer
+	deflater, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deflater.Write(raw.Bytes())
+	if err := deflater.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:4], uint32(width))
+	binary.BigEndian.PutUint32(header[4:8], uint32(len(rows)))
+	header[8], header[9] = 8, 6
+
+	data := bytes.NewBuffer(append([]byte(nil), pngSignature...))
+	for _, chunk := range []pngChunk{
+		{"CgBI", []byte{0x50, 0x00, 0x20, 0x02}},
+		{"IHDR", header},
+		{"IDAT", compressed.Bytes()},
+		{"IEND", nil},
+	} {
+		binary.Write(data, binary.BigEndian, uint32(len(chunk.data)))
+		data.WriteString(chunk.typ)
+		data.Write(chunk.data)
+		binary.Write(data, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(chunk.typ), chunk.data...)))
+	}
+	return data.Bytes()
+}
+
+func TestUncrushPNG(t *testing.T) {
+	// An opaque red pixel and a half transparent green one, premultiplied in BGRA order
+	rows := [][]byte{
+		{0x00, 0x00, 0xff, 0xff, 0x00, 0x80, 0x00, 0x80},
+		{0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff},
+	}
+	want := [][]color.NRGBA{
+		{{0xff, 0x00, 0x00, 0xff}, {0x00, 0xff, 0x00, 0x80}},
+		{{0x00, 0x00, 0x00, 0x00}, {0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, filter := range []byte{0, 1, 2} {
+		data, err := UncrushPNG(crushPNG(t, 2, rows, filter))
+		if err != nil {
+			t.Fatalf("UncrushPNG() with filter %d error = %v", filter, err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("UncrushPNG() with filter %d returned an invalid png: %v", filter, err)
+		}
+		if img.Bounds() != image.Rect(0, 0, 2, 2) {
+			t.Fatalf("UncrushPNG() with filter %d bounds = %v", filter, img.Bounds())
+		}
+		for y, row := range want {
+			for x, pixel := range row {
+				if got := color.NRGBAModel.Convert(img.At(x, y)); got != pixel {
+					t.Errorf("UncrushPNG() with filter %d pixel (%d, %d) = %v, want %v", filter, x, y, got, pixel)
+				}
+			}
+		}
+	}
+}
+
+func TestUncrushPNGStandard(t *testing.T) {
+	var standard bytes.Buffer
+	if err := png.Encode(&standard, image.NewNRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data, err := UncrushPNG(standard.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, standard.Bytes()) {
+		t.Error("UncrushPNG() changed a standard png")
+	}
+
+	if _, err := UncrushPNG([]byte("GIF89a")); err == nil {
+		t.Error("UncrushPNG() of a gif error = nil, want an error")
+	}
+	if _, err := UncrushPNG(crushPNG(t, 2, [][]byte{{0, 0, 0}}, 0)); err == nil {
+		t.Error("UncrushPNG() of truncated image data error = nil, want an error")
+	}
+}
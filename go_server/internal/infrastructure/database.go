@@ -2,10 +2,14 @@ package infrastructure
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4/stdlib"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 func NewDBConnection() (*sql.DB, error) {
@@ -26,24 +30,36 @@ func NewDBConnection() (*sql.DB, error) {
 	return db, nil
 }
 
+// MigrateDB applies the pending Postgres migrations.
 func MigrateDB(db *sql.DB) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS builds (
-			upload_id TEXT PRIMARY KEY,
-			bundle_id TEXT NOT NULL,
-			version TEXT NOT NULL,
-			build_number TEXT NOT NULL,
-			title TEXT NOT NULL,
-			icon TEXT,
-			description TEXT,
-			file_size BIGINT NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
-			platform TEXT NOT NULL
-		)
-	`
-	_, err := db.Exec(query)
+	return migrate(db, DialectPostgres)
+}
+
+// migrate applies the pending migrations of dialect and logs how many were applied.
+func migrate(db *sql.DB, dialect Dialect) error {
+	migrator, err := NewMigrator(db, dialect)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	applied, err := migrator.Up()
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
+	if applied > 0 {
+		fmt.Printf("Applied %d database migrations\n", applied)
+	}
 	return nil
 }
+
+// isUniqueViolation reports whether err is a Postgres or SQLite unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
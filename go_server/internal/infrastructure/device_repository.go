@@ -0,0 +1,102 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const devicesFileName = "_devices.json"
+
+// FileDeviceRepository keeps the registered devices in a single JSON file in StorageDir.
+type FileDeviceRepository struct {
+	mu sync.Mutex
+}
+
+// NewFileDeviceRepository initializes the storage and returns a new FileDeviceRepository.
+func NewFileDeviceRepository() (*FileDeviceRepository, error) {
+	if err := os.MkdirAll(StorageDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", StorageDir, err)
+	}
+	return &FileDeviceRepository{}, nil
+}
+
+func (r *FileDeviceRepository) GetDevices(tester string) ([]*domain.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all, err := r.loadDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*domain.Device
+	for _, device := range all {
+		if tester == "" || device.Tester == tester {
+			devices = append(devices, device)
+		}
+	}
+	sort.SliceStable(devices, func(i, j int) bool {
+		if devices[i].Tester != devices[j].Tester {
+			return devices[i].Tester < devices[j].Tester
+		}
+		return devices[i].CreatedAt.Before(devices[j].CreatedAt)
+	})
+
+	return devices, nil
+}
+
+// SaveDevice stores a device, updating its attributes if the tester already registered it.
+func (r *FileDeviceRepository) SaveDevice(device *domain.Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	devices, err := r.loadDevices()
+	if err != nil {
+		return err
+	}
+
+	saved := false
+	for _, existing := range devices {
+		if existing.Tester == device.Tester && existing.UDID == device.UDID {
+			existing.Product = device.Product
+			existing.Version = device.Version
+			existing.Serial = device.Serial
+			saved = true
+			break
+		}
+	}
+	if !saved {
+		devices = append(devices, device)
+	}
+
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode devices: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(StorageDir, devicesFileName), data); err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
+	return nil
+}
+
+// loadDevices reads all registered devices.
+func (r *FileDeviceRepository) loadDevices() ([]*domain.Device, error) {
+	data, err := os.ReadFile(filepath.Join(StorageDir, devicesFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read devices file: %w", err)
+	}
+
+	var devices []*domain.Device
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, fmt.Errorf("failed to decode devices file: %w", err)
+	}
+	return devices, nil
+}
@@ -0,0 +1,183 @@
+package infrastructure
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/shogo82148/androidbinary"
+	"github.com/shogo82148/androidbinary/apk"
+	"howett.net/plist"
+)
+
+// apkIconConfig asks the resource table for the densest icon of a pre-Oreo device,
+// so that adaptive (XML) icons are skipped in favor of their bitmap fallback.
+var apkIconConfig = &androidbinary.ResTableConfig{
+	Density:    640, // xxxhdpi
+	SDKVersion: 25,
+}
+
+// ExtractAPKIcon returns the launcher icon of the .apk file at filePath.
+// The icon is returned as stored in the package (usually PNG or WebP).
+func ExtractAPKIcon(filePath string) ([]byte, error) {
+	pkg, err := apk.OpenFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open apk file: %w", err)
+	}
+	defer pkg.Close()
+
+	iconPath, err := pkg.Manifest().App.Icon.WithResTableConfig(apkIconConfig).String()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve icon resource: %w", err)
+	}
+	if androidbinary.IsResID(iconPath) {
+		return nil, fmt.Errorf("unable to resolve icon resource %s", iconPath)
+	}
+
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open apk file: %w", err)
+	}
+	defer archive.Close()
+
+	if isBitmap(iconPath) {
+		return readZipFile(&archive.Reader, iconPath)
+	}
+
+	// Adaptive icons are XML drawables; fall back to the densest bitmap with the same name
+	baseName := strings.TrimSuffix(path.Base(iconPath), path.Ext(iconPath))
+	var best *zip.File
+	for _, f := range archive.File {
+		if !strings.HasPrefix(f.Name, "res/") || !isBitmap(f.Name) {
+			continue
+		}
+		if strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name)) != baseName {
+			continue
+		}
+		if best == nil || f.UncompressedSize64 > best.UncompressedSize64 {
+			best = f
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no bitmap icon found for %s", iconPath)
+	}
+	return readZipFile(&archive.Reader, best.Name)
+}
+
+// ExtractIPAIcon returns the largest app icon of the .ipa file at filePath as a
+// standard PNG, converting it from Apple's CgBI format if necessary.
+func ExtractIPAIcon(filePath string) ([]byte, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ipa file: %w", err)
+	}
+	defer archive.Close()
+
+	data, err := readAppBundleFile(&archive.Reader, "Info.plist")
+	if err != nil {
+		return nil, err
+	}
+
+	var info infoPlist
+	if _, err := plist.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to decode Info.plist: %w", err)
+	}
+
+	dir, err := appBundleDir(&archive.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Icon files are declared by base name, e.g. AppIcon60x60 for AppIcon60x60@3x.png
+	var best *zip.File
+	for _, f := range archive.File {
+		name := strings.TrimPrefix(f.Name, dir)
+		if name == f.Name || strings.Contains(name, "/") || !strings.HasSuffix(name, ".png") {
+			continue
+		}
+		for _, iconName := range info.iconNames() {
+			if strings.HasPrefix(name, strings.TrimSuffix(iconName, ".png")) {
+				if best == nil || f.UncompressedSize64 > best.UncompressedSize64 {
+					best = f
+				}
+				break
+			}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no icon found in %s", dir)
+	}
+
+	icon, err := readZipFile(&archive.Reader, best.Name)
+	if err != nil {
+		return nil, err
+	}
+	return UncrushPNG(icon)
+}
+
+// isBitmap reports whether name is an image file browsers can display.
+func isBitmap(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png", ".webp", ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// maxZipEntrySize is the most data read from an entry of an uploaded archive, so zip
+// bombs can't keep the server busy decompressing.
+const maxZipEntrySize = 1 << 30 // 1 GB
+
+// maxBufferedZipEntrySize is the most data read into memory from an entry of an
+// uploaded archive, such as a manifest or an icon.
+const maxBufferedZipEntrySize = 64 << 20 // 64 MB
+
+var errZipEntryTooLarge = errors.New("zip entry is too large")
+
+// limitedReader reads from r like io.LimitReader, but fails with errZipEntryTooLarge
+// instead of stopping when r holds more than remaining bytes.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, errZipEntryTooLarge
+	}
+	return n, err
+}
+
+// readZipFile reads the named file from a zip archive.
+func readZipFile(archive *zip.Reader, name string) ([]byte, error) {
+	for _, f := range archive.File {
+		if f.Name == name {
+			return readZipEntry(f)
+		}
+	}
+	return nil, fmt.Errorf("%s not found", name)
+}
+
+// readZipEntry reads a zip entry into memory, failing if it decompresses to more
+// than maxBufferedZipEntrySize bytes.
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(&limitedReader{r: rc, remaining: maxBufferedZipEntrySize})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,117 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"archive/zip"
+	"fmt"
+	"path"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// IPAInfo holds the metadata read from the Info.plist of an .ipa file.
+type IPAInfo struct {
+	BundleID    string
+	Version     string
+	BuildNumber string
+	Title       string
+
+	// Provisioning is nil when the .ipa has no embedded.mobileprovision.
+	Provisioning *domain.ProvisioningProfile
+}
+
+// infoPlist maps the Info.plist keys we care about.
+type infoPlist struct {
+	CFBundleIdentifier         string      `plist:"CFBundleIdentifier"`
+	CFBundleShortVersionString string      `plist:"CFBundleShortVersionString"`
+	CFBundleVersion            string      `plist:"CFBundleVersion"`
+	CFBundleDisplayName        string      `plist:"CFBundleDisplayName"`
+	CFBundleName               string      `plist:"CFBundleName"`
+	CFBundleIcons              bundleIcons `plist:"CFBundleIcons"`
+	CFBundleIconsIPad          bundleIcons `plist:"CFBundleIcons~ipad"`
+	CFBundleIconFiles          []string    `plist:"CFBundleIconFiles"`
+	CFBundleIconFile           string      `plist:"CFBundleIconFile"`
+}
+
+type bundleIcons struct {
+	CFBundlePrimaryIcon struct {
+		CFBundleIconFiles []string `plist:"CFBundleIconFiles"`
+	} `plist:"CFBundlePrimaryIcon"`
+}
+
+// iconNames returns the icon base names declared in the Info.plist.
+func (p *infoPlist) iconNames() []string {
+	var names []string
+	names = append(names, p.CFBundleIcons.CFBundlePrimaryIcon.CFBundleIconFiles...)
+	names = append(names, p.CFBundleIconsIPad.CFBundlePrimaryIcon.CFBundleIconFiles...)
+	names = append(names, p.CFBundleIconFiles...)
+	if p.CFBundleIconFile != "" {
+		names = append(names, p.CFBundleIconFile)
+	}
+	return names
+}
+
+// ParseIPA opens the .ipa archive at filePath and reads the application metadata
+// from Payload/*.app/Info.plist. Both XML and binary plists are supported.
+func ParseIPA(filePath string) (*IPAInfo, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ipa file: %w", err)
+	}
+	defer archive.Close()
+
+	data, err := readAppBundleFile(&archive.Reader, "Info.plist")
+	if err != nil {
+		return nil, err
+	}
+
+	var info infoPlist
+	if _, err := plist.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to decode Info.plist: %w", err)
+	}
+
+	title := info.CFBundleDisplayName
+	if title == "" {
+		title = info.CFBundleName
+	}
+
+	ipaInfo := &IPAInfo{
+		BundleID:    info.CFBundleIdentifier,
+		Version:     info.CFBundleShortVersionString,
+		BuildNumber: info.CFBundleVersion,
+		Title:       title,
+	}
+
+	if data, err := readAppBundleFile(&archive.Reader, "embedded.mobileprovision"); err == nil {
+		profile, err := ParseMobileProvision(data)
+		if err != nil {
+			// A broken profile shouldn't prevent reading the rest of the metadata
+			fmt.Printf("Error parsing provisioning profile: %v\n", err)
+		} else {
+			ipaInfo.Provisioning = profile
+		}
+	}
+
+	return ipaInfo, nil
+}
+
+// appBundleDir returns the Payload/<name>.app/ directory of an .ipa archive.
+func appBundleDir(archive *zip.Reader) (string, error) {
+	for _, f := range archive.File {
+		parts := strings.Split(f.Name, "/")
+		if len(parts) >= 3 && parts[0] == "Payload" && strings.HasSuffix(parts[1], ".app") {
+			return path.Join(parts[0], parts[1]) + "/", nil
+		}
+	}
+	return "", fmt.Errorf("no Payload/*.app directory found in ipa")
+}
+
+// readAppBundleFile reads a file located directly inside the Payload/*.app directory.
+func readAppBundleFile(archive *zip.Reader, name string) ([]byte, error) {
+	dir, err := appBundleDir(archive)
+	if err != nil {
+		return nil, err
+	}
+	return readZipFile(archive, dir+name)
+}
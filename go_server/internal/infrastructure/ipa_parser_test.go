@@ -0,0 +1,108 @@
+package infrastructure
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"howett.net/plist"
+)
+
+// writeIPA writes an .ipa with the given files in Payload/App.app to a temporary file.
+func writeIPA(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "app.ipa")
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	for name, data := range files {
+		w, err := archive.Create("Payload/App.app/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func marshalPlist(t *testing.T, value any, format int) []byte {
+	t.Helper()
+	data, err := plist.Marshal(value, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseIPA(t *testing.T) {
+	info := map[string]any{
+		"CFBundleIdentifier":         "com.example.app",
+		"CFBundleShortVersionString": "2.4.0",
+		"CFBundleVersion":            "321",
+		"CFBundleName":               "Example",
+	}
+	displayName := map[string]any{
+		"CFBundleIdentifier":         "com.example.app",
+		"CFBundleShortVersionString": "2.4.0",
+		"CFBundleVersion":            "321",
+		"CFBundleName":               "Example",
+		"CFBundleDisplayName":        "Example Beta",
+	}
+
+	tests := []struct {
+		name  string
+		files map[string][]byte
+		title string
+	}{
+		{"XML plist", map[string][]byte{"Info.plist": marshalPlist(t, info, plist.XMLFormat)}, "Example"},
+		{"binary plist", map[string][]byte{"Info.plist": marshalPlist(t, info, plist.BinaryFormat)}, "Example"},
+		{"display name", map[string][]byte{"Info.plist": marshalPlist(t, displayName, plist.XMLFormat)}, "Example Beta"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseIPA(writeIPA(t, tt.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := IPAInfo{BundleID: "com.example.app", Version: "2.4.0", BuildNumber: "321", Title: tt.title}
+			if *got != want {
+				t.Errorf("ParseIPA() = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestParseIPAInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string][]byte
+	}{
+		{"no Info.plist", map[string][]byte{"App": []byte("binary")}},
+		{"broken Info.plist", map[string][]byte{"Info.plist": []byte("<plist><dict><key>")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseIPA(writeIPA(t, tt.files)); err == nil {
+				t.Error("ParseIPA() error = nil, want an error")
+			}
+		})
+	}
+
+	notZip := filepath.Join(t.TempDir(), "app.ipa")
+	if err := os.WriteFile(notZip, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseIPA(notZip); err == nil {
+		t.Error("ParseIPA() of a file that isn't a zip archive error = nil, want an error")
+	}
+}
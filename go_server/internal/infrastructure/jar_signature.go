@@ -0,0 +1,265 @@
+package infrastructure
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+var errNotJARSigned = errors.New("apk has no v1 signature")
+
+// jarDigestAlgorithms maps manifest digest attribute prefixes to hash constructors,
+// strongest first.
+var jarDigestAlgorithms = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"SHA-512", sha512.New},
+	{"SHA-384", sha512.New384},
+	{"SHA-256", sha256.New},
+	{"SHA1", sha1.New},
+	{"SHA-1", sha1.New},
+}
+
+// manifestSection is a section of a JAR manifest or signature file.
+type manifestSection struct {
+	raw        []byte
+	attributes map[string]string
+}
+
+// verifyJARSignature verifies the v1 (JAR) signature of the .apk at filePath. It
+// returns the signer certificates and the newer signature schemes the signer declared
+// through X-Android-APK-Signed, which must also be present for the APK to be intact.
+func verifyJARSignature(filePath string) ([]*x509.Certificate, []string, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open apk file: %w", err)
+	}
+	defer archive.Close()
+
+	// Index the entries once, rejecting duplicates that could show the verifier a
+	// different entry than the one Android installs
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		if _, ok := files[f.Name]; ok {
+			return nil, nil, fmt.Errorf("duplicate entry %s", f.Name)
+		}
+		files[f.Name] = f
+	}
+
+	manifestFile, ok := files["META-INF/MANIFEST.MF"]
+	if !ok {
+		return nil, nil, errNotJARSigned
+	}
+	manifestData, err := readZipEntry(manifestFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest := parseManifest(manifestData)
+	if len(manifest) == 0 {
+		return nil, nil, fmt.Errorf("empty MANIFEST.MF")
+	}
+
+	entries := make(map[string]map[string]string)
+	for _, section := range manifest[1:] {
+		if name := section.attributes["Name"]; name != "" {
+			entries[name] = section.attributes
+		}
+	}
+
+	var certificates []*x509.Certificate
+	var strippedSchemes []string
+	for _, f := range archive.File {
+		dir, name := path.Split(f.Name)
+		if dir != "META-INF/" || !strings.HasSuffix(name, ".SF") {
+			continue
+		}
+		cert, schemes, err := verifySignatureFile(files, f.Name, manifestData, manifest)
+		if err != nil {
+			return nil, nil, err
+		}
+		certificates = append(certificates, cert)
+		strippedSchemes = append(strippedSchemes, schemes...)
+	}
+	if len(certificates) == 0 {
+		return nil, nil, errNotJARSigned
+	}
+
+	// Every entry outside META-INF must be listed in the manifest with a matching digest
+	for _, f := range archive.File {
+		if strings.HasSuffix(f.Name, "/") || strings.HasPrefix(f.Name, "META-INF/") {
+			continue
+		}
+		attributes, ok := entries[f.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s is not listed in MANIFEST.MF", f.Name)
+		}
+		if err := verifyEntryDigest(f, attributes); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+
+	return certificates, strippedSchemes, nil
+}
+
+// verifySignatureFile verifies a META-INF/*.SF file against its signature block and
+// the manifest, and returns the signer certificate.
+func verifySignatureFile(files map[string]*zip.File, sfName string, manifestData []byte, manifest []manifestSection) (*x509.Certificate, []string, error) {
+	sfData, err := readZipEntry(files[sfName])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	base := strings.TrimSuffix(sfName, ".SF")
+	var blockFile *zip.File
+	for _, ext := range []string{".RSA", ".EC", ".DSA"} {
+		if blockFile = files[base+ext]; blockFile != nil {
+			break
+		}
+	}
+	if blockFile == nil {
+		return nil, nil, fmt.Errorf("no signature block for %s", sfName)
+	}
+	blockData, err := readZipEntry(blockFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p7, err := pkcs7.Parse(blockData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse signature block for %s: %w", sfName, err)
+	}
+	p7.Content = sfData
+	if err := p7.Verify(); err != nil {
+		return nil, nil, fmt.Errorf("invalid signature for %s: %w", sfName, err)
+	}
+	cert := p7.GetOnlySigner()
+	if cert == nil {
+		return nil, nil, fmt.Errorf("%s must have exactly one signer", sfName)
+	}
+
+	sf := parseManifest(sfData)
+	if len(sf) == 0 {
+		return nil, nil, fmt.Errorf("empty %s", sfName)
+	}
+
+	var schemes []string
+	for _, id := range strings.Split(sf[0].attributes["X-Android-APK-Signed"], ",") {
+		switch strings.TrimSpace(id) {
+		case "2":
+			schemes = append(schemes, "v2")
+		case "3":
+			schemes = append(schemes, "v3")
+		}
+	}
+
+	// Prefer the digest of the whole manifest, fall back to per-section digests
+	if err := verifyDigestAttribute(sf[0].attributes, "-Digest-Manifest", manifestData); err == nil {
+		return cert, schemes, nil
+	}
+
+	sections := make(map[string]manifestSection)
+	for _, section := range manifest[1:] {
+		sections[section.attributes["Name"]] = section
+	}
+	for _, section := range sf[1:] {
+		name := section.attributes["Name"]
+		manifestSection, ok := sections[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s lists %s which is not in MANIFEST.MF", sfName, name)
+		}
+		if err := verifyDigestAttribute(section.attributes, "-Digest", manifestSection.raw); err != nil {
+			return nil, nil, fmt.Errorf("%s: manifest section %s: %w", sfName, name, err)
+		}
+	}
+
+	return cert, schemes, nil
+}
+
+// verifyDigestAttribute checks data against the strongest <algorithm><suffix> attribute.
+func verifyDigestAttribute(attributes map[string]string, suffix string, data []byte) error {
+	return verifyDigest(attributes, suffix, bytes.NewReader(data))
+}
+
+// verifyEntryDigest checks a zip entry against the strongest <algorithm>-Digest
+// attribute of its manifest section. The entry is streamed through the hash, and
+// entries that decompress to more than maxZipEntrySize bytes are rejected.
+func verifyEntryDigest(f *zip.File, attributes map[string]string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	return verifyDigest(attributes, "-Digest", &limitedReader{r: rc, remaining: maxZipEntrySize})
+}
+
+// verifyDigest checks the data read from r against the strongest
+// <algorithm><suffix> attribute.
+func verifyDigest(attributes map[string]string, suffix string, r io.Reader) error {
+	for _, algorithm := range jarDigestAlgorithms {
+		expected, ok := attributes[algorithm.name+suffix]
+		if !ok {
+			continue
+		}
+		h := algorithm.new()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) != expected {
+			return fmt.Errorf("%s digest mismatch", algorithm.name)
+		}
+		return nil
+	}
+	return fmt.Errorf("no supported digest")
+}
+
+// parseManifest splits a JAR manifest into sections, keeping the raw bytes of each
+// section (including the terminating blank line) for per-section digests.
+func parseManifest(data []byte) []manifestSection {
+	var sections []manifestSection
+	for len(data) > 0 {
+		end := len(data)
+		next := len(data)
+		for _, sep := range [][]byte{[]byte("\r\n\r\n"), []byte("\n\n"), []byte("\r\r")} {
+			if i := bytes.Index(data, sep); i >= 0 && i+len(sep) < next {
+				end, next = i, i+len(sep)
+			}
+		}
+
+		raw := data[:next]
+		data = data[next:]
+
+		attributes := make(map[string]string)
+		var key string
+		for _, line := range strings.FieldsFunc(string(raw[:end]), func(r rune) bool { return r == '\r' || r == '\n' }) {
+			// Lines longer than 72 bytes continue on the next line after a single space
+			if strings.HasPrefix(line, " ") && key != "" {
+				attributes[key] += line[1:]
+				continue
+			}
+			name, value, ok := strings.Cut(line, ": ")
+			if !ok {
+				continue
+			}
+			key = name
+			attributes[key] = value
+		}
+		if len(attributes) > 0 || len(sections) == 0 {
+			sections = append(sections, manifestSection{raw: raw, attributes: attributes})
+		}
+	}
+	return sections
+}
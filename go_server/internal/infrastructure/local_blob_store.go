@@ -0,0 +1,197 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalBlobStore stores blobs as files below a root directory. Directories whose
+// names start with an underscore hold staging data and are not listed.
+type LocalBlobStore struct {
+	root string
+}
+
+func NewLocalBlobStore(root string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", root, err)
+	}
+	return &LocalBlobStore{root: root}, nil
+}
+
+func (s *LocalBlobStore) Put(key string, r io.Reader, size int64) error {
+	return s.write(key, r, os.Rename)
+}
+
+func (s *LocalBlobStore) Create(key string, r io.Reader, size int64) error {
+	// Unlike a rename, a hard link fails if the target exists
+	return s.write(key, r, func(tempPath, filePath string) error {
+		if err := os.Link(tempPath, filePath); err != nil {
+			if os.IsExist(err) {
+				return application.ErrBlobExists
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// write writes the contents of r next to the file of key, and then moves them into
+// place with move, so readers never see a partial blob.
+func (s *LocalBlobStore) write(key string, r io.Reader, move func(tempPath, filePath string) error) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filePath), ".put-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		return fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+	if err := move(file.Name(), filePath); err != nil {
+		if errors.Is(err, application.ErrBlobExists) {
+			return err
+		}
+		return fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) Get(key string, offset, length int64) (io.ReadCloser, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, application.ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("failed to open blob %s: %w", key, err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek blob %s: %w", key, err)
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+func (s *LocalBlobStore) Stat(key string) (*application.BlobInfo, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, application.ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("failed to stat blob %s: %w", key, err)
+	}
+	if stat.IsDir() {
+		return nil, application.ErrBlobNotFound
+	}
+	return &application.BlobInfo{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (s *LocalBlobStore) Delete(key string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) List(prefix string) ([]*application.BlobInfo, error) {
+	var blobs []*application.BlobInfo
+	err := filepath.WalkDir(s.root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), "_") || (strings.HasPrefix(entry.Name(), ".") && filePath != s.root) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, &application.BlobInfo{Key: key, Size: stat.Size(), ModTime: stat.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+	return blobs, nil
+}
+
+// stagingDir returns the directory uploads are staged in. It is inside the root,
+// so staged files can be moved into the store without copying them.
+func (s *LocalBlobStore) stagingDir() string {
+	return filepath.Join(s.root, stagingDirName)
+}
+
+// moveIn stores the local file at filePath under key by renaming it.
+func (s *LocalBlobStore) moveIn(key, filePath string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	if err := os.Rename(filePath, target); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", key, err)
+	}
+	return nil
+}
+
+// path returns the file path of a key, rejecting keys that would point outside the root.
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,140 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func putBlob(t *testing.T, store application.BlobStore, key, content string) {
+	t.Helper()
+	if err := store.Put(key, strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readBlob(t *testing.T, store application.BlobStore, key string, offset, length int64) string {
+	t.Helper()
+	body, err := store.Get(key, offset, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLocalBlobStoreRangeReads(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	putBlob(t, store, "apps/com.example.app/app.ipa", "0123456789")
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{3, -1, "3456789"},
+		{3, 4, "3456"},
+		{8, 10, "89"},
+		{0, 0, ""},
+	}
+	for _, tt := range tests {
+		if got := readBlob(t, store, "apps/com.example.app/app.ipa", tt.offset, tt.length); got != tt.want {
+			t.Errorf("Get(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+
+	// Range reads back the seekable reader that downloads are served from
+	info, err := store.Stat("apps/com.example.app/app.ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := application.NewBlobReader(store, info)
+	defer reader.Close()
+	if _, err := reader.Seek(-4, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(reader); err != nil || string(data) != "6789" {
+		t.Errorf("read after Seek(-4, io.SeekEnd) = %q, %v, want %q", data, err, "6789")
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalBlobStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putBlob(t, store, "apps/a/1", "one")
+	putBlob(t, store, "apps/b/2", "two")
+	putBlob(t, store, "apps/a/1", "replaced")
+	// Staging data is not listed
+	if err := os.MkdirAll(filepath.Join(root, stagingDirName), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, stagingDirName, "upload"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readBlob(t, store, "apps/a/1", 0, -1); got != "replaced" {
+		t.Errorf("Get() after Put() of an existing key = %q, want %q", got, "replaced")
+	}
+	blobs, err := store.List("apps/a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 || blobs[0].Key != "apps/a/1" || blobs[0].Size != int64(len("replaced")) {
+		t.Errorf("List(apps/a/) = %v", blobs)
+	}
+	if blobs, err := store.List(""); err != nil || len(blobs) != 2 {
+		t.Errorf("List() = %v, %v, want 2 blobs", blobs, err)
+	}
+
+	if err := store.Delete("apps/a/1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("apps/a/1"); err != nil {
+		t.Errorf("Delete() of a deleted blob error = %v", err)
+	}
+	if _, err := store.Get("apps/a/1", 0, -1); !errors.Is(err, application.ErrBlobNotFound) {
+		t.Errorf("Get() of a deleted blob error = %v, want ErrBlobNotFound", err)
+	}
+	if _, err := store.Stat("apps"); !errors.Is(err, application.ErrBlobNotFound) {
+		t.Errorf("Stat() of a directory error = %v, want ErrBlobNotFound", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "apps/../../outside"} {
+		if err := store.Put(key, strings.NewReader("x"), 1); err == nil {
+			t.Errorf("Put(%q) error = nil, want an error", key)
+		}
+	}
+}
+
+func TestLocalBlobStoreCreate(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create("locks/upload", strings.NewReader("first"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create("locks/upload", strings.NewReader("second"), 6); !errors.Is(err, application.ErrBlobExists) {
+		t.Errorf("Create() of an existing blob error = %v, want ErrBlobExists", err)
+	}
+	if got := readBlob(t, store, "locks/upload", 0, -1); got != "first" {
+		t.Errorf("Get() = %q, want the blob Create() was first called with", got)
+	}
+	if blobs, err := store.List("locks/"); err != nil || len(blobs) != 1 {
+		t.Errorf("List() = %v, %v, want only the created blob", blobs, err)
+	}
+}
@@ -0,0 +1,108 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const membersFileName = "_members.json"
+
+// FileMemberRepository keeps the members of every app in a JSON file in StorageDir.
+type FileMemberRepository struct {
+	mu sync.Mutex
+}
+
+// NewFileMemberRepository initializes the storage and returns a new FileMemberRepository.
+func NewFileMemberRepository() (*FileMemberRepository, error) {
+	if err := os.MkdirAll(StorageDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", StorageDir, err)
+	}
+	return &FileMemberRepository{}, nil
+}
+
+func (r *FileMemberRepository) SaveMember(member *domain.Member) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var members []*domain.Member
+	if err := readJSONFile(membersFileName, &members); err != nil {
+		return err
+	}
+
+	saved := false
+	for _, existing := range members {
+		if sameMember(existing, member.BundleID, member.Email, member.Group) {
+			member.CreatedAt = existing.CreatedAt
+			existing.Role = member.Role
+			saved = true
+			break
+		}
+	}
+	if !saved {
+		members = append(members, member)
+	}
+	return writeJSONFile(membersFileName, members)
+}
+
+func (r *FileMemberRepository) GetMembers(bundleID string) ([]*domain.Member, error) {
+	return r.findMembers(func(member *domain.Member) bool { return member.BundleID == bundleID })
+}
+
+func (r *FileMemberRepository) GetUserMembers(email string, groups []string) ([]*domain.Member, error) {
+	return r.findMembers(func(member *domain.Member) bool {
+		if member.Email != "" {
+			return member.Email == email
+		}
+		return slices.Contains(groups, member.Group)
+	})
+}
+
+func (r *FileMemberRepository) DeleteMember(bundleID, email, group string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var members []*domain.Member
+	if err := readJSONFile(membersFileName, &members); err != nil {
+		return err
+	}
+	for i, member := range members {
+		if sameMember(member, bundleID, email, group) {
+			return writeJSONFile(membersFileName, slices.Delete(members, i, i+1))
+		}
+	}
+	return application.ErrMemberNotFound
+}
+
+// findMembers returns the members that match, sorted by group and email like the database repositories.
+func (r *FileMemberRepository) findMembers(match func(*domain.Member) bool) ([]*domain.Member, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var members []*domain.Member
+	if err := readJSONFile(membersFileName, &members); err != nil {
+		return nil, err
+	}
+	var found []*domain.Member
+	for _, member := range members {
+		if match(member) {
+			found = append(found, member)
+		}
+	}
+	slices.SortFunc(found, func(a, b *domain.Member) int {
+		if a.Group != b.Group {
+			return strings.Compare(a.Group, b.Group)
+		}
+		return strings.Compare(a.Email, b.Email)
+	})
+	return found, nil
+}
+
+// sameMember reports whether member is the user with email, or the group, on the app with bundleID.
+func sameMember(member *domain.Member, bundleID, email, group string) bool {
+	return member.BundleID == bundleID && member.Email == email && member.Group == group
+}
@@ -0,0 +1,30 @@
+-- Databases created before versioned migrations already have these tables, so
+-- every statement is written to be a no-op on them.
+CREATE TABLE IF NOT EXISTS builds (
+	upload_id TEXT PRIMARY KEY,
+	bundle_id TEXT NOT NULL,
+	version TEXT NOT NULL,
+	build_number TEXT NOT NULL,
+	title TEXT NOT NULL,
+	icon TEXT,
+	description TEXT,
+	file_size BIGINT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	platform TEXT NOT NULL
+);
+
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS provisioning JSONB;
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS android JSONB;
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS signature JSONB;
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS artifact_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS sha256 TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS devices (
+	udid TEXT NOT NULL,
+	tester TEXT NOT NULL,
+	product TEXT NOT NULL,
+	version TEXT NOT NULL,
+	serial TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	PRIMARY KEY (tester, udid)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE builds DROP CONSTRAINT IF EXISTS builds_bundle_id_version_build_number_platform_key;
+DROP INDEX IF EXISTS builds_bundle_id_created_at_idx;
@@ -0,0 +1,26 @@
+-- Builds are listed and looked up per bundle ID, newest first
+CREATE INDEX IF NOT EXISTS builds_bundle_id_created_at_idx ON builds (bundle_id, created_at DESC);
+
+-- Uploading the same build twice used to add a second row. Which upload to keep is
+-- the operator's decision, so the migration stops and lists the duplicates until all
+-- but one upload of each has been deleted.
+DO $$
+DECLARE
+	duplicates text;
+BEGIN
+	SELECT string_agg(format('%s %s (%s) on %s: uploads %s', bundle_id, version, build_number, platform, upload_ids), E'\n')
+	INTO duplicates
+	FROM (
+		SELECT bundle_id, version, build_number, platform, string_agg(upload_id, ', ' ORDER BY created_at DESC) AS upload_ids
+		FROM builds
+		GROUP BY bundle_id, version, build_number, platform
+		HAVING COUNT(*) > 1
+	) t;
+
+	IF duplicates IS NOT NULL THEN
+		RAISE EXCEPTION E'builds were uploaded more than once; delete all but one upload of each from builds and migrate again:\n%', duplicates;
+	END IF;
+END
+$$;
+
+ALTER TABLE builds ADD CONSTRAINT builds_bundle_id_version_build_number_platform_key UNIQUE (bundle_id, version, build_number, platform);
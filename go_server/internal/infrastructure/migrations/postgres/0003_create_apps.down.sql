@@ -0,0 +1,2 @@
+ALTER TABLE builds DROP CONSTRAINT IF EXISTS builds_bundle_id_fkey;
+DROP TABLE IF EXISTS apps;
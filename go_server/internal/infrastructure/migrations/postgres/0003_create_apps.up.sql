@@ -0,0 +1,22 @@
+CREATE TABLE apps (
+	bundle_id TEXT PRIMARY KEY,
+	platform TEXT NOT NULL,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	icon TEXT NOT NULL DEFAULT '',
+	owner TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Apps of existing builds take their metadata from the newest build, like the app list did
+INSERT INTO apps (bundle_id, platform, name, description, icon, owner, created_at)
+SELECT bundle_id, platform, title, COALESCE(description, ''), COALESCE(icon, ''), '', first_created_at
+FROM (
+	SELECT bundle_id, platform, title, description, icon,
+		ROW_NUMBER() OVER(PARTITION BY bundle_id ORDER BY created_at DESC) AS rn,
+		MIN(created_at) OVER(PARTITION BY bundle_id) AS first_created_at
+	FROM builds
+) t
+WHERE rn = 1;
+
+ALTER TABLE builds ADD CONSTRAINT builds_bundle_id_fkey FOREIGN KEY (bundle_id) REFERENCES apps (bundle_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS promotions;
+DROP TABLE IF EXISTS channels;
@@ -0,0 +1,20 @@
+CREATE TABLE channels (
+	bundle_id TEXT NOT NULL REFERENCES apps (bundle_id),
+	name TEXT NOT NULL,
+	upload_id TEXT NOT NULL REFERENCES builds (upload_id),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_by TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (bundle_id, name)
+);
+
+CREATE TABLE promotions (
+	id TEXT PRIMARY KEY,
+	bundle_id TEXT NOT NULL REFERENCES apps (bundle_id),
+	channel TEXT NOT NULL,
+	upload_id TEXT NOT NULL REFERENCES builds (upload_id),
+	from_channel TEXT NOT NULL DEFAULT '',
+	promoted_by TEXT NOT NULL DEFAULT '',
+	promoted_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX promotions_bundle_id_promoted_at_idx ON promotions (bundle_id, promoted_at DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS apps_product_id_platform_key;
+ALTER TABLE apps DROP COLUMN IF EXISTS product_id;
+DROP TABLE IF EXISTS products;
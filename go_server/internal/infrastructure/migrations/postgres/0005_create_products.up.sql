@@ -0,0 +1,10 @@
+CREATE TABLE products (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+ALTER TABLE apps ADD COLUMN product_id TEXT REFERENCES products (id);
+
+-- A product has at most one app per platform
+CREATE UNIQUE INDEX apps_product_id_platform_key ON apps (product_id, platform);
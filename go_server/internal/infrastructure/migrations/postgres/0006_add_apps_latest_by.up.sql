@@ -0,0 +1,3 @@
+-- Which build is the latest of an app: '' or 'upload_time' for the newest upload,
+-- 'version' for the highest version
+ALTER TABLE apps ADD COLUMN latest_by TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS builds_deleted_at_idx;
+ALTER TABLE builds DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE builds DROP COLUMN IF EXISTS archived_at;
+ALTER TABLE builds DROP COLUMN IF EXISTS release_notes;
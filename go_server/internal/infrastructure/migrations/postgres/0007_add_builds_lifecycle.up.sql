@@ -0,0 +1,7 @@
+ALTER TABLE builds ADD COLUMN release_notes TEXT NOT NULL DEFAULT '';
+-- Archived builds are left out of listings but can still be downloaded
+ALTER TABLE builds ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+-- Deleted builds are purged with their files once the grace period has passed
+ALTER TABLE builds ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX builds_deleted_at_idx ON builds (deleted_at) WHERE deleted_at IS NOT NULL;
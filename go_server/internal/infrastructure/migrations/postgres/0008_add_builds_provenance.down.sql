@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS builds_commit_sha_idx;
+ALTER TABLE builds DROP COLUMN IF EXISTS variant;
+ALTER TABLE builds DROP COLUMN IF EXISTS pipeline_url;
+ALTER TABLE builds DROP COLUMN IF EXISTS ci_provider;
+ALTER TABLE builds DROP COLUMN IF EXISTS repository_url;
+ALTER TABLE builds DROP COLUMN IF EXISTS tag;
+ALTER TABLE builds DROP COLUMN IF EXISTS branch;
+ALTER TABLE builds DROP COLUMN IF EXISTS commit_sha;
@@ -0,0 +1,22 @@
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	user_groups JSONB NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	last_login_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	UNIQUE (issuer, subject)
+);
+
+CREATE INDEX users_email_idx ON users (email);
+
+CREATE TABLE sessions (
+	token_hash TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
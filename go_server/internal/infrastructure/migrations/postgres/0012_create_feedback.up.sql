@@ -0,0 +1,10 @@
+CREATE TABLE feedback (
+	id TEXT PRIMARY KEY,
+	bundle_id TEXT NOT NULL REFERENCES apps (bundle_id),
+	upload_id TEXT NOT NULL REFERENCES builds (upload_id),
+	author TEXT NOT NULL DEFAULT '',
+	message TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX feedback_upload_id_created_at_idx ON feedback (upload_id, created_at DESC);
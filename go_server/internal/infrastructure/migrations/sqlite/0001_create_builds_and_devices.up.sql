@@ -0,0 +1,29 @@
+-- Timestamps are declared as TIMESTAMP so the driver scans them into time.Time,
+-- and JSON columns are stored as text.
+CREATE TABLE IF NOT EXISTS builds (
+	upload_id TEXT PRIMARY KEY,
+	bundle_id TEXT NOT NULL,
+	version TEXT NOT NULL,
+	build_number TEXT NOT NULL,
+	title TEXT NOT NULL,
+	icon TEXT,
+	description TEXT,
+	file_size BIGINT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	platform TEXT NOT NULL,
+	provisioning TEXT,
+	android TEXT,
+	signature TEXT,
+	artifact_type TEXT NOT NULL DEFAULT '',
+	sha256 TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS devices (
+	udid TEXT NOT NULL,
+	tester TEXT NOT NULL,
+	product TEXT NOT NULL,
+	version TEXT NOT NULL,
+	serial TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (tester, udid)
+);
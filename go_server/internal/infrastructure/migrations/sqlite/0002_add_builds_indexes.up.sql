@@ -0,0 +1,28 @@
+-- Builds are listed and looked up per bundle ID, newest first
+CREATE INDEX IF NOT EXISTS builds_bundle_id_created_at_idx ON builds (bundle_id, created_at DESC);
+
+-- Uploading the same build twice used to add a second row. Which upload to keep is
+-- the operator's decision, so the migration stops and lists the duplicates until all
+-- but one upload of each has been deleted. SQLite can only raise errors in triggers,
+-- so the list is inserted into a table whose trigger fails with it.
+CREATE TEMP TABLE builds_duplicates (message TEXT);
+CREATE TEMP TRIGGER builds_duplicates_fail BEFORE INSERT ON builds_duplicates
+BEGIN
+	SELECT RAISE(ABORT, NEW.message);
+END;
+
+INSERT INTO builds_duplicates (message)
+SELECT 'builds were uploaded more than once; delete all but one upload of each from builds and migrate again:' || char(10) || group_concat(duplicate, char(10))
+FROM (
+	SELECT bundle_id || ' ' || version || ' (' || build_number || ') on ' || platform || ': uploads ' || group_concat(upload_id, ', ') AS duplicate
+	FROM builds
+	GROUP BY bundle_id, version, build_number, platform
+	HAVING COUNT(*) > 1
+)
+HAVING COUNT(*) > 0;
+
+DROP TRIGGER builds_duplicates_fail;
+DROP TABLE builds_duplicates;
+
+-- SQLite can't add constraints to existing tables, but a unique index enforces the same
+CREATE UNIQUE INDEX IF NOT EXISTS builds_bundle_id_version_build_number_platform_key ON builds (bundle_id, version, build_number, platform);
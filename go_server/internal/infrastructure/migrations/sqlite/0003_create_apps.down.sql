@@ -0,0 +1,25 @@
+CREATE TABLE builds_old (
+	upload_id TEXT PRIMARY KEY,
+	bundle_id TEXT NOT NULL,
+	version TEXT NOT NULL,
+	build_number TEXT NOT NULL,
+	title TEXT NOT NULL,
+	icon TEXT,
+	description TEXT,
+	file_size BIGINT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	platform TEXT NOT NULL,
+	provisioning TEXT,
+	android TEXT,
+	signature TEXT,
+	artifact_type TEXT NOT NULL DEFAULT '',
+	sha256 TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO builds_old SELECT upload_id, bundle_id, version, build_number, title, icon, description, file_size, created_at, platform, provisioning, android, signature, artifact_type, sha256 FROM builds;
+DROP TABLE builds;
+ALTER TABLE builds_old RENAME TO builds;
+
+CREATE INDEX builds_bundle_id_created_at_idx ON builds (bundle_id, created_at DESC);
+CREATE UNIQUE INDEX builds_bundle_id_version_build_number_platform_key ON builds (bundle_id, version, build_number, platform);
+
+DROP TABLE apps;
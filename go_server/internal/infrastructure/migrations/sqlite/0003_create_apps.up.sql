@@ -0,0 +1,45 @@
+CREATE TABLE apps (
+	bundle_id TEXT PRIMARY KEY,
+	platform TEXT NOT NULL,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	icon TEXT NOT NULL DEFAULT '',
+	owner TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL
+);
+
+-- Apps of existing builds take their metadata from the newest build, like the app list did
+INSERT INTO apps (bundle_id, platform, name, description, icon, owner, created_at)
+SELECT bundle_id, platform, title, COALESCE(description, ''), COALESCE(icon, ''), '', first_created_at
+FROM (
+	SELECT bundle_id, platform, title, description, icon,
+		ROW_NUMBER() OVER(PARTITION BY bundle_id ORDER BY created_at DESC) AS rn,
+		MIN(created_at) OVER(PARTITION BY bundle_id) AS first_created_at
+	FROM builds
+) t
+WHERE rn = 1;
+
+-- SQLite can't add a foreign key to an existing table, so builds is rebuilt with one
+CREATE TABLE builds_new (
+	upload_id TEXT PRIMARY KEY,
+	bundle_id TEXT NOT NULL REFERENCES apps (bundle_id),
+	version TEXT NOT NULL,
+	build_number TEXT NOT NULL,
+	title TEXT NOT NULL,
+	icon TEXT,
+	description TEXT,
+	file_size BIGINT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	platform TEXT NOT NULL,
+	provisioning TEXT,
+	android TEXT,
+	signature TEXT,
+	artifact_type TEXT NOT NULL DEFAULT '',
+	sha256 TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO builds_new SELECT upload_id, bundle_id, version, build_number, title, icon, description, file_size, created_at, platform, provisioning, android, signature, artifact_type, sha256 FROM builds;
+DROP TABLE builds;
+ALTER TABLE builds_new RENAME TO builds;
+
+CREATE INDEX builds_bundle_id_created_at_idx ON builds (bundle_id, created_at DESC);
+CREATE UNIQUE INDEX builds_bundle_id_version_build_number_platform_key ON builds (bundle_id, version, build_number, platform);
@@ -0,0 +1,12 @@
+CREATE TABLE products (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+-- Unlike in Postgres product_id has no foreign key, since SQLite couldn't drop the
+-- column again when rolling back. Products clear it before they are deleted.
+ALTER TABLE apps ADD COLUMN product_id TEXT;
+
+-- A product has at most one app per platform
+CREATE UNIQUE INDEX apps_product_id_platform_key ON apps (product_id, platform);
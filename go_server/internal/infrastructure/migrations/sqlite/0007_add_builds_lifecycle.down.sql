@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS builds_deleted_at_idx;
+ALTER TABLE builds DROP COLUMN deleted_at;
+ALTER TABLE builds DROP COLUMN archived_at;
+ALTER TABLE builds DROP COLUMN release_notes;
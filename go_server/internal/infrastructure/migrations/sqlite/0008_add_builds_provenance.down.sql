@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS builds_commit_sha_idx;
+ALTER TABLE builds DROP COLUMN variant;
+ALTER TABLE builds DROP COLUMN pipeline_url;
+ALTER TABLE builds DROP COLUMN ci_provider;
+ALTER TABLE builds DROP COLUMN repository_url;
+ALTER TABLE builds DROP COLUMN tag;
+ALTER TABLE builds DROP COLUMN branch;
+ALTER TABLE builds DROP COLUMN commit_sha;
@@ -0,0 +1,10 @@
+-- Where a build came from, as reported by the CI pipeline that uploaded it
+ALTER TABLE builds ADD COLUMN commit_sha TEXT NOT NULL DEFAULT '';
+ALTER TABLE builds ADD COLUMN branch TEXT NOT NULL DEFAULT '';
+ALTER TABLE builds ADD COLUMN tag TEXT NOT NULL DEFAULT '';
+ALTER TABLE builds ADD COLUMN repository_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE builds ADD COLUMN ci_provider TEXT NOT NULL DEFAULT '';
+ALTER TABLE builds ADD COLUMN pipeline_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE builds ADD COLUMN variant TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX builds_commit_sha_idx ON builds (commit_sha);
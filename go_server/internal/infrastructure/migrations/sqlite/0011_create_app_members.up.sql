@@ -0,0 +1,11 @@
+CREATE TABLE app_members (
+	bundle_id TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	group_name TEXT NOT NULL DEFAULT '',
+	role TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (bundle_id, email, group_name)
+);
+
+CREATE INDEX app_members_email_idx ON app_members (email);
+CREATE INDEX app_members_group_name_idx ON app_members (group_name);
@@ -0,0 +1,60 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"fmt"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+	"howett.net/plist"
+)
+
+// mobileProvision maps the keys of the plist signed inside an embedded.mobileprovision.
+type mobileProvision struct {
+	Name                 string                 `plist:"Name"`
+	TeamIdentifier       []string               `plist:"TeamIdentifier"`
+	ProvisionedDevices   []string               `plist:"ProvisionedDevices"`
+	ProvisionsAllDevices bool                   `plist:"ProvisionsAllDevices"`
+	ExpirationDate       time.Time              `plist:"ExpirationDate"`
+	Entitlements         map[string]interface{} `plist:"Entitlements"`
+}
+
+// ParseMobileProvision decodes a CMS-signed embedded.mobileprovision file.
+func ParseMobileProvision(data []byte) (*domain.ProvisioningProfile, error) {
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse provisioning profile signature: %w", err)
+	}
+
+	var profile mobileProvision
+	if _, err := plist.Unmarshal(p7.Content, &profile); err != nil {
+		return nil, fmt.Errorf("failed to decode provisioning profile: %w", err)
+	}
+
+	var teamID string
+	if len(profile.TeamIdentifier) > 0 {
+		teamID = profile.TeamIdentifier[0]
+	}
+
+	return &domain.ProvisioningProfile{
+		Name:               profile.Name,
+		TeamID:             teamID,
+		ProvisionedDevices: profile.ProvisionedDevices,
+		ExpirationDate:     profile.ExpirationDate,
+		DistributionType:   profile.distributionType(),
+	}, nil
+}
+
+// distributionType infers the distribution type from the profile contents.
+func (p *mobileProvision) distributionType() domain.DistributionType {
+	if p.ProvisionsAllDevices {
+		return domain.Enterprise
+	}
+	if len(p.ProvisionedDevices) == 0 {
+		return domain.AppStore
+	}
+	if getTaskAllow, _ := p.Entitlements["get-task-allow"].(bool); getTaskAllow {
+		return domain.Development
+	}
+	return domain.AdHoc
+}
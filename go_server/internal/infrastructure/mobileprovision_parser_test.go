@@ -0,0 +1,113 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+	"howett.net/plist"
+)
+
+// signProfile signs a provisioning profile plist the way Apple does, with a throwaway key.
+func signProfile(t *testing.T, profile map[string]any) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Profile Signing"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := pkcs7.NewSignedData(marshalPlist(t, profile, plist.XMLFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signed.AddSigner(cert, key, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := signed.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseMobileProvision(t *testing.T) {
+	expiration := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		profile map[string]any
+		want    domain.DistributionType
+	}{
+		{"ad hoc", map[string]any{
+			"ProvisionedDevices": []string{"00008030-001A2B3C4D5E6F70"},
+			"Entitlements":       map[string]any{"get-task-allow": false},
+		}, domain.AdHoc},
+		{"development", map[string]any{
+			"ProvisionedDevices": []string{"00008030-001A2B3C4D5E6F70"},
+			"Entitlements":       map[string]any{"get-task-allow": true},
+		}, domain.Development},
+		{"enterprise", map[string]any{"ProvisionsAllDevices": true}, domain.Enterprise},
+		{"app store", map[string]any{}, domain.AppStore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.profile["Name"] = "Example Profile"
+			tt.profile["TeamIdentifier"] = []string{"ABCDE12345"}
+			tt.profile["ExpirationDate"] = expiration
+
+			profile, err := ParseMobileProvision(signProfile(t, tt.profile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if profile.DistributionType != tt.want {
+				t.Errorf("DistributionType = %q, want %q", profile.DistributionType, tt.want)
+			}
+			if profile.Name != "Example Profile" || profile.TeamID != "ABCDE12345" || !profile.ExpirationDate.Equal(expiration) {
+				t.Errorf("ParseMobileProvision() = %+v", profile)
+			}
+		})
+	}
+
+	if _, err := ParseMobileProvision([]byte("<plist></plist>")); err == nil {
+		t.Error("ParseMobileProvision() of an unsigned profile error = nil, want an error")
+	}
+}
+
+func TestParseIPABrokenProvisioningProfile(t *testing.T) {
+	info := map[string]any{
+		"CFBundleIdentifier":         "com.example.app",
+		"CFBundleShortVersionString": "2.4.0",
+		"CFBundleVersion":            "321",
+		"CFBundleName":               "Example",
+	}
+	got, err := ParseIPA(writeIPA(t, map[string][]byte{
+		"Info.plist":               marshalPlist(t, info, plist.XMLFormat),
+		"embedded.mobileprovision": []byte("not a profile"),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BundleID != "com.example.app" || got.Provisioning != nil {
+		t.Errorf("ParseIPA() = %+v, want the Info.plist metadata without provisioning", got)
+	}
+}
@@ -0,0 +1,187 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testClientID = "app-distribution"
+
+// mockIssuer is an OpenID Connect provider that issues ID tokens with the claims set
+// on it for any authorization code whose PKCE verifier matches the last challenge.
+type mockIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	claims    map[string]any
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &mockIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                issuer.URL,
+			"authorization_endpoint":                issuer.URL + "/authorize",
+			"token_endpoint":                        issuer.URL + "/token",
+			"jwks_uri":                              issuer.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		digest := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(digest[:]) != issuer.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     issuer.sign(t),
+		})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// sign returns an ID token with the issuer's claims, signed with its key.
+func (i *mockIssuer) sign(t *testing.T) string {
+	claims := map[string]any{
+		"iss": i.URL,
+		"sub": "user-1",
+		"aud": testClientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range i.claims {
+		claims[name] = value
+	}
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	if err != nil {
+		t.Error(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Error(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Error(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func TestOIDCProviderEmailVerified(t *testing.T) {
+	tests := []struct {
+		name                string
+		emailVerified       any
+		assumeEmailVerified bool
+		want                bool
+	}{
+		{"verified", true, false, true},
+		{"unverified", false, false, false},
+		{"claim missing", nil, false, false},
+		{"claim missing with assumeEmailVerified", nil, true, true},
+		{"unverified with assumeEmailVerified", false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := newMockIssuer(t)
+			issuer.claims = map[string]any{
+				"email":  "dev@example.com",
+				"name":   "Dev",
+				"groups": []string{"mobile"},
+				"nonce":  "nonce",
+			}
+			if tt.emailVerified != nil {
+				issuer.claims["email_verified"] = tt.emailVerified
+			}
+
+			provider, err := NewOIDCProvider(context.Background(), issuer.URL, testClientID, "secret", []string{"openid", "email"}, tt.assumeEmailVerified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			issuer.challenge = codeChallenge(t, provider, "verifier")
+
+			identity, err := provider.Exchange(context.Background(), "http://localhost/callback", "code", "verifier", "nonce")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.EmailVerified != tt.want {
+				t.Errorf("EmailVerified = %v, want %v", identity.EmailVerified, tt.want)
+			}
+			if identity.Issuer != issuer.URL || identity.Subject != "user-1" || identity.Email != "dev@example.com" || identity.Name != "Dev" || len(identity.Groups) != 1 {
+				t.Errorf("Exchange() = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderExchangeRejects(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.claims = map[string]any{"email": "dev@example.com", "email_verified": true, "nonce": "nonce"}
+	provider, err := NewOIDCProvider(context.Background(), issuer.URL, testClientID, "secret", []string{"openid"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.challenge = codeChallenge(t, provider, "verifier")
+
+	if _, err := provider.Exchange(context.Background(), "http://localhost/callback", "code", "verifier", "other"); err == nil {
+		t.Error("Exchange() with another nonce error = nil, want an error")
+	}
+	if _, err := provider.Exchange(context.Background(), "http://localhost/callback", "code", "other", "nonce"); err == nil {
+		t.Error("Exchange() with another PKCE verifier error = nil, want an error")
+	}
+
+	issuer.claims["aud"] = "other-client"
+	if _, err := provider.Exchange(context.Background(), "http://localhost/callback", "code", "verifier", "nonce"); err == nil {
+		t.Error("Exchange() of an ID token for another client error = nil, want an error")
+	}
+}
+
+// codeChallenge returns the PKCE challenge that the login URL of provider sends for verifier.
+func codeChallenge(t *testing.T, provider *OIDCProvider, verifier string) string {
+	t.Helper()
+	loginURL, err := url.Parse(provider.AuthCodeURL("http://localhost/callback", "state", "nonce", verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loginURL.Query().Get("code_challenge")
+}
@@ -1,56 +1,156 @@
 package infrastructure
 
-const (
-	StorageDir = "go_uploads"
-)
-
 import (
+	"app-distribution-server-go/internal/application"
 	"app-distribution-server-go/internal/domain"
+	"bytes"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"path"
+	"time"
+)
+
+const (
+	UploadsDir   = "go_uploads"
+	iconFileName = "icon"
 )
 
+// buildColumns is the column list every build query selects, in scanBuild order.
+const buildColumns = `upload_id, bundle_id, version, build_number, title, icon, description, file_size, sha256, created_at, platform, artifact_type, provisioning, android, signature, release_notes, archived_at, deleted_at, commit_sha, branch, tag, repository_url, ci_provider, pipeline_url, variant`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 type PostgresAppRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	blobs application.BlobStore
+	// localLocks serializes access to app files in this process when the database
+	// has no advisory locks, as with SQLite. Postgres uses advisory locks instead,
+	// which also hold across replicas.
+	localLocks *contentLocks
+}
+
+// NewPostgresAppRepository returns a repository that keeps build metadata in db and
+// app files and icons in blobs.
+func NewPostgresAppRepository(db *sql.DB, blobs application.BlobStore) (*PostgresAppRepository, error) {
+	return &PostgresAppRepository{db: db, blobs: blobs}, nil
+}
+
+// appColumns is the column list every app query selects, in scanApp order.
+const appColumns = `bundle_id, platform, name, description, icon, owner, product_id, latest_by, created_at`
+
+func (r *PostgresAppRepository) GetApps() ([]*domain.App, error) {
+	query := `
+		SELECT ` + appColumns + `
+		FROM apps
+		ORDER BY bundle_id
+	`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for apps: %w", err)
+	}
+	defer rows.Close()
+
+	var apps []*domain.App
+	for rows.Next() {
+		app, err := scanApp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan app row: %w", err)
+		}
+		apps = append(apps, app)
+	}
+
+	return apps, nil
+}
+
+func (r *PostgresAppRepository) GetApp(bundleID string) (*domain.App, error) {
+	query := `
+		SELECT ` + appColumns + `
+		FROM apps
+		WHERE bundle_id = $1
+	`
+	app, err := scanApp(r.db.QueryRow(query, bundleID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, application.ErrAppNotFound
+		}
+		return nil, fmt.Errorf("failed to scan app row: %w", err)
+	}
+	return app, nil
+}
+
+func (r *PostgresAppRepository) CreateApp(app *domain.App) error {
+	query := `
+		INSERT INTO apps (` + appColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := r.db.Exec(query, app.BundleID, app.Platform, app.Name, app.Description, app.Icon, app.Owner, nullableString(app.ProductID), app.LatestBy, app.CreatedAt.UTC())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return application.ErrAppExists
+		}
+		return fmt.Errorf("failed to insert app: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresAppRepository) UpdateApp(app *domain.App) error {
+	query := `
+		UPDATE apps
+		SET platform = $2, name = $3, description = $4, icon = $5, owner = $6, latest_by = $7
+		WHERE bundle_id = $1
+	`
+	result, err := r.db.Exec(query, app.BundleID, app.Platform, app.Name, app.Description, app.Icon, app.Owner, app.LatestBy)
+	if err != nil {
+		return fmt.Errorf("failed to update app: %w", err)
+	}
+	return requireRowAffected(result, application.ErrAppNotFound)
 }
 
-func NewPostgresAppRepository(db *sql.DB) (*PostgresAppRepository, error) {
-	return &PostgresAppRepository{db: db}, nil
+func (r *PostgresAppRepository) DeleteApp(bundleID string) error {
+	result, err := r.db.Exec(`DELETE FROM apps WHERE bundle_id = $1`, bundleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete app: %w", err)
+	}
+	return requireRowAffected(result, application.ErrAppNotFound)
 }
 
-func (r *PostgresAppRepository) GetAllApps() ([]*domain.BuildInfo, error) {
+func (r *PostgresAppRepository) GetLatestBuilds() ([]*domain.BuildInfo, error) {
 	query := `
-		SELECT upload_id, bundle_id, version, build_number, title, icon, description, file_size, created_at, platform
+		SELECT ` + buildColumns + `
 		FROM (
 			SELECT *, ROW_NUMBER() OVER(PARTITION BY bundle_id ORDER BY created_at DESC) as rn
 			FROM builds
+			WHERE archived_at IS NULL AND deleted_at IS NULL
 		) t
 		WHERE rn = 1
 	`
 	rows, err := r.db.Query(query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query for all apps: %w", err)
+		return nil, fmt.Errorf("failed to query for latest builds: %w", err)
 	}
 	defer rows.Close()
 
-	var allApps []*domain.BuildInfo
+	var builds []*domain.BuildInfo
 	for rows.Next() {
-		var app domain.BuildInfo
-		if err := rows.Scan(&app.UploadID, &app.BundleID, &app.Version, &app.BuildNumber, &app.Title, &app.Icon, &app.Description, &app.FileSize, &app.CreatedAt, &app.Platform); err != nil {
-			return nil, fmt.Errorf("failed to scan app row: %w", err)
+		build, err := scanBuild(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan build row: %w", err)
 		}
-		allApps = append(allApps, &app)
+		builds = append(builds, build)
 	}
 
-	return allApps, nil
+	return builds, nil
 }
 
 func (r *PostgresAppRepository) GetAllVersions(bundleID string) ([]*domain.BuildInfo, error) {
 	query := `
-		SELECT upload_id, bundle_id, version, build_number, title, icon, description, file_size, created_at, platform
+		SELECT ` + buildColumns + `
 		FROM builds
 		WHERE bundle_id = $1
 		ORDER BY created_at DESC
@@ -63,11 +163,11 @@ func (r *PostgresAppRepository) GetAllVersions(bundleID string) ([]*domain.Build
 
 	var builds []*domain.BuildInfo
 	for rows.Next() {
-		var build domain.BuildInfo
-		if err := rows.Scan(&build.UploadID, &build.BundleID, &build.Version, &build.BuildNumber, &build.Title, &build.Icon, &build.Description, &build.FileSize, &build.CreatedAt, &build.Platform); err != nil {
+		build, err := scanBuild(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan build row: %w", err)
 		}
-		builds = append(builds, &build)
+		builds = append(builds, build)
 	}
 
 	return builds, nil
@@ -75,92 +175,687 @@ func (r *PostgresAppRepository) GetAllVersions(bundleID string) ([]*domain.Build
 
 func (r *PostgresAppRepository) GetLatestVersion(bundleID string) (*domain.BuildInfo, error) {
 	query := `
-		SELECT upload_id, bundle_id, version, build_number, title, icon, description, file_size, created_at, platform
+		SELECT ` + buildColumns + `
 		FROM builds
-		WHERE bundle_id = $1
+		WHERE bundle_id = $1 AND archived_at IS NULL AND deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT 1
 	`
 	row := r.db.QueryRow(query, bundleID)
 
-	var build domain.BuildInfo
-	if err := row.Scan(&build.UploadID, &build.BundleID, &build.Version, &build.BuildNumber, &build.Title, &build.Icon, &build.Description, &build.FileSize, &build.CreatedAt, &build.Platform); err != nil {
+	build, err := scanBuild(row)
+	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("no versions found for bundle ID %s", bundleID)
+			return nil, fmt.Errorf("%w: no listed build for bundle ID %s", application.ErrBuildNotFound, bundleID)
 		}
 		return nil, fmt.Errorf("failed to scan latest version row: %w", err)
 	}
 
-	return &build, nil
+	return build, nil
 }
 
-func (r *PostgresAppRepository) GetBuild(bundleID, version, buildNumber string) (*domain.BuildInfo, error) {
+func (r *PostgresAppRepository) GetBuild(bundleID string, platform domain.Platform, version, buildNumber string) (*domain.BuildInfo, error) {
 	query := `
-		SELECT upload_id, bundle_id, version, build_number, title, icon, description, file_size, created_at, platform
+		SELECT ` + buildColumns + `
 		FROM builds
-		WHERE bundle_id = $1 AND version = $2 AND build_number = $3
-		LIMIT 1
+		WHERE bundle_id = $1 AND platform = $2 AND version = $3 AND build_number = $4
 	`
-	row := r.db.QueryRow(query, bundleID, version, buildNumber)
+	row := r.db.QueryRow(query, bundleID, platform, version, buildNumber)
 
-	var build domain.BuildInfo
-	if err := row.Scan(&build.UploadID, &build.BundleID, &build.Version, &build.BuildNumber, &build.Title, &build.Icon, &build.Description, &build.FileSize, &build.CreatedAt, &build.Platform); err != nil {
+	build, err := scanBuild(row)
+	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("no build found for bundle ID %s, version %s, build number %s", bundleID, version, buildNumber)
+			return nil, fmt.Errorf("%w: no %s build for bundle ID %s, version %s, build number %s", application.ErrBuildNotFound, platform, bundleID, version, buildNumber)
 		}
 		return nil, fmt.Errorf("failed to scan build row: %w", err)
 	}
 
-	return &build, nil
+	return build, nil
 }
 
-func (r *PostgresAppRepository) SaveUpload(info *domain.BuildInfo, appFile io.Reader) error {
+func (r *PostgresAppRepository) GetBuildByUploadID(uploadID string) (*domain.BuildInfo, error) {
+	query := `
+		SELECT ` + buildColumns + `
+		FROM builds
+		WHERE upload_id = $1
+	`
+	build, err := scanBuild(r.db.QueryRow(query, uploadID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, application.ErrBuildNotFound
+		}
+		return nil, fmt.Errorf("failed to scan build row: %w", err)
+	}
+	return build, nil
+}
+
+func (r *PostgresAppRepository) GetBuildsByCommit(commit string) ([]*domain.BuildInfo, error) {
+	query := `
+		SELECT ` + buildColumns + `
+		FROM builds
+		WHERE commit_sha LIKE $1
+		ORDER BY created_at DESC
+	`
+	// Commits are hex, so they can't contain LIKE wildcards
+	rows, err := r.db.Query(query, commit+"%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for builds of commit %s: %w", commit, err)
+	}
+	defer rows.Close()
+
+	var builds []*domain.BuildInfo
+	for rows.Next() {
+		build, err := scanBuild(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan build row: %w", err)
+		}
+		builds = append(builds, build)
+	}
+
+	return builds, nil
+}
+
+func (r *PostgresAppRepository) UpdateBuild(build *domain.BuildInfo) error {
+	query := `
+		UPDATE builds
+		SET title = $2, description = $3, release_notes = $4, archived_at = $5, deleted_at = $6
+		WHERE upload_id = $1
+	`
+	result, err := r.db.Exec(query, build.UploadID, build.Title, build.Description, build.ReleaseNotes, nullableTime(build.ArchivedAt), nullableTime(build.DeletedAt))
+	if err != nil {
+		return fmt.Errorf("failed to update build: %w", err)
+	}
+	return requireRowAffected(result, application.ErrBuildNotFound)
+}
+
+func (r *PostgresAppRepository) GetDeletedBuilds(before time.Time) ([]*domain.BuildInfo, error) {
+	query := `
+		SELECT ` + buildColumns + `
+		FROM builds
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		ORDER BY deleted_at
+	`
+	rows, err := r.db.Query(query, before.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for deleted builds: %w", err)
+	}
+	defer rows.Close()
+
+	var builds []*domain.BuildInfo
+	for rows.Next() {
+		build, err := scanBuild(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan build row: %w", err)
+		}
+		builds = append(builds, build)
+	}
+
+	return builds, nil
+}
+
+// PurgeBuild removes a build with its promotions and feedback, then its icon and app file. The app
+// file is kept while other builds share its content, and stays locked until the build
+// is gone so a concurrent upload of the same content can't lose it.
+func (r *PostgresAppRepository) PurgeBuild(build *domain.BuildInfo) error {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
+
+	if build.SHA256 != "" {
+		unlock, err := r.lockContent(tx, build.SHA256)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	if _, err := tx.Exec(`DELETE FROM promotions WHERE upload_id = $1`, build.UploadID); err != nil {
+		return fmt.Errorf("failed to delete promotions of build: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM feedback WHERE upload_id = $1`, build.UploadID); err != nil {
+		return fmt.Errorf("failed to delete feedback on build: %w", err)
+	}
+	result, err := tx.Exec(`DELETE FROM builds WHERE upload_id = $1`, build.UploadID)
+	if err != nil {
+		return fmt.Errorf("failed to delete build: %w", err)
+	}
+	if err := requireRowAffected(result, application.ErrBuildNotFound); err != nil {
+		return err
+	}
+	var references int
+	if build.SHA256 != "" {
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM builds WHERE sha256 = $1`, build.SHA256).Scan(&references); err != nil {
+			return fmt.Errorf("failed to count builds sharing the app file: %w", err)
+		}
+	}
+	// The app file is deleted while the content is locked; if that fails the build is kept
+	if references == 0 {
+		if err := deleteBlobs(r.blobs, []string{appFileKey(build, buildDir(build))}); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return deleteBlobs(r.blobs, []string{iconKey(build)})
+}
+
+// StageUpload streams the application file into the staging directory of the blob store.
+func (r *PostgresAppRepository) StageUpload(appFile io.Reader, maxSize int64) (*application.StagedUpload, error) {
+	return stageUpload(stagingDir(r.blobs), appFile, maxSize)
+}
+
+func (r *PostgresAppRepository) SaveUpload(info *domain.BuildInfo, upload *application.StagedUpload) error {
+	provisioning, err := marshalNullableJSON(info.Provisioning)
+	if err != nil {
+		return fmt.Errorf("failed to encode provisioning profile: %w", err)
+	}
+	android, err := marshalNullableJSON(info.Android)
+	if err != nil {
+		return fmt.Errorf("failed to encode android metadata: %w", err)
+	}
+	signature, err := marshalNullableJSON(info.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to encode apk signature: %w", err)
+	}
+
+	// The app file is written before the transaction, so a slow blob store doesn't keep
+	// it open. Content that is already stored is checked again once it is locked.
+	key := contentKey(upload.SHA256)
+	if _, err := r.blobs.Stat(key); errors.Is(err, application.ErrBlobNotFound) {
+		if err := putStagedUpload(r.blobs, key, upload); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to check app file: %w", err)
+	}
+	if err := r.insertUpload(info, upload, provisioning, android, signature); err != nil {
+		return errors.Join(err, r.deleteUnreferencedContent(upload.SHA256))
+	}
+	return nil
+}
+
+// insertUpload inserts a build whose app file has been stored. The staged upload is
+// only put again if a concurrent purge deleted the stored content before it was locked.
+func (r *PostgresAppRepository) insertUpload(info *domain.BuildInfo, upload *application.StagedUpload, provisioning, android, signature interface{}) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	unlock, err := r.lockContent(tx, upload.SHA256)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := putContent(r.blobs, upload); err != nil {
+		return err
+	}
 
 	query := `
-		INSERT INTO builds (upload_id, bundle_id, version, build_number, title, icon, description, file_size, created_at, platform)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO builds (` + buildColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)
 	`
-	_, err = tx.Exec(query, info.UploadID, info.BundleID, info.Version, info.BuildNumber, info.Title, info.Icon, info.Description, info.FileSize, info.CreatedAt, info.Platform)
+	var provenance domain.Provenance
+	if info.Provenance != nil {
+		provenance = *info.Provenance
+	}
+	// Timestamps are stored in UTC, so SQLite can order them as text
+	_, err = tx.Exec(query, info.UploadID, info.BundleID, info.Version, info.BuildNumber, info.Title, info.Icon, info.Description, info.FileSize, info.SHA256, info.CreatedAt.UTC(), info.Platform, info.ArtifactType, provisioning, android, signature, info.ReleaseNotes, nullableTime(info.ArchivedAt), nullableTime(info.DeletedAt),
+		provenance.Commit, provenance.Branch, provenance.Tag, provenance.RepositoryURL, provenance.CIProvider, provenance.PipelineURL, provenance.Variant)
 	if err != nil {
-		tx.Rollback()
+		if isUniqueViolation(err) {
+			return application.ErrBuildExists
+		}
 		return fmt.Errorf("failed to insert build info: %w", err)
 	}
 
-	if err := r.saveAppFile(info, appFile); err != nil {
-		tx.Rollback()
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// deleteUnreferencedContent deletes the app file with digest unless a build refers to it,
+// as after an upload whose build could not be inserted.
+func (r *PostgresAppRepository) deleteUnreferencedContent(digest string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	unlock, err := r.lockContent(tx, digest)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var references int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM builds WHERE sha256 = $1`, digest).Scan(&references); err != nil {
+		return fmt.Errorf("failed to count builds sharing the app file: %w", err)
+	}
+	if references > 0 {
+		return nil
+	}
+	return deleteBlobs(r.blobs, []string{contentKey(digest)})
+}
+
+// lockContent locks the app file with digest until tx ends, and returns the function
+// that releases the lock of this process, if any.
+func (r *PostgresAppRepository) lockContent(tx *sql.Tx, digest string) (func(), error) {
+	if r.localLocks != nil {
+		return r.localLocks.lock(digest), nil
+	}
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, digest); err != nil {
+		return nil, fmt.Errorf("failed to lock app file: %w", err)
+	}
+	return func() {}, nil
+}
+
+// SaveIcon saves the app icon next to the application file.
+func (r *PostgresAppRepository) SaveIcon(info *domain.BuildInfo, icon []byte) error {
+	if err := r.blobs.Put(iconKey(info), bytes.NewReader(icon), int64(len(icon))); err != nil {
+		return fmt.Errorf("failed to save icon: %w", err)
+	}
+	return nil
+}
+
+// OpenAppFile opens the application file of a build.
+func (r *PostgresAppRepository) OpenAppFile(info *domain.BuildInfo) (io.ReadSeekCloser, *application.BlobInfo, error) {
+	return openBlob(r.blobs, appFileKey(info, buildDir(info)))
+}
+
+// OpenIcon opens the app icon of a build.
+func (r *PostgresAppRepository) OpenIcon(info *domain.BuildInfo) (io.ReadSeekCloser, *application.BlobInfo, error) {
+	return openBlob(r.blobs, iconKey(info))
+}
+
+func (r *PostgresAppRepository) GetChannels(bundleID string) ([]*domain.Channel, error) {
+	query := `
+		SELECT bundle_id, name, upload_id, updated_at, updated_by
+		FROM channels
+		WHERE bundle_id = $1
+		ORDER BY name
+	`
+	rows, err := r.db.Query(query, bundleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for channels of app %s: %w", bundleID, err)
+	}
+	defer rows.Close()
+
+	var channels []*domain.Channel
+	for rows.Next() {
+		var channel domain.Channel
+		if err := rows.Scan(&channel.BundleID, &channel.Name, &channel.UploadID, &channel.UpdatedAt, &channel.UpdatedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan channel row: %w", err)
+		}
+		channels = append(channels, &channel)
+	}
+
+	return channels, nil
+}
+
+func (r *PostgresAppRepository) GetChannel(bundleID, name string) (*domain.Channel, error) {
+	query := `
+		SELECT bundle_id, name, upload_id, updated_at, updated_by
+		FROM channels
+		WHERE bundle_id = $1 AND name = $2
+	`
+	var channel domain.Channel
+	err := r.db.QueryRow(query, bundleID, name).Scan(&channel.BundleID, &channel.Name, &channel.UploadID, &channel.UpdatedAt, &channel.UpdatedBy)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, application.ErrChannelNotFound
+		}
+		return nil, fmt.Errorf("failed to scan channel row: %w", err)
+	}
+	return &channel, nil
+}
+
+func (r *PostgresAppRepository) SavePromotion(promotion *domain.Promotion) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO channels (bundle_id, name, upload_id, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (bundle_id, name) DO UPDATE
+		SET upload_id = EXCLUDED.upload_id, updated_at = EXCLUDED.updated_at, updated_by = EXCLUDED.updated_by
+	`
+	promotedAt := promotion.PromotedAt.UTC()
+	if _, err := tx.Exec(query, promotion.BundleID, promotion.Channel, promotion.UploadID, promotedAt, promotion.PromotedBy); err != nil {
+		return fmt.Errorf("failed to update channel: %w", err)
+	}
+
+	query = `
+		INSERT INTO promotions (id, bundle_id, channel, upload_id, from_channel, promoted_by, promoted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	if _, err := tx.Exec(query, promotion.ID, promotion.BundleID, promotion.Channel, promotion.UploadID, promotion.FromChannel, promotion.PromotedBy, promotedAt); err != nil {
+		return fmt.Errorf("failed to insert promotion: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresAppRepository) GetPromotions(bundleID, channel string) ([]*domain.Promotion, error) {
+	query := `
+		SELECT id, bundle_id, channel, upload_id, from_channel, promoted_by, promoted_at
+		FROM promotions
+		WHERE bundle_id = $1 AND ($2 = '' OR channel = $2)
+		ORDER BY promoted_at DESC
+	`
+	rows, err := r.db.Query(query, bundleID, channel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for promotions of app %s: %w", bundleID, err)
+	}
+	defer rows.Close()
+
+	var promotions []*domain.Promotion
+	for rows.Next() {
+		var promotion domain.Promotion
+		if err := rows.Scan(&promotion.ID, &promotion.BundleID, &promotion.Channel, &promotion.UploadID, &promotion.FromChannel, &promotion.PromotedBy, &promotion.PromotedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan promotion row: %w", err)
+		}
+		promotions = append(promotions, &promotion)
+	}
+
+	return promotions, nil
+}
+
+func (r *PostgresAppRepository) SaveFeedback(feedback *domain.Feedback) error {
+	query := `
+		INSERT INTO feedback (id, bundle_id, upload_id, author, message, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(query, feedback.ID, feedback.BundleID, feedback.UploadID, feedback.Author, feedback.Message, feedback.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert feedback: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresAppRepository) GetFeedback(uploadID string) ([]*domain.Feedback, error) {
+	query := `
+		SELECT id, bundle_id, upload_id, author, message, created_at
+		FROM feedback
+		WHERE upload_id = $1
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.Query(query, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for feedback on build %s: %w", uploadID, err)
+	}
+	defer rows.Close()
+
+	var feedback []*domain.Feedback
+	for rows.Next() {
+		var f domain.Feedback
+		if err := rows.Scan(&f.ID, &f.BundleID, &f.UploadID, &f.Author, &f.Message, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feedback row: %w", err)
+		}
+		feedback = append(feedback, &f)
+	}
+
+	return feedback, nil
+}
+
+func (r *PostgresAppRepository) GetProducts() ([]*domain.Product, error) {
+	rows, err := r.db.Query(`SELECT id, name, created_at FROM products ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []*domain.Product
+	byID := make(map[string]*domain.Product)
+	for rows.Next() {
+		product := &domain.Product{Apps: make(map[domain.Platform]string)}
+		if err := rows.Scan(&product.ID, &product.Name, &product.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan product row: %w", err)
+		}
+		products = append(products, product)
+		byID[product.ID] = product
+	}
+	rows.Close()
+
+	rows, err = r.db.Query(`SELECT product_id, platform, bundle_id FROM apps WHERE product_id IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for product apps: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID, bundleID string
+		var platform domain.Platform
+		if err := rows.Scan(&productID, &platform, &bundleID); err != nil {
+			return nil, fmt.Errorf("failed to scan product app row: %w", err)
+		}
+		if product, ok := byID[productID]; ok {
+			product.Apps[platform] = bundleID
+		}
+	}
+
+	return products, nil
+}
+
+func (r *PostgresAppRepository) GetProduct(id string) (*domain.Product, error) {
+	product := &domain.Product{Apps: make(map[domain.Platform]string)}
+	err := r.db.QueryRow(`SELECT id, name, created_at FROM products WHERE id = $1`, id).Scan(&product.ID, &product.Name, &product.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, application.ErrProductNotFound
+		}
+		return nil, fmt.Errorf("failed to scan product row: %w", err)
+	}
+
+	rows, err := r.db.Query(`SELECT platform, bundle_id FROM apps WHERE product_id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for product apps: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bundleID string
+		var platform domain.Platform
+		if err := rows.Scan(&platform, &bundleID); err != nil {
+			return nil, fmt.Errorf("failed to scan product app row: %w", err)
+		}
+		product.Apps[platform] = bundleID
+	}
+
+	return product, nil
+}
+
+func (r *PostgresAppRepository) CreateProduct(product *domain.Product) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO products (id, name, created_at) VALUES ($1, $2, $3)`, product.ID, product.Name, product.CreatedAt.UTC())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return application.ErrProductExists
+		}
+		return fmt.Errorf("failed to insert product: %w", err)
+	}
+	if err := setProductApps(tx, product); err != nil {
 		return err
 	}
 
 	return tx.Commit()
 }
 
-// saveAppFile saves the application file.
-func (r *PostgresAppRepository) saveAppFile(info *domain.BuildInfo, appFile io.Reader) error {
-	uploadDir := filepath.Join(StorageDir, info.BundleID, info.Version, info.BuildNumber)
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return fmt.Errorf("failed to create upload directory: %w", err)
+func (r *PostgresAppRepository) UpdateProduct(product *domain.Product) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	fileName := "app.ipa"
-	if info.Platform == domain.Android {
-		fileName = "app.apk"
+	result, err := tx.Exec(`UPDATE products SET name = $2 WHERE id = $1`, product.ID, product.Name)
+	if err != nil {
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+	if err := requireRowAffected(result, application.ErrProductNotFound); err != nil {
+		return err
+	}
+	if err := setProductApps(tx, product); err != nil {
+		return err
 	}
-	filePath := filepath.Join(uploadDir, fileName)
 
-	file, err := os.Create(filePath)
+	return tx.Commit()
+}
+
+func (r *PostgresAppRepository) DeleteProduct(id string) error {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to create app file: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer file.Close()
+	defer tx.Rollback()
 
-	_, err = io.Copy(file, appFile)
+	if _, err := tx.Exec(`UPDATE apps SET product_id = NULL WHERE product_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to unlink product apps: %w", err)
+	}
+	result, err := tx.Exec(`DELETE FROM products WHERE id = $1`, id)
 	if err != nil {
-		return fmt.Errorf("failed to save app file: %w", err)
+		return fmt.Errorf("failed to delete product: %w", err)
+	}
+	if err := requireRowAffected(result, application.ErrProductNotFound); err != nil {
+		return err
 	}
 
+	return tx.Commit()
+}
+
+// setProductApps links exactly the apps of product to it. Apps of other products are
+// not moved.
+func setProductApps(tx *sql.Tx, product *domain.Product) error {
+	if _, err := tx.Exec(`UPDATE apps SET product_id = NULL WHERE product_id = $1`, product.ID); err != nil {
+		return fmt.Errorf("failed to unlink product apps: %w", err)
+	}
+	for _, bundleID := range product.Apps {
+		var productID sql.NullString
+		if err := tx.QueryRow(`SELECT product_id FROM apps WHERE bundle_id = $1`, bundleID).Scan(&productID); err != nil {
+			if err == sql.ErrNoRows {
+				return application.ErrAppNotFound
+			}
+			return fmt.Errorf("failed to get product of app %s: %w", bundleID, err)
+		}
+		if productID.Valid {
+			return fmt.Errorf("%w: %s belongs to %s", application.ErrAppInProduct, bundleID, productID.String)
+		}
+		if _, err := tx.Exec(`UPDATE apps SET product_id = $1 WHERE bundle_id = $2`, product.ID, bundleID); err != nil {
+			return fmt.Errorf("failed to link app %s to product: %w", bundleID, err)
+		}
+	}
+	return nil
+}
+
+// buildDir returns the blob key prefix of the files that belong to a single build.
+func buildDir(info *domain.BuildInfo) string {
+	return path.Join(info.BundleID, info.Version, info.BuildNumber)
+}
+
+// iconKey returns the blob key of a build's icon.
+func iconKey(info *domain.BuildInfo) string {
+	return path.Join(buildDir(info), iconFileName)
+}
+
+// scanApp scans a row selected with appColumns into an App.
+func scanApp(row rowScanner) (*domain.App, error) {
+	var app domain.App
+	var productID sql.NullString
+	if err := row.Scan(&app.BundleID, &app.Platform, &app.Name, &app.Description, &app.Icon, &app.Owner, &productID, &app.LatestBy, &app.CreatedAt); err != nil {
+		return nil, err
+	}
+	app.ProductID = productID.String
+	return &app, nil
+}
+
+// nullableString returns nil for an empty string, so the column is stored as NULL.
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullableTime returns nil for a nil time, so the column is stored as NULL, and
+// the time in UTC otherwise.
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// requireRowAffected returns notFound if a statement didn't change any row.
+func requireRowAffected(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return notFound
+	}
 	return nil
 }
+
+// scanBuild scans a row selected with buildColumns into a BuildInfo.
+func scanBuild(row rowScanner) (*domain.BuildInfo, error) {
+	var build domain.BuildInfo
+	var provisioning, android, signature []byte
+	var archivedAt, deletedAt sql.NullTime
+	var provenance domain.Provenance
+	if err := row.Scan(&build.UploadID, &build.BundleID, &build.Version, &build.BuildNumber, &build.Title, &build.Icon, &build.Description, &build.FileSize, &build.SHA256, &build.CreatedAt, &build.Platform, &build.ArtifactType, &provisioning, &android, &signature, &build.ReleaseNotes, &archivedAt, &deletedAt,
+		&provenance.Commit, &provenance.Branch, &provenance.Tag, &provenance.RepositoryURL, &provenance.CIProvider, &provenance.PipelineURL, &provenance.Variant); err != nil {
+		return nil, err
+	}
+	if !provenance.IsZero() {
+		build.Provenance = &provenance
+	}
+	if archivedAt.Valid {
+		build.ArchivedAt = &archivedAt.Time
+	}
+	if deletedAt.Valid {
+		build.DeletedAt = &deletedAt.Time
+	}
+
+	if provisioning != nil {
+		build.Provisioning = &domain.ProvisioningProfile{}
+		if err := json.Unmarshal(provisioning, build.Provisioning); err != nil {
+			return nil, fmt.Errorf("failed to decode provisioning profile: %w", err)
+		}
+	}
+	if android != nil {
+		build.Android = &domain.AndroidMetadata{}
+		if err := json.Unmarshal(android, build.Android); err != nil {
+			return nil, fmt.Errorf("failed to decode android metadata: %w", err)
+		}
+	}
+	if signature != nil {
+		build.Signature = &domain.APKSignature{}
+		if err := json.Unmarshal(signature, build.Signature); err != nil {
+			return nil, fmt.Errorf("failed to decode apk signature: %w", err)
+		}
+	}
+
+	return &build, nil
+}
+
+// marshalNullableJSON encodes v as JSON, or returns nil so the column is stored as NULL.
+func marshalNullableJSON[T any](v *T) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"database/sql"
+	"fmt"
+)
+
+type PostgresDeviceRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresDeviceRepository(db *sql.DB) (*PostgresDeviceRepository, error) {
+	return &PostgresDeviceRepository{db: db}, nil
+}
+
+func (r *PostgresDeviceRepository) GetDevices(tester string) ([]*domain.Device, error) {
+	query := `
+		SELECT udid, tester, product, version, serial, created_at
+		FROM devices
+		WHERE $1 = '' OR tester = $1
+		ORDER BY tester, created_at
+	`
+	rows, err := r.db.Query(query, tester)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for devices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []*domain.Device
+	for rows.Next() {
+		var device domain.Device
+		if err := rows.Scan(&device.UDID, &device.Tester, &device.Product, &device.Version, &device.Serial, &device.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan device row: %w", err)
+		}
+		devices = append(devices, &device)
+	}
+
+	return devices, nil
+}
+
+// SaveDevice stores a device, updating its attributes if the tester already registered it.
+func (r *PostgresDeviceRepository) SaveDevice(device *domain.Device) error {
+	query := `
+		INSERT INTO devices (udid, tester, product, version, serial, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tester, udid) DO UPDATE
+		SET product = EXCLUDED.product, version = EXCLUDED.version, serial = EXCLUDED.serial
+	`
+	_, err := r.db.Exec(query, device.UDID, device.Tester, device.Product, device.Version, device.Serial, device.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// memberColumns are the app_members columns in the order queryMembers scans them.
+const memberColumns = `bundle_id, email, group_name, role, created_at`
+
+type PostgresMemberRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresMemberRepository(db *sql.DB) (*PostgresMemberRepository, error) {
+	return &PostgresMemberRepository{db: db}, nil
+}
+
+func (r *PostgresMemberRepository) SaveMember(member *domain.Member) error {
+	query := `
+		INSERT INTO app_members (` + memberColumns + `)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (bundle_id, email, group_name) DO UPDATE
+		SET role = EXCLUDED.role
+		RETURNING created_at
+	`
+	row := r.db.QueryRow(query, member.BundleID, member.Email, member.Group, member.Role, member.CreatedAt.UTC())
+	if err := row.Scan(&member.CreatedAt); err != nil {
+		return fmt.Errorf("failed to save member: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresMemberRepository) GetMembers(bundleID string) ([]*domain.Member, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM app_members
+		WHERE bundle_id = $1
+		ORDER BY group_name, email
+	`
+	return r.queryMembers(query, bundleID)
+}
+
+func (r *PostgresMemberRepository) GetUserMembers(email string, groups []string) ([]*domain.Member, error) {
+	// Members of a group have an empty email and the other way round, so empty values never match
+	var conditions []string
+	var args []any
+	if email != "" {
+		args = append(args, email)
+		conditions = append(conditions, "email = $1")
+	}
+	var placeholders []string
+	for _, group := range groups {
+		if group != "" {
+			args = append(args, group)
+			placeholders = append(placeholders, "$"+strconv.Itoa(len(args)))
+		}
+	}
+	if len(placeholders) > 0 {
+		conditions = append(conditions, "group_name IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT ` + memberColumns + `
+		FROM app_members
+		WHERE ` + strings.Join(conditions, " OR ")
+	return r.queryMembers(query, args...)
+}
+
+func (r *PostgresMemberRepository) DeleteMember(bundleID, email, group string) error {
+	result, err := r.db.Exec(`DELETE FROM app_members WHERE bundle_id = $1 AND email = $2 AND group_name = $3`, bundleID, email, group)
+	if err != nil {
+		return fmt.Errorf("failed to delete member: %w", err)
+	}
+	return requireRowAffected(result, application.ErrMemberNotFound)
+}
+
+func (r *PostgresMemberRepository) queryMembers(query string, args ...any) ([]*domain.Member, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*domain.Member
+	for rows.Next() {
+		var member domain.Member
+		if err := rows.Scan(&member.BundleID, &member.Email, &member.Group, &member.Role, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan member row: %w", err)
+		}
+		members = append(members, &member)
+	}
+	return members, nil
+}
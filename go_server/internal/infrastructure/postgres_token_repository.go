@@ -0,0 +1,120 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// tokenColumns are the api_tokens columns in the order scanToken expects.
+const tokenColumns = `id, name, prefix, token_hash, bundle_ids, permissions, created_at, expires_at, last_used_at`
+
+type PostgresTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresTokenRepository(db *sql.DB) (*PostgresTokenRepository, error) {
+	return &PostgresTokenRepository{db: db}, nil
+}
+
+func (r *PostgresTokenRepository) CreateToken(token *domain.APIToken) error {
+	bundleIDs, err := json.Marshal(token.BundleIDs)
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle IDs: %w", err)
+	}
+	permissions, err := json.Marshal(token.Permissions)
+	if err != nil {
+		return fmt.Errorf("failed to encode permissions: %w", err)
+	}
+
+	query := `
+		INSERT INTO api_tokens (` + tokenColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err = r.db.Exec(query, token.ID, token.Name, token.Prefix, token.Hash, bundleIDs, permissions, token.CreatedAt.UTC(), nullableTime(token.ExpiresAt), nullableTime(token.LastUsedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresTokenRepository) GetTokens() ([]*domain.APIToken, error) {
+	query := `
+		SELECT ` + tokenColumns + `
+		FROM api_tokens
+		ORDER BY created_at
+	`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*domain.APIToken
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token row: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func (r *PostgresTokenRepository) GetTokenByHash(hash string) (*domain.APIToken, error) {
+	query := `
+		SELECT ` + tokenColumns + `
+		FROM api_tokens
+		WHERE token_hash = $1
+	`
+	token, err := scanToken(r.db.QueryRow(query, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, application.ErrTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to scan token row: %w", err)
+	}
+	return token, nil
+}
+
+func (r *PostgresTokenRepository) UpdateLastUsed(id string, usedAt time.Time) error {
+	if _, err := r.db.Exec(`UPDATE api_tokens SET last_used_at = $2 WHERE id = $1`, id, usedAt.UTC()); err != nil {
+		return fmt.Errorf("failed to update last use of token: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresTokenRepository) DeleteToken(id string) error {
+	result, err := r.db.Exec(`DELETE FROM api_tokens WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	return requireRowAffected(result, application.ErrTokenNotFound)
+}
+
+// scanToken scans a row selected with tokenColumns into an APIToken.
+func scanToken(row rowScanner) (*domain.APIToken, error) {
+	var token domain.APIToken
+	var bundleIDs, permissions []byte
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&token.ID, &token.Name, &token.Prefix, &token.Hash, &bundleIDs, &permissions, &token.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if err := json.Unmarshal(bundleIDs, &token.BundleIDs); err != nil {
+		return nil, fmt.Errorf("failed to decode bundle IDs: %w", err)
+	}
+	if err := json.Unmarshal(permissions, &token.Permissions); err != nil {
+		return nil, fmt.Errorf("failed to decode permissions: %w", err)
+	}
+	return &token, nil
+}
@@ -0,0 +1,118 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// userColumns are the users columns in the order scanUser expects.
+const userColumns = `id, issuer, subject, email, name, user_groups, created_at, last_login_at`
+
+type PostgresUserRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresUserRepository(db *sql.DB) (*PostgresUserRepository, error) {
+	return &PostgresUserRepository{db: db}, nil
+}
+
+func (r *PostgresUserRepository) SaveUser(user *domain.User) error {
+	groups, err := json.Marshal(user.Groups)
+	if err != nil {
+		return fmt.Errorf("failed to encode groups: %w", err)
+	}
+
+	query := `
+		INSERT INTO users (` + userColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (issuer, subject) DO UPDATE
+		SET email = EXCLUDED.email, name = EXCLUDED.name, user_groups = EXCLUDED.user_groups, last_login_at = EXCLUDED.last_login_at
+		RETURNING id, created_at
+	`
+	row := r.db.QueryRow(query, uuid.New().String(), user.Issuer, user.Subject, user.Email, user.Name, groups, user.CreatedAt.UTC(), user.LastLoginAt.UTC())
+	if err := row.Scan(&user.ID, &user.CreatedAt); err != nil {
+		return fmt.Errorf("failed to save user: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) GetUser(id string) (*domain.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1
+	`
+	user, err := scanUser(r.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, application.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to scan user row: %w", err)
+	}
+	return user, nil
+}
+
+func (r *PostgresUserRepository) CreateSession(session *domain.Session) error {
+	query := `
+		INSERT INTO sessions (token_hash, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	if _, err := r.db.Exec(query, session.Hash, session.UserID, session.CreatedAt.UTC(), session.ExpiresAt.UTC()); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) GetSessionByHash(hash string) (*domain.Session, error) {
+	query := `
+		SELECT token_hash, user_id, created_at, expires_at
+		FROM sessions
+		WHERE token_hash = $1
+	`
+	var session domain.Session
+	if err := r.db.QueryRow(query, hash).Scan(&session.Hash, &session.UserID, &session.CreatedAt, &session.ExpiresAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, application.ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to scan session row: %w", err)
+	}
+	return &session, nil
+}
+
+func (r *PostgresUserRepository) DeleteSession(hash string) error {
+	if _, err := r.db.Exec(`DELETE FROM sessions WHERE token_hash = $1`, hash); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) DeleteExpiredSessions(now time.Time) (int, error) {
+	result, err := r.db.Exec(`DELETE FROM sessions WHERE expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return int(deleted), nil
+}
+
+// scanUser scans a row selected with userColumns into a User.
+func scanUser(row rowScanner) (*domain.User, error) {
+	var user domain.User
+	var groups []byte
+	if err := row.Scan(&user.ID, &user.Issuer, &user.Subject, &user.Email, &user.Name, &groups, &user.CreatedAt, &user.LastLoginAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(groups, &user.Groups); err != nil {
+		return nil, fmt.Errorf("failed to decode groups: %w", err)
+	}
+	return &user, nil
+}
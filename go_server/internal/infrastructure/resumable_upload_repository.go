@@ -0,0 +1,414 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// resumableUploadsPrefix is the blob key prefix that partial uploads are kept under.
+const resumableUploadsPrefix = "resumable"
+
+// resumableRecordName is the name of the blob holding the record of an upload.
+const resumableRecordName = "upload.json"
+
+// resumableLockName is the name of the blob that exists while a request holds the
+// lock of an upload.
+const resumableLockName = "upload.lock"
+
+// resumableLockTimeout is how old a lock has to be to be taken as left behind by a
+// replica that stopped while holding it. It is far longer than requests take.
+const resumableLockTimeout = time.Hour
+
+// resumableUploadRecord is the stored record of a resumable upload. The SHA-256 state
+// of the bytes received so far is kept with it, so the digest doesn't have to be
+// recomputed over the whole file when the upload finishes.
+type resumableUploadRecord struct {
+	domain.ResumableUpload
+	HashState []byte `json:"hash_state,omitempty"`
+	// Chunks are the blobs holding the bytes received so far, in order.
+	Chunks []resumableChunk `json:"chunks,omitempty"`
+}
+
+type resumableChunk struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// BlobResumableUploadRepository keeps partial uploads in a blob store, as a record and
+// a blob per received chunk, so that every replica sharing the store can resume them.
+// Writes to one upload are serialized across the replicas by a lock blob, which only
+// one of them can create at a time.
+type BlobResumableUploadRepository struct {
+	blobs application.BlobStore
+}
+
+// NewBlobResumableUploadRepository returns a repository that stores partial uploads in blobs.
+func NewBlobResumableUploadRepository(blobs application.BlobStore) *BlobResumableUploadRepository {
+	return &BlobResumableUploadRepository{blobs: blobs}
+}
+
+func (r *BlobResumableUploadRepository) CreateUpload(upload *domain.ResumableUpload) error {
+	return r.saveRecord(&resumableUploadRecord{ResumableUpload: *upload})
+}
+
+func (r *BlobResumableUploadRepository) GetUpload(id string) (*domain.ResumableUpload, error) {
+	record, err := r.loadRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	return &record.ResumableUpload, nil
+}
+
+func (r *BlobResumableUploadRepository) WriteChunk(id string, offset int64, chunk io.Reader, expiresAt time.Time) (*domain.ResumableUpload, error) {
+	if err := r.lock(id); err != nil {
+		return nil, err
+	}
+	defer r.unlock(id)
+
+	record, err := r.loadRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != record.Offset {
+		return nil, application.ErrUploadOffsetMismatch
+	}
+	// The data of finished uploads may already have been saved and deleted
+	if record.Finished() {
+		return &record.ResumableUpload, nil
+	}
+
+	digest := sha256.New()
+	if record.HashState != nil {
+		if err := digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(record.HashState); err != nil {
+			return nil, fmt.Errorf("failed to restore upload digest: %w", err)
+		}
+	}
+
+	// Spool the chunk locally first, so that the bytes received before a request is cut
+	// off can be kept and stored with their size
+	spool, err := createSpoolFile(r.blobs)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	n, copyErr := io.Copy(io.MultiWriter(spool, digest), io.LimitReader(chunk, record.Length-offset))
+	if copyErr == nil && offset+n == record.Length {
+		// The chunk may not carry more bytes than the upload length that was announced
+		if extra, _ := chunk.Read(make([]byte, 1)); extra > 0 {
+			copyErr = application.ErrUploadTooLarge
+		}
+	}
+
+	// Keep whatever was received, so the client can resume from there
+	if n > 0 {
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to read upload chunk: %w", err)
+		}
+		key := chunkKey(id, offset)
+		if err := r.blobs.Put(key, io.LimitReader(spool, n), n); err != nil {
+			return nil, fmt.Errorf("failed to store upload chunk: %w", err)
+		}
+		record.Chunks = append(record.Chunks, resumableChunk{Key: key, Size: n})
+		if record.HashState, err = digest.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+			return nil, fmt.Errorf("failed to save upload digest: %w", err)
+		}
+		record.Offset += n
+	}
+	record.ExpiresAt = expiresAt
+	if err := r.saveRecord(record); err != nil {
+		return nil, err
+	}
+
+	if copyErr != nil {
+		if copyErr == application.ErrUploadTooLarge {
+			return &record.ResumableUpload, copyErr
+		}
+		return &record.ResumableUpload, fmt.Errorf("failed to write chunk: %w", copyErr)
+	}
+	return &record.ResumableUpload, nil
+}
+
+// StageUpload joins the chunks of a finished upload into a staged app file. The
+// chunks are kept until the upload is completed, so saving it can be retried.
+func (r *BlobResumableUploadRepository) StageUpload(id string) (*application.StagedUpload, error) {
+	record, err := r.loadRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	if !record.Finished() || record.Build != nil {
+		return nil, fmt.Errorf("upload %s is not finished or already saved", id)
+	}
+
+	digest := sha256.New()
+	if record.HashState != nil {
+		if err := digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(record.HashState); err != nil {
+			return nil, fmt.Errorf("failed to restore upload digest: %w", err)
+		}
+	}
+
+	file, err := createSpoolFile(r.blobs)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	staged := &application.StagedUpload{
+		Path:   file.Name(),
+		Size:   record.Offset,
+		SHA256: hex.EncodeToString(digest.Sum(nil)),
+	}
+
+	var size int64
+	for _, chunk := range record.Chunks {
+		n, err := r.copyChunk(file, chunk)
+		size += n
+		if err != nil {
+			staged.Remove()
+			return nil, err
+		}
+	}
+	if size != record.Length {
+		staged.Remove()
+		return nil, fmt.Errorf("upload %s has %d of %d bytes", id, size, record.Length)
+	}
+	if err := file.Sync(); err != nil {
+		staged.Remove()
+		return nil, fmt.Errorf("failed to stage upload: %w", err)
+	}
+	return staged, nil
+}
+
+// UpdateUpload saves the record of an upload. The chunks of uploads that have been
+// saved as a build are deleted.
+func (r *BlobResumableUploadRepository) UpdateUpload(upload *domain.ResumableUpload) error {
+	record, err := r.loadRecord(upload.ID)
+	if err != nil {
+		return err
+	}
+	record.ResumableUpload = *upload
+	if upload.Build == nil {
+		return r.saveRecord(record)
+	}
+
+	chunks := record.Chunks
+	record.Chunks = nil
+	if err := r.saveRecord(record); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		keys = append(keys, chunk.Key)
+	}
+	return deleteBlobs(r.blobs, keys)
+}
+
+func (r *BlobResumableUploadRepository) DeleteUpload(id string) error {
+	if err := r.lock(id); err != nil {
+		return err
+	}
+	defer r.unlock(id)
+
+	if _, err := r.loadRecord(id); err != nil {
+		return err
+	}
+	return r.remove(id)
+}
+
+func (r *BlobResumableUploadRepository) DeleteExpiredUploads(now time.Time) (int, error) {
+	blobs, err := r.blobs.List(resumableUploadsPrefix + "/")
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, blob := range blobs {
+		id, name := path.Split(strings.TrimPrefix(blob.Key, resumableUploadsPrefix+"/"))
+		if name != resumableRecordName {
+			continue
+		}
+		id = strings.TrimSuffix(id, "/")
+		record, err := r.loadRecord(id)
+		if err != nil {
+			fmt.Printf("Error loading upload %s: %v\n", id, err)
+			continue
+		}
+		if !now.After(record.ExpiresAt) {
+			continue
+		}
+		// Uploads that are being written to aren't expired
+		if err := r.lock(id); err != nil {
+			continue
+		}
+		err = r.remove(id)
+		r.unlock(id)
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// copyChunk appends a chunk of an upload to w.
+func (r *BlobResumableUploadRepository) copyChunk(w io.Writer, chunk resumableChunk) (int64, error) {
+	body, err := r.blobs.Get(chunk.Key, 0, chunk.Size)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read upload chunk %s: %w", chunk.Key, err)
+	}
+	defer body.Close()
+
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return n, fmt.Errorf("failed to read upload chunk %s: %w", chunk.Key, err)
+	}
+	if n != chunk.Size {
+		return n, fmt.Errorf("upload chunk %s has %d of %d bytes", chunk.Key, n, chunk.Size)
+	}
+	return n, nil
+}
+
+func (r *BlobResumableUploadRepository) LockUpload(id string) error {
+	return r.lock(id)
+}
+
+func (r *BlobResumableUploadRepository) UnlockUpload(id string) error {
+	return r.unlock(id)
+}
+
+// lock creates the lock blob of an upload, or returns ErrUploadLocked if another
+// request on any replica holds it. Locks older than resumableLockTimeout are broken.
+func (r *BlobResumableUploadRepository) lock(id string) error {
+	err := r.blobs.Create(lockKey(id), bytes.NewReader(nil), 0)
+	if !errors.Is(err, application.ErrBlobExists) {
+		return err
+	}
+
+	info, err := r.blobs.Stat(lockKey(id))
+	switch {
+	case errors.Is(err, application.ErrBlobNotFound):
+		// Unlocked in the meantime
+	case err != nil:
+		return err
+	case time.Since(info.ModTime) < resumableLockTimeout:
+		return application.ErrUploadLocked
+	default:
+		if err := r.blobs.Delete(lockKey(id)); err != nil {
+			return err
+		}
+	}
+
+	if err := r.blobs.Create(lockKey(id), bytes.NewReader(nil), 0); err != nil {
+		if errors.Is(err, application.ErrBlobExists) {
+			return application.ErrUploadLocked
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *BlobResumableUploadRepository) unlock(id string) error {
+	return r.blobs.Delete(lockKey(id))
+}
+
+// remove deletes the chunks and the record of an upload. The record goes last, so
+// an upload that couldn't be removed completely is removed again once it expires.
+func (r *BlobResumableUploadRepository) remove(id string) error {
+	blobs, err := r.blobs.List(uploadPrefix(id))
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for _, blob := range blobs {
+		// The lock is released by whoever holds it
+		if blob.Key != recordKey(id) && blob.Key != lockKey(id) {
+			keys = append(keys, blob.Key)
+		}
+	}
+	if err := deleteBlobs(r.blobs, keys); err != nil {
+		return err
+	}
+	return r.blobs.Delete(recordKey(id))
+}
+
+// loadRecord reads the record of an upload.
+func (r *BlobResumableUploadRepository) loadRecord(id string) (*resumableUploadRecord, error) {
+	// IDs come from the URL, so make sure they can't point to other blobs
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, application.ErrUploadNotFound
+	}
+
+	body, err := r.blobs.Get(recordKey(id), 0, -1)
+	if err != nil {
+		if errors.Is(err, application.ErrBlobNotFound) {
+			return nil, application.ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload record: %w", err)
+	}
+	defer body.Close()
+
+	var record resumableUploadRecord
+	if err := json.NewDecoder(body).Decode(&record); err != nil {
+		return nil, fmt.Errorf("failed to decode upload record: %w", err)
+	}
+	return &record, nil
+}
+
+// saveRecord writes the record of an upload. Blob stores replace blobs atomically, so
+// readers never see a partially written record.
+func (r *BlobResumableUploadRepository) saveRecord(record *resumableUploadRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload record: %w", err)
+	}
+	if err := r.blobs.Put(recordKey(record.ID), bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("failed to save upload record: %w", err)
+	}
+	return nil
+}
+
+// createSpoolFile creates a temporary file in the directory uploads to blobs are staged in.
+func createSpoolFile(blobs application.BlobStore) (*os.File, error) {
+	dir := stagingDir(blobs)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	file, err := os.CreateTemp(dir, "resumable-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging file: %w", err)
+	}
+	return file, nil
+}
+
+func uploadPrefix(id string) string {
+	return path.Join(resumableUploadsPrefix, id) + "/"
+}
+
+func recordKey(id string) string {
+	return path.Join(resumableUploadsPrefix, id, resumableRecordName)
+}
+
+func lockKey(id string) string {
+	return path.Join(resumableUploadsPrefix, id, resumableLockName)
+}
+
+// chunkKey returns a new key for the chunk of an upload starting at offset. Keys are
+// unique, so a replica writing the same chunk doesn't overwrite one a record points to.
+func chunkKey(id string, offset int64) string {
+	return path.Join(resumableUploadsPrefix, id, "chunks", strconv.FormatInt(offset, 10)+"-"+uuid.New().String())
+}
@@ -0,0 +1,70 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBlobResumableUploadRepositoryLock(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalBlobStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two replicas sharing the blob store
+	first := NewBlobResumableUploadRepository(store)
+	second := NewBlobResumableUploadRepository(store)
+
+	upload := &domain.ResumableUpload{ID: uuid.New().String(), Length: 10, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := first.CreateUpload(upload); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.LockUpload(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.WriteChunk(upload.ID, 0, strings.NewReader("01234"), upload.ExpiresAt); !errors.Is(err, application.ErrUploadLocked) {
+		t.Errorf("WriteChunk() on another replica while locked error = %v, want ErrUploadLocked", err)
+	}
+	if err := second.DeleteUpload(upload.ID); !errors.Is(err, application.ErrUploadLocked) {
+		t.Errorf("DeleteUpload() on another replica while locked error = %v, want ErrUploadLocked", err)
+	}
+	if err := first.UnlockUpload(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := second.WriteChunk(upload.ID, 0, strings.NewReader("01234"), upload.ExpiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.Offset != 5 {
+		t.Errorf("Offset = %d, want 5", written.Offset)
+	}
+
+	// A lock left behind by a replica that stopped is broken once it is old enough
+	if err := first.LockUpload(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-resumableLockTimeout - time.Minute)
+	if err := os.Chtimes(filepath.Join(root, filepath.FromSlash(lockKey(upload.ID))), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.WriteChunk(upload.ID, 5, strings.NewReader("56789"), upload.ExpiresAt); err != nil {
+		t.Errorf("WriteChunk() with a stale lock error = %v", err)
+	}
+
+	if err := first.DeleteUpload(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+	if blobs, err := store.List(uploadPrefix(upload.ID)); err != nil || len(blobs) != 0 {
+		t.Errorf("blobs of a deleted upload = %v, %v, want none", blobs, err)
+	}
+}
@@ -0,0 +1,136 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3BlobStore stores blobs as objects in an S3 compatible bucket, such as AWS S3 or MinIO.
+type S3BlobStore struct {
+	client *minio.Client
+	bucket string
+}
+
+// S3Config holds the connection settings of an S3BlobStore.
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// NewS3BlobStore connects to the bucket described by config, creating it if it doesn't exist.
+func NewS3BlobStore(config S3Config) (*S3BlobStore, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", config.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", config.Bucket, err)
+		}
+	}
+
+	return &S3BlobStore{client: client, bucket: config.Bucket}, nil
+}
+
+func (s *S3BlobStore) Put(key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Create(key string, r io.Reader, size int64) error {
+	opts := minio.PutObjectOptions{ContentType: "application/octet-stream"}
+	// If-None-Match: * makes the bucket reject the write if the object exists
+	opts.SetMatchETagExcept("*")
+	if _, err := s.client.PutObject(context.Background(), s.bucket, key, r, size, opts); err != nil {
+		// Concurrent conditional writes of the same key can also fail with a conflict
+		switch minio.ToErrorResponse(err).StatusCode {
+		case http.StatusPreconditionFailed, http.StatusConflict:
+			return application.ErrBlobExists
+		}
+		return fmt.Errorf("failed to create object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if offset > 0 || length >= 0 {
+		end := int64(0) // to the end of the object
+		if length >= 0 {
+			if length == 0 {
+				return io.NopCloser(strings.NewReader("")), nil
+			}
+			end = offset + length - 1
+		}
+		if err := opts.SetRange(offset, end); err != nil {
+			return nil, fmt.Errorf("invalid range for object %s: %w", key, err)
+		}
+	}
+
+	// Core makes a single ranged request, where Client.GetObject would issue its own
+	object, _, _, err := minio.Core{Client: s.client}.GetObject(context.Background(), s.bucket, key, opts)
+	if err != nil {
+		return nil, s.error("get", key, err)
+	}
+	return object, nil
+}
+
+func (s *S3BlobStore) Stat(key string) (*application.BlobInfo, error) {
+	stat, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s.error("stat", key, err)
+	}
+	return &application.BlobInfo{Key: key, Size: stat.Size, ModTime: stat.LastModified}, nil
+}
+
+func (s *S3BlobStore) Delete(key string) error {
+	if err := s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return s.error("delete", key, err)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) List(prefix string) ([]*application.BlobInfo, error) {
+	var blobs []*application.BlobInfo
+	for object := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		blobs = append(blobs, &application.BlobInfo{Key: object.Key, Size: object.Size, ModTime: object.LastModified})
+	}
+	return blobs, nil
+}
+
+// error wraps an S3 error, mapping missing objects to ErrBlobNotFound.
+func (s *S3BlobStore) error(action, key string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return application.ErrBlobNotFound
+	}
+	return fmt.Errorf("failed to %s object %s: %w", action, key, err)
+}
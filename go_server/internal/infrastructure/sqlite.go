@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteScheme is the DATABASE_URL prefix that selects SQLite, e.g. sqlite://data/app.db.
+const sqliteScheme = "sqlite://"
+
+// IsSQLiteURL reports whether databaseURL points to a SQLite database.
+func IsSQLiteURL(databaseURL string) bool {
+	return strings.HasPrefix(databaseURL, sqliteScheme)
+}
+
+// NewSQLiteConnection opens the SQLite database file named by DATABASE_URL,
+// creating it if it doesn't exist.
+func NewSQLiteConnection() (*sql.DB, error) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if !IsSQLiteURL(databaseURL) {
+		return nil, fmt.Errorf("DATABASE_URL must start with %s", sqliteScheme)
+	}
+
+	path, query, _ := strings.Cut(strings.TrimPrefix(databaseURL, sqliteScheme), "?")
+	if path == "" {
+		return nil, fmt.Errorf("DATABASE_URL has no database file path")
+	}
+
+	// WAL lets readers run alongside a writer, and immediate transactions take the
+	// write lock up front so concurrent uploads wait for it instead of failing
+	dsn := path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_txlock=immediate&_time_format=sqlite"
+	if query != "" {
+		dsn += "&" + query
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	return db, nil
+}
+
+// MigrateSQLiteDB applies the pending SQLite migrations.
+func MigrateSQLiteDB(db *sql.DB) error {
+	return migrate(db, DialectSQLite)
+}
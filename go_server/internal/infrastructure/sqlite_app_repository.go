@@ -0,0 +1,20 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"database/sql"
+)
+
+// SQLiteAppRepository stores build metadata in an embedded SQLite database. The
+// queries of PostgresAppRepository are portable SQL that SQLite runs unchanged, so
+// they are shared and only opening and migrating the database differ, and app files
+// are locked in process since SQLite has no advisory locks.
+type SQLiteAppRepository struct {
+	*PostgresAppRepository
+}
+
+// NewSQLiteAppRepository returns a repository that keeps build metadata in the SQLite
+// database db and app files and icons in blobs.
+func NewSQLiteAppRepository(db *sql.DB, blobs application.BlobStore) (*SQLiteAppRepository, error) {
+	return &SQLiteAppRepository{&PostgresAppRepository{db: db, blobs: blobs, localLocks: &contentLocks{}}}, nil
+}
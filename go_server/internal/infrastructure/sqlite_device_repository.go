@@ -0,0 +1,13 @@
+package infrastructure
+
+import "database/sql"
+
+// SQLiteDeviceRepository stores registered devices in an embedded SQLite database,
+// sharing the queries of PostgresDeviceRepository.
+type SQLiteDeviceRepository struct {
+	*PostgresDeviceRepository
+}
+
+func NewSQLiteDeviceRepository(db *sql.DB) (*SQLiteDeviceRepository, error) {
+	return &SQLiteDeviceRepository{&PostgresDeviceRepository{db: db}}, nil
+}
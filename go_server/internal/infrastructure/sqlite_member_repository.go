@@ -0,0 +1,13 @@
+package infrastructure
+
+import "database/sql"
+
+// SQLiteMemberRepository stores the members of apps in an embedded SQLite database,
+// sharing the queries of PostgresMemberRepository.
+type SQLiteMemberRepository struct {
+	*PostgresMemberRepository
+}
+
+func NewSQLiteMemberRepository(db *sql.DB) (*SQLiteMemberRepository, error) {
+	return &SQLiteMemberRepository{&PostgresMemberRepository{db: db}}, nil
+}
@@ -0,0 +1,13 @@
+package infrastructure
+
+import "database/sql"
+
+// SQLiteTokenRepository stores API tokens in an embedded SQLite database, sharing
+// the queries of PostgresTokenRepository.
+type SQLiteTokenRepository struct {
+	*PostgresTokenRepository
+}
+
+func NewSQLiteTokenRepository(db *sql.DB) (*SQLiteTokenRepository, error) {
+	return &SQLiteTokenRepository{&PostgresTokenRepository{db: db}}, nil
+}
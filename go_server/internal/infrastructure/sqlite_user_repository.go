@@ -0,0 +1,13 @@
+package infrastructure
+
+import "database/sql"
+
+// SQLiteUserRepository stores users and their sessions in an embedded SQLite
+// database, sharing the queries of PostgresUserRepository.
+type SQLiteUserRepository struct {
+	*PostgresUserRepository
+}
+
+func NewSQLiteUserRepository(db *sql.DB) (*SQLiteUserRepository, error) {
+	return &SQLiteUserRepository{&PostgresUserRepository{db: db}}, nil
+}
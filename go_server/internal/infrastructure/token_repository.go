@@ -0,0 +1,139 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const tokensFileName = "_tokens.json"
+
+// FileTokenRepository keeps the API tokens in a single JSON file in StorageDir.
+type FileTokenRepository struct {
+	mu sync.Mutex
+}
+
+// storedToken is an APIToken as it is saved, including the hash that is left out of responses.
+type storedToken struct {
+	*domain.APIToken
+	Hash string `json:"hash"`
+}
+
+// NewFileTokenRepository initializes the storage and returns a new FileTokenRepository.
+func NewFileTokenRepository() (*FileTokenRepository, error) {
+	if err := os.MkdirAll(StorageDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", StorageDir, err)
+	}
+	return &FileTokenRepository{}, nil
+}
+
+func (r *FileTokenRepository) CreateToken(token *domain.APIToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tokens, err := r.loadTokens()
+	if err != nil {
+		return err
+	}
+	return r.saveTokens(append(tokens, storedToken{APIToken: token, Hash: token.Hash}))
+}
+
+func (r *FileTokenRepository) GetTokens() ([]*domain.APIToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, err := r.loadTokens()
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*domain.APIToken
+	for _, token := range stored {
+		tokens = append(tokens, token.APIToken)
+	}
+	return tokens, nil
+}
+
+func (r *FileTokenRepository) GetTokenByHash(hash string) (*domain.APIToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tokens, err := r.loadTokens()
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		if token.Hash == hash {
+			return token.APIToken, nil
+		}
+	}
+	return nil, application.ErrTokenNotFound
+}
+
+func (r *FileTokenRepository) UpdateLastUsed(id string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tokens, err := r.loadTokens()
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if token.ID == id {
+			token.LastUsedAt = &usedAt
+			return r.saveTokens(tokens)
+		}
+	}
+	return nil
+}
+
+func (r *FileTokenRepository) DeleteToken(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tokens, err := r.loadTokens()
+	if err != nil {
+		return err
+	}
+	for i, token := range tokens {
+		if token.ID == id {
+			return r.saveTokens(append(tokens[:i], tokens[i+1:]...))
+		}
+	}
+	return application.ErrTokenNotFound
+}
+
+// loadTokens reads all tokens, oldest first.
+func (r *FileTokenRepository) loadTokens() ([]storedToken, error) {
+	data, err := os.ReadFile(filepath.Join(StorageDir, tokensFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	var tokens []storedToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode tokens file: %w", err)
+	}
+	for _, token := range tokens {
+		token.APIToken.Hash = token.Hash
+	}
+	return tokens, nil
+}
+
+func (r *FileTokenRepository) saveTokens(tokens []storedToken) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode tokens: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(StorageDir, tokensFileName), data); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	return nil
+}
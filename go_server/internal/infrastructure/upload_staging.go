@@ -0,0 +1,86 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// stagingDirName is the directory inside a storage root that uploads are streamed
+// into. Keeping it on the same filesystem lets SaveUpload rename instead of copy.
+const stagingDirName = "_staging"
+
+// stageUpload streams appFile into a new file in dir, hashing it on the way. It
+// stops reading once more than maxSize bytes have been written.
+func stageUpload(dir string, appFile io.Reader, maxSize int64) (*application.StagedUpload, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging file: %w", err)
+	}
+	defer file.Close()
+
+	upload := &application.StagedUpload{Path: file.Name()}
+	digest := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(file, digest), io.LimitReader(appFile, maxSize+1))
+	if err != nil {
+		upload.Remove()
+		return nil, fmt.Errorf("failed to stage app file: %w", err)
+	}
+	if size > maxSize {
+		upload.Remove()
+		return nil, application.ErrUploadTooLarge
+	}
+	if err := file.Sync(); err != nil {
+		upload.Remove()
+		return nil, fmt.Errorf("failed to stage app file: %w", err)
+	}
+
+	upload.Size = size
+	upload.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	return upload, nil
+}
+
+// stagingDir returns the local directory uploads for store are staged in.
+func stagingDir(store application.BlobStore) string {
+	if local, ok := store.(*LocalBlobStore); ok {
+		return local.stagingDir()
+	}
+	return filepath.Join(os.TempDir(), "app-distribution-staging")
+}
+
+// putStagedUpload stores a staged upload under key, after which removing it is a
+// no-op. Local stores take the file over by renaming it.
+func putStagedUpload(store application.BlobStore, key string, upload *application.StagedUpload) error {
+	if local, ok := store.(*LocalBlobStore); ok {
+		return local.moveIn(key, upload.Path)
+	}
+
+	file, err := os.Open(upload.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open staged upload: %w", err)
+	}
+	defer file.Close()
+
+	if err := store.Put(key, file, upload.Size); err != nil {
+		return err
+	}
+	return upload.Remove()
+}
+
+// openBlob opens the blob stored under key for reading and seeking.
+func openBlob(store application.BlobStore, key string) (io.ReadSeekCloser, *application.BlobInfo, error) {
+	info, err := store.Stat(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return application.NewBlobReader(store, info), info, nil
+}
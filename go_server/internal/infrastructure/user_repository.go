@@ -0,0 +1,166 @@
+package infrastructure
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	usersFileName    = "_users.json"
+	sessionsFileName = "_sessions.json"
+)
+
+// FileUserRepository keeps the users and their sessions in two JSON files in StorageDir.
+type FileUserRepository struct {
+	mu sync.Mutex
+}
+
+// NewFileUserRepository initializes the storage and returns a new FileUserRepository.
+func NewFileUserRepository() (*FileUserRepository, error) {
+	if err := os.MkdirAll(StorageDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", StorageDir, err)
+	}
+	return &FileUserRepository{}, nil
+}
+
+func (r *FileUserRepository) SaveUser(user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var users []*domain.User
+	if err := readJSONFile(usersFileName, &users); err != nil {
+		return err
+	}
+
+	saved := false
+	for _, existing := range users {
+		if existing.Issuer == user.Issuer && existing.Subject == user.Subject {
+			user.ID = existing.ID
+			user.CreatedAt = existing.CreatedAt
+			*existing = *user
+			saved = true
+			break
+		}
+	}
+	if !saved {
+		user.ID = uuid.New().String()
+		users = append(users, user)
+	}
+	return writeJSONFile(usersFileName, users)
+}
+
+func (r *FileUserRepository) GetUser(id string) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var users []*domain.User
+	if err := readJSONFile(usersFileName, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, application.ErrUserNotFound
+}
+
+func (r *FileUserRepository) CreateSession(session *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []*domain.Session
+	if err := readJSONFile(sessionsFileName, &sessions); err != nil {
+		return err
+	}
+	return writeJSONFile(sessionsFileName, append(sessions, session))
+}
+
+func (r *FileUserRepository) GetSessionByHash(hash string) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []*domain.Session
+	if err := readJSONFile(sessionsFileName, &sessions); err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if session.Hash == hash {
+			return session, nil
+		}
+	}
+	return nil, application.ErrSessionNotFound
+}
+
+func (r *FileUserRepository) DeleteSession(hash string) error {
+	return r.deleteSessions(func(session *domain.Session) bool { return session.Hash == hash })
+}
+
+func (r *FileUserRepository) DeleteExpiredSessions(now time.Time) (int, error) {
+	deleted := 0
+	err := r.deleteSessions(func(session *domain.Session) bool {
+		if session.Expired(now) {
+			deleted++
+			return true
+		}
+		return false
+	})
+	return deleted, err
+}
+
+// deleteSessions removes the sessions that match.
+func (r *FileUserRepository) deleteSessions(match func(*domain.Session) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []*domain.Session
+	if err := readJSONFile(sessionsFileName, &sessions); err != nil {
+		return err
+	}
+	kept := sessions[:0]
+	for _, session := range sessions {
+		if !match(session) {
+			kept = append(kept, session)
+		}
+	}
+	if len(kept) == len(sessions) {
+		return nil
+	}
+	return writeJSONFile(sessionsFileName, kept)
+}
+
+// readJSONFile decodes the file with the given name in StorageDir into v, leaving v
+// unchanged if the file doesn't exist.
+func readJSONFile(name string, v any) error {
+	data, err := os.ReadFile(filepath.Join(StorageDir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeJSONFile replaces the file with the given name in StorageDir with v as JSON.
+func writeJSONFile(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	if err := writeFileAtomic(filepath.Join(StorageDir, name), data); err != nil {
+		return fmt.Errorf("failed to save %s: %w", name, err)
+	}
+	return nil
+}
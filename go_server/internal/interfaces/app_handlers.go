@@ -0,0 +1,234 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+var appRegex = regexp.MustCompile(`^/api/apps/([^/]+)$`)
+
+// AppUpdate holds the app fields to change in a PATCH request. Fields that are
+// left out keep their value.
+type AppUpdate struct {
+	Platform    *domain.Platform `json:"platform"`
+	Name        *string          `json:"name"`
+	Description *string          `json:"description"`
+	Icon        *string          `json:"icon"`
+	Owner       *string          `json:"owner"`
+	// LatestBy is version or upload_time.
+	LatestBy *domain.VersionOrder `json:"latest_by"`
+}
+
+// CreateAppHandler godoc
+// @Summary Create an app
+// @Description Create an app ahead of its first upload. Apps are otherwise created from their first build.
+// @Tags apps
+// @Accept  json
+// @Produce  json
+// @Param   app body domain.App true "App to create"
+// @Success 201 {object} domain.App
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 409 {string} string "App already exists"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps [post]
+func (h *AppHandlers) CreateAppHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("CreateAppHandler called")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var app domain.App
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFormValueSize)).Decode(&app); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if app.BundleID == "" || app.Name == "" {
+		http.Error(w, "bundle_id and name are required", http.StatusBadRequest)
+		return
+	}
+	if !domain.ValidBundleID(app.BundleID) {
+		http.Error(w, "bundle_id must be a reverse-DNS identifier such as com.example.app", http.StatusBadRequest)
+		return
+	}
+	if _, ok := h.authorize(w, r, app.BundleID, domain.PermissionUpload); !ok {
+		return
+	}
+	if !validPlatform(app.Platform) {
+		http.Error(w, "platform must be ios or android", http.StatusBadRequest)
+		return
+	}
+	if !app.LatestBy.Valid() {
+		http.Error(w, "latest_by must be version or upload_time", http.StatusBadRequest)
+		return
+	}
+	// The creation date is set by the server, and products are changed through the product
+	app.CreatedAt = time.Time{}
+	app.ProductID = ""
+
+	if err := h.service.CreateApp(&app); err != nil {
+		appError(w, err, app.BundleID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(app); err != nil {
+		log.Printf("Error encoding app: %v", err)
+	}
+}
+
+// UpdateAppHandler godoc
+// @Summary Update an app
+// @Description Change the metadata of an app. Fields that are left out keep their value.
+// @Tags apps
+// @Accept  json
+// @Produce  json
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   app body AppUpdate true "Fields to change"
+// @Success 200 {object} domain.App
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "App not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id} [patch]
+func (h *AppHandlers) UpdateAppHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("UpdateAppHandler called")
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := appRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 2 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID := matches[1]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionUpload); !ok {
+		return
+	}
+
+	var update AppUpdate
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFormValueSize)).Decode(&update); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	app, err := h.service.GetApp(bundleID)
+	if err != nil {
+		appError(w, err, bundleID)
+		return
+	}
+	if update.Platform != nil {
+		if !validPlatform(*update.Platform) {
+			http.Error(w, "platform must be ios or android", http.StatusBadRequest)
+			return
+		}
+		app.Platform = *update.Platform
+	}
+	if update.Name != nil {
+		if *update.Name == "" {
+			http.Error(w, "name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		app.Name = *update.Name
+	}
+	if update.Description != nil {
+		app.Description = *update.Description
+	}
+	if update.Icon != nil {
+		app.Icon = *update.Icon
+	}
+	if update.Owner != nil {
+		app.Owner = *update.Owner
+	}
+	if update.LatestBy != nil {
+		if !update.LatestBy.Valid() {
+			http.Error(w, "latest_by must be version or upload_time", http.StatusBadRequest)
+			return
+		}
+		app.LatestBy = *update.LatestBy
+	}
+
+	if err := h.service.UpdateApp(app); err != nil {
+		appError(w, err, bundleID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding app: %v", err)
+	}
+}
+
+// DeleteAppHandler godoc
+// @Summary Delete an app
+// @Description Delete an app. Apps can only be deleted once they have no builds. Requires the
+// @Description manager role on the app, or an API token with the delete permission for it.
+// @Tags apps
+// @Param   Authorization header string false "Bearer followed by an API token, if not logged in"
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "App not found"
+// @Failure 409 {string} string "App still has builds"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id} [delete]
+func (h *AppHandlers) DeleteAppHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("DeleteAppHandler called")
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := appRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 2 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID := matches[1]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionDelete); !ok {
+		return
+	}
+
+	if err := h.service.DeleteApp(bundleID); err != nil {
+		appError(w, err, bundleID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// appError writes the response for an error returned by an app operation.
+func appError(w http.ResponseWriter, err error, bundleID string) {
+	switch {
+	case errors.Is(err, application.ErrAppNotFound):
+		http.Error(w, "App "+bundleID+" not found", http.StatusNotFound)
+	case errors.Is(err, application.ErrAppExists):
+		http.Error(w, "App "+bundleID+" already exists", http.StatusConflict)
+	case errors.Is(err, application.ErrAppHasBuilds):
+		http.Error(w, "App "+bundleID+" still has builds", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to handle app", http.StatusInternalServerError)
+		log.Printf("Error handling app %s: %v", bundleID, err)
+	}
+}
+
+func validPlatform(platform domain.Platform) bool {
+	return platform == domain.IOS || platform == domain.Android
+}
@@ -0,0 +1,122 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// appRequest returns a request with a JSON body, authenticated with the admin token.
+func appRequest(method, target, body string) *http.Request {
+	return withToken(httptest.NewRequest(method, target, strings.NewReader(body)), testAdminToken)
+}
+
+func TestCreateAppHandler(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := serve(env.handlers.CreateAppHandler, appRequest(http.MethodPost, "/api/apps", `{"bundle_id": "com.example.app", "platform": "ios", "name": "Example", "created_at": "2000-01-01T00:00:00Z", "product_id": "other"}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateAppHandler() = %d %s", w.Code, w.Body)
+	}
+	var app domain.App
+	if err := json.Unmarshal(w.Body.Bytes(), &app); err != nil {
+		t.Fatal(err)
+	}
+	// The creation date and product can't be set by the request
+	if app.BundleID != "com.example.app" || app.Name != "Example" || app.CreatedAt.Year() == 2000 || app.ProductID != "" {
+		t.Errorf("CreateAppHandler() = %+v", app)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"existing app", `{"bundle_id": "com.example.app", "platform": "ios", "name": "Example"}`, http.StatusConflict},
+		{"invalid JSON", `{`, http.StatusBadRequest},
+		{"missing name", `{"bundle_id": "com.example.other", "platform": "ios"}`, http.StatusBadRequest},
+		{"invalid bundle ID", `{"bundle_id": "../example", "platform": "ios", "name": "Example"}`, http.StatusBadRequest},
+		{"invalid platform", `{"bundle_id": "com.example.other", "platform": "windows", "name": "Example"}`, http.StatusBadRequest},
+		{"invalid latest_by", `{"bundle_id": "com.example.other", "platform": "ios", "name": "Example", "latest_by": "name"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serve(env.handlers.CreateAppHandler, appRequest(http.MethodPost, "/api/apps", tt.body)); w.Code != tt.want {
+			t.Errorf("CreateAppHandler() of %s = %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/apps", strings.NewReader(`{"bundle_id": "com.example.other", "platform": "ios", "name": "Example"}`))
+	if w := serve(env.handlers.CreateAppHandler, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("CreateAppHandler() without a token = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestUpdateAppHandler(t *testing.T) {
+	env := newTestEnv(t)
+	env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+
+	// Apps of builds uploaded before apps were stored are saved on their first update
+	w := serve(env.handlers.UpdateAppHandler, appRequest(http.MethodPatch, "/api/apps/com.example.app", `{"name": "Renamed", "latest_by": "version"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("UpdateAppHandler() = %d %s", w.Code, w.Body)
+	}
+	app, err := env.service.GetApp("com.example.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Name != "Renamed" || app.LatestBy != domain.OrderByVersion || app.Platform != domain.IOS {
+		t.Errorf("GetApp() after UpdateAppHandler() = %+v", app)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		want   int
+	}{
+		{"missing app", "/api/apps/com.example.missing", `{"name": "Renamed"}`, http.StatusNotFound},
+		{"empty name", "/api/apps/com.example.app", `{"name": ""}`, http.StatusBadRequest},
+		{"invalid platform", "/api/apps/com.example.app", `{"platform": "windows"}`, http.StatusBadRequest},
+		{"invalid JSON", "/api/apps/com.example.app", `[]`, http.StatusBadRequest},
+		{"invalid URL", "/api/apps/com.example.app/1.0", `{"name": "Renamed"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serve(env.handlers.UpdateAppHandler, appRequest(http.MethodPatch, tt.target, tt.body)); w.Code != tt.want {
+			t.Errorf("UpdateAppHandler() of %s = %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+}
+
+func TestDeleteAppHandler(t *testing.T) {
+	env := newTestEnv(t)
+	build := env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+
+	if w := serve(env.handlers.DeleteAppHandler, appRequest(http.MethodDelete, "/api/apps/com.example.missing", "")); w.Code != http.StatusNotFound {
+		t.Errorf("DeleteAppHandler() of a missing app = %d %s, want %d", w.Code, w.Body, http.StatusNotFound)
+	}
+	if w := serve(env.handlers.DeleteAppHandler, appRequest(http.MethodDelete, "/api/apps/com.example.app", "")); w.Code != http.StatusConflict {
+		t.Errorf("DeleteAppHandler() of an app with builds = %d %s, want %d", w.Code, w.Body, http.StatusConflict)
+	}
+
+	// Builds that were deleted but not purged yet are purged with the app
+	if err := env.service.DeleteBuild(build); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(env.handlers.DeleteAppHandler, appRequest(http.MethodDelete, "/api/apps/com.example.app", "")); w.Code != http.StatusNoContent {
+		t.Fatalf("DeleteAppHandler() of an app with deleted builds = %d %s, want %d", w.Code, w.Body, http.StatusNoContent)
+	}
+	if _, err := env.service.GetApp("com.example.app"); !errors.Is(err, application.ErrAppNotFound) {
+		t.Errorf("GetApp() of deleted app error = %v, want %v", err, application.ErrAppNotFound)
+	}
+	if _, _, err := env.service.OpenAppFile(build); !errors.Is(err, application.ErrBlobNotFound) {
+		t.Errorf("OpenAppFile() of purged build error = %v, want %v", err, application.ErrBlobNotFound)
+	}
+	if w := serve(env.handlers.DeleteAppHandler, appRequest(http.MethodDelete, "/api/apps/com.example.app", "")); w.Code != http.StatusNotFound {
+		t.Errorf("DeleteAppHandler() of a deleted app = %d %s, want %d", w.Code, w.Body, http.StatusNotFound)
+	}
+}
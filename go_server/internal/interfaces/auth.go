@@ -0,0 +1,99 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// requestToken returns the API token secret sent as "Authorization: Bearer <token>"
+// or in the X-Auth-Token header, or "" if there is none.
+func requestToken(r *http.Request) string {
+	if scheme, secret, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(secret)
+	}
+	return r.Header.Get("X-Auth-Token")
+}
+
+// authenticate returns the API token the request was made with. If it has none, or an
+// unknown or expired one, a 401 is written to w and ok is false.
+func authenticate(w http.ResponseWriter, r *http.Request, tokens *application.TokenService) (token *domain.APIToken, ok bool) {
+	secret := requestToken(r)
+	if secret == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		http.Error(w, "An API token is required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	token, err := tokens.Authenticate(secret)
+	if err != nil {
+		if errors.Is(err, application.ErrTokenNotFound) || errors.Is(err, application.ErrTokenExpired) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			http.Error(w, "Invalid or expired API token", http.StatusUnauthorized)
+			return nil, false
+		}
+		http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+		log.Printf("Error authenticating token: %v", err)
+		return nil, false
+	}
+	return token, true
+}
+
+// requestCaller returns who made the request. Requests are identified by the login
+// middleware while logins are enabled. Otherwise they are made with an API token, or
+// by guests who can view every app. If the request has an unknown or expired token, a
+// 401 is written to w and ok is false.
+func requestCaller(w http.ResponseWriter, r *http.Request, tokens *application.TokenService) (caller application.Caller, ok bool) {
+	if caller, ok := r.Context().Value(callerContextKey).(application.Caller); ok {
+		return caller, true
+	}
+	if requestToken(r) == "" {
+		return application.Caller{Guest: true}, true
+	}
+	token, ok := authenticate(w, r, tokens)
+	return application.Caller{Token: token}, ok
+}
+
+// loginsEnabled reports whether the request was identified by the login middleware,
+// which only happens while logins are enabled.
+func loginsEnabled(r *http.Request) bool {
+	_, ok := r.Context().Value(callerContextKey).(application.Caller)
+	return ok
+}
+
+// authorize checks that the caller of the request has permission on the app with
+// bundleID. Otherwise the error is written to w and ok is false.
+func (h *AppHandlers) authorize(w http.ResponseWriter, r *http.Request, bundleID string, permission domain.Permission) (caller application.Caller, ok bool) {
+	if caller, ok = requestCaller(w, r, h.tokens); !ok {
+		return caller, false
+	}
+	if err := h.access.Authorize(caller, bundleID, permission); err != nil {
+		accessError(w, err)
+		return caller, false
+	}
+	return caller, true
+}
+
+// accessError writes the response for an error returned by the access service. Callers
+// that aren't allowed an action get the reason as JSON.
+func accessError(w http.ResponseWriter, err error) {
+	var forbidden *application.ForbiddenError
+	switch {
+	case errors.As(err, &forbidden):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		if err := json.NewEncoder(w).Encode(forbidden); err != nil {
+			log.Printf("Error encoding forbidden response: %v", err)
+		}
+	case errors.Is(err, application.ErrNotAuthenticated):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		http.Error(w, "Login or API token required", http.StatusUnauthorized)
+	default:
+		http.Error(w, "Failed to authorize", http.StatusInternalServerError)
+		log.Printf("Error authorizing request: %v", err)
+	}
+}
@@ -0,0 +1,364 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sessionCookieName is the cookie that keeps a user logged in.
+	sessionCookieName = "ads_session"
+	// loginCookieName is the cookie that holds the state of a login in progress.
+	loginCookieName = "ads_login"
+	// loginTimeout is how long a user has to log in at the identity provider.
+	loginTimeout = 10 * time.Minute
+)
+
+type contextKey int
+
+const (
+	callerContextKey contextKey = iota
+	signerContextKey
+)
+
+// loginState is what the login cookie remembers between redirecting to the identity
+// provider and the provider redirecting back.
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect"`
+}
+
+type AuthHandlers struct {
+	service *application.AuthService
+	tokens  *application.TokenService
+	signer  *URLSigner
+	// callbackURL is where the identity provider redirects back to. If empty, it is
+	// derived from the request.
+	callbackURL string
+}
+
+// NewAuthHandlers returns the handlers that log users in through OpenID Connect. Links
+// to builds in responses to logged in users are signed with signer.
+func NewAuthHandlers(service *application.AuthService, tokens *application.TokenService, signer *URLSigner, callbackURL string) *AuthHandlers {
+	return &AuthHandlers{service: service, tokens: tokens, signer: signer, callbackURL: callbackURL}
+}
+
+// LoginHandler godoc
+// @Summary Log in
+// @Description Redirect to the OpenID Connect provider to log in with the authorization code flow
+// @Description and PKCE. After logging in, the user is sent back to redirect with a session cookie.
+// @Tags auth
+// @Param   redirect query string false "Path to return to after logging in, e.g. /api/apps"
+// @Success 302 {string} string "Redirect to the identity provider"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /auth/login [get]
+func (h *AuthHandlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("LoginHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state := loginState{Redirect: r.URL.Query().Get("redirect")}
+	// Only return to paths on this server, so the login can't be used to send users elsewhere
+	if !strings.HasPrefix(state.Redirect, "/") || strings.HasPrefix(state.Redirect, "//") || strings.HasPrefix(state.Redirect, "/\\") {
+		state.Redirect = "/api/auth/me"
+	}
+	var err error
+	for _, value := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		if *value, err = randomString(); err != nil {
+			http.Error(w, "Failed to start login", http.StatusInternalServerError)
+			log.Printf("Error generating login state: %v", err)
+			return
+		}
+	}
+
+	cookie, err := json.Marshal(state)
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		log.Printf("Error encoding login state: %v", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(cookie),
+		Path:     "/api/auth/",
+		MaxAge:   int(loginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.service.LoginURL(h.redirectURL(r), state.State, state.Nonce, state.Verifier), http.StatusFound)
+}
+
+// CallbackHandler godoc
+// @Summary Complete a login
+// @Description The OpenID Connect provider redirects here after the user logged in. The user is
+// @Description created or updated from the email, name and groups claims of the ID token and gets a
+// @Description session cookie.
+// @Tags auth
+// @Param   code query string true "Authorization code"
+// @Param   state query string true "State sent to the identity provider"
+// @Success 302 {string} string "Redirect to the page the login started from"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Login failed"
+// @Failure 403 {string} string "Email address not allowed"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /auth/callback [get]
+func (h *AuthHandlers) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("CallbackHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var state loginState
+	cookie, err := r.Cookie(loginCookieName)
+	if err == nil {
+		var data []byte
+		if data, err = base64.RawURLEncoding.DecodeString(cookie.Value); err == nil {
+			err = json.Unmarshal(data, &state)
+		}
+	}
+	if err != nil {
+		http.Error(w, "No login in progress, or it timed out", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: loginCookieName, Path: "/api/auth/", MaxAge: -1})
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		http.Error(w, "Login failed: "+providerError+" "+query.Get("error_description"), http.StatusUnauthorized)
+		return
+	}
+	if query.Get("state") == "" || query.Get("state") != state.State || query.Get("code") == "" {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	user, secret, err := h.service.Login(r.Context(), h.redirectURL(r), query.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		if errors.Is(err, application.ErrEmailNotAllowed) {
+			http.Error(w, "Your account is not allowed to log in", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		log.Printf("Error completing login: %v", err)
+		return
+	}
+	log.Printf("User %s logged in", user.Email)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    secret,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, state.Redirect, http.StatusFound)
+}
+
+// LogoutHandler godoc
+// @Summary Log out
+// @Description End the session of the logged in user.
+// @Tags auth
+// @Success 204 {string} string "No Content"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /auth/logout [post]
+func (h *AuthHandlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("LogoutHandler called")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := h.service.Logout(cookie.Value); err != nil {
+			http.Error(w, "Failed to log out", http.StatusInternalServerError)
+			log.Printf("Error logging out: %v", err)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MeHandler godoc
+// @Summary Get the logged in user
+// @Description Get the user the session cookie belongs to.
+// @Tags auth
+// @Produce  json
+// @Success 200 {object} domain.User
+// @Failure 401 {string} string "Not logged in"
+// @Router /auth/me [get]
+func (h *AuthHandlers) MeHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("MeHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	caller, _ := r.Context().Value(callerContextKey).(application.Caller)
+	if caller.User == nil {
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(caller.User); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding user: %v", err)
+	}
+}
+
+// Identify wraps a handler so it knows who made the request, without requiring a
+// login. Handlers respond with 401 to requests that need a user or token and have neither.
+func (h *AuthHandlers) Identify(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := h.identify(w, r)
+		if !ok {
+			return
+		}
+		next(w, h.withCaller(r, caller))
+	}
+}
+
+// RequireUser wraps a handler so it can only be used by logged in users, API tokens
+// and signed links. Browsers that aren't logged in are sent to the login page.
+func (h *AuthHandlers) RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := h.identify(w, r)
+		if !ok {
+			return
+		}
+		if caller != (application.Caller{}) {
+			next(w, h.withCaller(r, caller))
+			return
+		}
+
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, "/api/auth/login?redirect="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		http.Error(w, "Login required", http.StatusUnauthorized)
+	}
+}
+
+// identify returns the caller of a request from its session cookie, API token or signed
+// link, or the zero Caller if it has none of them. If the request can't be
+// authenticated, the error is written to w and ok is false.
+func (h *AuthHandlers) identify(w http.ResponseWriter, r *http.Request) (caller application.Caller, ok bool) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		user, err := h.service.Authenticate(cookie.Value)
+		if err == nil {
+			return application.Caller{User: user}, true
+		}
+		if !errors.Is(err, application.ErrSessionNotFound) {
+			http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+			log.Printf("Error authenticating session: %v", err)
+			return caller, false
+		}
+	}
+	if requestToken(r) != "" {
+		token, ok := authenticate(w, r, h.tokens)
+		return application.Caller{Token: token}, ok
+	}
+	if h.signer.Verify(r) {
+		return application.Caller{Guest: true}, true
+	}
+	return caller, true
+}
+
+// withCaller stores the caller in the request's context. Handlers of identified requests
+// also get the signer, so they can sign the links to builds in their response.
+func (h *AuthHandlers) withCaller(r *http.Request, caller application.Caller) *http.Request {
+	ctx := context.WithValue(r.Context(), callerContextKey, caller)
+	if caller != (application.Caller{}) {
+		ctx = context.WithValue(ctx, signerContextKey, h.signer)
+	}
+	return r.WithContext(ctx)
+}
+
+// redirectURL returns the URL the identity provider redirects back to after a login.
+func (h *AuthHandlers) redirectURL(r *http.Request) string {
+	if h.callbackURL != "" {
+		return h.callbackURL
+	}
+	return baseURL(r) + "/api/auth/callback"
+}
+
+// URLSigner signs links to builds, so that they can be opened by devices that aren't
+// logged in for a while, such as iOS installing an app over the air or a phone that
+// scanned a QR code.
+type URLSigner struct {
+	key []byte
+	ttl time.Duration
+}
+
+// NewURLSigner returns a URLSigner whose links are valid for ttl.
+func NewURLSigner(key []byte, ttl time.Duration) *URLSigner {
+	return &URLSigner{key: key, ttl: ttl}
+}
+
+// Sign returns the escaped path with a query that lets anyone request it until the link expires.
+func (s *URLSigner) Sign(path string) string {
+	expires := strconv.FormatInt(time.Now().Add(s.ttl).Unix(), 10)
+	return path + "?expires=" + expires + "&signature=" + s.signature(path, expires)
+}
+
+// Verify reports whether the request was made with a signed link that hasn't expired.
+func (s *URLSigner) Verify(r *http.Request) bool {
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	expected := s.signature(r.URL.EscapedPath(), query.Get("expires"))
+	return hmac.Equal([]byte(query.Get("signature")), []byte(expected))
+}
+
+func (s *URLSigner) signature(path, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(path + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedPath returns path signed with the signer of an authenticated request, or
+// path itself if authentication is disabled.
+func signedPath(r *http.Request, path string) string {
+	if signer, ok := r.Context().Value(signerContextKey).(*URLSigner); ok {
+		return signer.Sign(path)
+	}
+	return path
+}
+
+// isHTTPS reports whether the request was made over HTTPS, directly or through a reverse proxy.
+func isHTTPS(r *http.Request) bool {
+	return strings.HasPrefix(baseURL(r), "https:")
+}
+
+// randomString returns 256 random bits, encoded so they can be used in URLs and as a PKCE verifier.
+func randomString() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
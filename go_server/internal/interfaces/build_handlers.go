@@ -0,0 +1,347 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	buildRegex        = regexp.MustCompile(`^/api/apps/([^/]+)/([^/]+)/([^/]+)$`)
+	restoreBuildRegex = regexp.MustCompile(`^/api/apps/([^/]+)/([^/]+)/([^/]+)/restore$`)
+	// commitRegex matches full SHA-1 and SHA-256 git commits, and abbreviations of them.
+	commitRegex = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+)
+
+// BuildUpdate holds the build fields to change in a PATCH request. Fields that are
+// left out keep their value.
+type BuildUpdate struct {
+	Title        *string `json:"title"`
+	Description  *string `json:"description"`
+	ReleaseNotes *string `json:"release_notes"`
+	// Archived hides the build from listings, while it can still be downloaded by direct link.
+	Archived *bool `json:"archived"`
+}
+
+// GetBuildHandler godoc
+// @Summary Get a build
+// @Description Get a download link for a specific build of an app, including archived builds.
+// @Tags builds
+// @Produce  json
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   version path string true "Version of the app"
+// @Param   build_number path string true "Build number of the app"
+// @Success 200 {object} DownloadResponse
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Build not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/{version}/{build_number} [get]
+func (h *AppHandlers) GetBuildHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("GetBuildHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := buildRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 4 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID, version, buildNumber := matches[1], matches[2], matches[3]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionView); !ok {
+		return
+	}
+
+	build, err := h.service.GetBuild(bundleID, version, buildNumber)
+	if err != nil {
+		buildError(w, err, bundleID, version, buildNumber)
+		return
+	}
+
+	response, err := newDownloadResponse(r, build)
+	if err != nil {
+		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		log.Printf("Error generating QR code: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding download response: %v", err)
+	}
+}
+
+// BuildsHandler godoc
+// @Summary Find builds by commit
+// @Description Get download links for the builds of every app that were made from a git commit,
+// @Description newest first, e.g. to find the builds a bug report refers to. Abbreviated commits
+// @Description match every commit they are a prefix of.
+// @Tags builds
+// @Produce  json
+// @Param   commit query string true "Git commit SHA, full or abbreviated to at least 7 characters"
+// @Success 200 {array} DownloadResponse
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /builds [get]
+func (h *AppHandlers) BuildsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("BuildsHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	commit := strings.ToLower(r.URL.Query().Get("commit"))
+	if !commitRegex.MatchString(commit) {
+		http.Error(w, "commit must be a git commit SHA of 7 to 64 hex characters", http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := requestCaller(w, r, h.tokens)
+	if !ok {
+		return
+	}
+	builds, err := h.access.GetBuildsByCommit(caller, commit)
+	if err != nil {
+		if errors.Is(err, application.ErrNotAuthenticated) {
+			accessError(w, err)
+			return
+		}
+		http.Error(w, "Failed to get builds", http.StatusInternalServerError)
+		log.Printf("Error getting builds of commit %s: %v", commit, err)
+		return
+	}
+
+	response := make([]DownloadResponse, 0, len(builds))
+	for _, build := range builds {
+		item, err := newDownloadResponse(r, build)
+		if err != nil {
+			http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+			log.Printf("Error generating QR code: %v", err)
+			return
+		}
+		response = append(response, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding builds: %v", err)
+	}
+}
+
+// UpdateBuildHandler godoc
+// @Summary Update a build
+// @Description Correct the title, description or release notes of a build, or archive it.
+// @Description Archived builds are left out of listings and the latest version, but can still be
+// @Description downloaded by direct link. Fields that are left out keep their value.
+// @Tags builds
+// @Accept  json
+// @Produce  json
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   version path string true "Version of the app"
+// @Param   build_number path string true "Build number of the app"
+// @Param   build body BuildUpdate true "Fields to change"
+// @Success 200 {object} domain.BuildInfo
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Build not found"
+// @Failure 413 {string} string "Request body too large"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/{version}/{build_number} [patch]
+func (h *AppHandlers) UpdateBuildHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("UpdateBuildHandler called")
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := buildRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 4 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID, version, buildNumber := matches[1], matches[2], matches[3]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionUpload); !ok {
+		return
+	}
+
+	var update BuildUpdate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFormValueSize)).Decode(&update); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Request body exceeds the maximum size of %d bytes", maxFormValueSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	build, err := h.service.GetBuild(bundleID, version, buildNumber)
+	if err != nil {
+		buildError(w, err, bundleID, version, buildNumber)
+		return
+	}
+	if update.Title != nil {
+		if strings.TrimSpace(*update.Title) == "" {
+			http.Error(w, "title cannot be empty", http.StatusBadRequest)
+			return
+		}
+		build.Title = *update.Title
+	}
+	if update.Description != nil {
+		build.Description = *update.Description
+	}
+	if update.ReleaseNotes != nil {
+		build.ReleaseNotes = *update.ReleaseNotes
+	}
+	if update.Archived != nil {
+		switch {
+		case !*update.Archived:
+			build.ArchivedAt = nil
+		case build.ArchivedAt == nil:
+			now := time.Now()
+			build.ArchivedAt = &now
+		}
+	}
+
+	if err := h.service.UpdateBuild(build); err != nil {
+		buildError(w, err, bundleID, version, buildNumber)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(build); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding build: %v", err)
+	}
+}
+
+// DeleteBuildHandler godoc
+// @Summary Delete a build
+// @Description Delete a build. It disappears right away, and is purged with its files once the
+// @Description grace period set by BUILD_DELETE_GRACE_PERIOD has passed. Until then it can be
+// @Description restored. Builds that a channel points to cannot be deleted. Requires the manager
+// @Description role on the app, or an API token with the delete permission for it.
+// @Tags builds
+// @Produce  json
+// @Param   Authorization header string false "Bearer followed by an API token, if not logged in"
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   version path string true "Version of the app"
+// @Param   build_number path string true "Build number of the app"
+// @Success 202 {object} domain.BuildInfo
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Build not found"
+// @Failure 409 {string} string "Build is on a channel"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/{version}/{build_number} [delete]
+func (h *AppHandlers) DeleteBuildHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("DeleteBuildHandler called")
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := buildRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 4 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID, version, buildNumber := matches[1], matches[2], matches[3]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionDelete); !ok {
+		return
+	}
+
+	build, err := h.service.GetBuild(bundleID, version, buildNumber)
+	if err == nil {
+		err = h.service.DeleteBuild(build)
+	}
+	if err != nil {
+		buildError(w, err, bundleID, version, buildNumber)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(build); err != nil {
+		log.Printf("Error encoding build: %v", err)
+	}
+}
+
+// RestoreBuildHandler godoc
+// @Summary Restore a deleted build
+// @Description Undo the deletion of a build whose grace period hasn't passed yet. Requires the
+// @Description manager role on the app, or an API token with the delete permission for it.
+// @Tags builds
+// @Produce  json
+// @Param   Authorization header string false "Bearer followed by an API token, if not logged in"
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   version path string true "Version of the app"
+// @Param   build_number path string true "Build number of the app"
+// @Success 200 {object} domain.BuildInfo
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Build not found or already purged"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/{version}/{build_number}/restore [post]
+func (h *AppHandlers) RestoreBuildHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("RestoreBuildHandler called")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := restoreBuildRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 4 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID, version, buildNumber := matches[1], matches[2], matches[3]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionDelete); !ok {
+		return
+	}
+
+	build, err := h.service.RestoreBuild(bundleID, version, buildNumber)
+	if err != nil {
+		buildError(w, err, bundleID, version, buildNumber)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(build); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding build: %v", err)
+	}
+}
+
+// buildError writes the response for an error returned by a build operation.
+func buildError(w http.ResponseWriter, err error, bundleID, version, buildNumber string) {
+	switch {
+	case errors.Is(err, application.ErrBuildNotFound):
+		http.Error(w, "Build not found", http.StatusNotFound)
+	case errors.Is(err, application.ErrBuildOnChannel):
+		http.Error(w, "Cannot delete a build that is on a channel. Promote another build first ("+err.Error()+")", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to handle build", http.StatusInternalServerError)
+		log.Printf("Error handling build %s, %s, %s: %v", bundleID, version, buildNumber, err)
+	}
+}
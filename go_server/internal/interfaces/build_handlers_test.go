@@ -0,0 +1,179 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildRequest returns a request for a build of com.example.app, authenticated with
+// the admin token.
+func buildRequest(method, path, body string) *http.Request {
+	return withToken(httptest.NewRequest(method, "/api/apps/com.example.app"+path, strings.NewReader(body)), testAdminToken)
+}
+
+func TestGetLatestAppVersionHandlerWithoutListedBuilds(t *testing.T) {
+	env := newTestEnv(t)
+	latest := func() *httptest.ResponseRecorder {
+		return serve(env.handlers.GetLatestAppVersionHandler, buildRequest(http.MethodGet, "", ""))
+	}
+
+	// An app created ahead of its first upload
+	if err := env.service.CreateApp(&domain.App{BundleID: "com.example.app", Platform: domain.IOS, Name: "Example"}); err != nil {
+		t.Fatal(err)
+	}
+	if w := latest(); w.Code != http.StatusNotFound {
+		t.Errorf("GetLatestAppVersionHandler() of an app without builds = %d %s, want %d", w.Code, w.Body, http.StatusNotFound)
+	}
+
+	env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+	if w := latest(); w.Code != http.StatusOK {
+		t.Fatalf("GetLatestAppVersionHandler() = %d %s", w.Code, w.Body)
+	}
+
+	if w := serve(env.handlers.UpdateBuildHandler, buildRequest(http.MethodPatch, "/1.0/1", `{"archived": true}`)); w.Code != http.StatusOK {
+		t.Fatalf("UpdateBuildHandler() = %d %s", w.Code, w.Body)
+	}
+	if w := latest(); w.Code != http.StatusNotFound {
+		t.Errorf("GetLatestAppVersionHandler() of an app whose builds are archived = %d %s, want %d", w.Code, w.Body, http.StatusNotFound)
+	}
+	// The changelog to the latest build has nothing to end at either
+	w := serve(env.handlers.ChangelogHandler, buildRequest(http.MethodGet, "/changelog?from_version=1.0&from_build_number=1", ""))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("ChangelogHandler() to the latest build of an app whose builds are archived = %d %s, want %d", w.Code, w.Body, http.StatusNotFound)
+	}
+
+	if w := serve(env.handlers.UpdateBuildHandler, buildRequest(http.MethodPatch, "/1.0/1", `{"archived": false}`)); w.Code != http.StatusOK {
+		t.Fatalf("UpdateBuildHandler() = %d %s", w.Code, w.Body)
+	}
+	if w := serve(env.handlers.DeleteBuildHandler, buildRequest(http.MethodDelete, "/1.0/1", "")); w.Code != http.StatusAccepted {
+		t.Fatalf("DeleteBuildHandler() = %d %s", w.Code, w.Body)
+	}
+	if w := latest(); w.Code != http.StatusNotFound {
+		t.Errorf("GetLatestAppVersionHandler() of an app whose builds are deleted = %d %s, want %d", w.Code, w.Body, http.StatusNotFound)
+	}
+}
+
+func TestBuildLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+	kept := env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+	purged := env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "2"), nil)
+	recent := env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "3"), nil)
+
+	// A build on a channel can't be deleted until another build is promoted
+	if _, err := env.service.PromoteBuild(kept, "production", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(env.handlers.DeleteBuildHandler, buildRequest(http.MethodDelete, "/1.0/1", "")); w.Code != http.StatusConflict {
+		t.Errorf("DeleteBuildHandler() of a build on a channel = %d %s, want %d", w.Code, w.Body, http.StatusConflict)
+	}
+
+	for _, path := range []string{"/1.0/2", "/1.0/3"} {
+		if w := serve(env.handlers.DeleteBuildHandler, buildRequest(http.MethodDelete, path, "")); w.Code != http.StatusAccepted {
+			t.Fatalf("DeleteBuildHandler(%s) = %d %s", path, w.Code, w.Body)
+		}
+		if w := serve(env.handlers.GetBuildHandler, buildRequest(http.MethodGet, path, "")); w.Code != http.StatusNotFound {
+			t.Errorf("GetBuildHandler(%s) of a deleted build = %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+
+	// Only the build whose grace period has passed is purged
+	deletedAt := time.Now().Add(-2 * time.Hour)
+	purged.DeletedAt = &deletedAt
+	if err := env.service.UpdateBuild(purged); err != nil {
+		t.Fatal(err)
+	}
+	count, err := env.service.PurgeDeletedBuilds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("PurgeDeletedBuilds() = %d, want 1", count)
+	}
+	if _, _, err := env.service.OpenAppFile(purged); !errors.Is(err, application.ErrBlobNotFound) {
+		t.Errorf("OpenAppFile() of purged build error = %v, want %v", err, application.ErrBlobNotFound)
+	}
+	if w := serve(env.handlers.RestoreBuildHandler, buildRequest(http.MethodPost, "/1.0/2/restore", "")); w.Code != http.StatusNotFound {
+		t.Errorf("RestoreBuildHandler() of a purged build = %d %s, want %d", w.Code, w.Body, http.StatusNotFound)
+	}
+
+	if w := serve(env.handlers.RestoreBuildHandler, buildRequest(http.MethodPost, "/1.0/3/restore", "")); w.Code != http.StatusOK {
+		t.Fatalf("RestoreBuildHandler() of a recently deleted build = %d %s", w.Code, w.Body)
+	}
+	latest, err := env.service.GetLatestVersion("com.example.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.UploadID != recent.UploadID {
+		t.Errorf("GetLatestVersion() after restore = build %s, want %s", latest.UploadID, recent.UploadID)
+	}
+	if file, _, err := env.service.OpenAppFile(recent); err != nil {
+		t.Errorf("OpenAppFile() of restored build error = %v", err)
+	} else {
+		file.Close()
+	}
+}
+
+func TestBuildsHandler(t *testing.T) {
+	env := newTestEnv(t)
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	provenance := map[string]string{"commit": strings.ToUpper(commit), "branch": "main", "ci_provider": "github-actions", "pipeline_url": "https://example.com/runs/1"}
+	ios := env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), provenance)
+	android := env.upload(t, "app.apk", testAPK(t, newTestSigner(t, "Release"), "com.example.android", 1), provenance)
+	env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "2"), map[string]string{"commit": "fedcba9"})
+	_, secret, err := env.tokens.CreateToken("android", []string{"com.example.android"}, []domain.Permission{domain.PermissionView}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builds := func(query, secret string) *httptest.ResponseRecorder {
+		return serve(env.handlers.BuildsHandler, withToken(httptest.NewRequest(http.MethodGet, "/api/builds?"+query, nil), secret))
+	}
+
+	// The commit is stored in lowercase, so abbreviated and uppercase lookups find it
+	for _, tt := range []struct {
+		name   string
+		query  string
+		secret string
+		want   []string
+	}{
+		{"full commit", "commit=" + commit, testAdminToken, []string{android.UploadID, ios.UploadID}},
+		{"abbreviated commit", "commit=0123456", testAdminToken, []string{android.UploadID, ios.UploadID}},
+		{"uppercase commit", "commit=0123456789ABCDEF", testAdminToken, []string{android.UploadID, ios.UploadID}},
+		{"unknown commit", "commit=abcdef0", testAdminToken, nil},
+		{"token scoped to one app", "commit=0123456", secret, []string{android.UploadID}},
+	} {
+		w := builds(tt.query, tt.secret)
+		if w.Code != http.StatusOK {
+			t.Fatalf("BuildsHandler() with %s = %d %s", tt.name, w.Code, w.Body)
+		}
+		var response []DownloadResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, build := range response {
+			got = append(got, build.UploadID)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("BuildsHandler() with %s = %v, want %v", tt.name, got, tt.want)
+		}
+		if len(response) > 0 && (response[0].Provenance == nil || response[0].Provenance.Commit != commit || response[0].Provenance.PipelineURL != "https://example.com/runs/1") {
+			t.Errorf("BuildsHandler() with %s provenance = %+v", tt.name, response[0].Provenance)
+		}
+	}
+
+	for _, query := range []string{"", "commit=012345", "commit=not-a-commit"} {
+		if w := builds(query, testAdminToken); w.Code != http.StatusBadRequest {
+			t.Errorf("BuildsHandler(%q) = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+	if w := builds("commit=0123456", "unknown"); w.Code != http.StatusUnauthorized {
+		t.Errorf("BuildsHandler() with an unknown token = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
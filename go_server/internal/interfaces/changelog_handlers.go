@@ -0,0 +1,172 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var changelogRegex = regexp.MustCompile(`^/api/apps/([^/]+)/changelog$`)
+
+var (
+	// markdown renders release notes with GitHub flavored Markdown, which is what
+	// most CI tools and commit messages produce.
+	markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	// releaseNotesPolicy strips anything from rendered release notes that could run
+	// scripts or restyle the page they are shown on.
+	releaseNotesPolicy = bluemonday.UGCPolicy()
+)
+
+// ChangelogEntry is the release notes of one build in a changelog.
+type ChangelogEntry struct {
+	Version          string    `json:"version"`
+	BuildNumber      string    `json:"build_number"`
+	CreatedAt        time.Time `json:"created_at"`
+	ReleaseNotes     string    `json:"release_notes,omitempty"`
+	ReleaseNotesHTML string    `json:"release_notes_html,omitempty"`
+}
+
+// ChangelogResponse is everything that changed between two builds of an app.
+type ChangelogResponse struct {
+	BundleID        string `json:"bundle_id"`
+	FromVersion     string `json:"from_version"`
+	FromBuildNumber string `json:"from_build_number"`
+	ToVersion       string `json:"to_version"`
+	ToBuildNumber   string `json:"to_build_number"`
+	// Entries are the builds after from up to and including to, newest first.
+	Entries []ChangelogEntry `json:"entries"`
+	// Changelog combines the release notes of all entries, with a heading per build.
+	Changelog     string `json:"changelog"`
+	ChangelogHTML string `json:"changelog_html"`
+}
+
+// ChangelogHandler godoc
+// @Summary Get the changelog between two builds
+// @Description Combine the release notes of every build after the from build, up to and including
+// @Description the to build, so testers see everything that changed since the build they have
+// @Description installed. Builds are compared by version, then build number. Without to, the
+// @Description latest build of the app is used.
+// @Tags builds
+// @Produce  json
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   from_version query string true "Version of the build to start after"
+// @Param   from_build_number query string true "Build number of the build to start after"
+// @Param   to_version query string false "Version of the last build to include"
+// @Param   to_build_number query string false "Build number of the last build to include"
+// @Success 200 {object} ChangelogResponse
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Build not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/changelog [get]
+func (h *AppHandlers) ChangelogHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("ChangelogHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := changelogRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 2 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID := matches[1]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionView); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	fromVersion, fromBuildNumber := query.Get("from_version"), query.Get("from_build_number")
+	toVersion, toBuildNumber := query.Get("to_version"), query.Get("to_build_number")
+	if fromVersion == "" || fromBuildNumber == "" {
+		http.Error(w, "from_version and from_build_number are required", http.StatusBadRequest)
+		return
+	}
+	if (toVersion == "") != (toBuildNumber == "") {
+		http.Error(w, "Set both to_version and to_build_number, or neither", http.StatusBadRequest)
+		return
+	}
+
+	from, err := h.service.GetBuild(bundleID, fromVersion, fromBuildNumber)
+	if err != nil {
+		buildError(w, err, bundleID, fromVersion, fromBuildNumber)
+		return
+	}
+	var to *domain.BuildInfo
+	if toVersion != "" {
+		to, err = h.service.GetBuild(bundleID, toVersion, toBuildNumber)
+	} else {
+		to, err = h.service.GetLatestVersion(bundleID)
+	}
+	if err != nil {
+		buildError(w, err, bundleID, toVersion, toBuildNumber)
+		return
+	}
+	if domain.CompareBuilds(from, to) > 0 {
+		http.Error(w, "The from build must be older than the to build", http.StatusBadRequest)
+		return
+	}
+
+	builds, err := h.service.GetChangelog(from, to)
+	if err != nil {
+		http.Error(w, "Failed to get changelog", http.StatusInternalServerError)
+		log.Printf("Error getting changelog of %s: %v", bundleID, err)
+		return
+	}
+
+	response := ChangelogResponse{
+		BundleID:        bundleID,
+		FromVersion:     from.Version,
+		FromBuildNumber: from.BuildNumber,
+		ToVersion:       to.Version,
+		ToBuildNumber:   to.BuildNumber,
+		Entries:         make([]ChangelogEntry, 0, len(builds)),
+	}
+	var changelog strings.Builder
+	for _, build := range builds {
+		entry := ChangelogEntry{
+			Version:      build.Version,
+			BuildNumber:  build.BuildNumber,
+			CreatedAt:    build.CreatedAt,
+			ReleaseNotes: build.ReleaseNotes,
+		}
+		fmt.Fprintf(&changelog, "## %s (%s)\n\n", build.Version, build.BuildNumber)
+		if build.ReleaseNotes != "" {
+			entry.ReleaseNotesHTML = renderMarkdown(build.ReleaseNotes)
+			changelog.WriteString(strings.TrimSpace(build.ReleaseNotes) + "\n\n")
+		}
+		response.Entries = append(response.Entries, entry)
+	}
+	response.Changelog = changelog.String()
+	response.ChangelogHTML = renderMarkdown(response.Changelog)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding changelog: %v", err)
+	}
+}
+
+// renderMarkdown renders Markdown release notes as sanitized HTML. Notes that fail
+// to render are left out rather than failing the response they are part of.
+func renderMarkdown(source string) string {
+	var html bytes.Buffer
+	if err := markdown.Convert([]byte(source), &html); err != nil {
+		log.Printf("Error rendering Markdown: %v", err)
+		return ""
+	}
+	return releaseNotesPolicy.Sanitize(html.String())
+}
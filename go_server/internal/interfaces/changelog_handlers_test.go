@@ -0,0 +1,141 @@
+package interfaces
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// unsafeReleaseNotes is Markdown release notes with HTML that must not reach the page
+// they are shown on.
+const unsafeReleaseNotes = "**Fixed** the login\n\n<script>alert(1)</script>\n\n<img src=x onerror=\"alert(2)\">\n\n[Details](javascript:alert(3))"
+
+// checkSanitized reports an error if the rendered release notes kept markup that
+// could run scripts, or lost the Markdown formatting.
+func checkSanitized(t *testing.T, name, html string) {
+	t.Helper()
+	if !strings.Contains(html, "<strong>Fixed</strong>") {
+		t.Errorf("%s = %q, want the Markdown rendered", name, html)
+	}
+	for _, unsafe := range []string{"<script", "alert(1)", "onerror", "javascript:"} {
+		if strings.Contains(html, unsafe) {
+			t.Errorf("%s = %q, contains %q", name, html, unsafe)
+		}
+	}
+}
+
+func TestReleaseNotes(t *testing.T) {
+	env := newTestEnv(t)
+	env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), map[string]string{"release_notes": unsafeReleaseNotes})
+
+	w := serve(env.handlers.GetBuildHandler, withToken(httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app/1.0/1", nil), testAdminToken))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetBuildHandler() = %d %s", w.Code, w.Body)
+	}
+	var response DownloadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	// The raw notes are returned as uploaded, only the HTML is sanitized
+	if response.ReleaseNotes != unsafeReleaseNotes {
+		t.Errorf("GetBuildHandler() release notes = %q, want %q", response.ReleaseNotes, unsafeReleaseNotes)
+	}
+	checkSanitized(t, "GetBuildHandler() release notes HTML", response.ReleaseNotesHTML)
+}
+
+func TestUploadHandlerReleaseNotesFile(t *testing.T) {
+	env := newTestEnv(t)
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, file := range []struct{ field, name, content string }{
+		{"app_file", "app.ipa", string(testIPA(t, "com.example.app", "1.0", "1"))},
+		{"release_notes", "notes.md", "# Notes\n\n- From a file"},
+	} {
+		part, err := form.CreateFormFile(file.field, file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(file.content))
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/apps/upload", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+
+	if w := serve(env.handlers.UploadHandler, withToken(r, testAdminToken)); w.Code != http.StatusOK {
+		t.Fatalf("UploadHandler() = %d %s", w.Code, w.Body)
+	}
+	build, err := env.service.GetBuild("com.example.app", "1.0", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build.ReleaseNotes != "# Notes\n\n- From a file" {
+		t.Errorf("release notes from a file part = %q", build.ReleaseNotes)
+	}
+}
+
+func TestChangelogHandler(t *testing.T) {
+	env := newTestEnv(t)
+	for i, notes := range []string{"Installed", "", "Second fix", unsafeReleaseNotes} {
+		env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", fmt.Sprint(i+1)), map[string]string{"release_notes": notes})
+	}
+	changelog := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app/changelog?"+query, nil)
+		return serve(env.handlers.ChangelogHandler, withToken(r, testAdminToken))
+	}
+
+	// Without to, the changelog runs to the latest build
+	w := changelog("from_version=1.0&from_build_number=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("ChangelogHandler() = %d %s", w.Code, w.Body)
+	}
+	var response ChangelogResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	var buildNumbers []string
+	for _, entry := range response.Entries {
+		buildNumbers = append(buildNumbers, entry.BuildNumber)
+	}
+	if strings.Join(buildNumbers, ",") != "4,3,2" || response.ToBuildNumber != "4" {
+		t.Errorf("ChangelogHandler() entries = %v to %s, want 4,3,2 newest first", buildNumbers, response.ToBuildNumber)
+	}
+	if strings.Contains(response.Changelog, "Installed") || !strings.Contains(response.Changelog, "## 1.0 (3)\n\nSecond fix") {
+		t.Errorf("ChangelogHandler() changelog = %q", response.Changelog)
+	}
+	checkSanitized(t, "ChangelogHandler() changelog HTML", response.ChangelogHTML)
+	checkSanitized(t, "ChangelogHandler() entry HTML", response.Entries[0].ReleaseNotesHTML)
+
+	w = changelog("from_version=1.0&from_build_number=1&to_version=1.0&to_build_number=3")
+	if w.Code != http.StatusOK {
+		t.Fatalf("ChangelogHandler() with to = %d %s", w.Code, w.Body)
+	}
+	response = ChangelogResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Entries) != 2 || response.Entries[0].BuildNumber != "3" {
+		t.Errorf("ChangelogHandler() with to = %+v, want builds 3 and 2", response.Entries)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"no from", "to_version=1.0&to_build_number=3", http.StatusBadRequest},
+		{"half a to", "from_version=1.0&from_build_number=1&to_version=1.0", http.StatusBadRequest},
+		{"from after to", "from_version=1.0&from_build_number=3&to_version=1.0&to_build_number=1", http.StatusBadRequest},
+		{"missing from", "from_version=1.0&from_build_number=9", http.StatusNotFound},
+	} {
+		if w := changelog(tt.query); w.Code != tt.want {
+			t.Errorf("ChangelogHandler() with %s = %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+}
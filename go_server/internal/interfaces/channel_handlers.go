@@ -0,0 +1,207 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+var (
+	channelsRegex   = regexp.MustCompile(`^/api/apps/([^/]+)/channels$`)
+	promoteRegex    = regexp.MustCompile(`^/api/apps/([^/]+)/channels/([^/]+)/promote$`)
+	promotionsRegex = regexp.MustCompile(`^/api/apps/([^/]+)/promotions$`)
+
+	// channelNameRegex restricts channel names to short identifiers like beta or qa-2
+	channelNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+)
+
+// PromoteRequest selects the build to put on a channel: either the build of
+// another channel, or a build by version and build number.
+type PromoteRequest struct {
+	FromChannel string `json:"from_channel,omitempty"`
+	Version     string `json:"version,omitempty"`
+	BuildNumber string `json:"build_number,omitempty"`
+}
+
+// ChannelsHandler godoc
+// @Summary List the channels of an app
+// @Description Get the release channels of an app with the builds they point to.
+// @Tags channels
+// @Produce  json
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Success 200 {array} domain.Channel
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/channels [get]
+func (h *AppHandlers) ChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("ChannelsHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := channelsRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 2 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID := matches[1]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionView); !ok {
+		return
+	}
+
+	channels, err := h.service.GetChannels(bundleID)
+	if err != nil {
+		http.Error(w, "Failed to get channels", http.StatusInternalServerError)
+		log.Printf("Error getting channels for %s: %v", bundleID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(channels); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding channels: %v", err)
+	}
+}
+
+// PromoteHandler godoc
+// @Summary Promote a build to a channel
+// @Description Point a channel to the build of another channel (from_channel), or to a build
+// @Description by version and build number. The channel is created if it doesn't exist, and
+// @Description the promotion is recorded with the email of the user or the name of the API token
+// @Description that made it and when. Requires the manager role on the app, or an API token with
+// @Description the promote permission for it.
+// @Tags channels
+// @Accept  json
+// @Produce  json
+// @Param   Authorization header string false "Bearer followed by an API token, if not logged in"
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   channel path string true "Channel to promote to, e.g. beta"
+// @Param   promotion body PromoteRequest true "Build to promote"
+// @Success 200 {object} domain.Channel
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Channel or build not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/channels/{channel}/promote [post]
+func (h *AppHandlers) PromoteHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("PromoteHandler called")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := promoteRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 3 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID := matches[1]
+	channelName := matches[2]
+	if !channelNameRegex.MatchString(channelName) {
+		http.Error(w, "Channel names must be lowercase letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := h.authorize(w, r, bundleID, domain.PermissionPromote)
+	if !ok {
+		return
+	}
+
+	var request PromoteRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFormValueSize)).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	var channel *domain.Channel
+	var err error
+	switch {
+	case request.FromChannel != "" && request.Version == "" && request.BuildNumber == "":
+		if request.FromChannel == channelName {
+			http.Error(w, "Cannot promote a channel to itself", http.StatusBadRequest)
+			return
+		}
+		channel, err = h.service.PromoteChannel(bundleID, request.FromChannel, channelName, caller.Name())
+	case request.FromChannel == "" && request.Version != "" && request.BuildNumber != "":
+		var build *domain.BuildInfo
+		if build, err = h.service.GetBuild(bundleID, request.Version, request.BuildNumber); err == nil {
+			channel, err = h.service.PromoteBuild(build, channelName, caller.Name())
+		}
+	default:
+		http.Error(w, "Set either from_channel, or version and build_number", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, application.ErrChannelNotFound):
+			http.Error(w, "Channel "+request.FromChannel+" not found", http.StatusNotFound)
+		case errors.Is(err, application.ErrBuildNotFound):
+			http.Error(w, "Build not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to promote build", http.StatusInternalServerError)
+			log.Printf("Error promoting build of %s to %s: %v", bundleID, channelName, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(channel); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding channel: %v", err)
+	}
+}
+
+// PromotionsHandler godoc
+// @Summary List the promotions of an app
+// @Description Get the history of builds put on the channels of an app, newest first.
+// @Tags channels
+// @Produce  json
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   channel query string false "Only list promotions to this channel"
+// @Success 200 {array} domain.Promotion
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/promotions [get]
+func (h *AppHandlers) PromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("PromotionsHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := promotionsRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 2 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID := matches[1]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionView); !ok {
+		return
+	}
+
+	promotions, err := h.service.GetPromotions(bundleID, r.URL.Query().Get("channel"))
+	if err != nil {
+		http.Error(w, "Failed to get promotions", http.StatusInternalServerError)
+		log.Printf("Error getting promotions for %s: %v", bundleID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(promotions); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding promotions: %v", err)
+	}
+}
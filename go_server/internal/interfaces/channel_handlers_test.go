@@ -0,0 +1,143 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// promote promotes a build of com.example.app to channel with the request body.
+func promote(env *testEnv, secret, channel, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/apps/com.example.app/channels/"+channel+"/promote", strings.NewReader(body))
+	return serve(env.handlers.PromoteHandler, withToken(r, secret))
+}
+
+func TestChannels(t *testing.T) {
+	env := newTestEnv(t)
+	first := env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+	second := env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "2"), nil)
+	_, secret, err := env.tokens.CreateToken("release", []string{"com.example.app"}, []domain.Permission{domain.PermissionView, domain.PermissionPromote}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := promote(env, secret, "beta", `{"version": "1.0", "build_number": "1"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PromoteHandler() of a build = %d %s", w.Code, w.Body)
+	}
+	var channel domain.Channel
+	if err := json.Unmarshal(w.Body.Bytes(), &channel); err != nil {
+		t.Fatal(err)
+	}
+	if channel.Name != "beta" || channel.UploadID != first.UploadID || channel.UpdatedBy != "release" {
+		t.Errorf("PromoteHandler() = %+v", channel)
+	}
+	if w := promote(env, secret, "production", `{"from_channel": "beta"}`); w.Code != http.StatusOK {
+		t.Fatalf("PromoteHandler() of a channel = %d %s", w.Code, w.Body)
+	}
+	if w := promote(env, secret, "beta", `{"version": "1.0", "build_number": "2"}`); w.Code != http.StatusOK {
+		t.Fatalf("PromoteHandler() of a newer build = %d %s", w.Code, w.Body)
+	}
+
+	// Promoting from beta to production copied the build beta pointed to then
+	w = serve(env.handlers.ChannelsHandler, withToken(httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app/channels", nil), secret))
+	if w.Code != http.StatusOK {
+		t.Fatalf("ChannelsHandler() = %d %s", w.Code, w.Body)
+	}
+	var channels []domain.Channel
+	if err := json.Unmarshal(w.Body.Bytes(), &channels); err != nil {
+		t.Fatal(err)
+	}
+	uploads := map[string]string{}
+	for _, channel := range channels {
+		if channel.Build == nil || channel.Build.UploadID != channel.UploadID {
+			t.Errorf("channel %s has build %+v, want %s", channel.Name, channel.Build, channel.UploadID)
+		}
+		uploads[channel.Name] = channel.UploadID
+	}
+	if len(uploads) != 2 || uploads["beta"] != second.UploadID || uploads["production"] != first.UploadID {
+		t.Errorf("ChannelsHandler() = %v, want beta on %s and production on %s", uploads, second.UploadID, first.UploadID)
+	}
+
+	w = serve(env.handlers.GetLatestAppVersionHandler, withToken(httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app?channel=production", nil), secret))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetLatestAppVersionHandler() of a channel = %d %s", w.Code, w.Body)
+	}
+	var response DownloadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.UploadID != first.UploadID {
+		t.Errorf("GetLatestAppVersionHandler() of production = build %s, want %s", response.UploadID, first.UploadID)
+	}
+	w = serve(env.handlers.GetLatestAppVersionHandler, withToken(httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app?channel=qa", nil), secret))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GetLatestAppVersionHandler() of a missing channel = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// The history is newest first, and can be narrowed to one channel
+	for query, want := range map[string][]string{
+		"":              {"beta", "production", "beta"},
+		"?channel=beta": {"beta", "beta"},
+	} {
+		w := serve(env.handlers.PromotionsHandler, withToken(httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app/promotions"+query, nil), secret))
+		if w.Code != http.StatusOK {
+			t.Fatalf("PromotionsHandler(%q) = %d %s", query, w.Code, w.Body)
+		}
+		var promotions []domain.Promotion
+		if err := json.Unmarshal(w.Body.Bytes(), &promotions); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, promotion := range promotions {
+			got = append(got, promotion.Channel)
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("PromotionsHandler(%q) channels = %v, want %v", query, got, want)
+		}
+		if query == "" && (promotions[1].FromChannel != "beta" || promotions[1].PromotedBy != "release") {
+			t.Errorf("promotion to production = %+v", promotions[1])
+		}
+	}
+}
+
+func TestPromoteHandlerErrors(t *testing.T) {
+	env := newTestEnv(t)
+	env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+	_, viewer, err := env.tokens.CreateToken("viewer", []string{"com.example.app"}, []domain.Permission{domain.PermissionView}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		channel string
+		body    string
+		want    int
+	}{
+		{"missing channel", testAdminToken, "production", `{"from_channel": "beta"}`, http.StatusNotFound},
+		{"missing build", testAdminToken, "beta", `{"version": "1.0", "build_number": "2"}`, http.StatusNotFound},
+		{"channel to itself", testAdminToken, "beta", `{"from_channel": "beta"}`, http.StatusBadRequest},
+		{"channel and build", testAdminToken, "beta", `{"from_channel": "qa", "version": "1.0", "build_number": "1"}`, http.StatusBadRequest},
+		{"no build number", testAdminToken, "beta", `{"version": "1.0"}`, http.StatusBadRequest},
+		{"invalid channel name", testAdminToken, "Beta", `{"version": "1.0", "build_number": "1"}`, http.StatusBadRequest},
+		{"token without the promote permission", viewer, "beta", `{"version": "1.0", "build_number": "1"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := promote(env, tt.secret, tt.channel, tt.body); w.Code != tt.want {
+			t.Errorf("PromoteHandler() with %s = %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+
+	channels, err := env.service.GetChannels("com.example.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 0 {
+		t.Errorf("GetChannels() after failed promotions = %+v, want none", channels)
+	}
+}
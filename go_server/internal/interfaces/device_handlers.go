@@ -0,0 +1,346 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"go.mozilla.org/pkcs7"
+	"howett.net/plist"
+)
+
+// udidRegex matches the UDIDs of iOS devices: 40 hex digits, or 8 and 16 hex digits
+// separated by a dash on newer devices.
+var udidRegex = regexp.MustCompile(`^([0-9a-fA-F]{40}|[0-9a-fA-F]{8}-[0-9a-fA-F]{16})$`)
+
+// maxTesterLength is the longest tester name a device can be registered under.
+const maxTesterLength = 100
+
+type DeviceHandlers struct {
+	service *application.DeviceService
+	access  *application.AccessService
+	tokens  *application.TokenService
+	// deviceCAs are the Apple CAs that issue the certificates devices sign their
+	// attributes with. Enrollment is disabled when it is nil.
+	deviceCAs *x509.CertPool
+}
+
+// NewDeviceHandlers returns the device handlers. Registered devices can only be listed
+// by callers that access allows to manage the members of an app.
+func NewDeviceHandlers(service *application.DeviceService, access *application.AccessService, tokens *application.TokenService, deviceCAs *x509.CertPool) *DeviceHandlers {
+	return &DeviceHandlers{service: service, access: access, tokens: tokens, deviceCAs: deviceCAs}
+}
+
+// profileService is the Profile Service payload that asks iOS to post its device attributes back.
+type profileService struct {
+	PayloadContent      profileServiceContent `plist:"PayloadContent"`
+	PayloadDescription  string                `plist:"PayloadDescription"`
+	PayloadDisplayName  string                `plist:"PayloadDisplayName"`
+	PayloadIdentifier   string                `plist:"PayloadIdentifier"`
+	PayloadOrganization string                `plist:"PayloadOrganization"`
+	PayloadType         string                `plist:"PayloadType"`
+	PayloadUUID         string                `plist:"PayloadUUID"`
+	PayloadVersion      int                   `plist:"PayloadVersion"`
+}
+
+type profileServiceContent struct {
+	URL              string   `plist:"URL"`
+	DeviceAttributes []string `plist:"DeviceAttributes"`
+	Challenge        string   `plist:"Challenge"`
+}
+
+// deviceAttributes are the attributes iOS posts back to the Profile Service URL.
+type deviceAttributes struct {
+	UDID      string `plist:"UDID"`
+	Product   string `plist:"PRODUCT"`
+	Version   string `plist:"VERSION"`
+	Serial    string `plist:"SERIAL"`
+	Challenge string `plist:"CHALLENGE"`
+}
+
+// EnrollHandler godoc
+// @Summary Get the device enrollment profile
+// @Description Get a .mobileconfig that makes an iOS device send its UDID to the server.
+// @Tags devices
+// @Produce  application/x-apple-aspen-config
+// @Param   tester query string true "Tester the device belongs to"
+// @Success 200 {file} file "Enrollment profile"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 503 {string} string "Device enrollment is not configured"
+// @Router /devices/enroll [get]
+func (h *DeviceHandlers) EnrollHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("EnrollHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.deviceCAs == nil {
+		http.Error(w, "Device enrollment is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	tester := r.URL.Query().Get("tester")
+	if !validTester(w, tester) {
+		return
+	}
+
+	profile := profileService{
+		PayloadContent: profileServiceContent{
+			URL:              baseURL(r) + "/api/devices/enroll/callback",
+			DeviceAttributes: []string{"UDID", "PRODUCT", "VERSION", "SERIAL"},
+			Challenge:        tester,
+		},
+		PayloadDescription:  "Registers this device so it can be added to ad-hoc builds.",
+		PayloadDisplayName:  "App Distribution Device Registration",
+		PayloadIdentifier:   "app-distribution.device-registration",
+		PayloadOrganization: "App Distribution",
+		PayloadType:         "Profile Service",
+		PayloadUUID:         strings.ToUpper(uuid.New().String()),
+		PayloadVersion:      1,
+	}
+
+	data, err := plist.MarshalIndent(profile, plist.XMLFormat, "\t")
+	if err != nil {
+		http.Error(w, "Failed to generate enrollment profile", http.StatusInternalServerError)
+		log.Printf("Error encoding enrollment profile: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-apple-aspen-config")
+	w.Header().Set("Content-Disposition", "attachment; filename=enroll.mobileconfig")
+	w.Write(data)
+}
+
+// EnrollCallbackHandler godoc
+// @Summary Receive device attributes
+// @Description Endpoint iOS posts the signed device attributes to after installing the enrollment profile.
+// @Description The signature must chain to the Apple device CAs set by DEVICE_CA_FILE.
+// @Tags devices
+// @Accept  application/pkcs7-signature
+// @Success 301 {string} string "Redirect to the enrollment result"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 503 {string} string "Device enrollment is not configured"
+// @Router /devices/enroll/callback [post]
+func (h *DeviceHandlers) EnrollCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("EnrollCallbackHandler called")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.deviceCAs == nil {
+		http.Error(w, "Device enrollment is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	p7, err := pkcs7.Parse(body)
+	if err != nil {
+		http.Error(w, "Invalid device attributes", http.StatusBadRequest)
+		log.Printf("Error parsing device attributes: %v", err)
+		return
+	}
+	// The signer certificate is part of the message, so only its chain to Apple's
+	// device CAs shows that a real device sent the attributes
+	if err := p7.VerifyWithChain(h.deviceCAs); err != nil {
+		http.Error(w, "Invalid device attributes signature", http.StatusBadRequest)
+		log.Printf("Error verifying device attributes: %v", err)
+		return
+	}
+
+	var attributes deviceAttributes
+	if _, err := plist.Unmarshal(p7.Content, &attributes); err != nil {
+		http.Error(w, "Invalid device attributes", http.StatusBadRequest)
+		log.Printf("Error decoding device attributes: %v", err)
+		return
+	}
+
+	if !udidRegex.MatchString(attributes.UDID) {
+		http.Error(w, "Invalid UDID", http.StatusBadRequest)
+		return
+	}
+	if !validTester(w, attributes.Challenge) {
+		return
+	}
+
+	device := domain.Device{
+		UDID:      attributes.UDID,
+		Tester:    attributes.Challenge,
+		Product:   attributes.Product,
+		Version:   attributes.Version,
+		Serial:    attributes.Serial,
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.service.SaveDevice(&device); err != nil {
+		http.Error(w, "Failed to save device", http.StatusInternalServerError)
+		log.Printf("Error saving device: %v", err)
+		return
+	}
+
+	// iOS expects a redirect, which it opens in Safari once the profile is installed.
+	http.Redirect(w, r, "/api/devices/enroll/complete?udid="+url.QueryEscape(device.UDID), http.StatusMovedPermanently)
+}
+
+// EnrollCompleteHandler godoc
+// @Summary Show the enrollment result
+// @Description Page shown on the device after its UDID was registered.
+// @Tags devices
+// @Produce  html
+// @Param   udid query string true "UDID of the registered device"
+// @Success 200 {string} string "Enrollment result"
+// @Router /devices/enroll/complete [get]
+func (h *DeviceHandlers) EnrollCompleteHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("EnrollCompleteHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	udid := r.URL.Query().Get("udid")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html><html><head><meta name=\"viewport\" content=\"width=device-width\"></head>"+
+		"<body><h1>Device registered</h1><p>UDID: %s</p></body></html>", html.EscapeString(udid))
+}
+
+// DevicesHandler godoc
+// @Summary List registered devices
+// @Description Get the devices registered through enrollment, optionally filtered by tester.
+// @Description Requires the manager role on an app, or the admin token.
+// @Tags devices
+// @Produce  json
+// @Param   tester query string false "Only return devices of this tester"
+// @Success 200 {array} domain.Device
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 500 {string} string "Failed to get devices"
+// @Router /devices [get]
+func (h *DeviceHandlers) DevicesHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("DevicesHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorize(w, r) {
+		return
+	}
+
+	devices, err := h.service.GetDevices(r.URL.Query().Get("tester"))
+	if err != nil {
+		http.Error(w, "Failed to get devices", http.StatusInternalServerError)
+		log.Printf("Error getting devices: %v", err)
+		return
+	}
+	if devices == nil {
+		devices = []*domain.Device{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(devices); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding devices: %v", err)
+	}
+}
+
+// ExportDevicesHandler godoc
+// @Summary Export registered devices
+// @Description Export devices in the tab-separated format accepted by Apple's "Register Multiple Devices" upload.
+// @Description Requires the manager role on an app, or the admin token.
+// @Tags devices
+// @Produce  text/tab-separated-values
+// @Param   tester query string false "Only export devices of this tester"
+// @Success 200 {file} file "Device list"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 500 {string} string "Failed to get devices"
+// @Router /devices/export [get]
+func (h *DeviceHandlers) ExportDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("ExportDevicesHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorize(w, r) {
+		return
+	}
+
+	devices, err := h.service.GetDevices(r.URL.Query().Get("tester"))
+	if err != nil {
+		http.Error(w, "Failed to get devices", http.StatusInternalServerError)
+		log.Printf("Error getting devices: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/tab-separated-values; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=devices.txt")
+	fmt.Fprint(w, "Device ID\tDevice Name\tDevice Platform\n")
+	for _, device := range devices {
+		fmt.Fprintf(w, "%s\t%s\tios\n", tsvField(device.UDID), deviceName(device))
+	}
+}
+
+// authorize checks that the caller of the request may see the registered devices, which
+// identify testers and their devices across every app. Otherwise the error is written
+// to w and false is returned.
+func (h *DeviceHandlers) authorize(w http.ResponseWriter, r *http.Request) bool {
+	caller, ok := requestCaller(w, r, h.tokens)
+	if !ok {
+		return false
+	}
+	if err := h.access.AuthorizeAny(caller, domain.PermissionManageMembers); err != nil {
+		accessError(w, err)
+		return false
+	}
+	return true
+}
+
+// deviceName builds the name a device is registered under in the developer portal.
+func deviceName(device *domain.Device) string {
+	name := device.Tester
+	if device.Product != "" {
+		name += " " + device.Product
+	}
+	return tsvField(name)
+}
+
+// tsvField replaces the runs of whitespace in value, including tabs and newlines that
+// would break the TSV format, with single spaces.
+func tsvField(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// validTester checks that a tester name is set, not too long and free of control
+// characters. Otherwise the error is written to w and false is returned.
+func validTester(w http.ResponseWriter, tester string) bool {
+	if tester == "" {
+		http.Error(w, "Missing tester", http.StatusBadRequest)
+		return false
+	}
+	if len(tester) > maxTesterLength {
+		http.Error(w, fmt.Sprintf("tester must be at most %d characters", maxTesterLength), http.StatusBadRequest)
+		return false
+	}
+	if strings.IndexFunc(tester, unicode.IsControl) >= 0 {
+		http.Error(w, "tester must not contain tabs, newlines or other control characters", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
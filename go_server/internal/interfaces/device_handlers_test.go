@@ -0,0 +1,196 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"app-distribution-server-go/internal/infrastructure"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+	"howett.net/plist"
+)
+
+// testDeviceCA is a CA that issues device certificates like Apple's device CAs.
+type testDeviceCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestDeviceCA(t *testing.T, name string) *testDeviceCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testDeviceCA{cert: cert, key: key}
+}
+
+func (ca *testDeviceCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// sign returns the attributes signed with a device certificate issued by ca, as iOS
+// posts them to the enrollment callback.
+func (ca *testDeviceCA) sign(t *testing.T, attributes map[string]string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Device"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := plist.Marshal(attributes, plist.XMLFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signed.AddSigner(cert, key, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := signed.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func newTestDeviceHandlers(t *testing.T, env *testEnv, deviceCAs *x509.CertPool) *DeviceHandlers {
+	t.Helper()
+	repo, err := infrastructure.NewSQLiteDeviceRepository(env.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDeviceHandlers(application.NewDeviceService(repo), env.access, env.tokens, deviceCAs)
+}
+
+func TestEnrollHandler(t *testing.T) {
+	env := newTestEnv(t)
+	handlers := newTestDeviceHandlers(t, env, newTestDeviceCA(t, "Device CA").pool())
+
+	w := serve(handlers.EnrollHandler, httptest.NewRequest(http.MethodGet, "/api/devices/enroll?tester=Jane", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("EnrollHandler() = %d %s", w.Code, w.Body)
+	}
+	var profile profileService
+	if _, err := plist.Unmarshal(w.Body.Bytes(), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.PayloadType != "Profile Service" ||
+		profile.PayloadContent.URL != "http://example.com/api/devices/enroll/callback" ||
+		profile.PayloadContent.Challenge != "Jane" {
+		t.Errorf("EnrollHandler() profile = %+v", profile)
+	}
+
+	for _, tester := range []string{"", "Jane\tDoe", strings.Repeat("a", maxTesterLength+1)} {
+		r := httptest.NewRequest(http.MethodGet, "/api/devices/enroll?tester="+strings.ReplaceAll(tester, "\t", "%09"), nil)
+		if w := serve(handlers.EnrollHandler, r); w.Code != http.StatusBadRequest {
+			t.Errorf("EnrollHandler() for tester %q = %d, want %d", tester, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	disabled := newTestDeviceHandlers(t, env, nil)
+	if w := serve(disabled.EnrollHandler, httptest.NewRequest(http.MethodGet, "/api/devices/enroll?tester=Jane", nil)); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("EnrollHandler() without device CAs = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestEnrollCallbackHandler(t *testing.T) {
+	env := newTestEnv(t)
+	ca := newTestDeviceCA(t, "Device CA")
+	handlers := newTestDeviceHandlers(t, env, ca.pool())
+	callback := func(body []byte) *httptest.ResponseRecorder {
+		return serve(handlers.EnrollCallbackHandler, httptest.NewRequest(http.MethodPost, "/api/devices/enroll/callback", bytes.NewReader(body)))
+	}
+
+	w := callback(ca.sign(t, map[string]string{
+		"UDID":      "00008030-001A2B3C4D5E6F70",
+		"PRODUCT":   "iPhone12,1",
+		"VERSION":   "21A329",
+		"CHALLENGE": "Jane",
+	}))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/api/devices/enroll/complete?udid=00008030-001A2B3C4D5E6F70" {
+		t.Fatalf("EnrollCallbackHandler() = %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"not signed", []byte("<plist></plist>")},
+		{"signed by another CA", newTestDeviceCA(t, "Other CA").sign(t, map[string]string{
+			"UDID": "00008030-001A2B3C4D5E6F71", "CHALLENGE": "Jane",
+		})},
+		{"invalid UDID", ca.sign(t, map[string]string{"UDID": "../../etc", "CHALLENGE": "Jane"})},
+		{"no tester", ca.sign(t, map[string]string{"UDID": "00008030-001A2B3C4D5E6F72"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := callback(tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("EnrollCallbackHandler() = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	// Only the device with valid attributes was registered, and only managers see it
+	r := httptest.NewRequest(http.MethodGet, "/api/devices?tester=Jane", nil)
+	if w := serve(handlers.DevicesHandler, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("DevicesHandler() without a token = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w = serve(handlers.DevicesHandler, withToken(httptest.NewRequest(http.MethodGet, "/api/devices?tester=Jane", nil), testAdminToken))
+	var devices []*domain.Device
+	if err := json.Unmarshal(w.Body.Bytes(), &devices); err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].UDID != "00008030-001A2B3C4D5E6F70" || devices[0].Tester != "Jane" || devices[0].Product != "iPhone12,1" {
+		t.Errorf("DevicesHandler() = %s", w.Body)
+	}
+}
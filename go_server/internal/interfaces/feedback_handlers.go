@@ -0,0 +1,145 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var feedbackRegex = regexp.MustCompile(`^/api/apps/([^/]+)/([^/]+)/([^/]+)/feedback$`)
+
+// maxFeedbackLength is the longest feedback message, in bytes.
+const maxFeedbackLength = 16 << 10
+
+// FeedbackRequest is feedback to leave on a build.
+type FeedbackRequest struct {
+	Message string `json:"message"`
+}
+
+// FeedbackHandler godoc
+// @Summary List the feedback on a build
+// @Description Get the feedback testers left on a build, newest first.
+// @Tags builds
+// @Produce  json
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   version path string true "Version of the app"
+// @Param   build_number path string true "Build number of the app"
+// @Success 200 {array} domain.Feedback
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Build not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/{version}/{build_number}/feedback [get]
+func (h *AppHandlers) FeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("FeedbackHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := feedbackRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 4 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID, version, buildNumber := matches[1], matches[2], matches[3]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionView); !ok {
+		return
+	}
+
+	build, err := h.service.GetBuild(bundleID, version, buildNumber)
+	if err != nil {
+		buildError(w, err, bundleID, version, buildNumber)
+		return
+	}
+	feedback, err := h.service.GetFeedback(build)
+	if err != nil {
+		http.Error(w, "Failed to get feedback", http.StatusInternalServerError)
+		log.Printf("Error getting feedback on %s, %s, %s: %v", bundleID, version, buildNumber, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(feedback); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding feedback: %v", err)
+	}
+}
+
+// AddFeedbackHandler godoc
+// @Summary Leave feedback on a build
+// @Description Leave feedback on a build, such as a bug report. Requires the tester role or
+// @Description higher on the app, or an API token with the feedback permission.
+// @Tags builds
+// @Accept  json
+// @Produce  json
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   version path string true "Version of the app"
+// @Param   build_number path string true "Build number of the app"
+// @Param   feedback body FeedbackRequest true "Feedback to leave"
+// @Success 201 {object} domain.Feedback
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Build not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/{version}/{build_number}/feedback [post]
+func (h *AppHandlers) AddFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("AddFeedbackHandler called")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := feedbackRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 4 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID, version, buildNumber := matches[1], matches[2], matches[3]
+
+	caller, ok := h.authorize(w, r, bundleID, domain.PermissionFeedback)
+	if !ok {
+		return
+	}
+
+	var request FeedbackRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFormValueSize)).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	message := strings.TrimSpace(request.Message)
+	if message == "" {
+		http.Error(w, "message is required", http.StatusBadRequest)
+		return
+	}
+	if len(message) > maxFeedbackLength {
+		http.Error(w, fmt.Sprintf("message must be at most %d bytes", maxFeedbackLength), http.StatusBadRequest)
+		return
+	}
+
+	build, err := h.service.GetBuild(bundleID, version, buildNumber)
+	if err != nil {
+		buildError(w, err, bundleID, version, buildNumber)
+		return
+	}
+	feedback, err := h.service.AddFeedback(build, caller.Name(), message)
+	if err != nil {
+		http.Error(w, "Failed to save feedback", http.StatusInternalServerError)
+		log.Printf("Error saving feedback on %s, %s, %s: %v", bundleID, version, buildNumber, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(feedback); err != nil {
+		log.Printf("Error encoding feedback: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// feedbackRequest returns a request for the feedback on build 1.0 (1) of com.example.app.
+func feedbackRequest(method, body string) *http.Request {
+	return httptest.NewRequest(method, "/api/apps/com.example.app/1.0/1/feedback", strings.NewReader(body))
+}
+
+// asUser returns r as the login middleware passes it on for the user with email.
+func asUser(r *http.Request, email string) *http.Request {
+	return loggedIn(r, application.Caller{User: &domain.User{Email: email}}, nil)
+}
+
+func TestFeedbackHandlers(t *testing.T) {
+	env := newTestEnv(t)
+	env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+	for email, role := range map[string]domain.Role{
+		"viewer@example.com": domain.RoleViewer,
+		"tester@example.com": domain.RoleTester,
+		"dev@example.com":    domain.RoleDeveloper,
+	} {
+		if err := env.members.SaveMember(&domain.Member{BundleID: "com.example.app", Email: email, Role: role, CreatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, secret, err := env.tokens.CreateToken("bot", []string{"com.example.app"}, []domain.Permission{domain.PermissionFeedback}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Testers and the roles above them can leave feedback, as can tokens with the permission
+	for _, r := range []*http.Request{
+		asUser(feedbackRequest(http.MethodPost, `{"message": "Crashes on launch"}`), "tester@example.com"),
+		asUser(feedbackRequest(http.MethodPost, `{"message": "  Login is slow\n"}`), "dev@example.com"),
+		withToken(feedbackRequest(http.MethodPost, `{"message": "Screenshot test failed"}`), secret),
+	} {
+		if w := serve(env.handlers.AddFeedbackHandler, r); w.Code != http.StatusCreated {
+			t.Fatalf("AddFeedbackHandler() = %d %s", w.Code, w.Body)
+		}
+	}
+
+	// Viewers can read the feedback, newest first
+	w := serve(env.handlers.FeedbackHandler, asUser(feedbackRequest(http.MethodGet, ""), "viewer@example.com"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("FeedbackHandler() = %d %s", w.Code, w.Body)
+	}
+	var feedback []domain.Feedback
+	if err := json.Unmarshal(w.Body.Bytes(), &feedback); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range feedback {
+		got = append(got, f.Author+": "+f.Message)
+	}
+	want := []string{"bot: Screenshot test failed", "dev@example.com: Login is slow", "tester@example.com: Crashes on launch"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("FeedbackHandler() = %q, want %q", got, want)
+	}
+
+	for _, tt := range []struct {
+		name string
+		r    *http.Request
+		want int
+	}{
+		{"viewer", asUser(feedbackRequest(http.MethodPost, `{"message": "Hi"}`), "viewer@example.com"), http.StatusForbidden},
+		{"non-member", asUser(feedbackRequest(http.MethodPost, `{"message": "Hi"}`), "other@example.com"), http.StatusForbidden},
+		{"guest", feedbackRequest(http.MethodPost, `{"message": "Hi"}`), http.StatusUnauthorized},
+		{"empty message", asUser(feedbackRequest(http.MethodPost, `{"message": " "}`), "tester@example.com"), http.StatusBadRequest},
+		{"too long message", asUser(feedbackRequest(http.MethodPost, `{"message": "`+strings.Repeat("a", maxFeedbackLength+1)+`"}`), "tester@example.com"), http.StatusBadRequest},
+		{"missing build", asUser(httptest.NewRequest(http.MethodPost, "/api/apps/com.example.app/1.0/2/feedback", strings.NewReader(`{"message": "Hi"}`)), "tester@example.com"), http.StatusNotFound},
+	} {
+		if w := serve(env.handlers.AddFeedbackHandler, tt.r); w.Code != tt.want {
+			t.Errorf("AddFeedbackHandler() as %s = %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+	if w := serve(env.handlers.FeedbackHandler, asUser(feedbackRequest(http.MethodGet, ""), "other@example.com")); w.Code != http.StatusForbidden {
+		t.Errorf("FeedbackHandler() as a non-member = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -3,53 +3,158 @@ package interfaces
 import (
 	"app-distribution-server-go/internal/application"
 	"app-distribution-server-go/internal/domain"
+	"app-distribution-server-go/internal/infrastructure"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"regexp"
 
 	"github.com/google/uuid"
-	"github.com/nao1215/deapk/apk"
 	"github.com/skip2/go-qrcode"
+	"howett.net/plist"
 )
 
+// maxFormValueSize is the maximum size of a form field other than the app file.
+const maxFormValueSize = 1 << 20
+
 type AppHandlers struct {
-	service *application.AppService
+	service       *application.AppService
+	access        *application.AccessService
+	tokens        *application.TokenService
+	maxUploadSize int64
 }
 
-func NewAppHandlers(service *application.AppService) *AppHandlers {
-	return &AppHandlers{service: service}
+// NewAppHandlers returns the app handlers. Every request is checked with access
+// before it reaches service, and requests with an API token are authenticated with
+// tokens. Uploaded app files larger than maxUploadSize bytes are rejected.
+func NewAppHandlers(service *application.AppService, access *application.AccessService, tokens *application.TokenService, maxUploadSize int64) *AppHandlers {
+	return &AppHandlers{service: service, access: access, tokens: tokens, maxUploadSize: maxUploadSize}
 }
 
 // DownloadResponse represents the response for the download endpoint.
 type DownloadResponse struct {
 	domain.BuildInfo
-	QRCode string `json:"qr_code"`
+	DownloadURL string `json:"download_url"`
+	// Installable is false for artifacts such as .aab bundles that devices cannot install,
+	// in which case InstallURL and QRCode are empty.
+	Installable bool   `json:"installable"`
+	InstallURL  string `json:"install_url,omitempty"`
+	QRCode      string `json:"qr_code,omitempty"`
+	// ReleaseNotesHTML is the release notes rendered from Markdown and sanitized.
+	ReleaseNotesHTML string `json:"release_notes_html,omitempty"`
+	// App is the app the build belongs to. It is only set for the latest version of an app.
+	App *domain.App `json:"app,omitempty"`
+}
+
+// newDownloadResponse builds the download response for a build. The QR code
+// points to the install URL, which is an itms-services link for iOS builds.
+func newDownloadResponse(r *http.Request, build *domain.BuildInfo) (DownloadResponse, error) {
+	response := DownloadResponse{
+		BuildInfo:   *build,
+		DownloadURL: buildDownloadURL(r, build),
+		Installable: build.Artifact().Installable(),
+	}
+	if build.ReleaseNotes != "" {
+		response.ReleaseNotesHTML = renderMarkdown(build.ReleaseNotes)
+	}
+	if !response.Installable {
+		return response, nil
+	}
+
+	response.InstallURL = buildInstallURL(r, build)
+	png, err := qrcode.Encode(response.InstallURL, qrcode.Medium, 256)
+	if err != nil {
+		return DownloadResponse{}, err
+	}
+	response.QRCode = base64.StdEncoding.EncodeToString(png)
+
+	return response, nil
+}
+
+// baseURL returns the scheme and host the request was made to, honoring
+// the X-Forwarded-Proto header set by reverse proxies.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// buildPath returns the API path prefix of a single build.
+func buildPath(build *domain.BuildInfo) string {
+	return "/api/apps/" + url.PathEscape(build.BundleID) + "/" + url.PathEscape(build.Version) + "/" + url.PathEscape(build.BuildNumber)
+}
+
+// buildDownloadURL returns the absolute URL of the build's binary, signed for
+// authenticated requests.
+func buildDownloadURL(r *http.Request, build *domain.BuildInfo) string {
+	return baseURL(r) + signedPath(r, buildPath(build)+"/download")
+}
+
+// buildManifestURL returns the absolute URL of the build's OTA manifest, signed for
+// authenticated requests, since iOS fetches it without the user's cookies.
+func buildManifestURL(r *http.Request, build *domain.BuildInfo) string {
+	return baseURL(r) + signedPath(r, buildPath(build)+"/manifest.plist")
+}
+
+// buildIconURL returns the absolute URL of the build's icon, signed for authenticated
+// requests, since iOS fetches it for the install prompt without the user's cookies.
+func buildIconURL(r *http.Request, build *domain.BuildInfo) string {
+	return baseURL(r) + signedPath(r, buildPath(build)+"/icon")
+}
+
+// buildInstallURL returns the URL a device should open to install the build.
+// iOS cannot install a raw .ipa from the browser, so it gets an itms-services link.
+func buildInstallURL(r *http.Request, build *domain.BuildInfo) string {
+	if build.Platform == domain.IOS {
+		return "itms-services://?action=download-manifest&url=" + url.QueryEscape(buildManifestURL(r, build))
+	}
+	return buildDownloadURL(r, build)
 }
 
 // AppsHandler godoc
 // @Summary List all apps
-// @Description Get a list of all available applications.
+// @Description Get a list of all available applications with their newest build.
 // @Tags apps
 // @Produce  json
-// @Success 200 {array} domain.BuildInfo
+// @Success 200 {array} domain.AppSummary
+// @Failure 401 {string} string "Unauthorized"
 // @Failure 500 {string} string "Failed to get apps"
 // @Router /apps [get]
 func (h *AppHandlers) AppsHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("AppsHandler called")
+	if r.Method == http.MethodPost {
+		h.CreateAppHandler(w, r)
+		return
+	}
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	apps, err := h.service.GetAllApps()
+	caller, ok := requestCaller(w, r, h.tokens)
+	if !ok {
+		return
+	}
+	apps, err := h.access.GetAllApps(caller)
 	if err != nil {
+		if errors.Is(err, application.ErrNotAuthenticated) {
+			accessError(w, err)
+			return
+		}
 		http.Error(w, "Failed to get apps", http.StatusInternalServerError)
 		log.Printf("Error getting apps: %v", err)
 		return
@@ -64,17 +169,38 @@ func (h *AppHandlers) AppsHandler(w http.ResponseWriter, r *http.Request) {
 
 // UploadHandler godoc
 // @Summary Upload a new app
-// @Description Upload a new .apk or .ipa file.
+// @Description Upload a new .apk, .aab or .ipa file. App Bundles (.aab) are stored for
+// @Description distribution through Google Play and cannot be installed directly.
+// @Description The file is streamed to storage, so metadata fields may come before or after it.
+// @Description A deleted build with the same version and build number is replaced.
+// @Description Requires the developer role on the app, or an API token with the upload permission
+// @Description for its bundle ID.
 // @Tags apps
 // @Accept  multipart/form-data
 // @Produce  json
-// @Param   app_file formData file true  "Application file (.apk or .ipa)"
-// @Param   bundle_id formData string false "Bundle ID (required for .ipa)"
-// @Param   version formData string false "Version (required for .ipa)"
-// @Param   build_number formData string false "Build Number (for .ipa and .apk)"
-// @Param   title formData string false "Title (required for .ipa)"
+// @Param   Authorization header string false "Bearer followed by an API token, if not logged in"
+// @Param   app_file formData file true  "Application file (.apk, .aab or .ipa)"
+// @Param   bundle_id formData string false "Bundle ID (overrides CFBundleIdentifier for .ipa and the package name for .apk and .aab)"
+// @Param   version formData string false "Version (overrides CFBundleShortVersionString for .ipa and versionName for .apk and .aab)"
+// @Param   build_number formData string false "Build Number (overrides CFBundleVersion for .ipa and versionCode for .apk and .aab)"
+// @Param   title formData string false "Title (overrides CFBundleDisplayName for .ipa and the application label for .apk and .aab)"
+// @Param   description formData string false "Description of the build"
+// @Param   release_notes formData string false "Release notes as Markdown, either a text field or a file part"
+// @Param   commit formData string false "Git commit SHA the build was made from, full or abbreviated"
+// @Param   branch formData string false "Git branch the build was made from"
+// @Param   tag formData string false "Git tag the build was made from"
+// @Param   repository_url formData string false "URL of the source repository"
+// @Param   ci_provider formData string false "CI service that made the build, e.g. github-actions"
+// @Param   pipeline_url formData string false "URL of the CI pipeline or job that made the build"
+// @Param   variant formData string false "Build variant or flavor, e.g. stagingDebug"
+// @Param   allow_signer_change formData bool false "Accept an .apk signed with a different certificate than earlier builds"
+// @Param   expected_sha256 query string false "Reject the upload unless the app file has this hex encoded SHA-256 digest"
 // @Success 200 {object} domain.BuildInfo
 // @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 409 {string} string "Signing certificate changed, or build already uploaded"
+// @Failure 413 {string} string "Upload or form field too large"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /apps/upload [post]
 func (h *AppHandlers) UploadHandler(w http.ResponseWriter, r *http.Request) {
@@ -84,141 +210,310 @@ func (h *AppHandlers) UploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 32 MB limit
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
+	// The bundle ID is only known once the app file has been read, so the caller's
+	// role on the app is checked when the upload is saved
+	caller, ok := requestCaller(w, r, h.tokens)
+	if !ok {
 		return
 	}
-
-	file, handler, err := r.FormFile("app_file")
-	if err != nil {
-		http.Error(w, "Failed to get app file from form", http.StatusBadRequest)
+	if err := h.access.AuthorizeAny(caller, domain.PermissionUpload); err != nil {
+		accessError(w, err)
 		return
 	}
-	defer file.Close()
 
-	var platform domain.Platform
-	var buildInfo domain.BuildInfo
-	var buildNumber string
+	// Leave some room for the other form fields on top of the file itself
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadSize+maxFormValueSize)
 
-	if strings.HasSuffix(handler.Filename, ".apk") {
-		platform = domain.Android
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
+		return
+	}
 
-		buildNumber = r.FormValue("build_number")
-		if buildNumber == "" {
-			buildNumber = "0" // Default if not provided
+	form := url.Values{}
+	var upload *application.StagedUpload
+	var fileName string
+	defer func() {
+		if upload != nil {
+			upload.Remove()
 		}
+	}()
 
-		tmpfile, err := os.CreateTemp("", "upload-*.apk")
-		if err != nil {
-			http.Error(w, "Failed to create temporary file", http.StatusInternalServerError)
-			return
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
 		}
-		defer os.Remove(tmpfile.Name())
-
-		fileSize, err := io.Copy(tmpfile, file)
 		if err != nil {
-			http.Error(w, "Failed to save temporary file", http.StatusInternalServerError)
+			h.uploadError(w, err)
 			return
 		}
 
-		apkParser := apk.NewAPK(tmpfile.Name())
-		if err := apkParser.Parse(); err != nil {
-			http.Error(w, "Failed to parse apk file", http.StatusInternalServerError)
-			log.Printf("Error parsing apk: %v", err)
-			return
+		if part.FormName() != "app_file" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValueSize+1))
+			if err != nil {
+				h.uploadError(w, err)
+				return
+			}
+			if len(value) > maxFormValueSize {
+				http.Error(w, fmt.Sprintf("Form field %s exceeds the maximum size of %d bytes", part.FormName(), maxFormValueSize), http.StatusRequestEntityTooLarge)
+				return
+			}
+			form.Add(part.FormName(), string(value))
+			continue
 		}
 
-		buildInfo = domain.BuildInfo{
-			UploadID:    uuid.New().String(),
-			BundleID:    apkParser.Package.Basic.PackageName,
-			Version:     apkParser.Package.Basic.Version,
-			BuildNumber: buildNumber,
-			Title:       apkParser.Package.Basic.ApplicationName,
-			FileSize:    fileSize,
-			CreatedAt:   time.Now(),
-			Platform:    platform,
+		if upload != nil {
+			http.Error(w, "Only one app_file can be uploaded at a time", http.StatusBadRequest)
+			return
 		}
-
-		if _, err := tmpfile.Seek(0, 0); err != nil {
-			http.Error(w, "Failed to seek temporary file", http.StatusInternalServerError)
+		fileName = part.FileName()
+		if artifactTypeOf(fileName) == "" {
+			http.Error(w, "Invalid file type. Only .apk, .aab and .ipa files are supported", http.StatusBadRequest)
 			return
 		}
-
-		if err := h.service.SaveUpload(&buildInfo, tmpfile); err != nil {
-			http.Error(w, "Failed to save upload", http.StatusInternalServerError)
-			log.Printf("Error saving upload: %v", err)
+		if upload, err = h.service.StageUpload(part, h.maxUploadSize); err != nil {
+			h.uploadError(w, err)
 			return
 		}
+	}
 
-	} else if strings.HasSuffix(handler.Filename, ".ipa") {
-		platform = domain.IOS
+	if upload == nil {
+		http.Error(w, "Failed to get app file from form", http.StatusBadRequest)
+		return
+	}
+	if expected := r.URL.Query().Get("expected_sha256"); expected != "" {
+		form.Set("expected_sha256", expected)
+	}
 
-		buildNumber = r.FormValue("build_number")
-		bundleID := r.FormValue("bundle_id")
-		version := r.FormValue("version")
-		title := r.FormValue("title")
+	buildInfo, ok := h.saveUpload(w, upload, fileName, form, caller)
+	if !ok {
+		return
+	}
 
-		if bundleID == "" || version == "" || buildNumber == "" || title == "" {
-			http.Error(w, "Missing required metadata for .ipa upload (bundle_id, version, build_number, title)", http.StatusBadRequest)
-			return
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(buildInfo); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// uploadError reports an error that occurred while reading the upload stream.
+func (h *AppHandlers) uploadError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, application.ErrUploadTooLarge) || errors.As(err, &maxBytesErr) {
+		http.Error(w, fmt.Sprintf("Upload exceeds the maximum size of %d bytes", h.maxUploadSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Failed to read upload", http.StatusBadRequest)
+	log.Printf("Error reading upload: %v", err)
+}
+
+// artifactTypeOf returns the artifact type for an uploaded file name, or "" if the
+// file type isn't supported.
+func artifactTypeOf(fileName string) domain.ArtifactType {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".apk":
+		return domain.APK
+	case ".ipa":
+		return domain.IPA
+	case ".aab":
+		return domain.AAB
+	}
+	return ""
+}
+
+// saveUpload extracts the build metadata from a staged application file, letting
+// form values override what was parsed, and saves the build if caller may upload
+// builds of the app. Errors are written to w, in which case ok is false.
+func (h *AppHandlers) saveUpload(w http.ResponseWriter, upload *application.StagedUpload, fileName string, form url.Values, caller application.Caller) (buildInfo *domain.BuildInfo, ok bool) {
+	// Reject corrupted transfers before anything is parsed or saved
+	if expected := form.Get("expected_sha256"); expected != "" && !strings.EqualFold(expected, upload.SHA256) {
+		http.Error(w, "SHA-256 mismatch: expected "+expected+" but received "+upload.SHA256, http.StatusBadRequest)
+		return nil, false
+	}
+
+	buildInfo = &domain.BuildInfo{
+		UploadID:     uuid.New().String(),
+		FileSize:     upload.Size,
+		SHA256:       upload.SHA256,
+		CreatedAt:    time.Now(),
+		ArtifactType: artifactTypeOf(fileName),
+	}
+
+	var icon []byte
+	var iconErr error
+
+	switch buildInfo.ArtifactType {
+	case domain.APK:
+		apkInfo, err := infrastructure.ParseAPK(upload.Path)
+		if err != nil {
+			http.Error(w, "Failed to parse apk file", http.StatusInternalServerError)
+			log.Printf("Error parsing apk: %v", err)
+			return nil, false
 		}
 
-		tmpfile, err := os.CreateTemp("", "upload-*.ipa")
+		// Form values override what was parsed from the manifest, whose versionCode is
+		// the build number
+		buildInfo.Platform = domain.Android
+		buildInfo.BundleID = formValueOr(form, "bundle_id", apkInfo.BundleID)
+		buildInfo.Version = formValueOr(form, "version", apkInfo.Version)
+		buildInfo.BuildNumber = formValueOr(form, "build_number", apkInfo.BuildNumber)
+		buildInfo.Title = formValueOr(form, "title", apkInfo.Title)
+		buildInfo.Android = apkInfo.Android
+
+		signature, err := infrastructure.VerifyAPKSignature(upload.Path)
 		if err != nil {
-			http.Error(w, "Failed to create temporary file", http.StatusInternalServerError)
-			return
+			http.Error(w, "APK signature verification failed: "+err.Error(), http.StatusBadRequest)
+			log.Printf("Error verifying apk signature: %v", err)
+			return nil, false
 		}
-		defer os.Remove(tmpfile.Name())
+		buildInfo.Signature = signature
+
+		icon, iconErr = infrastructure.ExtractAPKIcon(upload.Path)
 
-		fileSize, err := io.Copy(tmpfile, file)
+	case domain.IPA:
+		ipaInfo, err := infrastructure.ParseIPA(upload.Path)
 		if err != nil {
-			http.Error(w, "Failed to save temporary file", http.StatusInternalServerError)
-			return
+			// Fall back to the form values if the Info.plist can't be read
+			log.Printf("Error parsing ipa: %v", err)
+			ipaInfo = &infrastructure.IPAInfo{}
 		}
 
-		buildInfo = domain.BuildInfo{
-			UploadID:    uuid.New().String(),
-			BundleID:    bundleID,
-			Version:     version,
-			BuildNumber: buildNumber,
-			Title:       title,
-			FileSize:    fileSize,
-			CreatedAt:   time.Now(),
-			Platform:    platform,
+		// Form values override what was parsed from the Info.plist
+		buildInfo.Platform = domain.IOS
+		buildInfo.BundleID = formValueOr(form, "bundle_id", ipaInfo.BundleID)
+		buildInfo.Version = formValueOr(form, "version", ipaInfo.Version)
+		buildInfo.BuildNumber = formValueOr(form, "build_number", ipaInfo.BuildNumber)
+		buildInfo.Title = formValueOr(form, "title", ipaInfo.Title)
+		buildInfo.Provisioning = ipaInfo.Provisioning
+
+		if buildInfo.BundleID == "" || buildInfo.Version == "" || buildInfo.BuildNumber == "" || buildInfo.Title == "" {
+			http.Error(w, "Missing required metadata for .ipa upload (bundle_id, version, build_number, title)", http.StatusBadRequest)
+			return nil, false
 		}
 
-		if _, err := tmpfile.Seek(0, 0); err != nil {
-			http.Error(w, "Failed to seek temporary file", http.StatusInternalServerError)
-			return
+		icon, iconErr = infrastructure.ExtractIPAIcon(upload.Path)
+
+	case domain.AAB:
+		aabInfo, err := infrastructure.ParseAAB(upload.Path)
+		if err != nil {
+			http.Error(w, "Failed to parse aab file", http.StatusBadRequest)
+			log.Printf("Error parsing aab: %v", err)
+			return nil, false
 		}
 
-		if err := h.service.SaveUpload(&buildInfo, tmpfile); err != nil {
-			http.Error(w, "Failed to save upload", http.StatusInternalServerError)
-			log.Printf("Error saving upload: %v", err)
-			return
+		buildInfo.Platform = domain.Android
+		buildInfo.BundleID = formValueOr(form, "bundle_id", aabInfo.BundleID)
+		buildInfo.Version = formValueOr(form, "version", aabInfo.Version)
+		buildInfo.BuildNumber = formValueOr(form, "build_number", aabInfo.BuildNumber)
+		buildInfo.Title = formValueOr(form, "title", aabInfo.Title)
+		buildInfo.Android = aabInfo.Android
+
+		icon, iconErr = infrastructure.ExtractAABIcon(upload.Path)
+
+	default:
+		http.Error(w, "Invalid file type. Only .apk, .aab and .ipa files are supported", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if !domain.ValidBundleID(buildInfo.BundleID) {
+		http.Error(w, "bundle_id must be a reverse-DNS identifier such as com.example.app", http.StatusBadRequest)
+		return nil, false
+	}
+	// Nothing about the earlier builds of the app may be revealed before the caller is
+	// known to be allowed to upload them
+	if err := h.access.Authorize(caller, buildInfo.BundleID, domain.PermissionUpload); err != nil {
+		accessError(w, err)
+		return nil, false
+	}
+
+	allowSignerChange := form.Get("allow_signer_change") == "true"
+	if err := h.service.CheckSigner(buildInfo, allowSignerChange); err != nil {
+		if errors.Is(err, application.ErrSignerChanged) {
+			http.Error(w, "The signing certificate differs from earlier builds of "+buildInfo.BundleID+", so it cannot be installed as an update. Set allow_signer_change=true to upload it anyway", http.StatusConflict)
+			return nil, false
 		}
+		http.Error(w, "Failed to check signing certificate", http.StatusInternalServerError)
+		log.Printf("Error checking signer: %v", err)
+		return nil, false
+	}
+
+	// Apps don't carry a description or release notes, so they only come from the form
+	buildInfo.Description = form.Get("description")
+	buildInfo.ReleaseNotes = form.Get("release_notes")
+
+	provenance := domain.Provenance{
+		Commit:        strings.ToLower(form.Get("commit")),
+		Branch:        form.Get("branch"),
+		Tag:           form.Get("tag"),
+		RepositoryURL: form.Get("repository_url"),
+		CIProvider:    form.Get("ci_provider"),
+		PipelineURL:   form.Get("pipeline_url"),
+		Variant:       form.Get("variant"),
+	}
+	if provenance.Commit != "" && !commitRegex.MatchString(provenance.Commit) {
+		http.Error(w, "commit must be a git commit SHA of 7 to 64 hex characters", http.StatusBadRequest)
+		return nil, false
+	}
+	if !provenance.IsZero() {
+		buildInfo.Provenance = &provenance
+	}
 
+	if iconErr != nil {
+		log.Printf("Error extracting %s icon: %v", buildInfo.ArtifactType, iconErr)
 	} else {
-		http.Error(w, "Invalid file type. Only .apk and .ipa files are supported", http.StatusBadRequest)
-		return
+		buildInfo.Icon = buildPath(buildInfo) + "/icon"
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(buildInfo); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		log.Printf("Error encoding response: %v", err)
+	if err := h.service.SaveUpload(buildInfo, upload); err != nil {
+		if errors.Is(err, application.ErrBuildExists) {
+			http.Error(w, fmt.Sprintf("Version %s (%s) of %s has already been uploaded", buildInfo.Version, buildInfo.BuildNumber, buildInfo.BundleID), http.StatusConflict)
+			return nil, false
+		}
+		http.Error(w, "Failed to save upload", http.StatusInternalServerError)
+		log.Printf("Error saving upload: %v", err)
+		return nil, false
 	}
+
+	// The icon is only stored once the build is, so a rejected duplicate can't replace
+	// the icon of the build it collides with
+	if iconErr == nil {
+		if err := h.service.SaveIcon(buildInfo, icon); err != nil {
+			log.Printf("Error saving icon: %v", err)
+		}
+	}
+
+	return buildInfo, true
+}
+
+// formValueOr returns the form value for key, or fallback if it is empty.
+func formValueOr(form url.Values, key, fallback string) string {
+	if value := form.Get(key); value != "" {
+		return value
+	}
+	return fallback
 }
 
 // GetLatestAppVersionHandler godoc
 // @Summary Get latest app version
-// @Description Get a download link for the latest version of an app.
+// @Description Get a download link for the latest version of an app, together with the app.
+// @Description The latest version is the newest upload, or the highest version for apps whose
+// @Description latest_by is version. With version, the latest build in that version range is
+// @Description returned. With channel, the build the channel points to is returned instead.
+// @Description With installable, .aab bundles are skipped so that the install URL and QR code
+// @Description point to the latest build devices can install.
 // @Tags apps
 // @Produce  json
 // @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   channel query string false "Release channel to resolve, e.g. beta"
+// @Param   version query string false "Version range, e.g. >=2.3 <3, ^2.3 or 2.x"
+// @Param   installable query bool false "Only consider builds devices can install"
 // @Success 200 {object} DownloadResponse
-// @Failure 400 {string} string "Invalid URL"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Channel or build not found"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /apps/{bundle_id} [get]
 func (h *AppHandlers) GetLatestAppVersionHandler(w http.ResponseWriter, r *http.Request) {
@@ -228,35 +523,67 @@ func (h *AppHandlers) GetLatestAppVersionHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	latestRegex := regexp.MustCompile(`/api/apps/([^/]+)`)
-	matches := latestRegex.FindStringSubmatch(r.URL.Path)
+	matches := appRegex.FindStringSubmatch(r.URL.Path)
 	if len(matches) < 2 {
 		http.Error(w, "Invalid URL", http.StatusBadRequest)
 		return
 	}
 	bundleID := matches[1]
 
-	build, err := h.service.GetLatestVersion(bundleID)
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionView); !ok {
+		return
+	}
+
+	versions, err := domain.ParseVersionRange(r.URL.Query().Get("version"))
+	if err != nil {
+		http.Error(w, "Invalid version range: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var build *domain.BuildInfo
+	if channel := r.URL.Query().Get("channel"); channel != "" {
+		if len(versions) > 0 {
+			http.Error(w, "Set either channel or version", http.StatusBadRequest)
+			return
+		}
+		build, err = h.service.GetChannelBuild(bundleID, channel)
+		if errors.Is(err, application.ErrChannelNotFound) {
+			http.Error(w, "Channel "+channel+" not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		installable := r.URL.Query().Get("installable") == "true"
+		build, err = h.service.GetLatestVersionInRange(bundleID, versions, installable)
+		if errors.Is(err, application.ErrBuildNotFound) {
+			switch {
+			case installable:
+				http.Error(w, "No build that devices can install matches the version range", http.StatusNotFound)
+			case len(versions) > 0:
+				http.Error(w, "No build matches the version range", http.StatusNotFound)
+			default:
+				// Every build may have been archived or deleted, or none uploaded yet
+				http.Error(w, "App "+bundleID+" has no listed builds", http.StatusNotFound)
+			}
+			return
+		}
+	}
 	if err != nil {
 		http.Error(w, "Failed to get latest version", http.StatusInternalServerError)
 		log.Printf("Error getting latest version for %s: %v", bundleID, err)
 		return
 	}
 
-	downloadURL := "http://" + r.Host + "/api/apps/" + bundleID + "/" + build.Version + "/" + build.BuildNumber + "/download"
-	var png []byte
-	png, err = qrcode.Encode(downloadURL, qrcode.Medium, 256)
+	response, err := newDownloadResponse(r, build)
 	if err != nil {
 		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
 		log.Printf("Error generating QR code: %v", err)
 		return
 	}
 
-	qrCodeBase64 := base64.StdEncoding.EncodeToString(png)
-
-	response := DownloadResponse{
-		BuildInfo: *build,
-		QRCode:    qrCodeBase64,
+	if response.App, err = h.service.GetApp(bundleID); err != nil {
+		http.Error(w, "Failed to get app", http.StatusInternalServerError)
+		log.Printf("Error getting app %s: %v", bundleID, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -268,12 +595,21 @@ func (h *AppHandlers) GetLatestAppVersionHandler(w http.ResponseWriter, r *http.
 
 // GetAllAppVersionsHandler godoc
 // @Summary Get all app versions
-// @Description Get all versions of an app.
+// @Description Get all versions of an app, newest first. Versions are ordered by upload time or
+// @Description by version, which compares semantic versions, then build numbers such as Android
+// @Description versionCode or iOS CFBundleVersion. The default order is the app's latest_by.
 // @Tags apps
 // @Produce  json
 // @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   order query string false "Order of the versions" Enums(version, upload_time)
+// @Param   version query string false "Only list versions in this range, e.g. >=2.3 <3, ^2.3 or 2.x"
+// @Param   archived query bool false "List the archived versions instead"
+// @Param   branch query string false "Only list versions built from this branch"
+// @Param   commit query string false "Only list versions built from this commit, full or abbreviated"
 // @Success 200 {array} DownloadResponse
-// @Failure 400 {string} string "Invalid URL"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /apps/{bundle_id}/versions [get]
 func (h *AppHandlers) GetAllAppVersionsHandler(w http.ResponseWriter, r *http.Request) {
@@ -291,7 +627,35 @@ func (h *AppHandlers) GetAllAppVersionsHandler(w http.ResponseWriter, r *http.Re
 	}
 	bundleID := matches[1]
 
-	versions, err := h.service.GetAllVersions(bundleID)
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionView); !ok {
+		return
+	}
+
+	order := domain.VersionOrder(r.URL.Query().Get("order"))
+	if !order.Valid() {
+		http.Error(w, "order must be version or upload_time", http.StatusBadRequest)
+		return
+	}
+	versionRange, err := domain.ParseVersionRange(r.URL.Query().Get("version"))
+	if err != nil {
+		http.Error(w, "Invalid version range: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	commit := strings.ToLower(r.URL.Query().Get("commit"))
+	if commit != "" && !commitRegex.MatchString(commit) {
+		http.Error(w, "commit must be a git commit SHA of 7 to 64 hex characters", http.StatusBadRequest)
+		return
+	}
+
+	query := application.BuildQuery{
+		Order:    order,
+		Versions: versionRange,
+		Archived: r.URL.Query().Get("archived") == "true",
+		Branch:   r.URL.Query().Get("branch"),
+		Commit:   commit,
+	}
+	versions, err := h.service.GetAllVersions(bundleID, query)
 	if err != nil {
 		http.Error(w, "Failed to get versions", http.StatusInternalServerError)
 		log.Printf("Error getting versions for %s: %v", bundleID, err)
@@ -300,21 +664,14 @@ func (h *AppHandlers) GetAllAppVersionsHandler(w http.ResponseWriter, r *http.Re
 
 	var response []DownloadResponse
 	for _, version := range versions {
-		downloadURL := "http://" + r.Host + "/api/apps/" + bundleID + "/" + version.Version + "/" + version.BuildNumber + "/download"
-		var png []byte
-		png, err = qrcode.Encode(downloadURL, qrcode.Medium, 256)
+		item, err := newDownloadResponse(r, version)
 		if err != nil {
 			http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
 			log.Printf("Error generating QR code: %v", err)
 			return
 		}
 
-		qrCodeBase64 := base64.StdEncoding.EncodeToString(png)
-
-		response = append(response, DownloadResponse{
-			BuildInfo: *version,
-			QRCode:    qrCodeBase64,
-		})
+		response = append(response, item)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -326,14 +683,20 @@ func (h *AppHandlers) GetAllAppVersionsHandler(w http.ResponseWriter, r *http.Re
 
 // DownloadHandler godoc
 // @Summary Download an app
-// @Description Download a specific version of an app.
+// @Description Download a specific version of an app. Range requests are supported.
 // @Tags apps
 // @Produce  application/octet-stream
 // @Param   bundle_id path string true "Bundle ID of the app"
 // @Param   version path string true "Version of the app"
 // @Param   build_number path string true "Build number of the app"
+// @Param   Range header string false "Byte range to download, e.g. bytes=0-1023"
 // @Success 200 {file} file "Application file"
+// @Success 206 {file} file "Requested range of the application file"
+// @Success 304 {string} string "Not Modified"
+// @Header  200 {string} ETag "SHA-256 digest of the application file"
 // @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
 // @Failure 404 {string} string "Not Found"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /apps/{bundle_id}/{version}/{build_number}/download [get]
@@ -354,24 +717,199 @@ func (h *AppHandlers) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 	version := matches[2]
 	buildNumber := matches[3]
 
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionView); !ok {
+		return
+	}
+
 	build, err := h.service.GetBuild(bundleID, version, buildNumber)
 	if err != nil {
-		http.Error(w, "Failed to get build", http.StatusInternalServerError)
-		log.Printf("Error getting build for %s, %s, %s: %v", bundleID, version, buildNumber, err)
+		buildError(w, err, bundleID, version, buildNumber)
 		return
 	}
 
-	fileName := "app.ipa"
-	if build.Platform == domain.Android {
-		fileName = "app.apk"
+	file, blob, err := h.service.OpenAppFile(build)
+	if err != nil {
+		if errors.Is(err, application.ErrBlobNotFound) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to open file", http.StatusInternalServerError)
+		log.Printf("Error opening app file for %s, %s, %s: %v", bundleID, version, buildNumber, err)
+		return
 	}
-	filePath := filepath.Join("go_uploads", bundleID, version, buildNumber, fileName)
+	defer file.Close()
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
+	// The digest identifies the content, so it makes a strong ETag for conditional and range requests
+	if build.SHA256 != "" {
+		w.Header().Set("ETag", `"`+build.SHA256+`"`)
 	}
 
+	fileName := build.FileName()
 	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
-	http.ServeFile(w, r, filePath)
+	http.ServeContent(w, r, fileName, blob.ModTime, file)
+}
+
+// manifest is the OTA install manifest consumed by iOS through itms-services.
+type manifest struct {
+	Items []manifestItem `plist:"items"`
+}
+
+type manifestItem struct {
+	Assets   []manifestAsset  `plist:"assets"`
+	Metadata manifestMetadata `plist:"metadata"`
+}
+
+type manifestAsset struct {
+	Kind string `plist:"kind"`
+	URL  string `plist:"url"`
+}
+
+type manifestMetadata struct {
+	BundleIdentifier string `plist:"bundle-identifier"`
+	BundleVersion    string `plist:"bundle-version"`
+	Kind             string `plist:"kind"`
+	Title            string `plist:"title"`
+}
+
+// ManifestHandler godoc
+// @Summary Get the OTA install manifest
+// @Description Get the manifest.plist used by iOS to install a build over the air.
+// @Tags apps
+// @Produce  xml
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   version path string true "Version of the app"
+// @Param   build_number path string true "Build number of the app"
+// @Success 200 {string} string "manifest.plist"
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/{version}/{build_number}/manifest.plist [get]
+func (h *AppHandlers) ManifestHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("ManifestHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	manifestRegex := regexp.MustCompile(`/api/apps/([^/]+)/([^/]+)/([^/]+)/manifest\.plist`)
+	matches := manifestRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 4 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID := matches[1]
+	version := matches[2]
+	buildNumber := matches[3]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionView); !ok {
+		return
+	}
+
+	build, err := h.service.GetBuild(bundleID, version, buildNumber)
+	if err != nil {
+		buildError(w, err, bundleID, version, buildNumber)
+		return
+	}
+
+	if build.Platform != domain.IOS {
+		http.Error(w, "Manifest is only available for iOS builds", http.StatusNotFound)
+		return
+	}
+
+	assets := []manifestAsset{
+		{Kind: "software-package", URL: buildDownloadURL(r, build)},
+	}
+	if build.Icon != "" {
+		iconURL := buildIconURL(r, build)
+		assets = append(assets,
+			manifestAsset{Kind: "display-image", URL: iconURL},
+			manifestAsset{Kind: "full-size-image", URL: iconURL},
+		)
+	}
+
+	m := manifest{
+		Items: []manifestItem{{
+			Assets: assets,
+			Metadata: manifestMetadata{
+				BundleIdentifier: build.BundleID,
+				BundleVersion:    build.Version,
+				Kind:             "software",
+				Title:            build.Title,
+			},
+		}},
+	}
+
+	data, err := plist.MarshalIndent(m, plist.XMLFormat, "\t")
+	if err != nil {
+		http.Error(w, "Failed to generate manifest", http.StatusInternalServerError)
+		log.Printf("Error encoding manifest: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(data)
+}
+
+// IconHandler godoc
+// @Summary Get an app icon
+// @Description Get the icon extracted from a specific build of an app.
+// @Tags apps
+// @Produce  image/png
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   version path string true "Version of the app"
+// @Param   build_number path string true "Build number of the app"
+// @Success 200 {file} file "Icon image"
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Not Found"
+// @Router /apps/{bundle_id}/{version}/{build_number}/icon [get]
+func (h *AppHandlers) IconHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("IconHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	iconRegex := regexp.MustCompile(`/api/apps/([^/]+)/([^/]+)/([^/]+)/icon$`)
+	matches := iconRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 4 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	bundleID := matches[1]
+	version := matches[2]
+	buildNumber := matches[3]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionView); !ok {
+		return
+	}
+
+	build, err := h.service.GetBuild(bundleID, version, buildNumber)
+	if err != nil {
+		buildError(w, err, bundleID, version, buildNumber)
+		return
+	}
+
+	icon, blob, err := h.service.OpenIcon(build)
+	if err != nil {
+		if errors.Is(err, application.ErrBlobNotFound) {
+			http.Error(w, "Icon not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to open icon", http.StatusInternalServerError)
+		log.Printf("Error opening icon for %s, %s, %s: %v", bundleID, version, buildNumber, err)
+		return
+	}
+	defer icon.Close()
+
+	// Icons never change for a given build, but only public ones may be kept by shared caches
+	if loginsEnabled(r) {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	http.ServeContent(w, r, "icon", blob.ModTime, icon)
 }
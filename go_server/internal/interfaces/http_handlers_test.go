@@ -0,0 +1,452 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"app-distribution-server-go/internal/infrastructure"
+	"app-distribution-server-go/internal/infrastructure/apktest"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"howett.net/plist"
+)
+
+// testAdminToken is the ADMIN_TOKEN of the handlers newTestEnv returns.
+const testAdminToken = "test-admin-token"
+
+// testEnv holds app handlers and the services behind them, backed by a SQLite
+// database and a blob store in a temporary directory.
+type testEnv struct {
+	db       *sql.DB
+	handlers *AppHandlers
+	service  *application.AppService
+	access   *application.AccessService
+	blobs    application.BlobStore
+	tokens   *application.TokenService
+	members  application.MemberRepository
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("DATABASE_URL", "sqlite://"+filepath.Join(dir, "test.db"))
+	db, err := infrastructure.NewSQLiteConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := infrastructure.MigrateSQLiteDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := infrastructure.NewLocalBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := infrastructure.NewSQLiteAppRepository(db, blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenRepo, err := infrastructure.NewSQLiteTokenRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := infrastructure.NewSQLiteMemberRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := application.NewAppService(repo, time.Hour)
+	tokens := application.NewTokenService(tokenRepo, testAdminToken)
+	access := application.NewAccessService(service, members)
+	return &testEnv{
+		db:       db,
+		handlers: NewAppHandlers(service, access, tokens, 1<<20),
+		service:  service,
+		access:   access,
+		blobs:    blobs,
+		tokens:   tokens,
+		members:  members,
+	}
+}
+
+// serve passes r to handler and returns the response.
+func serve(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// withToken returns r authenticated with the API token secret.
+func withToken(r *http.Request, secret string) *http.Request {
+	r.Header.Set("Authorization", "Bearer "+secret)
+	return r
+}
+
+// loggedIn returns r as the login middleware passes it on for caller, with links
+// signed by signer.
+func loggedIn(r *http.Request, caller application.Caller, signer *URLSigner) *http.Request {
+	return (&AuthHandlers{signer: signer}).withCaller(r, caller)
+}
+
+// uploadRequest returns a multipart upload of an app file named fileName followed by
+// the form fields.
+func uploadRequest(t *testing.T, fileName string, content []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("app_file", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/apps/upload", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+// upload uploads an app file with the admin token and returns the saved build.
+func (e *testEnv) upload(t *testing.T, fileName string, content []byte, fields map[string]string) *domain.BuildInfo {
+	t.Helper()
+	w := serve(e.handlers.UploadHandler, withToken(uploadRequest(t, fileName, content, fields), testAdminToken))
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload of %s: %d %s", fileName, w.Code, w.Body)
+	}
+	var build domain.BuildInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &build); err != nil {
+		t.Fatal(err)
+	}
+	return &build
+}
+
+// testIPA returns an .ipa whose Info.plist has the bundle ID, version and build
+// number, with an icon.
+func testIPA(t *testing.T, bundleID, version, buildNumber string) []byte {
+	t.Helper()
+	info, err := plist.Marshal(map[string]any{
+		"CFBundleIdentifier":         bundleID,
+		"CFBundleShortVersionString": version,
+		"CFBundleVersion":            buildNumber,
+		"CFBundleName":               "Example",
+		"CFBundleIconFiles":          []string{"AppIcon60x60"},
+	}, plist.XMLFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var icon bytes.Buffer
+	if err := png.Encode(&icon, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	var data bytes.Buffer
+	archive := zip.NewWriter(&data)
+	for name, content := range map[string][]byte{
+		"Payload/Example.app/Info.plist":          info,
+		"Payload/Example.app/AppIcon60x60@2x.png": icon.Bytes(),
+		"Payload/Example.app/Example":             []byte("binary"),
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return data.Bytes()
+}
+
+// testAPK returns an .apk of the package with a version code, signed with the v2 scheme
+// by signer.
+func testAPK(t *testing.T, signer *apktest.Signer, packageName string, versionCode int) []byte {
+	t.Helper()
+	data, err := apktest.Build(apktest.Manifest{
+		Package:     packageName,
+		VersionName: "1.0",
+		VersionCode: versionCode,
+		Label:       "Example",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = signer.Sign(data, apktest.V2); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// newTestSigner returns an APK signer with the common name.
+func newTestSigner(t *testing.T, commonName string) *apktest.Signer {
+	t.Helper()
+	signer, err := apktest.NewSigner(pkix.Name{CommonName: commonName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestUploadHandlerFormOverrides(t *testing.T) {
+	env := newTestEnv(t)
+	signer := newTestSigner(t, "Release")
+
+	build := env.upload(t, "app.apk", testAPK(t, signer, "com.example.android", 7), nil)
+	if build.BundleID != "com.example.android" || build.Version != "1.0" || build.BuildNumber != "7" || build.Title != "Example" {
+		t.Errorf("upload without overrides = %+v", build)
+	}
+
+	// Form values override the metadata of every platform, each under its own bundle ID
+	uploads := []struct {
+		fileName string
+		content  []byte
+		bundleID string
+	}{
+		{"app.apk", testAPK(t, signer, "com.example.android", 8), "com.example.staging"},
+		{"app.ipa", testIPA(t, "com.example.app", "1.0", "8"), "com.example.staging.ios"},
+	}
+	for _, u := range uploads {
+		build := env.upload(t, u.fileName, u.content, map[string]string{
+			"bundle_id":    u.bundleID,
+			"version":      "1.0-rc1",
+			"build_number": "9",
+			"title":        "Example Staging",
+		})
+		if build.BundleID != u.bundleID || build.Version != "1.0-rc1" || build.BuildNumber != "9" || build.Title != "Example Staging" {
+			t.Errorf("upload of %s with overrides = %+v", u.fileName, build)
+		}
+	}
+
+	w := serve(env.handlers.UploadHandler, withToken(uploadRequest(t, "app.apk", testAPK(t, signer, "com.example.android", 9), map[string]string{
+		"bundle_id": "not a bundle id",
+	}), testAdminToken))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("upload with an invalid bundle_id = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGetAllAppVersionsHandlerProvenance(t *testing.T) {
+	env := newTestEnv(t)
+	for i, provenance := range []map[string]string{
+		{"commit": "1111111aaaa", "branch": "main"},
+		{"commit": "2222222bbbb", "branch": "feature/login"},
+		{"commit": "3333333cccc", "branch": "main"},
+		nil,
+	} {
+		env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", fmt.Sprint(i+1)), provenance)
+	}
+	versions := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app/versions?"+query, nil)
+		return serve(env.handlers.GetAllAppVersionsHandler, withToken(r, testAdminToken))
+	}
+
+	for query, want := range map[string]string{
+		"branch=main":                      "3,1",
+		"branch=feature%2Flogin":           "2",
+		"commit=1111111":                   "1",
+		"commit=3333333CCCC":               "3",
+		"branch=main&commit=2222222":       "",
+		"order=upload_time&branch=release": "",
+	} {
+		w := versions(query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GetAllAppVersionsHandler(%s) = %d %s", query, w.Code, w.Body)
+		}
+		var response []DownloadResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, build := range response {
+			got = append(got, build.BuildNumber)
+		}
+		if strings.Join(got, ",") != want {
+			t.Errorf("GetAllAppVersionsHandler(%s) = builds %v, want %s", query, got, want)
+		}
+	}
+	if w := versions("commit=xyz"); w.Code != http.StatusBadRequest {
+		t.Errorf("GetAllAppVersionsHandler() with an invalid commit = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	// A commit that isn't a SHA is rejected on upload too
+	w := serve(env.handlers.UploadHandler, withToken(uploadRequest(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "5"), map[string]string{"commit": "main"}), testAdminToken))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("upload with an invalid commit = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGetBuildHandlerPlatform(t *testing.T) {
+	env := newTestEnv(t)
+	ios := env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+	// An Android build may share the bundle ID, version and build number
+	env.upload(t, "app.apk", testAPK(t, newTestSigner(t, "Release"), "com.example.app", 1), nil)
+
+	// The URL names the app, so the build for the app's platform is returned
+	w := serve(env.handlers.GetBuildHandler, withToken(httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app/1.0/1", nil), testAdminToken))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetBuildHandler() = %d %s", w.Code, w.Body)
+	}
+	var response DownloadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.UploadID != ios.UploadID {
+		t.Errorf("GetBuildHandler() = build %s, want the iOS build %s", response.UploadID, ios.UploadID)
+	}
+}
+
+func TestGetLatestAppVersionHandlerPath(t *testing.T) {
+	env := newTestEnv(t)
+	env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+
+	if w := serve(env.handlers.GetLatestAppVersionHandler, withToken(httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app", nil), testAdminToken)); w.Code != http.StatusOK {
+		t.Errorf("GetLatestAppVersionHandler() = %d %s", w.Code, w.Body)
+	}
+	// Unknown sub-paths of an app aren't answered with its latest build
+	if w := serve(env.handlers.GetLatestAppVersionHandler, withToken(httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app/unknown", nil), testAdminToken)); w.Code != http.StatusBadRequest {
+		t.Errorf("GetLatestAppVersionHandler() of an unknown sub-path = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestManifestHandlerSignsLinks(t *testing.T) {
+	env := newTestEnv(t)
+	env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+
+	signer := NewURLSigner([]byte("key"), time.Hour)
+	r := httptest.NewRequest(http.MethodGet, "/api/apps/com.example.app/1.0/1/manifest.plist", nil)
+	w := serve(env.handlers.ManifestHandler, loggedIn(r, application.Caller{Guest: true}, signer))
+	if w.Code != http.StatusOK {
+		t.Fatalf("ManifestHandler() = %d %s", w.Code, w.Body)
+	}
+
+	var m manifest
+	if _, err := plist.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	assets := map[string]string{}
+	for _, asset := range m.Items[0].Assets {
+		assets[asset.Kind] = asset.URL
+	}
+	// iOS fetches every asset without the user's cookies, so each link has to be signed
+	for kind, path := range map[string]string{
+		"software-package": "/api/apps/com.example.app/1.0/1/download",
+		"display-image":    "/api/apps/com.example.app/1.0/1/icon",
+		"full-size-image":  "/api/apps/com.example.app/1.0/1/icon",
+	} {
+		link, err := url.Parse(assets[kind])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.Path != path || !strings.HasPrefix(assets[kind], "http://example.com/") {
+			t.Errorf("%s URL = %s, want %s", kind, assets[kind], path)
+		}
+		if !signer.Verify(httptest.NewRequest(http.MethodGet, link.RequestURI(), nil)) {
+			t.Errorf("%s URL %s is not signed", kind, assets[kind])
+		}
+	}
+}
+
+func TestUploadHandlerSignerChange(t *testing.T) {
+	env := newTestEnv(t)
+	env.upload(t, "app.apk", testAPK(t, newTestSigner(t, "Release"), "com.example.android", 1), nil)
+	other := newTestSigner(t, "Debug")
+
+	w := serve(env.handlers.UploadHandler, withToken(uploadRequest(t, "app.apk", testAPK(t, other, "com.example.android", 2), nil), testAdminToken))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("upload with another signer = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	build := env.upload(t, "app.apk", testAPK(t, other, "com.example.android", 2), map[string]string{"allow_signer_change": "true"})
+	if build.Signature == nil || !build.Signature.SignerChanged {
+		t.Errorf("upload with allow_signer_change Signature = %+v, want SignerChanged", build.Signature)
+	}
+}
+
+func TestUploadHandlerAuthorizesBeforeSignerCheck(t *testing.T) {
+	env := newTestEnv(t)
+	env.upload(t, "app.apk", testAPK(t, newTestSigner(t, "Release"), "com.example.android", 1), nil)
+	_, secret, err := env.tokens.CreateToken("ci", []string{"com.example.other"}, []domain.Permission{domain.PermissionUpload}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A token for another app must not learn that the app exists or who signs it
+	w := serve(env.handlers.UploadHandler, withToken(uploadRequest(t, "app.apk", testAPK(t, newTestSigner(t, "Debug"), "com.example.android", 2), nil), secret))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("upload for an app the token can't be used for = %d %s, want %d", w.Code, w.Body, http.StatusForbidden)
+	}
+}
+
+func TestUploadHandlerStreaming(t *testing.T) {
+	env := newTestEnv(t)
+	ipa := testIPA(t, "com.example.app", "1.0", "1")
+	digest := sha256.Sum256(ipa)
+
+	r := uploadRequest(t, "app.ipa", ipa, map[string]string{"release_notes": "Fixed login"})
+	r.URL.RawQuery = "expected_sha256=" + strings.ToUpper(hex.EncodeToString(digest[:]))
+	w := serve(env.handlers.UploadHandler, withToken(r, testAdminToken))
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload with the expected digest = %d %s", w.Code, w.Body)
+	}
+	var build domain.BuildInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &build); err != nil {
+		t.Fatal(err)
+	}
+	// Fields sent after the file are still applied
+	if build.FileSize != int64(len(ipa)) || build.SHA256 != hex.EncodeToString(digest[:]) || build.ReleaseNotes != "Fixed login" {
+		t.Errorf("upload = %+v", build)
+	}
+
+	tests := []struct {
+		name  string
+		r     *http.Request
+		code  int
+		query string
+	}{
+		{"digest mismatch", uploadRequest(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "2"), nil), http.StatusBadRequest, "expected_sha256=" + strings.Repeat("0", 64)},
+		{"file too large", uploadRequest(t, "app.ipa", make([]byte, 1<<20+1), nil), http.StatusRequestEntityTooLarge, ""},
+		{"field too large", uploadRequest(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "3"), map[string]string{
+			"description": strings.Repeat("a", maxFormValueSize+1),
+		}), http.StatusRequestEntityTooLarge, ""},
+		{"unsupported file type", uploadRequest(t, "app.zip", ipa, nil), http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.r.URL.RawQuery = tt.query
+			if w := serve(env.handlers.UploadHandler, withToken(tt.r, testAdminToken)); w.Code != tt.code {
+				t.Errorf("UploadHandler() = %d %s, want %d", w.Code, w.Body, tt.code)
+			}
+		})
+	}
+
+	builds, err := env.service.GetAllVersions("com.example.app", application.BuildQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(builds) != 1 {
+		t.Errorf("rejected uploads saved builds: %d builds, want 1", len(builds))
+	}
+}
@@ -0,0 +1,205 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var membersRegex = regexp.MustCompile(`^/api/apps/([^/]+)/members$`)
+
+// MemberRequest gives a user or a group a role on an app. Exactly one of Email and Group is set.
+type MemberRequest struct {
+	Email string `json:"email,omitempty"`
+	// Group is a value of the groups claim in the ID tokens of users, such as qa.
+	Group string `json:"group,omitempty"`
+	// Role is viewer, tester, developer or manager.
+	Role domain.Role `json:"role"`
+}
+
+// MembersHandler godoc
+// @Summary List the members of an app
+// @Description Get the users and groups that have a role on an app. Requires the manager role
+// @Description on the app, or the admin token.
+// @Tags members
+// @Produce  json
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Success 200 {array} domain.Member
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/members [get]
+func (h *AppHandlers) MembersHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("MembersHandler called")
+	switch r.Method {
+	case http.MethodPut:
+		h.SetMemberHandler(w, r)
+		return
+	case http.MethodDelete:
+		h.RemoveMemberHandler(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bundleID, ok := h.authorizeMembers(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := h.access.GetMembers(bundleID)
+	if err != nil {
+		http.Error(w, "Failed to get members", http.StatusInternalServerError)
+		log.Printf("Error getting members of %s: %v", bundleID, err)
+		return
+	}
+	if members == nil {
+		members = []*domain.Member{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(members); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding members: %v", err)
+	}
+}
+
+// SetMemberHandler godoc
+// @Summary Add or change a member of an app
+// @Description Give a user, by email, or every user in a group a role on an app, replacing the
+// @Description role they had. Viewers can list and download builds, testers can also give
+// @Description feedback, developers can also upload builds, and managers can also delete and
+// @Description promote builds and change the members. Apps don't have to exist yet, so developers
+// @Description can upload their first build. Requires the manager role on the app, or the admin token.
+// @Tags members
+// @Accept  json
+// @Produce  json
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   member body MemberRequest true "User or group and its role"
+// @Success 200 {object} domain.Member
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/members [put]
+func (h *AppHandlers) SetMemberHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("SetMemberHandler called")
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bundleID, ok := h.authorizeMembers(w, r)
+	if !ok {
+		return
+	}
+
+	var request MemberRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFormValueSize)).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if !validMember(w, request.Email, request.Group) {
+		return
+	}
+	if !request.Role.Valid() {
+		http.Error(w, "role must be viewer, tester, developer or manager", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.access.SetMember(bundleID, request.Email, request.Group, request.Role)
+	if err != nil {
+		http.Error(w, "Failed to save member", http.StatusInternalServerError)
+		log.Printf("Error saving member of %s: %v", bundleID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(member); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding member: %v", err)
+	}
+}
+
+// RemoveMemberHandler godoc
+// @Summary Remove a member of an app
+// @Description Take the role on an app away from a user or a group. Users keep the roles they
+// @Description have through their groups. Requires the manager role on the app, or the admin token.
+// @Tags members
+// @Param   bundle_id path string true "Bundle ID of the app"
+// @Param   email query string false "Email of the user to remove"
+// @Param   group query string false "Group to remove"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Member not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/{bundle_id}/members [delete]
+func (h *AppHandlers) RemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("RemoveMemberHandler called")
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bundleID, ok := h.authorizeMembers(w, r)
+	if !ok {
+		return
+	}
+
+	email, group := r.URL.Query().Get("email"), r.URL.Query().Get("group")
+	if !validMember(w, email, group) {
+		return
+	}
+
+	if err := h.access.RemoveMember(bundleID, email, group); err != nil {
+		if errors.Is(err, application.ErrMemberNotFound) {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		log.Printf("Error removing member of %s: %v", bundleID, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeMembers returns the bundle ID of a members request if its caller can manage
+// the members of the app. Otherwise the error is written to w and ok is false.
+func (h *AppHandlers) authorizeMembers(w http.ResponseWriter, r *http.Request) (bundleID string, ok bool) {
+	matches := membersRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 2 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return "", false
+	}
+	bundleID = matches[1]
+
+	if _, ok := h.authorize(w, r, bundleID, domain.PermissionManageMembers); !ok {
+		return "", false
+	}
+	return bundleID, true
+}
+
+// validMember checks that exactly one of email and group is set. Otherwise the error is
+// written to w and false is returned.
+func validMember(w http.ResponseWriter, email, group string) bool {
+	if (email == "") == (group == "") {
+		http.Error(w, "Set either email or group", http.StatusBadRequest)
+		return false
+	}
+	if email != "" && !strings.Contains(email, "@") {
+		http.Error(w, "email must be an email address", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
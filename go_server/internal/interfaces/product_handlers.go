@@ -0,0 +1,576 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+var (
+	productRegex        = regexp.MustCompile(`^/api/products/([^/]+)$`)
+	productLatestRegex  = regexp.MustCompile(`^/api/products/([^/]+)/latest$`)
+	productInstallRegex = regexp.MustCompile(`^/api/products/([^/]+)/install$`)
+
+	// productIDRegex restricts product IDs to slugs that read well in landing URLs
+	productIDRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+)
+
+// ProductRequest is the body of requests that create or update a product.
+type ProductRequest struct {
+	ID        string   `json:"id,omitempty"`
+	Name      string   `json:"name"`
+	BundleIDs []string `json:"bundle_ids"`
+}
+
+// ProductResponse is a product with its landing URL and the newest build of each of its apps.
+type ProductResponse struct {
+	domain.Product
+	// LandingURL sends each device to the build for its platform.
+	LandingURL string `json:"landing_url"`
+	// QRCode is a base64 encoded PNG of the landing URL.
+	QRCode string                                `json:"qr_code"`
+	Builds map[domain.Platform]*DownloadResponse `json:"builds"`
+}
+
+// ProductsHandler godoc
+// @Summary List all products
+// @Description Get the products that group apps across platforms and have an app the caller can
+// @Description view. Apps the caller can't view are left out.
+// @Tags products
+// @Produce  json
+// @Success 200 {array} domain.Product
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /products [get]
+func (h *AppHandlers) ProductsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("ProductsHandler called")
+	if r.Method == http.MethodPost {
+		h.CreateProductHandler(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	caller, ok := requestCaller(w, r, h.tokens)
+	if !ok {
+		return
+	}
+	products, err := h.access.GetProducts(caller)
+	if err != nil {
+		if errors.Is(err, application.ErrNotAuthenticated) {
+			accessError(w, err)
+			return
+		}
+		http.Error(w, "Failed to get products", http.StatusInternalServerError)
+		log.Printf("Error getting products: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(products); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding products: %v", err)
+	}
+}
+
+// CreateProductHandler godoc
+// @Summary Create a product
+// @Description Group apps of different platforms, e.g. com.acme.app on Android and com.acme.ios on iOS, under one product.
+// @Description An app can only be in one product; remove it from its product before adding it to another.
+// @Description Requires the admin token or the manager role on every app of the product.
+// @Tags products
+// @Accept  json
+// @Produce  json
+// @Param   Authorization header string false "Bearer followed by the admin token, if not logged in"
+// @Param   product body ProductRequest true "Product to create"
+// @Success 201 {object} domain.Product
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "App not found"
+// @Failure 409 {string} string "Product already exists, or an app belongs to another product"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /products [post]
+func (h *AppHandlers) CreateProductHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("CreateProductHandler called")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request, ok := decodeProductRequest(w, r)
+	if !ok {
+		return
+	}
+	if !productIDRegex.MatchString(request.ID) {
+		http.Error(w, "id must be lowercase letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+		return
+	}
+	if !h.authorizeProductApps(w, r, request.BundleIDs) {
+		return
+	}
+
+	product, err := h.service.CreateProduct(request.ID, request.Name, request.BundleIDs)
+	if err != nil {
+		productError(w, err, request.ID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(product); err != nil {
+		log.Printf("Error encoding product: %v", err)
+	}
+}
+
+// GetProductHandler godoc
+// @Summary Get a product
+// @Description Get a product with the newest installable build of each of its apps, and the landing URL
+// @Description that sends each device to the build for its platform.
+// @Tags products
+// @Produce  json
+// @Param   id path string true "Product ID"
+// @Param   channel query string false "Release channel to resolve instead of the newest builds"
+// @Success 200 {object} ProductResponse
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 404 {string} string "Product not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /products/{id} [get]
+func (h *AppHandlers) GetProductHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("GetProductHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	product, ok := h.productFromPath(w, r, productRegex)
+	if !ok {
+		return
+	}
+	caller, ok := requestCaller(w, r, h.tokens)
+	if !ok {
+		return
+	}
+	channel := r.URL.Query().Get("channel")
+
+	landingURL := productLandingURL(r, product, channel)
+	png, err := qrcode.Encode(landingURL, qrcode.Medium, 256)
+	if err != nil {
+		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		log.Printf("Error generating QR code: %v", err)
+		return
+	}
+	response := ProductResponse{
+		Product:    *product,
+		LandingURL: landingURL,
+		QRCode:     base64.StdEncoding.EncodeToString(png),
+		Builds:     make(map[domain.Platform]*DownloadResponse),
+	}
+
+	for platform, bundleID := range product.Apps {
+		// Apps the caller can't view are left out like apps without builds
+		if err := h.access.Authorize(caller, bundleID, domain.PermissionView); err != nil {
+			continue
+		}
+		build, err := h.service.GetProductBuild(product, platform, channel)
+		if err != nil {
+			// A platform without builds, or not on the channel, is left out
+			log.Printf("No %s build for product %s: %v", platform, product.ID, err)
+			continue
+		}
+		item, err := newDownloadResponse(r, build)
+		if err != nil {
+			http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+			log.Printf("Error generating QR code: %v", err)
+			return
+		}
+		response.Builds[platform] = &item
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding product: %v", err)
+	}
+}
+
+// UpdateProductHandler godoc
+// @Summary Update a product
+// @Description Replace the name and apps of a product. Requires the admin token or the manager role
+// @Description on every app of the product, both before and after the change. Apps of other products
+// @Description can't be added until they are removed from their product.
+// @Tags products
+// @Accept  json
+// @Produce  json
+// @Param   Authorization header string false "Bearer followed by the admin token, if not logged in"
+// @Param   id path string true "Product ID"
+// @Param   product body ProductRequest true "New name and apps"
+// @Success 200 {object} domain.Product
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Product or app not found"
+// @Failure 409 {string} string "An app belongs to another product"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /products/{id} [put]
+func (h *AppHandlers) UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("UpdateProductHandler called")
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	product, ok := h.productFromPath(w, r, productRegex)
+	if !ok {
+		return
+	}
+	request, ok := decodeProductRequest(w, r)
+	if !ok {
+		return
+	}
+	if !h.authorizeProductApps(w, r, append(productBundleIDs(product), request.BundleIDs...)) {
+		return
+	}
+
+	updated, err := h.service.UpdateProduct(product.ID, request.Name, request.BundleIDs)
+	if err != nil {
+		productError(w, err, product.ID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(updated); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding product: %v", err)
+	}
+}
+
+// DeleteProductHandler godoc
+// @Summary Delete a product
+// @Description Delete a product. Its apps and builds are kept. Requires the admin token or the
+// @Description manager role on every app of the product.
+// @Tags products
+// @Param   Authorization header string false "Bearer followed by the admin token, if not logged in"
+// @Param   id path string true "Product ID"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {string} string "Invalid URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Product not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /products/{id} [delete]
+func (h *AppHandlers) DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("DeleteProductHandler called")
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	product, ok := h.productFromPath(w, r, productRegex)
+	if !ok {
+		return
+	}
+	if !h.authorizeProductApps(w, r, productBundleIDs(product)) {
+		return
+	}
+
+	if err := h.service.DeleteProduct(product.ID); err != nil {
+		productError(w, err, product.ID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ProductLatestHandler godoc
+// @Summary Get the latest build of a product for the requesting device
+// @Description Get a download link for the newest build of the product's app for the platform of
+// @Description the device, detected from the User-Agent. The QR code points to the landing URL, so
+// @Description the same code works on every device.
+// @Tags products
+// @Produce  json
+// @Param   id path string true "Product ID"
+// @Param   platform query string false "Platform to use instead of detecting it (ios or android)"
+// @Param   channel query string false "Release channel to resolve instead of the newest build"
+// @Success 200 {object} DownloadResponse
+// @Failure 400 {string} string "Platform could not be determined"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Product or build not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /products/{id}/latest [get]
+func (h *AppHandlers) ProductLatestHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("ProductLatestHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	product, ok := h.productFromPath(w, r, productLatestRegex)
+	if !ok {
+		return
+	}
+	platform := requestPlatform(r)
+	if platform == "" {
+		http.Error(w, "Could not determine the platform from the User-Agent. Set platform to ios or android", http.StatusBadRequest)
+		return
+	}
+	channel := r.URL.Query().Get("channel")
+
+	build, ok := h.productBuild(w, r, product, platform, channel)
+	if !ok {
+		return
+	}
+
+	response, err := newDownloadResponse(r, build)
+	if err == nil && response.Installable {
+		var png []byte
+		if png, err = qrcode.Encode(productLandingURL(r, product, channel), qrcode.Medium, 256); err == nil {
+			response.QRCode = base64.StdEncoding.EncodeToString(png)
+		}
+	}
+	if err != nil {
+		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		log.Printf("Error generating QR code: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding download response: %v", err)
+	}
+}
+
+// productLandingPage lists the install links of a product for devices whose platform
+// isn't known, such as desktop browsers.
+var productLandingPage = template.Must(template.New("product").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Name}}</title></head>
+<body>
+<h1>{{.Name}}</h1>
+<ul>
+{{range .Links}}<li><a href="{{.URL}}">{{.Platform}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// ProductInstallHandler godoc
+// @Summary Install a product
+// @Description Landing URL of a product. Devices are redirected to the install URL of the build
+// @Description for their platform, detected from the User-Agent. Other browsers get a page linking
+// @Description to the install URL of every platform.
+// @Tags products
+// @Produce  html
+// @Param   id path string true "Product ID"
+// @Param   channel query string false "Release channel to install from instead of the newest build"
+// @Success 302 {string} string "Redirect to the install URL"
+// @Success 200 {string} string "Page with the install links of every platform"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 404 {string} string "Product or build not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /products/{id}/install [get]
+func (h *AppHandlers) ProductInstallHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("ProductInstallHandler called")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	product, ok := h.productFromPath(w, r, productInstallRegex)
+	if !ok {
+		return
+	}
+	channel := r.URL.Query().Get("channel")
+
+	if platform := requestPlatform(r); platform != "" {
+		build, ok := h.productBuild(w, r, product, platform, channel)
+		if !ok {
+			return
+		}
+		// Only a channel can point to a build that can't be installed
+		if !build.Artifact().Installable() {
+			http.Error(w, "The build on channel "+channel+" cannot be installed on devices", http.StatusNotFound)
+			return
+		}
+		http.Redirect(w, r, buildInstallURL(r, build), http.StatusFound)
+		return
+	}
+
+	caller, ok := requestCaller(w, r, h.tokens)
+	if !ok {
+		return
+	}
+
+	type link struct {
+		Platform domain.Platform
+		URL      template.URL
+	}
+	var links []link
+	for _, platform := range []domain.Platform{domain.IOS, domain.Android} {
+		build, err := h.service.GetProductBuild(product, platform, channel)
+		if err != nil || !build.Artifact().Installable() {
+			continue
+		}
+		if err := h.access.Authorize(caller, build.BundleID, domain.PermissionView); err != nil {
+			continue
+		}
+		// itms-services links would be dropped as unsafe URLs otherwise
+		links = append(links, link{Platform: platform, URL: template.URL(buildInstallURL(r, build))})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := productLandingPage.Execute(w, struct {
+		Name  string
+		Links []link
+	}{product.Name, links}); err != nil {
+		log.Printf("Error rendering product page: %v", err)
+	}
+}
+
+// productFromPath loads the product whose ID is the first match of pathRegex.
+// Errors are written to w, in which case ok is false.
+func (h *AppHandlers) productFromPath(w http.ResponseWriter, r *http.Request, pathRegex *regexp.Regexp) (product *domain.Product, ok bool) {
+	matches := pathRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 2 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return nil, false
+	}
+	id := matches[1]
+
+	product, err := h.service.GetProduct(id)
+	if err != nil {
+		productError(w, err, id)
+		return nil, false
+	}
+	return product, true
+}
+
+// productBuild returns the build of a product for platform if the caller of r can view
+// it. Errors are written to w, in which case ok is false.
+func (h *AppHandlers) productBuild(w http.ResponseWriter, r *http.Request, product *domain.Product, platform domain.Platform, channel string) (build *domain.BuildInfo, ok bool) {
+	build, err := h.service.GetProductBuild(product, platform, channel)
+	switch {
+	case errors.Is(err, application.ErrAppNotFound):
+		http.Error(w, "Product "+product.ID+" has no "+string(platform)+" app", http.StatusNotFound)
+		return nil, false
+	case errors.Is(err, application.ErrChannelNotFound):
+		http.Error(w, "Channel "+channel+" not found", http.StatusNotFound)
+		return nil, false
+	case errors.Is(err, application.ErrBuildNotFound):
+		http.Error(w, "Product "+product.ID+" has no "+string(platform)+" build that can be installed on devices", http.StatusNotFound)
+		return nil, false
+	case err != nil:
+		http.Error(w, "Failed to get build", http.StatusInternalServerError)
+		log.Printf("Error getting %s build of product %s: %v", platform, product.ID, err)
+		return nil, false
+	}
+	if _, ok := h.authorize(w, r, build.BundleID, domain.PermissionView); !ok {
+		return nil, false
+	}
+	return build, true
+}
+
+// authorizeProductApps checks that the caller of r may change a product with the apps in
+// bundleIDs, which takes the admin token or the manager role on each of them. Errors are
+// written to w, in which case ok is false.
+func (h *AppHandlers) authorizeProductApps(w http.ResponseWriter, r *http.Request, bundleIDs []string) (ok bool) {
+	caller, ok := requestCaller(w, r, h.tokens)
+	if !ok {
+		return false
+	}
+	// Products without apps still need a manager
+	if err := h.access.AuthorizeAny(caller, domain.PermissionManageMembers); err != nil {
+		accessError(w, err)
+		return false
+	}
+	for _, bundleID := range bundleIDs {
+		if err := h.access.Authorize(caller, bundleID, domain.PermissionManageMembers); err != nil {
+			accessError(w, err)
+			return false
+		}
+	}
+	return true
+}
+
+// productBundleIDs returns the bundle IDs of the apps of a product.
+func productBundleIDs(product *domain.Product) []string {
+	bundleIDs := make([]string, 0, len(product.Apps))
+	for _, bundleID := range product.Apps {
+		bundleIDs = append(bundleIDs, bundleID)
+	}
+	return bundleIDs
+}
+
+// decodeProductRequest reads the body of a create or update request. Errors are
+// written to w, in which case ok is false.
+func decodeProductRequest(w http.ResponseWriter, r *http.Request) (request ProductRequest, ok bool) {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFormValueSize)).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return request, false
+	}
+	if request.Name == "" || len(request.BundleIDs) == 0 {
+		http.Error(w, "name and bundle_ids are required", http.StatusBadRequest)
+		return request, false
+	}
+	return request, true
+}
+
+// productError writes the response for an error returned by a product operation.
+func productError(w http.ResponseWriter, err error, id string) {
+	switch {
+	case errors.Is(err, application.ErrProductNotFound):
+		http.Error(w, "Product "+id+" not found", http.StatusNotFound)
+	case errors.Is(err, application.ErrProductExists):
+		http.Error(w, "Product "+id+" already exists", http.StatusConflict)
+	case errors.Is(err, application.ErrAppNotFound):
+		http.Error(w, "App not found", http.StatusNotFound)
+	case errors.Is(err, application.ErrPlatformTaken):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, application.ErrAppInProduct):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to handle product", http.StatusInternalServerError)
+		log.Printf("Error handling product %s: %v", id, err)
+	}
+}
+
+// productLandingURL returns the URL that sends each device to the product's build for its platform.
+func productLandingURL(r *http.Request, product *domain.Product, channel string) string {
+	landingURL := baseURL(r) + "/api/products/" + url.PathEscape(product.ID) + "/install"
+	if channel != "" {
+		landingURL += "?channel=" + url.QueryEscape(channel)
+	}
+	return landingURL
+}
+
+// requestPlatform returns the platform set by the platform query parameter, or
+// else the platform of the device the request came from, or "" if it isn't known.
+func requestPlatform(r *http.Request) domain.Platform {
+	if platform := domain.Platform(r.URL.Query().Get("platform")); validPlatform(platform) {
+		return platform
+	}
+
+	userAgent := r.UserAgent()
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		return domain.Android
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return domain.IOS
+	}
+	return ""
+}
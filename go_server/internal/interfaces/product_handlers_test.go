@@ -0,0 +1,181 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// productRequest returns a request to the product API with a JSON body, authenticated
+// with the admin token.
+func productRequest(method, target, body string) *http.Request {
+	return withToken(httptest.NewRequest(method, target, strings.NewReader(body)), testAdminToken)
+}
+
+// newProductTestEnv returns a test environment with an iOS app com.example.ios and an
+// Android app com.example.android, each with a build.
+func newProductTestEnv(t *testing.T) (env *testEnv, ios, android *domain.BuildInfo) {
+	t.Helper()
+	env = newTestEnv(t)
+	ios = env.upload(t, "app.ipa", testIPA(t, "com.example.ios", "1.0", "1"), nil)
+	android = env.upload(t, "app.apk", testAPK(t, newTestSigner(t, "Release"), "com.example.android", 1), nil)
+	return env, ios, android
+}
+
+func TestProductHandlers(t *testing.T) {
+	env, ios, android := newProductTestEnv(t)
+
+	w := serve(env.handlers.CreateProductHandler, productRequest(http.MethodPost, "/api/products", `{"id": "example", "name": "Example", "bundle_ids": ["com.example.ios", "com.example.android"]}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateProductHandler() = %d %s", w.Code, w.Body)
+	}
+	var product domain.Product
+	if err := json.Unmarshal(w.Body.Bytes(), &product); err != nil {
+		t.Fatal(err)
+	}
+	if product.Apps[domain.IOS] != "com.example.ios" || product.Apps[domain.Android] != "com.example.android" {
+		t.Errorf("CreateProductHandler() apps = %v", product.Apps)
+	}
+
+	w = serve(env.handlers.GetProductHandler, productRequest(http.MethodGet, "/api/products/example", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetProductHandler() = %d %s", w.Code, w.Body)
+	}
+	var response ProductResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.LandingURL != "http://example.com/api/products/example/install" || response.QRCode == "" {
+		t.Errorf("GetProductHandler() landing URL = %q", response.LandingURL)
+	}
+	if len(response.Builds) != 2 || response.Builds[domain.IOS].UploadID != ios.UploadID || response.Builds[domain.Android].UploadID != android.UploadID {
+		t.Errorf("GetProductHandler() builds = %+v", response.Builds)
+	}
+
+	// The device's platform picks the build, unless it is set explicitly
+	for _, tt := range []struct {
+		target, userAgent string
+		want              *domain.BuildInfo
+	}{
+		{"/api/products/example/latest", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", ios},
+		{"/api/products/example/latest", "Mozilla/5.0 (Linux; Android 14)", android},
+		{"/api/products/example/latest?platform=android", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", android},
+	} {
+		r := productRequest(http.MethodGet, tt.target, "")
+		r.Header.Set("User-Agent", tt.userAgent)
+		w := serve(env.handlers.ProductLatestHandler, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("ProductLatestHandler(%s, %s) = %d %s", tt.target, tt.userAgent, w.Code, w.Body)
+		}
+		var build DownloadResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &build); err != nil {
+			t.Fatal(err)
+		}
+		if build.UploadID != tt.want.UploadID {
+			t.Errorf("ProductLatestHandler(%s, %s) = build %s, want %s", tt.target, tt.userAgent, build.UploadID, tt.want.UploadID)
+		}
+	}
+	if w := serve(env.handlers.ProductLatestHandler, productRequest(http.MethodGet, "/api/products/example/latest", "")); w.Code != http.StatusBadRequest {
+		t.Errorf("ProductLatestHandler() without a platform = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	r := productRequest(http.MethodGet, "/api/products/example/install", "")
+	r.Header.Set("User-Agent", "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X)")
+	w = serve(env.handlers.ProductInstallHandler, r)
+	if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), "itms-services://") {
+		t.Errorf("ProductInstallHandler() on an iPad = %d %s, want a redirect to itms-services", w.Code, w.Header().Get("Location"))
+	}
+	w = serve(env.handlers.ProductInstallHandler, productRequest(http.MethodGet, "/api/products/example/install", ""))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "itms-services://") || !strings.Contains(w.Body.String(), ">android</a>") {
+		t.Errorf("ProductInstallHandler() in a browser = %d %s, want links to both builds", w.Code, w.Body)
+	}
+
+	w = serve(env.handlers.UpdateProductHandler, productRequest(http.MethodPut, "/api/products/example", `{"name": "Renamed", "bundle_ids": ["com.example.android"]}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("UpdateProductHandler() = %d %s", w.Code, w.Body)
+	}
+	updated, err := env.service.GetProduct("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Renamed" || len(updated.Apps) != 1 || updated.Apps[domain.Android] != "com.example.android" {
+		t.Errorf("GetProduct() after UpdateProductHandler() = %+v", updated)
+	}
+	w = serve(env.handlers.ProductLatestHandler, productRequest(http.MethodGet, "/api/products/example/latest?platform=ios", ""))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("ProductLatestHandler() of a platform without an app = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	if w := serve(env.handlers.DeleteProductHandler, productRequest(http.MethodDelete, "/api/products/example", "")); w.Code != http.StatusNoContent {
+		t.Fatalf("DeleteProductHandler() = %d %s", w.Code, w.Body)
+	}
+	if w := serve(env.handlers.GetProductHandler, productRequest(http.MethodGet, "/api/products/example", "")); w.Code != http.StatusNotFound {
+		t.Errorf("GetProductHandler() of a deleted product = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	// The apps of a deleted product can join another one
+	w = serve(env.handlers.CreateProductHandler, productRequest(http.MethodPost, "/api/products", `{"id": "other", "name": "Other", "bundle_ids": ["com.example.android"]}`))
+	if w.Code != http.StatusCreated {
+		t.Errorf("CreateProductHandler() with the app of a deleted product = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestProductHandlersErrors(t *testing.T) {
+	env, _, _ := newProductTestEnv(t)
+	env.upload(t, "app.ipa", testIPA(t, "com.example.ipad", "1.0", "1"), nil)
+	w := serve(env.handlers.CreateProductHandler, productRequest(http.MethodPost, "/api/products", `{"id": "example", "name": "Example", "bundle_ids": ["com.example.ios"]}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateProductHandler() = %d %s", w.Code, w.Body)
+	}
+
+	creates := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"existing ID", `{"id": "example", "name": "Example", "bundle_ids": ["com.example.android"]}`, http.StatusConflict},
+		// Apps aren't moved silently from the product they are in
+		{"app of another product", `{"id": "other", "name": "Other", "bundle_ids": ["com.example.ios"]}`, http.StatusConflict},
+		{"two apps of a platform", `{"id": "other", "name": "Other", "bundle_ids": ["com.example.android", "com.example.ipad", "com.example.ios"]}`, http.StatusBadRequest},
+		{"missing app", `{"id": "other", "name": "Other", "bundle_ids": ["com.example.missing"]}`, http.StatusNotFound},
+		{"invalid ID", `{"id": "Other", "name": "Other", "bundle_ids": ["com.example.android"]}`, http.StatusBadRequest},
+		{"no apps", `{"id": "other", "name": "Other", "bundle_ids": []}`, http.StatusBadRequest},
+	}
+	for _, tt := range creates {
+		if w := serve(env.handlers.CreateProductHandler, productRequest(http.MethodPost, "/api/products", tt.body)); w.Code != tt.want {
+			t.Errorf("CreateProductHandler() with %s = %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+
+	w = serve(env.handlers.CreateProductHandler, productRequest(http.MethodPost, "/api/products", `{"id": "other", "name": "Other", "bundle_ids": ["com.example.android"]}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateProductHandler() = %d %s", w.Code, w.Body)
+	}
+	updates := []struct {
+		name   string
+		target string
+		body   string
+		want   int
+	}{
+		{"app of another product", "/api/products/other", `{"name": "Other", "bundle_ids": ["com.example.android", "com.example.ios"]}`, http.StatusConflict},
+		{"missing product", "/api/products/missing", `{"name": "Missing", "bundle_ids": ["com.example.ipad"]}`, http.StatusNotFound},
+	}
+	for _, tt := range updates {
+		if w := serve(env.handlers.UpdateProductHandler, productRequest(http.MethodPut, tt.target, tt.body)); w.Code != tt.want {
+			t.Errorf("UpdateProductHandler() with %s = %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+
+	// Failed changes leave the products as they were
+	for id, want := range map[string]string{"example": "com.example.ios", "other": "com.example.android"} {
+		product, err := env.service.GetProduct(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bundleIDs := productBundleIDs(product); len(bundleIDs) != 1 || bundleIDs[0] != want {
+			t.Errorf("GetProduct(%s) apps = %v, want only %s", id, product.Apps, want)
+		}
+	}
+}
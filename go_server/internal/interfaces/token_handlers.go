@@ -0,0 +1,206 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var tokenRegex = regexp.MustCompile(`^/api/tokens/([^/]+)$`)
+
+type TokenHandlers struct {
+	service *application.TokenService
+}
+
+func NewTokenHandlers(service *application.TokenService) *TokenHandlers {
+	return &TokenHandlers{service: service}
+}
+
+// TokenRequest describes the API token to create.
+type TokenRequest struct {
+	Name string `json:"name"`
+	// BundleIDs are the apps the token can be used for. "*" allows every app.
+	BundleIDs   []string            `json:"bundle_ids"`
+	Permissions []domain.Permission `json:"permissions"`
+	// ExpiresAt is when the token stops working. Tokens without it don't expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// TokenResponse is a newly created API token together with its secret.
+type TokenResponse struct {
+	domain.APIToken
+	// Token is the secret to send in the Authorization or X-Auth-Token header.
+	// It is only returned when the token is created.
+	Token string `json:"token"`
+}
+
+// TokensHandler godoc
+// @Summary List API tokens
+// @Description Get every API token without its secret. Requires the admin token.
+// @Tags tokens
+// @Produce  json
+// @Param   Authorization header string true "Bearer followed by the admin token"
+// @Success 200 {array} domain.APIToken
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /tokens [get]
+func (h *TokenHandlers) TokensHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("TokensHandler called")
+	if r.Method == http.MethodPost {
+		h.CreateTokenHandler(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	tokens, err := h.service.GetTokens()
+	if err != nil {
+		http.Error(w, "Failed to get tokens", http.StatusInternalServerError)
+		log.Printf("Error getting tokens: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tokens); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding tokens: %v", err)
+	}
+}
+
+// CreateTokenHandler godoc
+// @Summary Create an API token
+// @Description Create a token that can give feedback on, upload, delete or promote builds of the given apps.
+// @Description The secret is only returned in this response. Requires the admin token.
+// @Tags tokens
+// @Accept  json
+// @Produce  json
+// @Param   Authorization header string true "Bearer followed by the admin token"
+// @Param   token body TokenRequest true "Token to create"
+// @Success 201 {object} TokenResponse
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /tokens [post]
+func (h *TokenHandlers) CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("CreateTokenHandler called")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	var request TokenRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFormValueSize)).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(request.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if len(request.BundleIDs) == 0 || len(request.Permissions) == 0 {
+		http.Error(w, "bundle_ids and permissions are required", http.StatusBadRequest)
+		return
+	}
+	for _, bundleID := range request.BundleIDs {
+		if bundleID == "" {
+			http.Error(w, "bundle_ids cannot be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, permission := range request.Permissions {
+		if !permission.Valid() {
+			http.Error(w, "permissions must be feedback, upload, delete or promote", http.StatusBadRequest)
+			return
+		}
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	token, secret, err := h.service.CreateToken(request.Name, request.BundleIDs, request.Permissions, request.ExpiresAt)
+	if err != nil {
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		log.Printf("Error creating token: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(TokenResponse{APIToken: *token, Token: secret}); err != nil {
+		log.Printf("Error encoding token: %v", err)
+	}
+}
+
+// RevokeTokenHandler godoc
+// @Summary Revoke an API token
+// @Description Delete a token so it can no longer be used. Requires the admin token.
+// @Tags tokens
+// @Param   Authorization header string true "Bearer followed by the admin token"
+// @Param   id path string true "Token ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Token not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /tokens/{id} [delete]
+func (h *TokenHandlers) RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("RevokeTokenHandler called")
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := tokenRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) < 2 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	id := matches[1]
+
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	if err := h.service.RevokeToken(id); err != nil {
+		if errors.Is(err, application.ErrTokenNotFound) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		log.Printf("Error revoking token %s: %v", id, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeAdmin checks that the request was made with the admin token. Otherwise
+// the error is written to w and false is returned.
+func (h *TokenHandlers) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := authenticate(w, r, h.service)
+	if !ok {
+		return false
+	}
+	if !h.service.IsAdmin(token) {
+		http.Error(w, "Only the admin token can manage tokens", http.StatusForbidden)
+		return false
+	}
+	return true
+}
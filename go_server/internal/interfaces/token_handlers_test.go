@@ -0,0 +1,136 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/domain"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenRequest returns a request to the token API with a JSON body, authenticated
+// with secret.
+func tokenRequest(method, target, body, secret string) *http.Request {
+	return withToken(httptest.NewRequest(method, target, strings.NewReader(body)), secret)
+}
+
+func TestTokenHandlers(t *testing.T) {
+	env := newTestEnv(t)
+	handlers := NewTokenHandlers(env.tokens)
+	env.upload(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil)
+
+	w := serve(handlers.TokensHandler, tokenRequest(http.MethodPost, "/api/tokens", `{"name": "ci", "bundle_ids": ["com.example.app"], "permissions": ["upload"]}`, testAdminToken))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateTokenHandler() = %d %s", w.Code, w.Body)
+	}
+	var created TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Token == "" || !strings.HasPrefix(created.Token, created.Prefix) {
+		t.Errorf("CreateTokenHandler() = %+v, want the secret starting with the prefix", created)
+	}
+
+	// The token is scoped to its app and permissions
+	ipa := testIPA(t, "com.example.app", "1.0", "2")
+	w = serve(env.handlers.UploadHandler, withToken(uploadRequest(t, "app.ipa", ipa, nil), created.Token))
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload with the token = %d %s", w.Code, w.Body)
+	}
+	// X-Auth-Token works as well as the Authorization header
+	r := uploadRequest(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "3"), nil)
+	r.Header.Set("X-Auth-Token", created.Token)
+	if w := serve(env.handlers.UploadHandler, r); w.Code != http.StatusOK {
+		t.Errorf("upload with the token in X-Auth-Token = %d %s", w.Code, w.Body)
+	}
+	w = serve(env.handlers.UploadHandler, withToken(uploadRequest(t, "app.ipa", testIPA(t, "com.example.other", "1.0", "1"), nil), created.Token))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("upload for another app = %d %s, want %d", w.Code, w.Body, http.StatusForbidden)
+	}
+	w = serve(env.handlers.DeleteBuildHandler, withToken(httptest.NewRequest(http.MethodDelete, "/api/apps/com.example.app/1.0/2", nil), created.Token))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("DeleteBuildHandler() without the delete permission = %d %s, want %d", w.Code, w.Body, http.StatusForbidden)
+	}
+	if w := serve(env.handlers.UploadHandler, uploadRequest(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "4"), nil)); w.Code != http.StatusUnauthorized {
+		t.Errorf("upload without a token = %d %s, want %d", w.Code, w.Body, http.StatusUnauthorized)
+	}
+
+	// Listings show when the token was last used, but never its secret
+	w = serve(handlers.TokensHandler, tokenRequest(http.MethodGet, "/api/tokens", "", testAdminToken))
+	if w.Code != http.StatusOK {
+		t.Fatalf("TokensHandler() = %d %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), created.Token) {
+		t.Errorf("TokensHandler() = %s, contains the secret", w.Body)
+	}
+	var tokens []domain.APIToken
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != created.ID || tokens[0].LastUsedAt == nil {
+		t.Errorf("TokensHandler() = %+v, want the token with its last use", tokens)
+	}
+
+	// Only the admin token manages tokens
+	for _, tt := range []struct {
+		name    string
+		handler http.HandlerFunc
+		r       *http.Request
+		want    int
+	}{
+		{"list with a scoped token", handlers.TokensHandler, tokenRequest(http.MethodGet, "/api/tokens", "", created.Token), http.StatusForbidden},
+		{"create with a scoped token", handlers.TokensHandler, tokenRequest(http.MethodPost, "/api/tokens", `{"name": "other", "bundle_ids": ["*"], "permissions": ["upload"]}`, created.Token), http.StatusForbidden},
+		{"revoke with a scoped token", handlers.RevokeTokenHandler, tokenRequest(http.MethodDelete, "/api/tokens/"+created.ID, "", created.Token), http.StatusForbidden},
+		{"list without a token", handlers.TokensHandler, httptest.NewRequest(http.MethodGet, "/api/tokens", nil), http.StatusUnauthorized},
+	} {
+		if w := serve(tt.handler, tt.r); w.Code != tt.want {
+			t.Errorf("%s = %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+
+	if w := serve(handlers.RevokeTokenHandler, tokenRequest(http.MethodDelete, "/api/tokens/"+created.ID, "", testAdminToken)); w.Code != http.StatusNoContent {
+		t.Fatalf("RevokeTokenHandler() = %d %s", w.Code, w.Body)
+	}
+	if w := serve(handlers.RevokeTokenHandler, tokenRequest(http.MethodDelete, "/api/tokens/"+created.ID, "", testAdminToken)); w.Code != http.StatusNotFound {
+		t.Errorf("RevokeTokenHandler() of a revoked token = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	w = serve(env.handlers.UploadHandler, withToken(uploadRequest(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "4"), nil), created.Token))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("upload with a revoked token = %d %s, want %d", w.Code, w.Body, http.StatusUnauthorized)
+	}
+}
+
+func TestExpiredToken(t *testing.T) {
+	env := newTestEnv(t)
+	expiresAt := time.Now().Add(-time.Minute)
+	_, secret, err := env.tokens.CreateToken("ci", []string{domain.AllBundleIDs}, []domain.Permission{domain.PermissionUpload}, &expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(env.handlers.UploadHandler, withToken(uploadRequest(t, "app.ipa", testIPA(t, "com.example.app", "1.0", "1"), nil), secret))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("upload with an expired token = %d %s, want %d", w.Code, w.Body, http.StatusUnauthorized)
+	}
+}
+
+func TestCreateTokenHandlerValidation(t *testing.T) {
+	handlers := NewTokenHandlers(newTestEnv(t).tokens)
+	for _, tt := range []struct {
+		name string
+		body string
+	}{
+		{"no name", `{"bundle_ids": ["*"], "permissions": ["upload"]}`},
+		{"no apps", `{"name": "ci", "bundle_ids": [], "permissions": ["upload"]}`},
+		{"empty bundle ID", `{"name": "ci", "bundle_ids": [""], "permissions": ["upload"]}`},
+		{"no permissions", `{"name": "ci", "bundle_ids": ["*"]}`},
+		{"unknown permission", `{"name": "ci", "bundle_ids": ["*"], "permissions": ["admin"]}`},
+		{"past expiry", `{"name": "ci", "bundle_ids": ["*"], "permissions": ["upload"], "expires_at": "2001-01-01T00:00:00Z"}`},
+		{"invalid JSON", `{"name": `},
+	} {
+		if w := serve(handlers.TokensHandler, tokenRequest(http.MethodPost, "/api/tokens", tt.body, testAdminToken)); w.Code != http.StatusBadRequest {
+			t.Errorf("CreateTokenHandler() with %s = %d %s, want %d", tt.name, w.Code, w.Body, http.StatusBadRequest)
+		}
+	}
+}
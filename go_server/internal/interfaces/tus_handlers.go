@@ -0,0 +1,403 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+)
+
+var uploadIDRegex = regexp.MustCompile(`^/api/apps/uploads/([^/]+)$`)
+
+// TusHandlers implement the tus resumable upload protocol (https://tus.io/protocols/resumable-upload)
+// for app files. Finished uploads are saved like uploads to /api/apps/upload.
+type TusHandlers struct {
+	apps    *AppHandlers
+	uploads *application.UploadService
+}
+
+func NewTusHandlers(apps *AppHandlers, uploads *application.UploadService) *TusHandlers {
+	return &TusHandlers{apps: apps, uploads: uploads}
+}
+
+// UploadsHandler godoc
+// @Summary Create a resumable upload
+// @Description Start a tus 1.0 resumable upload of an .apk, .aab or .ipa file. Upload-Metadata
+// @Description must contain the filename, and may contain bundle_id, version, build_number,
+// @Description title, allow_signer_change and expected_sha256 like the parameters of /apps/upload.
+// @Description OPTIONS returns the protocol versions, extensions and maximum size the server supports.
+// @Description Requires an API token with the upload permission, and only that token can resume the upload.
+// @Tags uploads
+// @Param   Authorization header string true "Bearer followed by an API token"
+// @Param   Tus-Resumable header string true "Protocol version (1.0.0)"
+// @Param   Upload-Length header int true "Size of the app file in bytes"
+// @Param   Upload-Metadata header string true "Comma separated key and base64 value pairs, e.g. filename YXBwLmlwYQ=="
+// @Success 201 {string} string "Created, with the upload URL in the Location header"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} application.ForbiddenError
+// @Failure 412 {string} string "Unsupported tus version"
+// @Failure 413 {string} string "Upload too large"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/uploads [post]
+// @Router /apps/uploads [options]
+func (h *TusHandlers) UploadsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("UploadsHandler called")
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.apps.maxUploadSize, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	token, ok := authenticate(w, r, h.apps.tokens)
+	if !ok {
+		return
+	}
+	caller := application.Caller{Token: token}
+	if err := h.apps.access.AuthorizeAny(caller, domain.PermissionUpload); err != nil {
+		accessError(w, err)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid or missing Upload-Length header", http.StatusBadRequest)
+		return
+	}
+	if length > h.apps.maxUploadSize {
+		http.Error(w, fmt.Sprintf("Upload exceeds the maximum size of %d bytes", h.apps.maxUploadSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata header: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if artifactTypeOf(metadata["filename"]) == "" {
+		http.Error(w, "Upload-Metadata must contain a filename ending in .apk, .aab or .ipa", http.StatusBadRequest)
+		return
+	}
+	// Fail early when the bundle ID is known, rather than after the whole file has been sent
+	if bundleID := metadata["bundle_id"]; bundleID != "" {
+		if err := h.apps.access.Authorize(caller, bundleID, domain.PermissionUpload); err != nil {
+			accessError(w, err)
+			return
+		}
+	}
+
+	upload, err := h.uploads.CreateUpload(length, metadata, token.ID)
+	if err != nil {
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		log.Printf("Error creating upload: %v", err)
+		return
+	}
+
+	w.Header().Set("Location", baseURL(r)+"/api/apps/uploads/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// UploadHandler godoc
+// @Summary Resume, probe or terminate a resumable upload
+// @Description HEAD returns the number of bytes received in Upload-Offset. PATCH appends the
+// @Description request body at Upload-Offset; the upload is saved as a build once all bytes have
+// @Description arrived. If saving fails with a server error the upload is kept, and an empty PATCH
+// @Description at the end of the upload saves it again. DELETE terminates the upload. GET returns
+// @Description the upload as JSON, including the saved build once it has finished. Requires the
+// @Description API token that created the upload.
+// @Tags uploads
+// @Accept  application/offset+octet-stream
+// @Produce  json
+// @Param   Authorization header string true "Bearer followed by an API token"
+// @Param   id path string true "Upload ID"
+// @Param   Tus-Resumable header string true "Protocol version (1.0.0)"
+// @Param   Upload-Offset header int false "Offset the PATCH body starts at"
+// @Success 200 {object} domain.ResumableUpload
+// @Success 204 {string} string "No Content"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Upload not found"
+// @Failure 409 {string} string "Upload-Offset does not match, or build already uploaded"
+// @Failure 410 {string} string "Upload expired"
+// @Failure 415 {string} string "Unsupported Content-Type"
+// @Failure 423 {string} string "Upload is locked by another request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /apps/uploads/{id} [head]
+// @Router /apps/uploads/{id} [patch]
+// @Router /apps/uploads/{id} [delete]
+// @Router /apps/uploads/{id} [get]
+func (h *TusHandlers) UploadHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("UploadHandler (tus) called")
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	matches := uploadIDRegex.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	id := matches[1]
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := h.authorizeUpload(w, r, id)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		upload, err := h.uploads.GetUpload(id)
+		if err != nil {
+			tusError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(upload); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			log.Printf("Error encoding upload: %v", err)
+		}
+
+	case http.MethodHead:
+		if !checkTusResumable(w, r) {
+			return
+		}
+		upload, err := h.uploads.GetUpload(id)
+		if err != nil {
+			// HEAD responses have no body, so only the status is sent
+			w.WriteHeader(tusErrorStatus(err))
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodPatch:
+		if !checkTusResumable(w, r) {
+			return
+		}
+		h.patchUpload(w, r, id, token)
+
+	case http.MethodDelete:
+		if !checkTusResumable(w, r) {
+			return
+		}
+		if err := h.uploads.DeleteUpload(id); err != nil {
+			tusError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// patchUpload appends the request body to the upload and saves the build once the
+// last byte has arrived.
+func (h *TusHandlers) patchUpload(w http.ResponseWriter, r *http.Request, id string, token *domain.APIToken) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid or missing Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.uploads.WriteChunk(id, offset, r.Body)
+	if err != nil {
+		tusError(w, err)
+		return
+	}
+
+	// Finished uploads are saved once. An empty PATCH retries saving an upload whose
+	// save failed with a server error.
+	if upload.Finished() && upload.Build == nil {
+		if !h.finishUpload(w, upload, token) {
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finishUpload saves a finished upload as a build. If the app file is rejected the
+// upload is terminated, since resuming it can't change the outcome. After server
+// errors it is kept, so that saving can be retried without sending the file again.
+func (h *TusHandlers) finishUpload(w http.ResponseWriter, upload *domain.ResumableUpload, token *domain.APIToken) bool {
+	// The lock is shared by the replicas, so only one of them saves the upload
+	if err := h.uploads.LockUpload(upload.ID); err != nil {
+		tusError(w, err)
+		return false
+	}
+	saved, rejected := h.saveFinishedUpload(w, upload, token)
+	if err := h.uploads.UnlockUpload(upload.ID); err != nil {
+		log.Printf("Error unlocking upload %s: %v", upload.ID, err)
+	}
+
+	if rejected {
+		if err := h.uploads.DeleteUpload(upload.ID); err != nil {
+			log.Printf("Error deleting upload %s: %v", upload.ID, err)
+		}
+	}
+	return saved
+}
+
+// saveFinishedUpload saves an upload whose lock is held as a build. rejected is set
+// if the app file was rejected rather than saving it failing with a server error.
+func (h *TusHandlers) saveFinishedUpload(w http.ResponseWriter, upload *domain.ResumableUpload, token *domain.APIToken) (saved, rejected bool) {
+	// Another request may have saved it before this one took the lock
+	current, err := h.uploads.GetUpload(upload.ID)
+	if err != nil {
+		tusError(w, err)
+		return false, false
+	}
+	if current.Build != nil {
+		upload.Build = current.Build
+		return true, false
+	}
+
+	staged, err := h.uploads.StageUpload(upload.ID)
+	if err != nil {
+		http.Error(w, "Failed to read upload", http.StatusInternalServerError)
+		log.Printf("Error staging upload %s: %v", upload.ID, err)
+		return false, false
+	}
+	defer staged.Remove()
+
+	form := url.Values{}
+	for key, value := range upload.Metadata {
+		form.Set(key, value)
+	}
+
+	status := &statusWriter{ResponseWriter: w}
+	build, ok := h.apps.saveUpload(status, staged, upload.Metadata["filename"], form, application.Caller{Token: token})
+	if !ok {
+		if status.status >= http.StatusInternalServerError {
+			log.Printf("Keeping upload %s so that saving it can be retried", upload.ID)
+			return false, false
+		}
+		return false, true
+	}
+
+	if err := h.uploads.CompleteUpload(upload, build); err != nil {
+		// The build is saved, so the upload itself succeeded
+		log.Printf("Error completing upload %s: %v", upload.ID, err)
+	}
+	return true, false
+}
+
+// statusWriter records the status code written to a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// authorizeUpload authenticates the request and checks that it was made with the token
+// that created the upload. Uploads of other tokens are reported as not found. Otherwise
+// the error is written to w and ok is false.
+func (h *TusHandlers) authorizeUpload(w http.ResponseWriter, r *http.Request, id string) (token *domain.APIToken, ok bool) {
+	if token, ok = authenticate(w, r, h.apps.tokens); !ok {
+		return nil, false
+	}
+	upload, err := h.uploads.GetUpload(id)
+	if err == nil && upload.TokenID != token.ID {
+		err = application.ErrUploadNotFound
+	}
+	if err != nil {
+		tusError(w, err)
+		return nil, false
+	}
+	return token, true
+}
+
+// checkTusResumable rejects requests for protocol versions other than tusVersion.
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// tusError writes the response for an error returned by the upload service.
+func tusError(w http.ResponseWriter, err error) {
+	status := tusErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("Error handling upload: %v", err)
+		http.Error(w, "Failed to handle upload", status)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func tusErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, application.ErrUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, application.ErrUploadExpired):
+		return http.StatusGone
+	case errors.Is(err, application.ErrUploadOffsetMismatch):
+		return http.StatusConflict
+	case errors.Is(err, application.ErrUploadLocked):
+		return http.StatusLocked
+	case errors.Is(err, application.ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header, a comma separated list of
+// keys each followed by an optional space and base64 encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("value of %s is not base64: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,117 @@
+package interfaces
+
+import (
+	"app-distribution-server-go/internal/application"
+	"app-distribution-server-go/internal/domain"
+	"app-distribution-server-go/internal/infrastructure"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tusRequest returns a tus request authenticated with the API token secret.
+func tusRequest(method, target, secret string, body []byte) *http.Request {
+	r := httptest.NewRequest(method, target, bytes.NewReader(body))
+	r.Header.Set("Tus-Resumable", tusVersion)
+	return withToken(r, secret)
+}
+
+// patch sends the chunk of a tus upload at offset.
+func patch(handlers *TusHandlers, location, secret string, offset int, chunk []byte) *httptest.ResponseRecorder {
+	r := tusRequest(http.MethodPatch, location, secret, chunk)
+	r.Header.Set("Content-Type", "application/offset+octet-stream")
+	r.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	return serve(handlers.UploadHandler, r)
+}
+
+func TestTusUpload(t *testing.T) {
+	env := newTestEnv(t)
+	handlers := NewTusHandlers(env.handlers, application.NewUploadService(infrastructure.NewBlobResumableUploadRepository(env.blobs), time.Hour))
+	_, secret, err := env.tokens.CreateToken("ci", []string{domain.AllBundleIDs}, []domain.Permission{domain.PermissionUpload, domain.PermissionView}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipa := testIPA(t, "com.example.app", "1.0", "1")
+
+	r := tusRequest(http.MethodPost, "/api/apps/uploads", secret, nil)
+	r.Header.Set("Upload-Length", strconv.Itoa(len(ipa)))
+	r.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("app.ipa"))+
+		",release_notes "+base64.StdEncoding.EncodeToString([]byte("Resumed")))
+	w := serve(handlers.UploadsHandler, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("UploadsHandler() = %d %s", w.Code, w.Body)
+	}
+	location := strings.TrimPrefix(w.Header().Get("Location"), "http://example.com")
+
+	half := len(ipa) / 2
+	if w := patch(handlers, location, secret, 0, ipa[:half]); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != strconv.Itoa(half) {
+		t.Fatalf("PATCH of the first half = %d %s", w.Code, w.Body)
+	}
+
+	// Other tokens can't see the upload, and chunks must continue where the last one ended
+	_, other, err := env.tokens.CreateToken("other", []string{domain.AllBundleIDs}, []domain.Permission{domain.PermissionUpload}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := patch(handlers, location, other, half, ipa[half:]); w.Code != http.StatusNotFound {
+		t.Errorf("PATCH with another token = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := patch(handlers, location, secret, 0, ipa); w.Code != http.StatusConflict {
+		t.Errorf("PATCH at an old offset = %d, want %d", w.Code, http.StatusConflict)
+	}
+	w = serve(handlers.UploadHandler, tusRequest(http.MethodHead, location, secret, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != strconv.Itoa(half) {
+		t.Errorf("HEAD = %d with Upload-Offset %s, want %d", w.Code, w.Header().Get("Upload-Offset"), half)
+	}
+
+	if w := patch(handlers, location, secret, half, ipa[half:]); w.Code != http.StatusNoContent {
+		t.Fatalf("PATCH of the second half = %d %s", w.Code, w.Body)
+	}
+	w = serve(handlers.UploadHandler, tusRequest(http.MethodGet, location, secret, nil))
+	var upload domain.ResumableUpload
+	if err := json.Unmarshal(w.Body.Bytes(), &upload); err != nil {
+		t.Fatal(err)
+	}
+	if upload.Build == nil || upload.Build.BundleID != "com.example.app" || upload.Build.ReleaseNotes != "Resumed" {
+		t.Errorf("finished upload = %s", w.Body)
+	}
+	if _, err := env.service.GetBuild("com.example.app", "1.0", "1"); err != nil {
+		t.Errorf("GetBuild() of the finished upload error = %v", err)
+	}
+}
+
+func TestParseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		header string
+		want   map[string]string
+	}{
+		{"", map[string]string{}},
+		{"filename YXBwLmFwaw==", map[string]string{"filename": "app.apk"}},
+		{"filename YXBwLmFwaw==,release_notes Rml4ZXMgY3Jhc2g=", map[string]string{"filename": "app.apk", "release_notes": "Fixes crash"}},
+		// Spaces around pairs and empty pairs are ignored, and keys may have no value
+		{" filename YXBwLmFwaw== , , is_confidential", map[string]string{"filename": "app.apk", "is_confidential": ""}},
+	}
+	for _, tt := range tests {
+		got, err := parseUploadMetadata(tt.header)
+		if err != nil {
+			t.Errorf("parseUploadMetadata(%q) error = %v", tt.header, err)
+			continue
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("parseUploadMetadata(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+
+	for _, header := range []string{"filename app.apk", "filename YXBwLmFwaw"} {
+		if _, err := parseUploadMetadata(header); err == nil {
+			t.Errorf("parseUploadMetadata(%q) error = nil, want an error", header)
+		}
+	}
+}